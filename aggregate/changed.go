@@ -97,6 +97,12 @@ func (a Changed) WithMetadata(key string, value interface{}) goengine.Message {
 	return &a
 }
 
+func (a Changed) withMetadataValues(meta metadata.Metadata) *Changed {
+	a.metadata = meta
+
+	return &a
+}
+
 func (a Changed) withVersion(version uint) *Changed {
 	a.version = version
 
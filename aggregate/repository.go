@@ -102,9 +102,9 @@ func (r *Repository) GetAggregateRoot(ctx context.Context, aggregateID ID) (Root
 
 // enrichEventMetadata add's aggregate_id and aggregate_type as metadata to domainEvent
 func (r *Repository) enrichMetadata(aggregateEvent *Changed, aggregateID ID) *Changed {
-	domainEvent := aggregateEvent.WithMetadata(IDKey, aggregateID)
-	domainEvent = domainEvent.WithMetadata(TypeKey, r.aggregateType.String())
-	domainEvent = domainEvent.WithMetadata(VersionKey, aggregateEvent.Version())
+	meta := metadata.WithValue(aggregateEvent.Metadata(), IDKey, aggregateID)
+	meta = metadata.WithValue(meta, TypeKey, r.aggregateType.String())
+	meta = metadata.WithValue(meta, VersionKey, aggregateEvent.Version())
 
-	return domainEvent.(*Changed)
+	return aggregateEvent.withMetadataValues(meta)
 }
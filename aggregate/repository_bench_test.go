@@ -0,0 +1,37 @@
+// +build unit
+
+package aggregate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/metadata"
+)
+
+func BenchmarkRepository_enrichMetadata(b *testing.B) {
+	repository := &Repository{
+		aggregateType: &Type{name: "bank_account"},
+		streamName:    "event_stream",
+	}
+
+	meta := metadata.New()
+	meta = metadata.WithValue(meta, "_correlation_id", "e2b6d1e4-4b37-4b7f-9b8a-1d3c2b7c7f01")
+	meta = metadata.WithValue(meta, "_causation_id", "0f1c6a6e-3f0a-4d9b-8d71-53a1a7d6c1b2")
+
+	aggregateID := GenerateID()
+	change, err := ReconstituteChange(aggregateID, goengine.GenerateUUID(), struct{}{}, meta, time.Now(), 1)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		enriched := repository.enrichMetadata(change, aggregateID)
+		if enriched.Metadata().Value(VersionKey) == nil {
+			b.Fail()
+		}
+	}
+}
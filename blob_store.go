@@ -0,0 +1,22 @@
+package goengine
+
+import (
+	"context"
+	"errors"
+)
+
+// PayloadClaimCheckKey is the metadata key containing the reference to the payload when it's stored in a BlobStore
+const PayloadClaimCheckKey = "_payload_claim_check"
+
+// ErrBlobNotFound occurs when no blob is stored for a reference
+var ErrBlobNotFound = errors.New("goengine: no blob found for the reference")
+
+// BlobStore stores large payloads outside of the event store.
+// Only the reference returned by Put is stored with the event, this is also known as a claim check.
+type BlobStore interface {
+	// Put stores the data and returns the reference to retrieve it
+	Put(ctx context.Context, data []byte) (string, error)
+
+	// Get returns the data of the reference or ErrBlobNotFound when no data is stored for the reference
+	Get(ctx context.Context, reference string) ([]byte, error)
+}
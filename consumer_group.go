@@ -0,0 +1,118 @@
+package goengine
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDeliveryExpired occurs when a delivery is nacked after it's visibility timeout expired
+var ErrDeliveryExpired = errors.New("goengine: the delivery expired and may have been redelivered")
+
+type (
+	// ConsumerGroup is a named group of competing consumers of a event stream.
+	// Every message of the stream is delivered to one of the consumers of the group at least once.
+	ConsumerGroup interface {
+		// Receive returns at most count messages that are not acknowledged and not delivered to another consumer.
+		// A message that is not acknowledged within the visibility timeout is delivered again.
+		Receive(ctx context.Context, count uint) ([]Delivery, error)
+
+		// Checkpoint returns the number of the last message that was acknowledged together with all messages before it
+		Checkpoint(ctx context.Context) (int64, error)
+	}
+
+	// Delivery is a message that was delivered to a consumer of a ConsumerGroup
+	Delivery interface {
+		// Message returns the delivered message and it's number within the stream
+		Message() (Message, int64)
+
+		// Attempt returns the number of times the message was delivered
+		Attempt() int
+
+		// Ack acknowledges that the message was handled
+		Ack(ctx context.Context) error
+
+		// Nack indicates that the message was not handled and should be delivered again
+		Nack(ctx context.Context) error
+	}
+)
+
+// Consume receives the messages of the consumer group and calls the handler for every received message.
+// A message is acknowledged when the handler succeeds and nacked when it returns an error.
+// When no messages are received Consume waits for the pollInterval before trying again.
+// Consume blocks until the context is done or the consumer group returned an error.
+func Consume(
+	ctx context.Context,
+	group ConsumerGroup,
+	batchSize uint,
+	pollInterval time.Duration,
+	handler SubscriptionHandler,
+	logger Logger,
+) error {
+	switch {
+	case group == nil:
+		return InvalidArgumentError("group")
+	case batchSize == 0:
+		return InvalidArgumentError("batchSize")
+	case pollInterval <= 0:
+		return InvalidArgumentError("pollInterval")
+	case handler == nil:
+		return InvalidArgumentError("handler")
+	}
+
+	if logger == nil {
+		logger = NopLogger
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		deliveries, err := group.Receive(ctx, batchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			message, messageNumber := delivery.Message()
+			if err := handler(ctx, message, messageNumber); err != nil {
+				logger.Warn("failed to handle delivery", func(e LoggerEntry) {
+					e.Error(err)
+					e.Int64("message.no", messageNumber)
+					e.Int("delivery.attempt", delivery.Attempt())
+				})
+
+				if err := delivery.Nack(ctx); err != nil && err != ErrDeliveryExpired {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				continue
+			}
+
+			if err := delivery.Ack(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+
+		// Receive the next batch immediately when the batch was full
+		if uint(len(deliveries)) == batchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(pollInterval)
+		}
+	}
+}
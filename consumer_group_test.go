@@ -0,0 +1,79 @@
+// +build unit
+
+package goengine_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsume(t *testing.T) {
+	t.Run("Invalid arguments", func(t *testing.T) {
+		handler := func(context.Context, goengine.Message, int64) error { return nil }
+		group, err := inmemory.NewConsumerGroup(inmemory.NewEventStore(nil), "event_stream", "workers", time.Second)
+		require.NoError(t, err)
+
+		testCases := []struct {
+			title         string
+			group         goengine.ConsumerGroup
+			batchSize     uint
+			pollInterval  time.Duration
+			handler       goengine.SubscriptionHandler
+			expectedError string
+		}{
+			{"Invalid group", nil, 1, time.Second, handler, "group"},
+			{"Invalid batch size", group, 0, time.Second, handler, "batchSize"},
+			{"Invalid poll interval", group, 1, 0, handler, "pollInterval"},
+			{"Invalid handler", group, 1, time.Second, nil, "handler"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				err := goengine.Consume(context.Background(), testCase.group, testCase.batchSize, testCase.pollInterval, testCase.handler, nil)
+
+				assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedError), err)
+			})
+		}
+	})
+
+	t.Run("Ack handled messages and retry failed messages", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		store := createSubscriptionEventStore(t, 3)
+		group, err := inmemory.NewConsumerGroup(store, "event_stream", "workers", time.Minute)
+		require.NoError(t, err)
+
+		attempts := map[int64]int{}
+		handled := make(chan int64, 10)
+		done := make(chan error)
+		go func() {
+			done <- goengine.Consume(ctx, group, 2, time.Millisecond, func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+				attempts[messageNumber]++
+				if messageNumber == 2 && attempts[messageNumber] == 1 {
+					return errors.New("failed to handle message")
+				}
+
+				handled <- messageNumber
+				return nil
+			}, nil)
+		}()
+
+		assert.ElementsMatch(t, []int64{1, 3, 2}, []int64{<-handled, <-handled, <-handled})
+
+		cancel()
+		assert.NoError(t, <-done)
+		assert.Equal(t, 2, attempts[2])
+
+		checkpoint, err := group.Checkpoint(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), checkpoint)
+	})
+}
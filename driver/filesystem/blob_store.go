@@ -0,0 +1,96 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hellofresh/goengine"
+)
+
+// Ensure BlobStore implements goengine.BlobStore
+var _ goengine.BlobStore = &BlobStore{}
+
+// BlobStore is a goengine.BlobStore that stores the blobs as files in a directory.
+// The blobs are content addressed so storing the same data twice results in one file.
+type BlobStore struct {
+	dir string
+}
+
+// NewBlobStore returns a new BlobStore storing the blobs in dir
+func NewBlobStore(dir string) (*BlobStore, error) {
+	if strings.TrimSpace(dir) == "" {
+		return nil, goengine.InvalidArgumentError("dir")
+	}
+
+	return &BlobStore{dir: dir}, nil
+}
+
+// Put stores the data and returns the sha256 hash of the data as the reference
+func (s *BlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	hash := sha256.Sum256(data)
+	reference := hex.EncodeToString(hash[:])
+
+	file := s.path(reference)
+	if _, err := os.Stat(file); err == nil {
+		return reference, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so a blob is never read while it's being written
+	tmp, err := ioutil.TempFile(filepath.Dir(file), reference+".tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return reference, nil
+}
+
+// Get returns the data of the reference or goengine.ErrBlobNotFound when no data is stored for the reference
+func (s *BlobStore) Get(ctx context.Context, reference string) ([]byte, error) {
+	if !isReference(reference) {
+		return nil, goengine.InvalidArgumentError("reference")
+	}
+
+	data, err := ioutil.ReadFile(s.path(reference))
+	if os.IsNotExist(err) {
+		return nil, goengine.ErrBlobNotFound
+	}
+
+	return data, err
+}
+
+// path returns the path of the blob, blobs are spread over sub directories to limit the number of files per directory
+func (s *BlobStore) path(reference string) string {
+	return filepath.Join(s.dir, reference[:2], reference)
+}
+
+// isReference returns true when the reference is a hex encoded sha256 hash which guarantees it's a valid file name
+func isReference(reference string) bool {
+	if len(reference) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(reference)
+	return err == nil
+}
@@ -0,0 +1,61 @@
+// +build unit
+
+package filesystem_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/filesystem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBlobStore(t *testing.T) {
+	store, err := filesystem.NewBlobStore(" ")
+
+	assert.Equal(t, goengine.InvalidArgumentError("dir"), err)
+	assert.Nil(t, store)
+}
+
+func TestBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goengine-blobs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	store, err := filesystem.NewBlobStore(dir)
+	require.NoError(t, err)
+
+	t.Run("put and get", func(t *testing.T) {
+		reference, err := store.Put(ctx, []byte(`{"document":"large"}`))
+		require.NoError(t, err)
+
+		data, err := store.Get(ctx, reference)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(`{"document":"large"}`), data)
+
+		// The same data results in the same reference
+		again, err := store.Put(ctx, []byte(`{"document":"large"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, reference, again)
+	})
+
+	t.Run("unknown reference", func(t *testing.T) {
+		data, err := store.Get(ctx, strings.Repeat("ab", 32))
+
+		assert.Equal(t, goengine.ErrBlobNotFound, err)
+		assert.Nil(t, data)
+	})
+
+	t.Run("invalid reference", func(t *testing.T) {
+		data, err := store.Get(ctx, "../../etc/passwd")
+
+		assert.Equal(t, goengine.InvalidArgumentError("reference"), err)
+		assert.Nil(t, data)
+	})
+}
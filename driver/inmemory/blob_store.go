@@ -0,0 +1,53 @@
+package inmemory
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/hellofresh/goengine"
+)
+
+// Ensure BlobStore implements goengine.BlobStore
+var _ goengine.BlobStore = &BlobStore{}
+
+// BlobStore is a in memory goengine.BlobStore
+type BlobStore struct {
+	sync.RWMutex
+
+	blobs map[string][]byte
+}
+
+// NewBlobStore returns a new BlobStore
+func NewBlobStore() *BlobStore {
+	return &BlobStore{
+		blobs: map[string][]byte{},
+	}
+}
+
+// Put stores the data and returns the sha256 hash of the data as the reference
+func (s *BlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	hash := sha256.Sum256(data)
+	reference := hex.EncodeToString(hash[:])
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.blobs[reference] = append([]byte(nil), data...)
+
+	return reference, nil
+}
+
+// Get returns the data of the reference or goengine.ErrBlobNotFound when no data is stored for the reference
+func (s *BlobStore) Get(ctx context.Context, reference string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	data, found := s.blobs[reference]
+	if !found {
+		return nil, goengine.ErrBlobNotFound
+	}
+
+	return data, nil
+}
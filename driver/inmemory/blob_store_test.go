@@ -0,0 +1,30 @@
+// +build unit
+
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobStore(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewBlobStore()
+
+	reference, err := store.Put(ctx, []byte(`{"document":"large"}`))
+	require.NoError(t, err)
+	assert.NotEmpty(t, reference)
+
+	data, err := store.Get(ctx, reference)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`{"document":"large"}`), data)
+
+	data, err = store.Get(ctx, "unknown")
+	assert.Equal(t, goengine.ErrBlobNotFound, err)
+	assert.Nil(t, data)
+}
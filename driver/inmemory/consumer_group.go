@@ -0,0 +1,224 @@
+package inmemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/metadata"
+)
+
+var (
+	// Ensure ConsumerGroup implements goengine.ConsumerGroup
+	_ goengine.ConsumerGroup = &ConsumerGroup{}
+	// Ensure consumerGroupDelivery implements goengine.Delivery
+	_ goengine.Delivery = &consumerGroupDelivery{}
+)
+
+// ConsumerGroup is a in memory goengine.ConsumerGroup.
+// The consumers of a group share the state of the group by using the same group name.
+type ConsumerGroup struct {
+	eventStore        *EventStore
+	streamName        goengine.StreamName
+	state             *consumerGroupState
+	visibilityTimeout time.Duration
+}
+
+// consumerGroupState is the state of a named consumer group that is shared by it's consumers
+type consumerGroupState struct {
+	sync.Mutex
+
+	checkpoint int64
+	delivered  int64
+	deliveries map[int64]*deliveryState
+}
+
+// deliveryState is the state of a delivered message that was not yet included in the checkpoint
+type deliveryState struct {
+	attempt   int
+	visibleAt time.Time
+	acked     bool
+}
+
+// NewConsumerGroup returns a ConsumerGroup for the stream.
+// ConsumerGroups with the same groupName and streamName share the messages of the stream.
+func NewConsumerGroup(
+	eventStore *EventStore,
+	streamName goengine.StreamName,
+	groupName string,
+	visibilityTimeout time.Duration,
+) (*ConsumerGroup, error) {
+	switch {
+	case eventStore == nil:
+		return nil, goengine.InvalidArgumentError("eventStore")
+	case streamName == "":
+		return nil, goengine.InvalidArgumentError("streamName")
+	case groupName == "":
+		return nil, goengine.InvalidArgumentError("groupName")
+	case visibilityTimeout <= 0:
+		return nil, goengine.InvalidArgumentError("visibilityTimeout")
+	}
+
+	return &ConsumerGroup{
+		eventStore:        eventStore,
+		streamName:        streamName,
+		state:             eventStore.consumerGroupState(streamName, groupName),
+		visibilityTimeout: visibilityTimeout,
+	}, nil
+}
+
+// Receive returns at most count messages that are not acknowledged and not delivered to another consumer
+func (c *ConsumerGroup) Receive(ctx context.Context, count uint) ([]goengine.Delivery, error) {
+	c.state.Lock()
+	defer c.state.Unlock()
+
+	c.state.advanceCheckpoint()
+
+	now := time.Now()
+
+	// Redeliver the messages of which the visibility timeout expired
+	var redeliver []int64
+	for no, delivery := range c.state.deliveries {
+		if !delivery.acked && !delivery.visibleAt.After(now) {
+			redeliver = append(redeliver, no)
+		}
+	}
+	sort.Slice(redeliver, func(i, j int) bool { return redeliver[i] < redeliver[j] })
+	if uint(len(redeliver)) > count {
+		redeliver = redeliver[:count]
+	}
+
+	var deliveries []goengine.Delivery
+	for _, no := range redeliver {
+		messages, numbers, err := c.load(ctx, no, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(messages) == 0 || numbers[0] != no {
+			// The message is no longer in the stream
+			c.state.deliveries[no].acked = true
+			continue
+		}
+
+		deliveries = append(deliveries, c.deliver(messages[0], no, now))
+	}
+
+	// Deliver the messages that where not yet delivered
+	if remaining := count - uint(len(deliveries)); remaining > 0 {
+		messages, numbers, err := c.load(ctx, c.state.delivered+1, remaining)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, message := range messages {
+			deliveries = append(deliveries, c.deliver(message, numbers[i], now))
+			c.state.delivered = numbers[i]
+		}
+	}
+
+	return deliveries, nil
+}
+
+// Checkpoint returns the number of the last message that was acknowledged together with all messages before it
+func (c *ConsumerGroup) Checkpoint(ctx context.Context) (int64, error) {
+	c.state.Lock()
+	defer c.state.Unlock()
+
+	c.state.advanceCheckpoint()
+
+	return c.state.checkpoint, nil
+}
+
+func (c *ConsumerGroup) load(ctx context.Context, fromNumber int64, count uint) ([]goengine.Message, []int64, error) {
+	stream, err := c.eventStore.Load(ctx, c.streamName, fromNumber, &count, metadata.NewMatcher())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return goengine.ReadEventStream(stream)
+}
+
+// deliver marks the message as delivered, the caller must hold the state lock
+func (c *ConsumerGroup) deliver(message goengine.Message, messageNumber int64, now time.Time) *consumerGroupDelivery {
+	state, found := c.state.deliveries[messageNumber]
+	if !found {
+		state = &deliveryState{}
+		c.state.deliveries[messageNumber] = state
+	}
+
+	state.attempt++
+	state.visibleAt = now.Add(c.visibilityTimeout)
+
+	return &consumerGroupDelivery{
+		group:         c.state,
+		message:       message,
+		messageNumber: messageNumber,
+		attempt:       state.attempt,
+	}
+}
+
+// advanceCheckpoint moves the checkpoint to the last message before the first message that is not acknowledged.
+// The caller must hold the state lock.
+func (s *consumerGroupState) advanceCheckpoint() {
+	checkpoint := s.delivered
+	for no, delivery := range s.deliveries {
+		if !delivery.acked && no <= checkpoint {
+			checkpoint = no - 1
+		}
+	}
+
+	for no := range s.deliveries {
+		if no <= checkpoint {
+			delete(s.deliveries, no)
+		}
+	}
+
+	s.checkpoint = checkpoint
+}
+
+// consumerGroupDelivery is a message delivered by a ConsumerGroup
+type consumerGroupDelivery struct {
+	group         *consumerGroupState
+	message       goengine.Message
+	messageNumber int64
+	attempt       int
+}
+
+// Message returns the delivered message and it's number within the stream
+func (d *consumerGroupDelivery) Message() (goengine.Message, int64) {
+	return d.message, d.messageNumber
+}
+
+// Attempt returns the number of times the message was delivered
+func (d *consumerGroupDelivery) Attempt() int {
+	return d.attempt
+}
+
+// Ack acknowledges that the message was handled
+func (d *consumerGroupDelivery) Ack(ctx context.Context) error {
+	d.group.Lock()
+	defer d.group.Unlock()
+
+	if state, found := d.group.deliveries[d.messageNumber]; found {
+		state.acked = true
+	}
+
+	return nil
+}
+
+// Nack indicates that the message was not handled and should be delivered again
+func (d *consumerGroupDelivery) Nack(ctx context.Context) error {
+	d.group.Lock()
+	defer d.group.Unlock()
+
+	state, found := d.group.deliveries[d.messageNumber]
+	if !found || state.acked || state.attempt != d.attempt {
+		return goengine.ErrDeliveryExpired
+	}
+
+	state.visibleAt = time.Time{}
+
+	return nil
+}
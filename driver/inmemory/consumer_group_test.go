@@ -0,0 +1,156 @@
+// +build unit
+
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConsumerGroup(t *testing.T) {
+	store := inmemory.NewEventStore(nil)
+
+	testCases := []struct {
+		title             string
+		eventStore        *inmemory.EventStore
+		streamName        goengine.StreamName
+		groupName         string
+		visibilityTimeout time.Duration
+		expectedError     string
+	}{
+		{"Invalid event store", nil, "event_stream", "group", time.Second, "eventStore"},
+		{"Invalid stream name", store, "", "group", time.Second, "streamName"},
+		{"Invalid group name", store, "event_stream", "", time.Second, "groupName"},
+		{"Invalid visibility timeout", store, "event_stream", "group", 0, "visibilityTimeout"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			group, err := inmemory.NewConsumerGroup(testCase.eventStore, testCase.streamName, testCase.groupName, testCase.visibilityTimeout)
+
+			assert.Nil(t, group)
+			assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedError), err)
+		})
+	}
+}
+
+func TestConsumerGroup_Receive(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Competing consumers", func(t *testing.T) {
+		store := createConsumerGroupEventStore(t, 5)
+
+		first, err := inmemory.NewConsumerGroup(store, "event_stream", "workers", time.Minute)
+		require.NoError(t, err)
+		second, err := inmemory.NewConsumerGroup(store, "event_stream", "workers", time.Minute)
+		require.NoError(t, err)
+		other, err := inmemory.NewConsumerGroup(store, "event_stream", "other", time.Minute)
+		require.NoError(t, err)
+
+		firstDeliveries, err := first.Receive(ctx, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 2, 3}, deliveryNumbers(firstDeliveries))
+
+		secondDeliveries, err := second.Receive(ctx, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{4, 5}, deliveryNumbers(secondDeliveries))
+
+		otherDeliveries, err := other.Receive(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 2, 3, 4, 5}, deliveryNumbers(otherDeliveries))
+
+		// Acknowledge all but the second message
+		for _, delivery := range append(firstDeliveries, secondDeliveries...) {
+			if _, no := delivery.Message(); no != 2 {
+				require.NoError(t, delivery.Ack(ctx))
+			}
+		}
+
+		checkpoint, err := first.Checkpoint(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), checkpoint)
+
+		require.NoError(t, firstDeliveries[1].Ack(ctx))
+
+		checkpoint, err = second.Checkpoint(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), checkpoint)
+
+		checkpoint, err = other.Checkpoint(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), checkpoint)
+	})
+
+	t.Run("Redeliver after the visibility timeout", func(t *testing.T) {
+		store := createConsumerGroupEventStore(t, 2)
+
+		group, err := inmemory.NewConsumerGroup(store, "event_stream", "workers", 10*time.Millisecond)
+		require.NoError(t, err)
+
+		deliveries, err := group.Receive(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Equal(t, 1, deliveries[0].Attempt())
+
+		deliveries, err = group.Receive(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{2}, deliveryNumbers(deliveries))
+
+		time.Sleep(20 * time.Millisecond)
+
+		redeliveries, err := group.Receive(ctx, 10)
+		require.NoError(t, err)
+		require.Equal(t, []int64{1, 2}, deliveryNumbers(redeliveries))
+		assert.Equal(t, 2, redeliveries[0].Attempt())
+
+		// The expired delivery can no longer be nacked
+		assert.Equal(t, goengine.ErrDeliveryExpired, deliveries[0].Nack(ctx))
+	})
+
+	t.Run("Redeliver a nacked message", func(t *testing.T) {
+		store := createConsumerGroupEventStore(t, 1)
+
+		group, err := inmemory.NewConsumerGroup(store, "event_stream", "workers", time.Minute)
+		require.NoError(t, err)
+
+		deliveries, err := group.Receive(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		require.NoError(t, deliveries[0].Nack(ctx))
+
+		redeliveries, err := group.Receive(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, redeliveries, 1)
+		assert.Equal(t, 2, redeliveries[0].Attempt())
+	})
+}
+
+func createConsumerGroupEventStore(t *testing.T, count int) *inmemory.EventStore {
+	store := inmemory.NewEventStore(nil)
+	require.NoError(t, store.Create(context.Background(), "event_stream"))
+
+	messages := make([]goengine.Message, count)
+	for i := range messages {
+		messages[i] = mocks.NewDummyMessage(goengine.GenerateUUID(), i, metadata.New(), time.Now())
+	}
+	require.NoError(t, store.AppendTo(context.Background(), "event_stream", messages))
+
+	return store
+}
+
+func deliveryNumbers(deliveries []goengine.Delivery) []int64 {
+	numbers := make([]int64, len(deliveries))
+	for i, delivery := range deliveries {
+		_, numbers[i] = delivery.Message()
+	}
+
+	return numbers
+}
@@ -19,6 +19,8 @@ var (
 	ErrNilMessage = errors.New("goengine: nil is not a valid message")
 	// Ensure that we satisfy the eventstore.EventStore interface
 	_ goengine.EventStore = &EventStore{}
+	// Ensure that we satisfy the goengine.CatchUpSubscriber interface
+	_ goengine.CatchUpSubscriber = &EventStore{}
 )
 
 // EventStore a in memory event store implementation
@@ -27,6 +29,16 @@ type EventStore struct {
 
 	logger  goengine.Logger
 	streams map[goengine.StreamName][]goengine.Message
+	watches map[*StreamWatch]struct{}
+
+	consumerGroupsLock sync.Mutex
+	consumerGroups     map[consumerGroupKey]*consumerGroupState
+}
+
+// consumerGroupKey identifies a named consumer group of a stream
+type consumerGroupKey struct {
+	streamName goengine.StreamName
+	groupName  string
 }
 
 // NewEventStore return a new inmemory.EventStore
@@ -34,11 +46,17 @@ func NewEventStore(logger goengine.Logger) *EventStore {
 	return &EventStore{
 		logger:  logger,
 		streams: map[goengine.StreamName][]goengine.Message{},
+		watches: map[*StreamWatch]struct{}{},
+
+		consumerGroups: map[consumerGroupKey]*consumerGroupState{},
 	}
 }
 
 // Create creates a event stream
 func (i *EventStore) Create(ctx context.Context, streamName goengine.StreamName) error {
+	i.Lock()
+	defer i.Unlock()
+
 	if _, found := i.streams[streamName]; found {
 		return ErrStreamExistsAlready
 	}
@@ -50,6 +68,9 @@ func (i *EventStore) Create(ctx context.Context, streamName goengine.StreamName)
 
 // HasStream returns true if the stream exists
 func (i *EventStore) HasStream(ctx context.Context, streamName goengine.StreamName) bool {
+	i.RLock()
+	defer i.RUnlock()
+
 	_, found := i.streams[streamName]
 
 	return found
@@ -117,5 +138,147 @@ func (i *EventStore) AppendTo(ctx context.Context, streamName goengine.StreamNam
 	copy(eventsToStore, storedEvents)
 	i.streams[streamName] = append(eventsToStore, streamEvents...)
 
+	i.notifyWatches(streamName, storedEventCount, streamEvents)
+
 	return nil
 }
+
+// SubscribeFrom starts a goengine.CatchUpSubscription on the stream beginning at the message with number fromNumber
+func (i *EventStore) SubscribeFrom(
+	ctx context.Context,
+	streamName goengine.StreamName,
+	fromNumber int64,
+	matcher metadata.Matcher,
+	handler goengine.SubscriptionHandler,
+	checkpoint goengine.SubscriptionCheckpoint,
+) (goengine.CatchUpSubscription, error) {
+	if !i.HasStream(ctx, streamName) {
+		return nil, ErrStreamNotFound
+	}
+
+	notifier := func(ctx context.Context, notify func()) error {
+		watch := i.Watch(streamName)
+		defer watch.Close()
+
+		notify()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-watch.Signal():
+				watch.Take()
+				notify()
+			}
+		}
+	}
+
+	return goengine.StartCatchUpSubscription(ctx, i, notifier, streamName, fromNumber, matcher, handler, checkpoint, i.logger)
+}
+
+// consumerGroupState returns the shared state of the named consumer group of the stream
+func (i *EventStore) consumerGroupState(streamName goengine.StreamName, groupName string) *consumerGroupState {
+	i.consumerGroupsLock.Lock()
+	defer i.consumerGroupsLock.Unlock()
+
+	key := consumerGroupKey{streamName, groupName}
+	state, found := i.consumerGroups[key]
+	if !found {
+		state = &consumerGroupState{
+			deliveries: map[int64]*deliveryState{},
+		}
+		i.consumerGroups[key] = state
+	}
+
+	return state
+}
+
+// Watch returns a StreamWatch that receives every message appended to the stream until it is closed
+func (i *EventStore) Watch(streamName goengine.StreamName) *StreamWatch {
+	watch := &StreamWatch{
+		eventStore: i,
+		streamName: streamName,
+		signal:     make(chan struct{}, 1),
+	}
+
+	i.Lock()
+	defer i.Unlock()
+
+	i.watches[watch] = struct{}{}
+
+	return watch
+}
+
+// notifyWatches notifies the watches of the stream about the appended messages.
+// The caller must hold the write lock.
+func (i *EventStore) notifyWatches(streamName goengine.StreamName, storedEventCount int, messages []goengine.Message) {
+	var appended []AppendedMessage
+	for watch := range i.watches {
+		if watch.streamName != streamName {
+			continue
+		}
+
+		if appended == nil {
+			appended = make([]AppendedMessage, len(messages))
+			for idx, msg := range messages {
+				appended[idx] = AppendedMessage{
+					Message: msg,
+					Number:  int64(storedEventCount + idx + 1),
+				}
+			}
+		}
+
+		watch.notify(appended)
+	}
+}
+
+// AppendedMessage is a message that was appended to a stream together with its number within the stream
+type AppendedMessage struct {
+	Message goengine.Message
+	Number  int64
+}
+
+// StreamWatch contains the messages appended to a stream that were not yet taken
+type StreamWatch struct {
+	eventStore *EventStore
+	streamName goengine.StreamName
+
+	mux      sync.Mutex
+	appended []AppendedMessage
+	signal   chan struct{}
+}
+
+// Signal returns a channel that receives a value when messages were appended to the stream
+func (w *StreamWatch) Signal() <-chan struct{} {
+	return w.signal
+}
+
+// Take returns and removes the appended messages of the watch
+func (w *StreamWatch) Take() []AppendedMessage {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	appended := w.appended
+	w.appended = nil
+
+	return appended
+}
+
+// Close stops the watch from receiving appended messages
+func (w *StreamWatch) Close() {
+	w.eventStore.Lock()
+	defer w.eventStore.Unlock()
+
+	delete(w.eventStore.watches, w)
+}
+
+// notify adds the appended messages to the watch without blocking the caller
+func (w *StreamWatch) notify(appended []AppendedMessage) {
+	w.mux.Lock()
+	w.appended = append(w.appended, appended...)
+	w.mux.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
@@ -268,3 +268,46 @@ func createEventStoreWithStream(t *testing.T, name goengine.StreamName) (*inmemo
 func mockMessage(metadataInfo map[string]interface{}) *mocks.DummyMessage {
 	return mocks.NewDummyMessage(goengine.UUID{}, nil, metadata.FromMap(metadataInfo), time.Now())
 }
+
+func TestEventStore_SubscribeFrom(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewEventStore(nil)
+	require.NoError(t, store.Create(ctx, "event_stream"))
+
+	appendMessages := func(count int) {
+		messages := make([]goengine.Message, count)
+		for i := range messages {
+			messages[i] = mocks.NewDummyMessage(goengine.GenerateUUID(), i, metadata.New(), time.Now())
+		}
+		require.NoError(t, store.AppendTo(ctx, "event_stream", messages))
+	}
+
+	t.Run("Unknown stream", func(t *testing.T) {
+		subscription, err := store.SubscribeFrom(ctx, "unknown", 1, nil, func(context.Context, goengine.Message, int64) error {
+			return nil
+		}, nil)
+
+		assert.Nil(t, subscription)
+		assert.Equal(t, inmemory.ErrStreamNotFound, err)
+	})
+
+	t.Run("Catch up and receive appended messages", func(t *testing.T) {
+		appendMessages(2)
+
+		handled := make(chan int64, 10)
+		subscription, err := store.SubscribeFrom(ctx, "event_stream", 1, nil, func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+			handled <- messageNumber
+			return nil
+		}, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), <-handled)
+		assert.Equal(t, int64(2), <-handled)
+
+		appendMessages(1)
+		assert.Equal(t, int64(3), <-handled)
+
+		assert.NoError(t, subscription.Close())
+		assert.Equal(t, int64(3), subscription.Position())
+	})
+}
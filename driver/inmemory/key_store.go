@@ -0,0 +1,66 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hellofresh/goengine"
+)
+
+// Ensure KeyStore implements goengine.KeyStore
+var _ goengine.KeyStore = &KeyStore{}
+
+// KeyStore is a in memory goengine.KeyStore
+type KeyStore struct {
+	sync.RWMutex
+
+	keys map[string][]byte
+}
+
+// NewKeyStore returns a new KeyStore
+func NewKeyStore() *KeyStore {
+	return &KeyStore{
+		keys: map[string][]byte{},
+	}
+}
+
+// Key returns the key of the data subject or goengine.ErrKeyNotFound when the subject has no key
+func (s *KeyStore) Key(ctx context.Context, subject string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	key, found := s.keys[subject]
+	if !found {
+		return nil, goengine.ErrKeyNotFound
+	}
+
+	return key, nil
+}
+
+// GetOrCreateKey returns the key of the data subject and creates a new key when the subject has no key
+func (s *KeyStore) GetOrCreateKey(ctx context.Context, subject string) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if key, found := s.keys[subject]; found {
+		return key, nil
+	}
+
+	key, err := goengine.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	s.keys[subject] = key
+
+	return key, nil
+}
+
+// DeleteKey deletes the key of the data subject
+func (s *KeyStore) DeleteKey(ctx context.Context, subject string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.keys, subject)
+
+	return nil
+}
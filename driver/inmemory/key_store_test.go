@@ -0,0 +1,40 @@
+// +build unit
+
+package inmemory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyStore(t *testing.T) {
+	ctx := context.Background()
+	store := inmemory.NewKeyStore()
+
+	key, err := store.Key(ctx, "alice")
+	assert.Equal(t, goengine.ErrKeyNotFound, err)
+	assert.Nil(t, key)
+
+	created, err := store.GetOrCreateKey(ctx, "alice")
+	require.NoError(t, err)
+	assert.Len(t, created, goengine.KeySize)
+
+	key, err = store.GetOrCreateKey(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, created, key)
+
+	key, err = store.Key(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, created, key)
+
+	require.NoError(t, store.DeleteKey(ctx, "alice"))
+
+	key, err = store.Key(ctx, "alice")
+	assert.Equal(t, goengine.ErrKeyNotFound, err)
+	assert.Nil(t, key)
+}
@@ -0,0 +1,85 @@
+package projection
+
+import (
+	"context"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// Ensure Listener implements sql.Listener
+var _ driverSQL.Listener = &Listener{}
+
+// Listener is a Listener that is notified by the inmemory.EventStore when events are appended to a stream
+type Listener struct {
+	eventStore *inmemory.EventStore
+	streamName goengine.StreamName
+
+	logger goengine.Logger
+}
+
+// NewListener returns a new Listener for the provided stream
+func NewListener(eventStore *inmemory.EventStore, streamName goengine.StreamName, logger goengine.Logger) (*Listener, error) {
+	switch {
+	case eventStore == nil:
+		return nil, goengine.InvalidArgumentError("eventStore")
+	case streamName == "":
+		return nil, goengine.InvalidArgumentError("streamName")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	return &Listener{
+		eventStore: eventStore,
+		streamName: streamName,
+		logger:     logger,
+	}, nil
+}
+
+// Listen calls the trigger for every event that is appended to the stream.
+// This includes an initial call to trigger with a nil notification.
+func (l *Listener) Listen(ctx context.Context, trigger driverSQL.ProjectionTrigger) error {
+	// Check if the context is expired
+	select {
+	default:
+	case <-ctx.Done():
+		return nil
+	}
+
+	// Watch the stream before the initial run to avoid losing events appended during the run
+	watch := l.eventStore.Watch(l.streamName)
+	defer watch.Close()
+
+	// Execute an initial run of the projection.
+	if err := trigger(ctx, nil); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.logger.Debug("context closed stopping listening", nil)
+			return nil
+		case <-watch.Signal():
+		}
+
+		for _, appended := range watch.Take() {
+			notification := &driverSQL.ProjectionNotification{
+				No:          appended.Number,
+				AggregateID: driverSQL.PartitionByAggregateID(appended.Message),
+			}
+
+			l.logger.Debug("received notification", func(e goengine.LoggerEntry) {
+				e.Int64("notification.no", notification.No)
+				e.String("notification.aggregate_id", notification.AggregateID)
+			})
+
+			if err := trigger(ctx, notification); err != nil {
+				return err
+			}
+		}
+	}
+}
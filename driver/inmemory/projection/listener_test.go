@@ -0,0 +1,65 @@
+// +build unit
+
+package projection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/hellofresh/goengine/driver/inmemory/projection"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewListener(t *testing.T) {
+	t.Run("Invalid arguments", func(t *testing.T) {
+		listener, err := projection.NewListener(nil, "event_stream", nil)
+		assert.Nil(t, listener)
+		assert.Equal(t, goengine.InvalidArgumentError("eventStore"), err)
+
+		listener, err = projection.NewListener(inmemory.NewEventStore(nil), "", nil)
+		assert.Nil(t, listener)
+		assert.Equal(t, goengine.InvalidArgumentError("streamName"), err)
+	})
+}
+
+func TestListener_Listen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	store, _ := createProjectionEventStore(t)
+	require.NoError(t, store.Create(ctx, "other_stream"))
+
+	listener, err := projection.NewListener(store, projectionStream, nil)
+	require.NoError(t, err)
+
+	notifications := make(chan *driverSQL.ProjectionNotification, 10)
+	done := make(chan error)
+	go func() {
+		done <- listener.Listen(ctx, func(ctx context.Context, notification *driverSQL.ProjectionNotification) error {
+			notifications <- notification
+			return nil
+		})
+	}()
+
+	// The initial notification is always nil
+	assert.Nil(t, <-notifications)
+
+	id := aggregate.GenerateID()
+	appendDeposits(t, store, id, 1, 2)
+	require.NoError(t, store.AppendTo(ctx, "other_stream", []goengine.Message{
+		createAggregateMessage(t, id, accountDeposited{}),
+	}))
+
+	assert.Equal(t, &driverSQL.ProjectionNotification{No: 1, AggregateID: string(id)}, <-notifications)
+	assert.Equal(t, &driverSQL.ProjectionNotification{No: 2, AggregateID: string(id)}, <-notifications)
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Empty(t, notifications)
+}
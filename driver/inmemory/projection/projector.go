@@ -0,0 +1,215 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/metadata"
+	pkgErrors "github.com/pkg/errors"
+)
+
+// ErrProjectionFailed occurs when a projection was previously marked as failed
+var ErrProjectionFailed = errors.New("goengine: projection was previously marked as failed")
+
+type errorAction int
+
+const (
+	errorRetry errorAction = iota
+	errorFail
+	errorIgnore
+	errorFallthrough
+)
+
+// resolveErrorAction determines the way the provided error should be handled by the projector.
+// The actions are the same as the ones used by the projectors in driver/sql.
+func resolveErrorAction(
+	projectionCallback driverSQL.ProjectionErrorCallback,
+	notification *driverSQL.ProjectionNotification,
+	err error,
+) errorAction {
+	switch err {
+	case ErrProjectionFailed:
+		return errorFail
+	case context.Canceled:
+		return errorIgnore
+	}
+
+	if e, ok := err.(*driverSQL.ProjectionHandlerError); ok {
+		switch projectionCallback(e.Cause(), notification) {
+		case driverSQL.ProjectionRetry:
+			return errorRetry
+		case driverSQL.ProjectionIgnoreError:
+			return errorIgnore
+		case driverSQL.ProjectionFail:
+			return errorFail
+		}
+	}
+
+	return errorFallthrough
+}
+
+// retryLimitError returns the error used when a notification was retried too often
+func retryLimitError() error {
+	return pkgErrors.Errorf(
+		"seriously %d retries is enough! maybe it's time to fix your projection or error handling code?",
+		math.MaxInt16,
+	)
+}
+
+// projector contains the logic for projecting the events of a inmemory.EventStore stream
+type projector struct {
+	eventStore *inmemory.EventStore
+	resolver   goengine.MessagePayloadResolver
+	projection goengine.Projection
+	handlers   map[string]goengine.MessageHandler
+	storage    *Storage
+}
+
+func newProjector(
+	eventStore *inmemory.EventStore,
+	resolver goengine.MessagePayloadResolver,
+	projection goengine.Projection,
+	storage *Storage,
+) (*projector, error) {
+	switch {
+	case eventStore == nil:
+		return nil, goengine.InvalidArgumentError("eventStore")
+	case resolver == nil:
+		return nil, goengine.InvalidArgumentError("resolver")
+	case projection == nil:
+		return nil, goengine.InvalidArgumentError("projection")
+	case len(projection.Handlers()) == 0:
+		return nil, goengine.InvalidArgumentError("projection")
+	case storage == nil:
+		return nil, goengine.InvalidArgumentError("storage")
+	}
+
+	return &projector{
+		eventStore: eventStore,
+		resolver:   resolver,
+		projection: projection,
+		handlers:   wrapProjectionHandlers(projection.Handlers()),
+		storage:    storage,
+	}, nil
+}
+
+// project projects the events of the stream that are accepted by the filter onto the state of the projection
+func (p *projector) project(
+	ctx context.Context,
+	projectionID string,
+	notification *driverSQL.ProjectionNotification,
+	filter func(message goengine.Message) bool,
+) error {
+	state := p.storage.acquire(projectionID)
+	defer state.Unlock()
+
+	if state.failed {
+		return ErrProjectionFailed
+	}
+
+	// The projection is already at the notification position
+	if notification != nil && notification.No <= state.position {
+		return nil
+	}
+
+	stream, err := p.eventStore.Load(ctx, p.projection.FromStream(), state.position+1, nil, metadata.NewMatcher())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+
+	for stream.Next() {
+		// Check if the context is expired
+		select {
+		default:
+		case <-ctx.Done():
+			return nil
+		}
+
+		message, messageNumber, err := stream.Message()
+		if err != nil {
+			return err
+		}
+
+		if filter != nil && !filter(message) {
+			continue
+		}
+
+		eventName, err := p.resolver.ResolveName(message.Payload())
+		if err != nil {
+			return err
+		}
+
+		handler, found := p.handlers[eventName]
+		if !found {
+			continue
+		}
+
+		if !state.initialized {
+			if state.state, err = p.projection.Init(ctx); err != nil {
+				return err
+			}
+			state.initialized = true
+		}
+
+		newState, err := handler(ctx, state.state, message)
+		if err != nil {
+			return err
+		}
+
+		state.state = newState
+		state.position = messageNumber
+	}
+
+	return stream.Err()
+}
+
+// wrapProjectionHandlers wraps the projection handlers so that any error or panic is caught and returned
+func wrapProjectionHandlers(handlers map[string]goengine.MessageHandler) map[string]goengine.MessageHandler {
+	res := make(map[string]goengine.MessageHandler, len(handlers))
+	for k, h := range handlers {
+		res[k] = wrapProjectionHandlerToTrapError(h)
+	}
+
+	return res
+}
+
+// wrapProjectionHandlerToTrapError wraps a projection handler with error catching code.
+// This ensures a projection handler can return a error or panic without destroying the projector
+func wrapProjectionHandlerToTrapError(handler goengine.MessageHandler) goengine.MessageHandler {
+	return func(ctx context.Context, state interface{}, message goengine.Message) (returnState interface{}, handlerErr error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+
+			// find out exactly what the error was and set err
+			var err error
+			switch x := r.(type) {
+			case string:
+				err = errors.New(x)
+			case error:
+				err = x
+			default:
+				err = pkgErrors.Errorf("unknown panic: (%T) %v", x, x)
+			}
+
+			handlerErr = driverSQL.NewProjectionHandlerError(err)
+		}()
+
+		var err error
+		returnState, err = handler(ctx, state, message)
+		if err != nil {
+			handlerErr = driverSQL.NewProjectionHandlerError(err)
+		}
+
+		return
+	}
+}
@@ -0,0 +1,206 @@
+package projection
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/metadata"
+)
+
+// AggregateProjector is a in memory projector that projects the events of every aggregate onto a separate projection state.
+// It follows the same semantics as the sql.AggregateProjector.
+type AggregateProjector struct {
+	sync.Mutex
+
+	projector         *projector
+	aggregateTypeName string
+
+	projectionErrorHandler driverSQL.ProjectionErrorCallback
+
+	logger goengine.Logger
+}
+
+// NewAggregateProjector creates a new projector for a projection of the provided aggregate type
+func NewAggregateProjector(
+	eventStore *inmemory.EventStore,
+	resolver goengine.MessagePayloadResolver,
+	aggregateTypeName string,
+	projection goengine.Projection,
+	storage *Storage,
+	projectionErrorHandler driverSQL.ProjectionErrorCallback,
+	logger goengine.Logger,
+) (*AggregateProjector, error) {
+	switch {
+	case aggregateTypeName == "":
+		return nil, goengine.InvalidArgumentError("aggregateTypeName")
+	case projectionErrorHandler == nil:
+		return nil, goengine.InvalidArgumentError("projectionErrorHandler")
+	}
+
+	p, err := newProjector(eventStore, resolver, projection, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	logger = logger.WithFields(func(e goengine.LoggerEntry) {
+		e.String("projection", projection.Name())
+	})
+
+	return &AggregateProjector{
+		projector:              p,
+		aggregateTypeName:      aggregateTypeName,
+		projectionErrorHandler: projectionErrorHandler,
+		logger:                 logger,
+	}, nil
+}
+
+// Run executes the projection and manages the state of the projection
+func (a *AggregateProjector) Run(ctx context.Context) error {
+	a.Lock()
+	defer a.Unlock()
+
+	return a.processNotification(ctx, nil)
+}
+
+// RunAndListen executes the projection and listens to any changes to the event store
+func (a *AggregateProjector) RunAndListen(ctx context.Context, listener driverSQL.Listener) error {
+	a.Lock()
+	defer a.Unlock()
+
+	return listener.Listen(ctx, a.processNotification)
+}
+
+func (a *AggregateProjector) processNotification(ctx context.Context, notification *driverSQL.ProjectionNotification) error {
+	// Check if the context is expired
+	select {
+	default:
+	case <-ctx.Done():
+		return nil
+	}
+
+	if notification != nil {
+		return a.projectAggregate(ctx, notification)
+	}
+
+	// A nil notification was received this mean that we need to find and project any aggregate that is out of sync
+	notifications, err := a.outOfSyncProjections(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range notifications {
+		if err := a.projectAggregate(ctx, n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *AggregateProjector) projectAggregate(ctx context.Context, notification *driverSQL.ProjectionNotification) error {
+	// Events without an aggregate id are not part of a aggregate projection
+	if notification.AggregateID == "" {
+		return nil
+	}
+
+	filter := func(message goengine.Message) bool {
+		return a.isAggregateType(message.Metadata()) && driverSQL.PartitionByAggregateID(message) == notification.AggregateID
+	}
+
+	for i := 0; i < math.MaxInt16; i++ {
+		err := a.projector.project(ctx, notification.AggregateID, notification, filter)
+
+		// No error occurred during projection so return
+		if err == nil {
+			return nil
+		}
+
+		// Resolve the action to take based on the error that occurred
+		logFields := func(e goengine.LoggerEntry) {
+			e.Error(err)
+			e.Int64("notification.no", notification.No)
+			e.String("notification.aggregate_id", notification.AggregateID)
+		}
+		switch resolveErrorAction(a.projectionErrorHandler, notification, err) {
+		case errorFail:
+			a.logger.Debug("ProcessHandler->ErrorHandler: marking projection as failed", logFields)
+			a.projector.storage.markFailed(notification.AggregateID)
+			return nil
+		case errorIgnore:
+			a.logger.Debug("ProcessHandler->ErrorHandler: ignoring error", logFields)
+			return nil
+		case errorRetry:
+			a.logger.Debug("ProcessHandler->ErrorHandler: retrying notification", logFields)
+			continue
+		}
+
+		a.logger.Debug("ProcessHandler->ErrorHandler: error fallthrough", logFields)
+		return err
+	}
+
+	return retryLimitError()
+}
+
+// outOfSyncProjections returns a notification for every aggregate of which the projection is behind the event store
+func (a *AggregateProjector) outOfSyncProjections(ctx context.Context) ([]*driverSQL.ProjectionNotification, error) {
+	stream, err := a.projector.eventStore.Load(ctx, a.projector.projection.FromStream(), 1, nil, metadata.NewMatcher())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = stream.Close()
+	}()
+
+	var notifications []*driverSQL.ProjectionNotification
+	latest := map[string]*driverSQL.ProjectionNotification{}
+	for stream.Next() {
+		message, messageNumber, err := stream.Message()
+		if err != nil {
+			return nil, err
+		}
+
+		aggregateID := driverSQL.PartitionByAggregateID(message)
+		if aggregateID == "" || !a.isAggregateType(message.Metadata()) {
+			continue
+		}
+
+		if notification, found := latest[aggregateID]; found {
+			notification.No = messageNumber
+			continue
+		}
+
+		notification := &driverSQL.ProjectionNotification{
+			No:          messageNumber,
+			AggregateID: aggregateID,
+		}
+		latest[aggregateID] = notification
+		notifications = append(notifications, notification)
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	positions := a.projector.storage.positions()
+
+	outOfSync := notifications[:0]
+	for _, notification := range notifications {
+		if notification.No > positions[notification.AggregateID] {
+			outOfSync = append(outOfSync, notification)
+		}
+	}
+
+	return outOfSync, nil
+}
+
+func (a *AggregateProjector) isAggregateType(m metadata.Metadata) bool {
+	typeName, ok := m.Value(aggregate.TypeKey).(string)
+	return ok && typeName == a.aggregateTypeName
+}
@@ -0,0 +1,108 @@
+package projection
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// StreamProjector is a in memory projector that projects the events of a stream onto a single projection state.
+// It follows the same semantics as the sql.StreamProjector.
+type StreamProjector struct {
+	sync.Mutex
+
+	projector *projector
+
+	projectionErrorHandler driverSQL.ProjectionErrorCallback
+
+	logger goengine.Logger
+}
+
+// NewStreamProjector creates a new projector for a projection
+func NewStreamProjector(
+	eventStore *inmemory.EventStore,
+	resolver goengine.MessagePayloadResolver,
+	projection goengine.Projection,
+	storage *Storage,
+	projectionErrorHandler driverSQL.ProjectionErrorCallback,
+	logger goengine.Logger,
+) (*StreamProjector, error) {
+	if projectionErrorHandler == nil {
+		return nil, goengine.InvalidArgumentError("projectionErrorHandler")
+	}
+
+	p, err := newProjector(eventStore, resolver, projection, storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	logger = logger.WithFields(func(e goengine.LoggerEntry) {
+		e.String("projection", projection.Name())
+	})
+
+	return &StreamProjector{
+		projector:              p,
+		projectionErrorHandler: projectionErrorHandler,
+		logger:                 logger,
+	}, nil
+}
+
+// Run executes the projection and manages the state of the projection
+func (s *StreamProjector) Run(ctx context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.processNotification(ctx, nil)
+}
+
+// RunAndListen executes the projection and listens to any changes to the event store
+func (s *StreamProjector) RunAndListen(ctx context.Context, listener driverSQL.Listener) error {
+	s.Lock()
+	defer s.Unlock()
+
+	return listener.Listen(ctx, s.processNotification)
+}
+
+func (s *StreamProjector) processNotification(ctx context.Context, notification *driverSQL.ProjectionNotification) error {
+	// Check if the context is expired
+	select {
+	default:
+	case <-ctx.Done():
+		return nil
+	}
+
+	for i := 0; i < math.MaxInt16; i++ {
+		err := s.projector.project(ctx, s.projector.projection.Name(), notification, nil)
+
+		// No error occurred during projection so return
+		if err == nil {
+			return nil
+		}
+
+		// Resolve the action to take based on the error that occurred
+		logFields := func(e goengine.LoggerEntry) {
+			e.Error(err)
+			e.Any("notification", notification)
+		}
+		switch resolveErrorAction(s.projectionErrorHandler, notification, err) {
+		case errorRetry:
+			s.logger.Debug("Trigger->ErrorHandler: retrying notification", logFields)
+			continue
+		case errorIgnore:
+			s.logger.Debug("Trigger->ErrorHandler: ignoring error", logFields)
+			return nil
+		case errorFail, errorFallthrough:
+			s.logger.Debug("Trigger->ErrorHandler: error fallthrough", logFields)
+			return err
+		}
+	}
+
+	return retryLimitError()
+}
@@ -0,0 +1,342 @@
+// +build unit
+
+package projection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/hellofresh/goengine/driver/inmemory/projection"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/metadata"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	projectionStream    = goengine.StreamName("event_stream")
+	projectionAggregate = "account"
+)
+
+type accountDeposited struct {
+	Amount int
+}
+
+type accountFailed struct{}
+
+type depositProjection struct{}
+
+func (*depositProjection) Init(ctx context.Context) (interface{}, error) {
+	return 0, nil
+}
+
+func (*depositProjection) Handlers() map[string]goengine.MessageHandler {
+	return map[string]goengine.MessageHandler{
+		"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+			return state.(int) + message.Payload().(accountDeposited).Amount, nil
+		},
+		"failed": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+			return nil, errors.New("projection failed")
+		},
+	}
+}
+
+func (*depositProjection) Name() string {
+	return "deposits"
+}
+
+func (*depositProjection) FromStream() goengine.StreamName {
+	return projectionStream
+}
+
+// lazyDepositProjection is a deposit projection of which the handler loads the payload using strategyJSON.LoadPayload
+type lazyDepositProjection struct {
+	depositProjection
+	payloads []interface{}
+}
+
+func (p *lazyDepositProjection) Handlers() map[string]goengine.MessageHandler {
+	return map[string]goengine.MessageHandler{
+		"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+			p.payloads = append(p.payloads, message.Payload())
+
+			payload, err := strategyJSON.LoadPayload(ctx, message.Payload())
+			if err != nil {
+				return nil, err
+			}
+
+			return state.(int) + payload.(accountDeposited).Amount, nil
+		},
+	}
+}
+
+func TestStreamProjector_RunAndListen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	store, resolver := createProjectionEventStore(t)
+	appendDeposits(t, store, aggregate.GenerateID(), 1, 2)
+
+	listener, err := projection.NewListener(store, projectionStream, nil)
+	require.NoError(t, err)
+
+	storage := projection.NewStorage()
+	projector, err := projection.NewStreamProjector(store, resolver, &depositProjection{}, storage, failOnError, nil)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- projector.RunAndListen(ctx, listener)
+	}()
+
+	assertProjectionState(t, storage, "deposits", 3, 2)
+
+	appendDeposits(t, store, aggregate.GenerateID(), 10)
+	assertProjectionState(t, storage, "deposits", 13, 3)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestStreamProjector_Run(t *testing.T) {
+	testCases := []struct {
+		title            string
+		action           driverSQL.ProjectionErrorAction
+		expectedError    bool
+		expectedPosition int64
+	}{
+		{"Fail on a projection error", driverSQL.ProjectionFail, true, 1},
+		{"Ignore a projection error", driverSQL.ProjectionIgnoreError, false, 1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			store, resolver := createProjectionEventStore(t)
+			appendDeposits(t, store, aggregate.GenerateID(), 5)
+			appendFailure(t, store, aggregate.GenerateID())
+
+			var callbackErr error
+			storage := projection.NewStorage()
+			projector, err := projection.NewStreamProjector(
+				store,
+				resolver,
+				&depositProjection{},
+				storage,
+				func(err error, notification *driverSQL.ProjectionNotification) driverSQL.ProjectionErrorAction {
+					callbackErr = err
+					return testCase.action
+				},
+				nil,
+			)
+			require.NoError(t, err)
+
+			err = projector.Run(context.Background())
+			if testCase.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.EqualError(t, callbackErr, "projection failed")
+
+			state, position, found := storage.State("deposits")
+			assert.True(t, found)
+			assert.Equal(t, 5, state)
+			assert.Equal(t, testCase.expectedPosition, position)
+		})
+	}
+}
+
+func TestStreamProjector_LazyPayload(t *testing.T) {
+	store, _ := createProjectionEventStore(t)
+
+	resolver := strategyJSON.NewPayloadTransformer()
+	require.NoError(t, resolver.RegisterPayload("deposited", func() interface{} {
+		return accountDeposited{}
+	}))
+
+	var loads int
+	lazy := strategyJSON.NewLazyPayload("deposited", "reference", func(context.Context) (interface{}, error) {
+		loads++
+		return accountDeposited{Amount: 10}, nil
+	})
+
+	id := aggregate.GenerateID()
+	appendDeposits(t, store, id, 5)
+	require.NoError(t, store.AppendTo(context.Background(), projectionStream, []goengine.Message{
+		createAggregateMessage(t, id, lazy),
+	}))
+
+	storage := projection.NewStorage()
+	lazyProjection := &lazyDepositProjection{}
+	projector, err := projection.NewStreamProjector(store, resolver, lazyProjection, storage, failOnError, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, projector.Run(context.Background()))
+
+	// The handler is dispatched using the payload type of the lazy payload and receives the lazy payload itself
+	assert.Equal(t, []interface{}{accountDeposited{Amount: 5}, lazy}, lazyProjection.payloads)
+	assert.Equal(t, 1, loads)
+	assertProjectionState(t, storage, "deposits", 15, 2)
+}
+
+func TestAggregateProjector_Run(t *testing.T) {
+	store, resolver := createProjectionEventStore(t)
+
+	firstID := aggregate.GenerateID()
+	secondID := aggregate.GenerateID()
+	failingID := aggregate.GenerateID()
+	appendDeposits(t, store, firstID, 1, 2)
+	appendDeposits(t, store, secondID, 5)
+	appendFailure(t, store, failingID)
+	appendDeposits(t, store, firstID, 3)
+
+	storage := projection.NewStorage()
+	projector, err := projection.NewAggregateProjector(store, resolver, projectionAggregate, &depositProjection{}, storage, failOnError, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, projector.Run(context.Background()))
+
+	state, position, found := storage.State(string(firstID))
+	assert.True(t, found)
+	assert.Equal(t, 6, state)
+	assert.Equal(t, int64(5), position)
+
+	state, position, found = storage.State(string(secondID))
+	assert.True(t, found)
+	assert.Equal(t, 5, state)
+	assert.Equal(t, int64(3), position)
+
+	assert.True(t, storage.Failed(string(failingID)))
+	assert.False(t, storage.Failed(string(firstID)))
+}
+
+func TestAggregateProjector_RunAndListen(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	store, resolver := createProjectionEventStore(t)
+
+	id := aggregate.GenerateID()
+	appendDeposits(t, store, id, 1)
+
+	listener, err := projection.NewListener(store, projectionStream, nil)
+	require.NoError(t, err)
+
+	storage := projection.NewStorage()
+	projector, err := projection.NewAggregateProjector(store, resolver, projectionAggregate, &depositProjection{}, storage, failOnError, nil)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- projector.RunAndListen(ctx, listener)
+	}()
+
+	assertProjectionState(t, storage, string(id), 1, 1)
+
+	appendDeposits(t, store, id, 2)
+	assertProjectionState(t, storage, string(id), 3, 2)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestNewStreamProjector(t *testing.T) {
+	store, resolver := createProjectionEventStore(t)
+	storage := projection.NewStorage()
+
+	testCases := []struct {
+		title         string
+		eventStore    *inmemory.EventStore
+		resolver      goengine.MessagePayloadResolver
+		projection    goengine.Projection
+		storage       *projection.Storage
+		errorCallback driverSQL.ProjectionErrorCallback
+		expectedError string
+	}{
+		{"Invalid eventStore", nil, resolver, &depositProjection{}, storage, failOnError, "eventStore"},
+		{"Invalid resolver", store, nil, &depositProjection{}, storage, failOnError, "resolver"},
+		{"Invalid projection", store, resolver, nil, storage, failOnError, "projection"},
+		{"Invalid storage", store, resolver, &depositProjection{}, nil, failOnError, "storage"},
+		{"Invalid error callback", store, resolver, &depositProjection{}, storage, nil, "projectionErrorHandler"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			projector, err := projection.NewStreamProjector(
+				testCase.eventStore,
+				testCase.resolver,
+				testCase.projection,
+				testCase.storage,
+				testCase.errorCallback,
+				nil,
+			)
+
+			assert.Nil(t, projector)
+			assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedError), err)
+		})
+	}
+}
+
+func failOnError(error, *driverSQL.ProjectionNotification) driverSQL.ProjectionErrorAction {
+	return driverSQL.ProjectionFail
+}
+
+func createProjectionEventStore(t *testing.T) (*inmemory.EventStore, *inmemory.PayloadRegistry) {
+	store := inmemory.NewEventStore(nil)
+	require.NoError(t, store.Create(context.Background(), projectionStream))
+
+	resolver := &inmemory.PayloadRegistry{}
+	require.NoError(t, resolver.RegisterPayload("deposited", accountDeposited{}))
+	require.NoError(t, resolver.RegisterPayload("failed", accountFailed{}))
+
+	return store, resolver
+}
+
+func appendDeposits(t *testing.T, store *inmemory.EventStore, id aggregate.ID, amounts ...int) {
+	var messages []goengine.Message
+	for _, amount := range amounts {
+		messages = append(messages, createAggregateMessage(t, id, accountDeposited{Amount: amount}))
+	}
+
+	require.NoError(t, store.AppendTo(context.Background(), projectionStream, messages))
+}
+
+func appendFailure(t *testing.T, store *inmemory.EventStore, id aggregate.ID) {
+	require.NoError(t, store.AppendTo(context.Background(), projectionStream, []goengine.Message{
+		createAggregateMessage(t, id, accountFailed{}),
+	}))
+}
+
+func createAggregateMessage(t *testing.T, id aggregate.ID, payload interface{}) goengine.Message {
+	meta := metadata.WithValue(metadata.New(), aggregate.IDKey, id)
+	meta = metadata.WithValue(meta, aggregate.TypeKey, projectionAggregate)
+
+	message, err := aggregate.ReconstituteChange(id, goengine.GenerateUUID(), payload, meta, time.Now(), 1)
+	require.NoError(t, err)
+
+	return message
+}
+
+func assertProjectionState(t *testing.T, storage *projection.Storage, projectionID string, expectedState interface{}, expectedPosition int64) {
+	deadline := time.Now().Add(time.Second)
+	for {
+		state, position, _ := storage.State(projectionID)
+		if state == expectedState && position == expectedPosition {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			assert.Equal(t, expectedState, state)
+			assert.Equal(t, expectedPosition, position)
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
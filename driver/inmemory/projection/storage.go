@@ -0,0 +1,86 @@
+package projection
+
+import "sync"
+
+// Storage stores the state of projections in memory.
+// A Storage should only be used by the projectors of a single projection.
+type Storage struct {
+	mux         sync.Mutex
+	projections map[string]*projectionState
+}
+
+// projectionState is the state of a single projection which is locked while it is being projected
+type projectionState struct {
+	sync.Mutex
+
+	initialized bool
+	failed      bool
+	position    int64
+	state       interface{}
+}
+
+// NewStorage returns a new Storage
+func NewStorage() *Storage {
+	return &Storage{
+		projections: map[string]*projectionState{},
+	}
+}
+
+// State returns the state and position of a projection.
+// The projectionID is the name of a stream projection or the aggregate id of a aggregate projection.
+func (s *Storage) State(projectionID string) (state interface{}, position int64, found bool) {
+	projection := s.acquire(projectionID)
+	defer projection.Unlock()
+
+	return projection.state, projection.position, projection.initialized
+}
+
+// Failed returns true when the projection was marked as failed
+func (s *Storage) Failed(projectionID string) bool {
+	projection := s.acquire(projectionID)
+	defer projection.Unlock()
+
+	return projection.failed
+}
+
+// acquire returns the locked state of the projection, the caller must unlock the state
+func (s *Storage) acquire(projectionID string) *projectionState {
+	s.mux.Lock()
+	projection, found := s.projections[projectionID]
+	if !found {
+		projection = &projectionState{}
+		s.projections[projectionID] = projection
+	}
+	s.mux.Unlock()
+
+	projection.Lock()
+
+	return projection
+}
+
+// positions returns the position of every known projection
+func (s *Storage) positions() map[string]int64 {
+	s.mux.Lock()
+	projections := make(map[string]*projectionState, len(s.projections))
+	for id, projection := range s.projections {
+		projections[id] = projection
+	}
+	s.mux.Unlock()
+
+	positions := make(map[string]int64, len(projections))
+	for id, projection := range projections {
+		projection.Lock()
+		positions[id] = projection.position
+		projection.Unlock()
+	}
+
+	return positions
+}
+
+// markFailed marks the projection as failed
+func (s *Storage) markFailed(projectionID string) {
+	projection := s.acquire(projectionID)
+	defer projection.Unlock()
+
+	projection.failed = true
+}
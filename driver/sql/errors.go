@@ -26,6 +26,12 @@ var (
 	ErrProjectionPreviouslyLocked = errors.New("goengine: unable to lock projection due to a previous lock being in place")
 	// ErrNoProjectionRequired occurs when a notification was being acquired but the projection was already at the indicated position
 	ErrNoProjectionRequired = errors.New("goengine: no projection acquisition required")
+	// ErrProjectionVersionMismatch occurs when the projection state was projected by another version of the projection
+	ErrProjectionVersionMismatch = errors.New("goengine: projection state was projected by another version of the projection")
+	// ErrPartitionCountChanged occurs when a partitioned projection was projected using another amount of partitions
+	ErrPartitionCountChanged = errors.New("goengine: projection was projected using another amount of partitions")
+	// errPrimaryListenerUnresponsive occurs when the primary listener of a FallbackListener did not receive a heartbeat
+	errPrimaryListenerUnresponsive = errors.New("goengine: primary listener did not receive a heartbeat")
 )
 
 // ProjectionHandlerError an error indicating that a projection handler failed
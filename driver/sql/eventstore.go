@@ -12,3 +12,12 @@ type ReadOnlyEventStore interface {
 	// LoadWithConnection returns a eventstream based on the provided constraints using the provided Queryer
 	LoadWithConnection(ctx context.Context, conn Queryer, streamName goengine.StreamName, fromNumber int64, count *uint, metadataMatcher metadata.Matcher) (goengine.EventStream, error)
 }
+
+// PartitionedReadOnlyEventStore is a ReadOnlyEventStore that is able to only load the events of a partition of the stream
+type PartitionedReadOnlyEventStore interface {
+	ReadOnlyEventStore
+
+	// LoadPartitionWithConnection returns a eventstream containing the events of the aggregates belonging to the partition.
+	// A aggregate belongs to the partition returned by AggregatePartition.
+	LoadPartitionWithConnection(ctx context.Context, conn Queryer, streamName goengine.StreamName, fromNumber int64, count *uint, metadataMatcher metadata.Matcher, partition uint32, partitions uint32) (goengine.EventStream, error)
+}
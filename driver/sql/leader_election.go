@@ -0,0 +1,224 @@
+package sql
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hellofresh/goengine"
+)
+
+type (
+	// Lease represents the ownership of a named resource
+	Lease struct {
+		Name      string
+		Holder    string
+		ExpiresAt time.Time
+	}
+
+	// LeaseStore persists leases
+	LeaseStore interface {
+		// Acquire acquires or renews the lease for the holder and returns true when the holder owns the lease
+		Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error)
+		// Release releases the lease when it's owned by the holder
+		Release(ctx context.Context, name string, holder string) error
+		// Owner returns the lease with the provided name.
+		// When no lease exists a Lease without a Holder is returned.
+		Owner(ctx context.Context, name string) (Lease, error)
+	}
+)
+
+// Active returns true when the lease is held and did not expire at the provided time
+func (l Lease) Active(now time.Time) bool {
+	return l.Holder != "" && now.Before(l.ExpiresAt)
+}
+
+// LeaderElection uses a lease to ensure only one process runs a task at any given time.
+// This can be used to ensure only a single replica runs a StreamProjector while the other replicas stand by.
+type LeaderElection struct {
+	store  LeaseStore
+	name   string
+	holder string
+
+	ttl           time.Duration
+	renewInterval time.Duration
+
+	leader int32
+
+	logger goengine.Logger
+}
+
+// NewLeaderElection returns a new LeaderElection
+//
+// The holder must be unique for every process, for example the hostname combined with the process id.
+// The lease is renewed every renewInterval and expires when it was not renewed within the ttl.
+func NewLeaderElection(
+	store LeaseStore,
+	name string,
+	holder string,
+	ttl time.Duration,
+	renewInterval time.Duration,
+	logger goengine.Logger,
+) (*LeaderElection, error) {
+	switch {
+	case store == nil:
+		return nil, goengine.InvalidArgumentError("store")
+	case strings.TrimSpace(name) == "":
+		return nil, goengine.InvalidArgumentError("name")
+	case strings.TrimSpace(holder) == "":
+		return nil, goengine.InvalidArgumentError("holder")
+	case ttl <= 0:
+		return nil, goengine.InvalidArgumentError("ttl")
+	case renewInterval <= 0 || renewInterval >= ttl:
+		return nil, goengine.InvalidArgumentError("renewInterval")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	logger = logger.WithFields(func(e goengine.LoggerEntry) {
+		e.String("lease", name)
+		e.String("lease_holder", holder)
+	})
+
+	return &LeaderElection{
+		store:         store,
+		name:          name,
+		holder:        holder,
+		ttl:           ttl,
+		renewInterval: renewInterval,
+		logger:        logger,
+	}, nil
+}
+
+// IsLeader returns true when the process currently holds the lease
+func (l *LeaderElection) IsLeader() bool {
+	return atomic.LoadInt32(&l.leader) == 1
+}
+
+// Owner returns the lease as currently known by the store
+func (l *LeaderElection) Owner(ctx context.Context) (Lease, error) {
+	return l.store.Owner(ctx, l.name)
+}
+
+// Run waits until the lease is acquired and then calls run.
+// The context provided to run is canceled when the lease is lost after which Run will wait to become the leader again.
+// Run returns when the context is canceled, when run returns without the lease being lost or when run returns an error.
+func (l *LeaderElection) Run(ctx context.Context, run func(ctx context.Context) error) error {
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		// Check if the context is expired
+		select {
+		default:
+		case <-ctx.Done():
+			return nil
+		}
+
+		acquired, err := l.store.Acquire(ctx, l.name, l.holder, l.ttl)
+		switch {
+		case err != nil:
+			l.logger.Warn("failed to acquire lease", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		case acquired:
+			lost, err := l.lead(ctx, run)
+			if !lost {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs while renewing the lease and returns true when the lease was lost
+func (l *LeaderElection) lead(ctx context.Context, run func(ctx context.Context) error) (bool, error) {
+	l.logger.Info("acquired lease", nil)
+	atomic.StoreInt32(&l.leader, 1)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		lost int32
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if !l.renew(leaderCtx) {
+			atomic.StoreInt32(&lost, 1)
+			cancel()
+		}
+	}()
+
+	err := run(leaderCtx)
+
+	cancel()
+	wg.Wait()
+	atomic.StoreInt32(&l.leader, 0)
+
+	if atomic.LoadInt32(&lost) == 1 {
+		l.logger.Warn("lost lease", func(e goengine.LoggerEntry) {
+			if err != nil {
+				e.Error(err)
+			}
+		})
+		return true, nil
+	}
+
+	// Use a fresh context since the provided context is likely to be canceled
+	if releaseErr := l.store.Release(context.Background(), l.name, l.holder); releaseErr != nil {
+		l.logger.Warn("failed to release lease", func(e goengine.LoggerEntry) {
+			e.Error(releaseErr)
+		})
+	} else {
+		l.logger.Info("released lease", nil)
+	}
+
+	return false, err
+}
+
+// renew renews the lease until the context is done and returns false when the lease was lost
+func (l *LeaderElection) renew(ctx context.Context) bool {
+	ticker := time.NewTicker(l.renewInterval)
+	defer ticker.Stop()
+
+	renewedAt := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-ticker.C:
+		}
+
+		acquired, err := l.store.Acquire(ctx, l.name, l.holder, l.ttl)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return true
+			}
+
+			l.logger.Warn("failed to renew lease", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+
+			// Stop before the lease expires since another process may take over the lease once it expired
+			if time.Since(renewedAt)+l.renewInterval >= l.ttl {
+				return false
+			}
+		case !acquired:
+			return false
+		default:
+			renewedAt = time.Now()
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// +build unit
+
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type leaseStoreStub struct {
+	sync.Mutex
+
+	leases     map[string]sql.Lease
+	acquireErr error
+}
+
+func (s *leaseStoreStub) Acquire(_ context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.acquireErr != nil {
+		return false, s.acquireErr
+	}
+
+	now := time.Now()
+	lease := s.leases[name]
+	if lease.Active(now) && lease.Holder != holder {
+		return false, nil
+	}
+
+	s.leases[name] = sql.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *leaseStoreStub) Release(_ context.Context, name string, holder string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.leases[name].Holder == holder {
+		delete(s.leases, name)
+	}
+	return nil
+}
+
+func (s *leaseStoreStub) Owner(_ context.Context, name string) (sql.Lease, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	lease, found := s.leases[name]
+	if !found {
+		return sql.Lease{Name: name}, nil
+	}
+	return lease, nil
+}
+
+func (s *leaseStoreStub) takeOver(name string, holder string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.leases[name] = sql.Lease{Name: name, Holder: holder, ExpiresAt: time.Now().Add(time.Hour)}
+}
+
+func TestNewLeaderElection(t *testing.T) {
+	store := &leaseStoreStub{leases: map[string]sql.Lease{}}
+
+	testCases := []struct {
+		title                 string
+		store                 sql.LeaseStore
+		name                  string
+		holder                string
+		ttl                   time.Duration
+		renewInterval         time.Duration
+		expectedArgumentError string
+	}{
+		{"No store", nil, "projection", "host-1", time.Second, time.Millisecond, "store"},
+		{"No name", store, " ", "host-1", time.Second, time.Millisecond, "name"},
+		{"No holder", store, "projection", "", time.Second, time.Millisecond, "holder"},
+		{"No ttl", store, "projection", "host-1", 0, time.Millisecond, "ttl"},
+		{"Renew interval exceeds ttl", store, "projection", "host-1", time.Second, time.Second, "renewInterval"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			election, err := sql.NewLeaderElection(
+				testCase.store,
+				testCase.name,
+				testCase.holder,
+				testCase.ttl,
+				testCase.renewInterval,
+				nil,
+			)
+
+			assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedArgumentError), err)
+			assert.Nil(t, election)
+		})
+	}
+}
+
+func TestLeaderElection_Run(t *testing.T) {
+	t.Run("Run as leader and release", func(t *testing.T) {
+		store := &leaseStoreStub{leases: map[string]sql.Lease{}}
+		election, err := sql.NewLeaderElection(store, "projection", "host-1", time.Second, 10*time.Millisecond, nil)
+		require.NoError(t, err)
+
+		var calls int
+		err = election.Run(context.Background(), func(ctx context.Context) error {
+			calls++
+			assert.True(t, election.IsLeader())
+
+			owner, err := election.Owner(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "host-1", owner.Holder)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.False(t, election.IsLeader())
+
+		owner, err := election.Owner(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, owner.Active(time.Now()))
+	})
+
+	t.Run("Return run error", func(t *testing.T) {
+		store := &leaseStoreStub{leases: map[string]sql.Lease{}}
+		election, err := sql.NewLeaderElection(store, "projection", "host-1", time.Second, 10*time.Millisecond, nil)
+		require.NoError(t, err)
+
+		expectedErr := errors.New("projection failed")
+		err = election.Run(context.Background(), func(ctx context.Context) error {
+			return expectedErr
+		})
+
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("Follow while another holder owns the lease", func(t *testing.T) {
+		store := &leaseStoreStub{leases: map[string]sql.Lease{}}
+		store.takeOver("projection", "host-2")
+
+		election, err := sql.NewLeaderElection(store, "projection", "host-1", time.Second, 10*time.Millisecond, nil)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err = election.Run(ctx, func(ctx context.Context) error {
+			t.Error("run should not be called by a follower")
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.False(t, election.IsLeader())
+	})
+
+	t.Run("Cancel run when the lease is lost", func(t *testing.T) {
+		store := &leaseStoreStub{leases: map[string]sql.Lease{}}
+		election, err := sql.NewLeaderElection(store, "projection", "host-1", time.Second, 10*time.Millisecond, nil)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var calls int
+		err = election.Run(ctx, func(leaderCtx context.Context) error {
+			calls++
+			if calls > 1 {
+				t.Error("run should not be called after the lease was taken over")
+				return nil
+			}
+
+			store.takeOver("projection", "host-2")
+			<-leaderCtx.Done()
+
+			// Stop the election once the lease was lost
+			time.AfterFunc(30*time.Millisecond, cancel)
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+		assert.False(t, election.IsLeader())
+	})
+}
@@ -1,9 +1,79 @@
 package sql
 
-import "context"
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type (
+	// Heartbeat sends a heartbeat notification that is expected to be received by a Listener
+	Heartbeat func(ctx context.Context) error
+
+	// NotificationDone is called by a projector once the notification it was triggered with is projected.
+	// The error is nil when the notification was projected successfully.
+	NotificationDone func(err error)
+)
+
+// notificationDoneKey is the context key of a notificationDoneClaim
+type notificationDoneKey struct{}
+
+// notificationDoneClaim contains the NotificationDone of a trigger and if a projector claimed it
+type notificationDoneClaim struct {
+	done    NotificationDone
+	claimed int32
+}
 
 // Listener listens to a event stream and triggers a notification when a event was appended
 type Listener interface {
 	// Listen starts listening to the event stream and call the trigger when a event was appended
 	Listen(ctx context.Context, trigger ProjectionTrigger) error
 }
+
+// WithNotificationDone returns a context used to trigger a notification of which the Listener needs to know when it is
+// projected, for example to acknowledge a message only after it was projected.
+//
+// A projector that projects notifications in the background claims the done func and calls it once the notification
+// was projected or failed to be projected, this includes when the trigger returns an error. When the projector stops
+// before the notification was projected the done func is not called.
+// The returned claimed func reports if the done func was claimed, when it was not the notification was projected or
+// ignored by the time the trigger returned.
+func WithNotificationDone(ctx context.Context, done NotificationDone) (context.Context, func() bool) {
+	claim := &notificationDoneClaim{done: done}
+
+	return context.WithValue(ctx, notificationDoneKey{}, claim), func() bool {
+		return atomic.LoadInt32(&claim.claimed) == 1
+	}
+}
+
+// claimNotificationDone returns the NotificationDone of the context and marks it as claimed.
+// nil is returned when the context has no NotificationDone or when it was already claimed.
+func claimNotificationDone(ctx context.Context) NotificationDone {
+	claim, ok := ctx.Value(notificationDoneKey{}).(*notificationDoneClaim)
+	if !ok || !atomic.CompareAndSwapInt32(&claim.claimed, 0, 1) {
+		return nil
+	}
+
+	return claim.done
+}
+
+// notificationDoneAfter returns a NotificationDone that calls done with the first error once it was called count times
+func notificationDoneAfter(count int, done NotificationDone) NotificationDone {
+	var (
+		mux      sync.Mutex
+		firstErr error
+	)
+	return func(err error) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		count--
+		if count == 0 {
+			done(firstErr)
+		}
+	}
+}
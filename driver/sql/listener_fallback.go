@@ -0,0 +1,201 @@
+package sql
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/hellofresh/goengine"
+)
+
+// Ensure FallbackListener implements Listener
+var _ Listener = &FallbackListener{}
+
+// FallbackListener is a Listener that listens using a primary Listener and falls back to a secondary Listener when the
+// primary Listener is unable to listen.
+// This can for example be used to listen using postgres LISTEN/NOTIFY and fall back to polling the event store.
+type FallbackListener struct {
+	primary  Listener
+	fallback Listener
+
+	heartbeat         Heartbeat
+	heartbeatInterval time.Duration
+	heartbeatTimeout  time.Duration
+
+	logger goengine.Logger
+}
+
+// NewFallbackListener returns a new FallbackListener
+func NewFallbackListener(primary Listener, fallback Listener, logger goengine.Logger) (*FallbackListener, error) {
+	switch {
+	case primary == nil:
+		return nil, goengine.InvalidArgumentError("primary")
+	case fallback == nil:
+		return nil, goengine.InvalidArgumentError("fallback")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	return &FallbackListener{
+		primary:  primary,
+		fallback: fallback,
+		logger:   logger,
+	}, nil
+}
+
+// WithHeartbeat enables a liveness check of the primary Listener.
+// Every interval the heartbeat is send and when the primary Listener does not receive a notification within the
+// timeout the fallback Listener is used.
+// This detects a primary Listener that is able to listen but never receives notifications, for example when
+// LISTEN is executed through PgBouncer in transaction mode.
+func (l *FallbackListener) WithHeartbeat(heartbeat Heartbeat, interval time.Duration, timeout time.Duration) {
+	l.heartbeat = heartbeat
+	l.heartbeatInterval = interval
+	l.heartbeatTimeout = timeout
+}
+
+// Listen starts listening using the primary Listener.
+// When the primary Listener returns an error that was not produced by the trigger or the primary Listener did not
+// receive a heartbeat the fallback Listener is used.
+// Heartbeat notifications are never passed to the trigger.
+func (l *FallbackListener) Listen(ctx context.Context, trigger ProjectionTrigger) error {
+	primaryCtx, stopPrimary := context.WithCancel(ctx)
+	defer stopPrimary()
+
+	var (
+		triggerErr   error
+		unresponsive int32
+	)
+	liveness := newListenerLiveness()
+	if l.heartbeat != nil {
+		go func() {
+			if !l.monitor(primaryCtx, liveness) {
+				atomic.StoreInt32(&unresponsive, 1)
+				stopPrimary()
+			}
+		}()
+	}
+
+	err := l.primary.Listen(primaryCtx, func(ctx context.Context, notification *ProjectionNotification) error {
+		liveness.received()
+		if notification.IsHeartbeat() {
+			return nil
+		}
+
+		liveness.busy(true)
+		defer liveness.busy(false)
+
+		triggerErr = trigger(ctx, notification)
+		return triggerErr
+	})
+
+	switch {
+	case atomic.LoadInt32(&unresponsive) == 1:
+		err = errPrimaryListenerUnresponsive
+	case err == nil:
+		return nil
+	case err == triggerErr:
+		// The trigger failed so falling back would not help
+		return err
+	}
+
+	// Check if the context is expired
+	select {
+	default:
+	case <-ctx.Done():
+		return err
+	}
+
+	l.logger.Warn("primary listener failed, falling back", func(e goengine.LoggerEntry) {
+		e.Error(err)
+	})
+
+	return l.fallback.Listen(ctx, trigger)
+}
+
+// monitor sends heartbeats and returns false when the primary listener did not receive a notification in time
+func (l *FallbackListener) monitor(ctx context.Context, liveness *listenerLiveness) bool {
+	ticker := time.NewTicker(l.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-ticker.C:
+		}
+
+		liveness.reset()
+		if err := l.heartbeat(ctx); err != nil {
+			// Failing to send a heartbeat says nothing about the primary listener so try again on the next tick
+			l.logger.Warn("failed to send listener heartbeat", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+			continue
+		}
+
+		if !liveness.wait(ctx, l.heartbeatTimeout) {
+			return false
+		}
+	}
+}
+
+// listenerLiveness keeps track of the notifications received by a Listener
+type listenerLiveness struct {
+	notified  chan struct{}
+	triggered int32
+}
+
+func newListenerLiveness() *listenerLiveness {
+	return &listenerLiveness{
+		notified: make(chan struct{}, 1),
+	}
+}
+
+// received marks that a notification was received
+func (l *listenerLiveness) received() {
+	select {
+	case l.notified <- struct{}{}:
+	default:
+	}
+}
+
+// busy marks that the listener is, or no longer is, waiting for the trigger
+func (l *listenerLiveness) busy(busy bool) {
+	if busy {
+		atomic.StoreInt32(&l.triggered, 1)
+	} else {
+		atomic.StoreInt32(&l.triggered, 0)
+	}
+}
+
+// reset forgets about notifications received before
+func (l *listenerLiveness) reset() {
+	select {
+	case <-l.notified:
+	default:
+	}
+}
+
+// wait returns false when no notification was received within the timeout.
+// A listener that is waiting for the trigger can't receive a notification so the timeout is extended.
+func (l *listenerLiveness) wait(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-l.notified:
+			return true
+		case <-timer.C:
+			if atomic.LoadInt32(&l.triggered) == 0 {
+				return false
+			}
+			timer.Reset(timeout)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// +build unit
+
+package sql_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listenerFunc func(ctx context.Context, trigger sql.ProjectionTrigger) error
+
+func (f listenerFunc) Listen(ctx context.Context, trigger sql.ProjectionTrigger) error {
+	return f(ctx, trigger)
+}
+
+func TestNewFallbackListener(t *testing.T) {
+	listener := listenerFunc(func(context.Context, sql.ProjectionTrigger) error { return nil })
+
+	_, err := sql.NewFallbackListener(nil, listener, nil)
+	assert.Equal(t, goengine.InvalidArgumentError("primary"), err)
+
+	_, err = sql.NewFallbackListener(listener, nil, nil)
+	assert.Equal(t, goengine.InvalidArgumentError("fallback"), err)
+}
+
+func TestFallbackListener_Listen(t *testing.T) {
+	noTrigger := func(context.Context, *sql.ProjectionNotification) error { return nil }
+
+	t.Run("Primary listener stops", func(t *testing.T) {
+		listener, err := sql.NewFallbackListener(
+			listenerFunc(func(context.Context, sql.ProjectionTrigger) error { return nil }),
+			listenerFunc(func(context.Context, sql.ProjectionTrigger) error {
+				t.Error("fallback listener should not be used")
+				return nil
+			}),
+			nil,
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, listener.Listen(context.Background(), noTrigger))
+	})
+
+	t.Run("Primary listener fails", func(t *testing.T) {
+		var fallbackCalls int
+		listener, err := sql.NewFallbackListener(
+			listenerFunc(func(context.Context, sql.ProjectionTrigger) error {
+				return errors.New("cannot execute LISTEN during recovery")
+			}),
+			listenerFunc(func(ctx context.Context, trigger sql.ProjectionTrigger) error {
+				fallbackCalls++
+				return trigger(ctx, nil)
+			}),
+			nil,
+		)
+		assert.NoError(t, err)
+
+		assert.NoError(t, listener.Listen(context.Background(), noTrigger))
+		assert.Equal(t, 1, fallbackCalls)
+	})
+
+	t.Run("Trigger fails", func(t *testing.T) {
+		expectedErr := errors.New("projection failed")
+		listener, err := sql.NewFallbackListener(
+			listenerFunc(func(ctx context.Context, trigger sql.ProjectionTrigger) error {
+				return trigger(ctx, nil)
+			}),
+			listenerFunc(func(context.Context, sql.ProjectionTrigger) error {
+				t.Error("fallback listener should not be used")
+				return nil
+			}),
+			nil,
+		)
+		assert.NoError(t, err)
+
+		err = listener.Listen(context.Background(), func(context.Context, *sql.ProjectionNotification) error {
+			return expectedErr
+		})
+		assert.Equal(t, expectedErr, err)
+	})
+	t.Run("Primary listener receives heartbeats", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		heartbeats := make(chan struct{}, 10)
+		var sendHeartbeats int32
+		listener, err := sql.NewFallbackListener(
+			listenerFunc(func(ctx context.Context, trigger sql.ProjectionTrigger) error {
+				for {
+					select {
+					case <-ctx.Done():
+						return nil
+					case <-heartbeats:
+						if err := trigger(ctx, &sql.ProjectionNotification{}); err != nil {
+							return err
+						}
+					}
+				}
+			}),
+			listenerFunc(func(context.Context, sql.ProjectionTrigger) error {
+				t.Error("fallback listener should not be used")
+				return nil
+			}),
+			nil,
+		)
+		require.NoError(t, err)
+		listener.WithHeartbeat(func(context.Context) error {
+			atomic.AddInt32(&sendHeartbeats, 1)
+			heartbeats <- struct{}{}
+			return nil
+		}, 10*time.Millisecond, 50*time.Millisecond)
+
+		err = listener.Listen(ctx, func(context.Context, *sql.ProjectionNotification) error {
+			t.Error("heartbeat notifications should not be triggered")
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, atomic.LoadInt32(&sendHeartbeats) > 1)
+	})
+
+	t.Run("Primary listener does not receive heartbeats", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var fallbackCalls int
+		listener, err := sql.NewFallbackListener(
+			listenerFunc(func(ctx context.Context, trigger sql.ProjectionTrigger) error {
+				if err := trigger(ctx, nil); err != nil {
+					return err
+				}
+
+				<-ctx.Done()
+				return nil
+			}),
+			listenerFunc(func(ctx context.Context, trigger sql.ProjectionTrigger) error {
+				fallbackCalls++
+				return trigger(ctx, nil)
+			}),
+			nil,
+		)
+		require.NoError(t, err)
+		listener.WithHeartbeat(func(context.Context) error {
+			return nil
+		}, 10*time.Millisecond, 20*time.Millisecond)
+
+		var triggerCalls int
+		err = listener.Listen(ctx, func(context.Context, *sql.ProjectionNotification) error {
+			triggerCalls++
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, fallbackCalls)
+		assert.Equal(t, 2, triggerCalls)
+		assert.NoError(t, ctx.Err(), "fallback should be used before the context expires")
+	})
+}
@@ -0,0 +1,64 @@
+// +build unit
+
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithNotificationDone(t *testing.T) {
+	t.Run("Claim the done func once", func(t *testing.T) {
+		var projected []error
+		ctx, claimed := WithNotificationDone(context.Background(), func(err error) {
+			projected = append(projected, err)
+		})
+		assert.False(t, claimed())
+
+		done := claimNotificationDone(ctx)
+		if assert.NotNil(t, done) {
+			done(nil)
+		}
+		assert.True(t, claimed())
+		assert.Nil(t, claimNotificationDone(ctx))
+		assert.Equal(t, []error{nil}, projected)
+	})
+
+	t.Run("No done func", func(t *testing.T) {
+		assert.Nil(t, claimNotificationDone(context.Background()))
+	})
+}
+
+func TestNotificationDoneAfter(t *testing.T) {
+	var projected []error
+	done := notificationDoneAfter(3, func(err error) {
+		projected = append(projected, err)
+	})
+
+	projectErr := errors.New("failed")
+	done(nil)
+	done(projectErr)
+	assert.Empty(t, projected)
+
+	done(nil)
+	assert.Equal(t, []error{projectErr}, projected)
+}
+
+func TestProjectionNotification_projected(t *testing.T) {
+	var projected []error
+	notification := &ProjectionNotification{No: 1, done: func(err error) {
+		projected = append(projected, err)
+	}}
+
+	notification.projected(nil)
+	notification.projected(nil)
+	assert.Equal(t, []error{nil}, projected)
+
+	var nilNotification *ProjectionNotification
+	assert.NotPanics(t, func() {
+		nilNotification.projected(nil)
+	})
+}
@@ -1,13 +1,24 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/hellofresh/goengine"
 )
 
-// MessageFactory reconstruct messages from the database
-type MessageFactory interface {
-	// CreateEventStream reconstructs the message from the provided rows
-	CreateEventStream(rows *sql.Rows) (goengine.EventStream, error)
-}
+type (
+	// MessageFactory reconstruct messages from the database
+	MessageFactory interface {
+		// CreateEventStream reconstructs the message from the provided rows
+		CreateEventStream(rows *sql.Rows) (goengine.EventStream, error)
+	}
+
+	// ContextMessageFactory is a MessageFactory that uses the context of the caller while reconstructing the messages
+	ContextMessageFactory interface {
+		MessageFactory
+
+		// CreateEventStreamWithContext reconstructs the message from the provided rows using the provided context
+		CreateEventStreamWithContext(ctx context.Context, rows *sql.Rows) (goengine.EventStream, error)
+	}
+)
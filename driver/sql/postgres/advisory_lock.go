@@ -30,20 +30,7 @@ func (t *advisoryLockProjectorTransaction) AcquireState(ctx context.Context) (dr
 		return t.projectionState, nil
 	}
 
-	var err error
-	state := driverSQL.ProjectionState{
-		Position: t.rawState.Position,
-	}
-
-	// Decode or initialize projection state
-	if state.Position == 0 {
-		// This is the fist time the projection runs so initialize the state
-		state.ProjectionState, err = t.stateSerialization.Init(ctx)
-	} else {
-		// Unmarshal the projection state
-		state.ProjectionState, err = t.stateSerialization.DecodeState(t.rawState.ProjectionState)
-	}
-
+	state, err := decodeProjectionState(ctx, t.stateSerialization, t.rawState)
 	if err != nil {
 		return state, err
 	}
@@ -126,3 +113,26 @@ func (t *advisoryLockWithUpdateProjectorTransaction) Close() error {
 
 	return t.advisoryLockProjectorTransaction.Close()
 }
+
+// decodeProjectionState decodes the raw projection state or initializes it when the projection never ran
+func decodeProjectionState(
+	ctx context.Context,
+	stateSerialization driverSQL.ProjectionStateSerialization,
+	rawState *driverSQL.ProjectionRawState,
+) (driverSQL.ProjectionState, error) {
+	var err error
+	state := driverSQL.ProjectionState{
+		Position: rawState.Position,
+	}
+
+	// Decode or initialize projection state
+	if state.Position == 0 {
+		// This is the fist time the projection runs so initialize the state
+		state.ProjectionState, err = stateSerialization.Init(ctx)
+	} else {
+		// Unmarshal the projection state
+		state.ProjectionState, err = stateSerialization.DecodeState(rawState.ProjectionState)
+	}
+
+	return state, err
+}
@@ -11,10 +11,17 @@ import (
 	"github.com/pkg/errors"
 )
 
-var _ driverSQL.AggregateProjectorStorage = &AdvisoryLockAggregateProjectionStorage{}
+var (
+	_ driverSQL.AggregateProjectorStorage = &AdvisoryLockAggregateProjectionStorage{}
+	_ driverSQL.VersionedProjectorStorage = &AdvisoryLockAggregateProjectionStorage{}
+)
 
 // AdvisoryLockAggregateProjectionStorage is a AggregateProjectorStorage that uses a advisory locks to lock a projection
+// The lock is based on the name of the projection table and the aggregate id so that the lock stays the same when the
+// projection table is replaced by a ProjectionRebuild.
 type AdvisoryLockAggregateProjectionStorage struct {
+	*aggregateProjectionVersion
+
 	stateSerialization driverSQL.ProjectionStateSerialization
 	useLockField       bool
 
@@ -24,6 +31,7 @@ type AdvisoryLockAggregateProjectionStorage struct {
 	queryPersistState         string
 	queryPersistFailure       string
 	queryAcquireLock          string
+	queryAcquireVersionedLock string
 	queryReleaseLock          string
 	querySetRowLocked         string
 }
@@ -54,22 +62,12 @@ func NewAdvisoryLockAggregateProjectionStorage(
 
 	/* #nosec G201 */
 	return &AdvisoryLockAggregateProjectionStorage{
-		stateSerialization: projectionStateSerialization,
-		useLockField:       useLockField,
-		logger:             logger,
-
-		queryOutOfSyncProjections: fmt.Sprintf(
-			`WITH aggregate_position AS (
-			   SELECT e.aggregate_id, MAX(e.no) AS no
-		        FROM %[1]s AS e
-			   GROUP BY aggregate_id
-			 )
-			 SELECT a.aggregate_id, a.no FROM aggregate_position AS a
-			   LEFT JOIN %[2]s AS p ON p.aggregate_id = a.aggregate_id
-			 WHERE p.aggregate_id IS NULL OR (a.no > p.position)`,
-			eventStoreTableQuoted,
-			projectionTableQuoted,
-		),
+		aggregateProjectionVersion: newAggregateProjectionVersion(projectionTableQuoted),
+		stateSerialization:         projectionStateSerialization,
+		useLockField:               useLockField,
+		logger:                     logger,
+
+		queryOutOfSyncProjections: aggregateOutOfSyncProjectionsQuery(eventStoreTableQuoted, projectionTableQuoted),
 		queryPersistState: fmt.Sprintf(
 			`UPDATE %[1]s SET position = $2, state = $3 WHERE aggregate_id = $1`,
 			projectionTableQuoted,
@@ -78,24 +76,8 @@ func NewAdvisoryLockAggregateProjectionStorage(
 			`UPDATE %[1]s SET failed = TRUE WHERE aggregate_id = $1`,
 			projectionTableQuoted,
 		),
-		// queryAcquireLock uses a `WITH` in order to insert if the projection is unknown other wise the row won't be locked
-		// The reason for using `INSERT SELECT` instead of `INSERT VALUES ON CONFLICT DO NOTHING` is that `ON CONFLICT` will
-		// increase the `no SERIAL` value.
-		queryAcquireLock: fmt.Sprintf(
-			`WITH projection AS (
-				SELECT no, locked, failed, position, state FROM %[1]s WHERE aggregate_id = $1
-			), new_projection AS (
-			  INSERT INTO %[1]s (aggregate_id, state) SELECT $1, 'null' WHERE NOT EXISTS (
-		    	 SELECT projection.no FROM projection
-			  ) ON CONFLICT DO NOTHING
-			  RETURNING *
-			)
-			SELECT pg_try_advisory_lock(%[2]s::regclass::oid::int, no), locked, failed, position, state FROM new_projection
-			UNION
-			SELECT pg_try_advisory_lock(%[2]s::regclass::oid::int, no), locked, failed, position, state FROM projection WHERE (position < $2 OR failed)`,
-			projectionTableQuoted,
-			projectionTableStr,
-		),
+		queryAcquireLock:          advisoryLockAggregateAcquireLockQuery(projectionTableQuoted, projectionTableStr, false),
+		queryAcquireVersionedLock: advisoryLockAggregateAcquireLockQuery(projectionTableQuoted, projectionTableStr, true),
 		queryReleaseLock: fmt.Sprintf(
 			`SELECT pg_advisory_unlock(%[2]s::regclass::oid::int, no) FROM %[1]s WHERE aggregate_id = $1`,
 			projectionTableQuoted,
@@ -132,7 +114,12 @@ func (a *AdvisoryLockAggregateProjectionStorage) Acquire(
 	}
 	aggregateID := notification.AggregateID
 
-	res := conn.QueryRowContext(ctx, a.queryAcquireLock, aggregateID, notification.No)
+	var res *sql.Row
+	if version, versioned := a.projectionVersion(); versioned {
+		res = conn.QueryRowContext(ctx, a.queryAcquireVersionedLock, aggregateID, notification.No, version)
+	} else {
+		res = conn.QueryRowContext(ctx, a.queryAcquireLock, aggregateID, notification.No)
+	}
 
 	var (
 		acquiredLock, locked, failed bool
@@ -204,3 +191,49 @@ func (a *AdvisoryLockAggregateProjectionStorage) releaseProjectionConnectionLock
 
 	return nil
 }
+
+// advisoryLockAggregateAcquireLockQuery returns the query used to acquire the advisory lock of a aggregate projection.
+// When versioned is true the version of a new projection is provided as the third argument.
+func advisoryLockAggregateAcquireLockQuery(projectionTableQuoted, projectionTableStr string, versioned bool) string {
+	insert := `INSERT INTO %[1]s (aggregate_id, state) SELECT $1, 'null'`
+	if versioned {
+		insert = `INSERT INTO %[1]s (aggregate_id, state, version) SELECT $1, 'null', $3`
+	}
+
+	// The query uses a `WITH` in order to insert if the projection is unknown other wise the row won't be locked
+	// The reason for using `INSERT SELECT` instead of `INSERT VALUES ON CONFLICT DO NOTHING` is that `ON CONFLICT` will
+	// increase the `no SERIAL` value.
+	/* #nosec G201 */
+	return fmt.Sprintf(
+		`WITH projection AS (
+			SELECT no, locked, failed, position, state FROM %[1]s WHERE aggregate_id = $1
+		), new_projection AS (
+		  `+insert+` WHERE NOT EXISTS (
+	    	 SELECT projection.no FROM projection
+		  ) ON CONFLICT DO NOTHING
+		  RETURNING *
+		)
+		SELECT pg_try_advisory_lock(%[2]s::regclass::oid::int, no), locked, failed, position, state FROM new_projection
+		UNION
+		SELECT pg_try_advisory_lock(%[2]s::regclass::oid::int, no), locked, failed, position, state FROM projection WHERE (position < $2 OR failed)`,
+		projectionTableQuoted,
+		projectionTableStr,
+	)
+}
+
+// aggregateOutOfSyncProjectionsQuery returns the query used to find the aggregate projections that are behind the event store
+func aggregateOutOfSyncProjectionsQuery(eventStoreTableQuoted, projectionTableQuoted string) string {
+	/* #nosec G201 */
+	return fmt.Sprintf(
+		`WITH aggregate_position AS (
+		   SELECT e.aggregate_id, MAX(e.no) AS no
+		    FROM %[1]s AS e
+		   GROUP BY aggregate_id
+		 )
+		 SELECT a.aggregate_id, a.no FROM aggregate_position AS a
+		   LEFT JOIN %[2]s AS p ON p.aggregate_id = a.aggregate_id
+		 WHERE p.aggregate_id IS NULL OR (a.no > p.position)`,
+		eventStoreTableQuoted,
+		projectionTableQuoted,
+	)
+}
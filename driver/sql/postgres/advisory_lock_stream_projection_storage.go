@@ -11,10 +11,19 @@ import (
 	driverSQL "github.com/hellofresh/goengine/driver/sql"
 )
 
-var _ driverSQL.StreamProjectorStorage = &AdvisoryLockStreamProjectionStorage{}
+var (
+	_ driverSQL.StreamProjectorStorage      = &AdvisoryLockStreamProjectionStorage{}
+	_ driverSQL.VersionedProjectorStorage   = &AdvisoryLockStreamProjectionStorage{}
+	_ driverSQL.StreamProjectionNamesLoader = &AdvisoryLockStreamProjectionStorage{}
+)
 
 // AdvisoryLockStreamProjectionStorage is a StreamProjectorStorage that uses a advisory locks to lock a projection
+// The lock is based on the names of the projection table and the projection so that the lock stays the same when the
+// projection table is replaced by a ProjectionRebuild.
 type AdvisoryLockStreamProjectionStorage struct {
+	streamProjectionVersion
+	streamProjectionNames
+
 	projectionName               string
 	projectionStateSerialization driverSQL.ProjectionStateSerialization
 	useLockField                 bool
@@ -55,6 +64,8 @@ func NewAdvisoryLockStreamProjectionStorage(
 
 	/* #nosec G201 */
 	return &AdvisoryLockStreamProjectionStorage{
+		streamProjectionVersion:      newStreamProjectionVersion(projectionName, projectionTableQuoted),
+		streamProjectionNames:        newStreamProjectionNames(projectionTableQuoted),
 		projectionName:               projectionName,
 		projectionStateSerialization: projectionStateSerialization,
 		useLockField:                 useLockField,
@@ -4,11 +4,15 @@ package postgres_test
 
 import (
 	"context"
+	dbSQL "database/sql"
 	"errors"
 	"testing"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
 	"github.com/golang/mock/gomock"
 	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
 	"github.com/hellofresh/goengine/driver/sql/postgres"
 	"github.com/hellofresh/goengine/mocks/driver/sql"
 	"github.com/stretchr/testify/assert"
@@ -48,3 +52,27 @@ func TestAdvisoryLockStreamProjectionStorage_CreateProjection(t *testing.T) {
 	err = storage.CreateProjection(ctx, mockDB)
 	assert.Equal(t, expectedErr, err)
 }
+
+func TestAdvisoryLockStreamProjectionStorage_Acquire(t *testing.T) {
+	test.RunWithMockDB(t, "Lock on the projection table and row", func(t *testing.T, db *dbSQL.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		// The lock key must stay the same so projectors of different versions never project at the same time
+		dbMock.ExpectQuery(`SELECT pg_try_advisory_lock\('projections'::regclass::oid::int, no\), locked, position, state FROM "projections" WHERE name = \$1`).
+			WithArgs("my_projection").
+			WillReturnRows(sqlmock.NewRows([]string{"lock", "locked", "position", "state"}).AddRow(false, false, 0, []byte("{}")))
+
+		storage, err := postgres.NewAdvisoryLockStreamProjectionStorage("my_projection", "projections", sql.NewProjectionStateSerialization(ctrl), false, nil)
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, _, err = storage.Acquire(ctx, conn, nil)
+		assert.Equal(t, driverSQL.ErrProjectionFailedToLock, err)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+
+	"github.com/hellofresh/goengine"
+)
+
+// Ensure BlobStore implements goengine.BlobStore
+var _ goengine.BlobStore = &BlobStore{}
+
+// BlobStore is a goengine.BlobStore that stores the blobs as postgres large objects.
+// The reference of a blob is the oid of the large object.
+type BlobStore struct {
+	db *sql.DB
+}
+
+// NewBlobStore returns a new BlobStore
+func NewBlobStore(db *sql.DB) (*BlobStore, error) {
+	if db == nil {
+		return nil, goengine.InvalidArgumentError("db")
+	}
+
+	return &BlobStore{db: db}, nil
+}
+
+// Put stores the data as a new large object and returns the oid of the large object as the reference
+func (s *BlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	var oid uint32
+	if err := s.db.QueryRowContext(ctx, `SELECT lo_from_bytea(0, $1)`, data).Scan(&oid); err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(uint64(oid), 10), nil
+}
+
+// Get returns the data of the large object or goengine.ErrBlobNotFound when the large object does not exist
+func (s *BlobStore) Get(ctx context.Context, reference string) ([]byte, error) {
+	oid, err := strconv.ParseUint(reference, 10, 32)
+	if err != nil {
+		return nil, goengine.InvalidArgumentError("reference")
+	}
+
+	// Selecting from the metadata avoids an error when the large object does not exist
+	var data []byte
+	err = s.db.QueryRowContext(ctx, `SELECT lo_get(oid) FROM pg_largeobject_metadata WHERE oid = $1`, oid).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, goengine.ErrBlobNotFound
+	}
+
+	return data, err
+}
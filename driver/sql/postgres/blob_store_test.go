@@ -0,0 +1,78 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBlobStore(t *testing.T) {
+	store, err := postgres.NewBlobStore(nil)
+
+	assert.Equal(t, goengine.InvalidArgumentError("db"), err)
+	assert.Nil(t, store)
+}
+
+func TestBlobStore_Put(t *testing.T) {
+	test.RunWithMockDB(t, "Store a large object", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT lo_from_bytea\(0, \$1\)`).
+			WithArgs([]byte("document")).
+			WillReturnRows(sqlmock.NewRows([]string{"lo_from_bytea"}).AddRow(16384))
+
+		store, err := postgres.NewBlobStore(db)
+		require.NoError(t, err)
+
+		reference, err := store.Put(context.Background(), []byte("document"))
+		assert.NoError(t, err)
+		assert.Equal(t, "16384", reference)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func TestBlobStore_Get(t *testing.T) {
+	test.RunWithMockDB(t, "Large object exists", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT lo_get\(oid\) FROM pg_largeobject_metadata WHERE oid = \$1`).
+			WithArgs(16384).
+			WillReturnRows(sqlmock.NewRows([]string{"lo_get"}).AddRow([]byte("document")))
+
+		store, err := postgres.NewBlobStore(db)
+		require.NoError(t, err)
+
+		data, err := store.Get(context.Background(), "16384")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("document"), data)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "No large object", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT lo_get\(oid\) FROM pg_largeobject_metadata WHERE oid = \$1`).
+			WithArgs(16384).
+			WillReturnRows(sqlmock.NewRows([]string{"lo_get"}))
+
+		store, err := postgres.NewBlobStore(db)
+		require.NoError(t, err)
+
+		data, err := store.Get(context.Background(), "16384")
+		assert.Equal(t, goengine.ErrBlobNotFound, err)
+		assert.Nil(t, data)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "Invalid reference", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		store, err := postgres.NewBlobStore(db)
+		require.NoError(t, err)
+
+		data, err := store.Get(context.Background(), "not-an-oid")
+		assert.Equal(t, goengine.InvalidArgumentError("reference"), err)
+		assert.Nil(t, data)
+	})
+}
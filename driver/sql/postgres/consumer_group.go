@@ -0,0 +1,478 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/metadata"
+)
+
+var (
+	// Ensure ConsumerGroup implements goengine.ConsumerGroup
+	_ goengine.ConsumerGroup = &ConsumerGroup{}
+	// Ensure consumerGroupDelivery implements goengine.Delivery
+	_ goengine.Delivery = &consumerGroupDelivery{}
+)
+
+// consumerGroupGapTimeout is the duration after which a ConsumerGroup stops waiting for a missing message
+const consumerGroupGapTimeout = 10 * time.Second
+
+// ConsumerGroup is a goengine.ConsumerGroup that stores the checkpoint and deliveries of the group in postgres tables.
+// The consumers of a group can run in separate processes by using the same stream and group name.
+//
+// Message numbers are assigned before a transaction commits, so a message with a lower number can become visible after
+// a message with a higher number. The skipped numbers are stored as deliveries without an attempt, these are delivered
+// once the message becomes visible and acknowledged when the message did not become visible within the gap timeout.
+type ConsumerGroup struct {
+	db         *sql.DB
+	eventStore goengine.ReadOnlyEventStore
+	streamName goengine.StreamName
+	groupName  string
+
+	visibilityTimeout int64
+	gapTimeout        int64
+
+	logger goengine.Logger
+
+	groupCreatedMux sync.Mutex
+	groupCreated    bool
+
+	queryCreateGroup       string
+	queryAdvanceCheckpoint string
+	queryDeleteAcked       string
+	queryLastDelivered     string
+	queryRedeliver         string
+	queryGaps              string
+	queryDeliverGap        string
+	queryTrackGaps         string
+	queryDeliver           string
+	queryAck               string
+	queryNack              string
+	queryCheckpoint        string
+}
+
+// NewConsumerGroup returns a new ConsumerGroup for the stream
+func NewConsumerGroup(
+	db *sql.DB,
+	eventStore goengine.ReadOnlyEventStore,
+	streamName goengine.StreamName,
+	groupName string,
+	groupTable string,
+	deliveryTable string,
+	visibilityTimeout time.Duration,
+	logger goengine.Logger,
+) (*ConsumerGroup, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case eventStore == nil:
+		return nil, goengine.InvalidArgumentError("eventStore")
+	case strings.TrimSpace(string(streamName)) == "":
+		return nil, goengine.InvalidArgumentError("streamName")
+	case strings.TrimSpace(groupName) == "":
+		return nil, goengine.InvalidArgumentError("groupName")
+	case strings.TrimSpace(groupTable) == "":
+		return nil, goengine.InvalidArgumentError("groupTable")
+	case strings.TrimSpace(deliveryTable) == "":
+		return nil, goengine.InvalidArgumentError("deliveryTable")
+	case visibilityTimeout < time.Millisecond:
+		return nil, goengine.InvalidArgumentError("visibilityTimeout")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	logger = logger.WithFields(func(e goengine.LoggerEntry) {
+		e.String("consumer_group", groupName)
+	})
+
+	groupTableQuoted := QuoteIdentifier(groupTable)
+	deliveryTableQuoted := QuoteIdentifier(deliveryTable)
+
+	/* #nosec G201 */
+	return &ConsumerGroup{
+		db:                db,
+		eventStore:        eventStore,
+		streamName:        streamName,
+		groupName:         groupName,
+		visibilityTimeout: visibilityTimeout.Nanoseconds() / int64(time.Millisecond),
+		gapTimeout:        consumerGroupGapTimeout.Nanoseconds() / int64(time.Millisecond),
+		logger:            logger,
+
+		queryCreateGroup: fmt.Sprintf(
+			`INSERT INTO %s (stream_name, name) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+			groupTableQuoted,
+		),
+		// The update locks the group row which ensures only one consumer of the group receives messages at a time
+		queryAdvanceCheckpoint: fmt.Sprintf(
+			`UPDATE %[1]s SET checkpoint = COALESCE(
+				(SELECT MIN(no) - 1 FROM %[2]s WHERE stream_name = $1 AND group_name = $2 AND NOT acked),
+				(SELECT MAX(no) FROM %[2]s WHERE stream_name = $1 AND group_name = $2),
+				checkpoint
+			) WHERE stream_name = $1 AND name = $2 RETURNING checkpoint`,
+			groupTableQuoted,
+			deliveryTableQuoted,
+		),
+		queryDeleteAcked: fmt.Sprintf(
+			`DELETE FROM %s WHERE stream_name = $1 AND group_name = $2 AND no <= $3`,
+			deliveryTableQuoted,
+		),
+		queryLastDelivered: fmt.Sprintf(
+			`SELECT COALESCE(MAX(no), $3) FROM %s WHERE stream_name = $1 AND group_name = $2`,
+			deliveryTableQuoted,
+		),
+		queryRedeliver: fmt.Sprintf(
+			`UPDATE %[1]s SET attempt = attempt + 1, visible_at = NOW() + $4 * INTERVAL '1 millisecond'
+			 WHERE stream_name = $1 AND group_name = $2 AND no IN (
+				SELECT no FROM %[1]s WHERE stream_name = $1 AND group_name = $2 AND NOT acked AND visible_at <= NOW() ORDER BY no LIMIT $3
+			 ) RETURNING no, attempt`,
+			deliveryTableQuoted,
+		),
+		queryGaps: fmt.Sprintf(
+			`SELECT no FROM %s WHERE stream_name = $1 AND group_name = $2 AND attempt = 0 AND NOT acked ORDER BY no LIMIT $3`,
+			deliveryTableQuoted,
+		),
+		queryDeliverGap: fmt.Sprintf(
+			`UPDATE %s SET attempt = 1, visible_at = NOW() + $4 * INTERVAL '1 millisecond' WHERE stream_name = $1 AND group_name = $2 AND no = $3`,
+			deliveryTableQuoted,
+		),
+		queryTrackGaps: fmt.Sprintf(
+			`INSERT INTO %s (stream_name, group_name, no, attempt, visible_at)
+			 SELECT $1, $2, generate_series($3::BIGINT, $4::BIGINT), 0, NOW() + $5 * INTERVAL '1 millisecond'`,
+			deliveryTableQuoted,
+		),
+		queryDeliver: fmt.Sprintf(
+			`INSERT INTO %s (stream_name, group_name, no, attempt, visible_at) VALUES ($1, $2, $3, 1, NOW() + $4 * INTERVAL '1 millisecond')`,
+			deliveryTableQuoted,
+		),
+		queryAck: fmt.Sprintf(
+			`UPDATE %s SET acked = TRUE WHERE stream_name = $1 AND group_name = $2 AND no = $3`,
+			deliveryTableQuoted,
+		),
+		queryNack: fmt.Sprintf(
+			`UPDATE %s SET visible_at = NOW() WHERE stream_name = $1 AND group_name = $2 AND no = $3 AND attempt = $4 AND NOT acked`,
+			deliveryTableQuoted,
+		),
+		queryCheckpoint: fmt.Sprintf(
+			`SELECT COALESCE(
+				(SELECT MIN(no) - 1 FROM %[2]s WHERE stream_name = $1 AND group_name = $2 AND NOT acked),
+				(SELECT MAX(no) FROM %[2]s WHERE stream_name = $1 AND group_name = $2),
+				(SELECT checkpoint FROM %[1]s WHERE stream_name = $1 AND name = $2),
+				0
+			)`,
+			groupTableQuoted,
+			deliveryTableQuoted,
+		),
+	}, nil
+}
+
+// Receive returns at most count messages that are not acknowledged and not delivered to another consumer
+func (c *ConsumerGroup) Receive(ctx context.Context, count uint) ([]goengine.Delivery, error) {
+	if err := c.createGroup(ctx); err != nil {
+		return nil, err
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			c.logger.Warn("failed to rollback consumer group transaction", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	var checkpoint int64
+	if err := tx.QueryRowContext(ctx, c.queryAdvanceCheckpoint, c.streamName, c.groupName).Scan(&checkpoint); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, c.queryDeleteAcked, c.streamName, c.groupName, checkpoint); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := c.redeliver(ctx, tx, count)
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining := count - uint(len(deliveries)); remaining > 0 {
+		gapDeliveries, err := c.deliverGaps(ctx, tx, remaining)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, gapDeliveries...)
+	}
+
+	if remaining := count - uint(len(deliveries)); remaining > 0 {
+		newDeliveries, err := c.deliver(ctx, tx, checkpoint, remaining)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, newDeliveries...)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Checkpoint returns the number of the last message that was acknowledged together with all messages before it
+func (c *ConsumerGroup) Checkpoint(ctx context.Context) (int64, error) {
+	var checkpoint int64
+	err := c.db.QueryRowContext(ctx, c.queryCheckpoint, c.streamName, c.groupName).Scan(&checkpoint)
+
+	return checkpoint, err
+}
+
+// createGroup creates the row of the group in the group table the first time it's called
+func (c *ConsumerGroup) createGroup(ctx context.Context) error {
+	c.groupCreatedMux.Lock()
+	defer c.groupCreatedMux.Unlock()
+
+	if c.groupCreated {
+		return nil
+	}
+
+	if _, err := c.db.ExecContext(ctx, c.queryCreateGroup, c.streamName, c.groupName); err != nil {
+		return err
+	}
+	c.groupCreated = true
+
+	return nil
+}
+
+// redeliver returns the deliveries of which the visibility or gap timeout expired
+func (c *ConsumerGroup) redeliver(ctx context.Context, tx *sql.Tx, count uint) ([]goengine.Delivery, error) {
+	rows, err := tx.QueryContext(ctx, c.queryRedeliver, c.streamName, c.groupName, count, c.visibilityTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	type redelivery struct {
+		no      int64
+		attempt int
+	}
+	var redeliveries []redelivery
+	for rows.Next() {
+		var r redelivery
+		if err := rows.Scan(&r.no, &r.attempt); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		redeliveries = append(redeliveries, r)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	var deliveries []goengine.Delivery
+	for _, r := range redeliveries {
+		messages, numbers, err := c.load(ctx, r.no, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(messages) == 0 || numbers[0] != r.no {
+			// The message is no longer or never became visible in the stream so there is nothing to deliver
+			if _, err := tx.ExecContext(ctx, c.queryAck, c.streamName, c.groupName, r.no); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		deliveries = append(deliveries, c.newDelivery(messages[0], r.no, r.attempt))
+	}
+
+	return deliveries, nil
+}
+
+// deliverGaps returns the deliveries for the missing messages that became visible
+func (c *ConsumerGroup) deliverGaps(ctx context.Context, tx *sql.Tx, count uint) ([]goengine.Delivery, error) {
+	rows, err := tx.QueryContext(ctx, c.queryGaps, c.streamName, c.groupName, count)
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps []int64
+	for rows.Next() {
+		var no int64
+		if err := rows.Scan(&no); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		gaps = append(gaps, no)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	var deliveries []goengine.Delivery
+	for _, no := range gaps {
+		messages, numbers, err := c.load(ctx, no, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(messages) == 0 || numbers[0] != no {
+			// The message is not visible yet
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, c.queryDeliverGap, c.streamName, c.groupName, no, c.visibilityTimeout); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, c.newDelivery(messages[0], no, 1))
+	}
+
+	return deliveries, nil
+}
+
+// deliver returns the deliveries for the messages after the last delivered message and tracks the skipped numbers
+func (c *ConsumerGroup) deliver(ctx context.Context, tx *sql.Tx, checkpoint int64, count uint) ([]goengine.Delivery, error) {
+	var lastDelivered int64
+	if err := tx.QueryRowContext(ctx, c.queryLastDelivered, c.streamName, c.groupName, checkpoint).Scan(&lastDelivered); err != nil {
+		return nil, err
+	}
+
+	messages, numbers, err := c.load(ctx, lastDelivered+1, count)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]goengine.Delivery, 0, len(messages))
+	for i, message := range messages {
+		if missing := lastDelivered + 1; missing < numbers[i] {
+			if err := c.trackGaps(ctx, tx, missing, numbers[i]-1); err != nil {
+				return nil, err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, c.queryDeliver, c.streamName, c.groupName, numbers[i], c.visibilityTimeout); err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, c.newDelivery(message, numbers[i], 1))
+		lastDelivered = numbers[i]
+	}
+
+	return deliveries, nil
+}
+
+// trackGaps stores the missing message numbers from and up to the provided numbers as deliveries without an attempt
+func (c *ConsumerGroup) trackGaps(ctx context.Context, tx *sql.Tx, from, to int64) error {
+	if to-from >= maxTrackedGaps {
+		c.logger.Warn("too many missing messages not all will be delivered", func(e goengine.LoggerEntry) {
+			e.Int64("from", from)
+			e.Int64("to", to)
+		})
+		to = from + maxTrackedGaps - 1
+	}
+
+	_, err := tx.ExecContext(ctx, c.queryTrackGaps, c.streamName, c.groupName, from, to, c.gapTimeout)
+	return err
+}
+
+func (c *ConsumerGroup) load(ctx context.Context, fromNumber int64, count uint) ([]goengine.Message, []int64, error) {
+	stream, err := c.eventStore.Load(ctx, c.streamName, fromNumber, &count, metadata.NewMatcher())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err := stream.Close(); err != nil {
+			c.logger.Warn("failed to close the consumer group event stream", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	return goengine.ReadEventStream(stream)
+}
+
+func (c *ConsumerGroup) newDelivery(message goengine.Message, messageNumber int64, attempt int) *consumerGroupDelivery {
+	return &consumerGroupDelivery{
+		group:         c,
+		message:       message,
+		messageNumber: messageNumber,
+		attempt:       attempt,
+	}
+}
+
+// consumerGroupDelivery is a message delivered by a ConsumerGroup
+type consumerGroupDelivery struct {
+	group         *ConsumerGroup
+	message       goengine.Message
+	messageNumber int64
+	attempt       int
+}
+
+// Message returns the delivered message and it's number within the stream
+func (d *consumerGroupDelivery) Message() (goengine.Message, int64) {
+	return d.message, d.messageNumber
+}
+
+// Attempt returns the number of times the message was delivered
+func (d *consumerGroupDelivery) Attempt() int {
+	return d.attempt
+}
+
+// Ack acknowledges that the message was handled
+func (d *consumerGroupDelivery) Ack(ctx context.Context) error {
+	_, err := d.group.db.ExecContext(ctx, d.group.queryAck, d.group.streamName, d.group.groupName, d.messageNumber)
+	return err
+}
+
+// Nack indicates that the message was not handled and should be delivered again
+func (d *consumerGroupDelivery) Nack(ctx context.Context) error {
+	res, err := d.group.db.ExecContext(ctx, d.group.queryNack, d.group.streamName, d.group.groupName, d.messageNumber, d.attempt)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return goengine.ErrDeliveryExpired
+	}
+
+	return nil
+}
+
+// ConsumerGroupCreateSchema return the sql statements needed for the postgres database in order to use the ConsumerGroup
+func ConsumerGroupCreateSchema(groupTable, deliveryTable string) []string {
+	/* #nosec G201 */
+	return []string{
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				stream_name VARCHAR(150) NOT NULL,
+				name VARCHAR(150) NOT NULL,
+				checkpoint BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (stream_name, name)
+			)`,
+			QuoteIdentifier(groupTable),
+		),
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				stream_name VARCHAR(150) NOT NULL,
+				group_name VARCHAR(150) NOT NULL,
+				no BIGINT NOT NULL,
+				attempt INTEGER NOT NULL,
+				visible_at TIMESTAMPTZ NOT NULL,
+				acked BOOLEAN NOT NULL DEFAULT FALSE,
+				PRIMARY KEY (stream_name, group_name, no)
+			)`,
+			QuoteIdentifier(deliveryTable),
+		),
+	}
+}
@@ -0,0 +1,229 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConsumerGroup(t *testing.T) {
+	test.RunWithMockDB(t, "Invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := mocks.NewEventStore(ctrl)
+
+		testCases := []struct {
+			title             string
+			db                *sql.DB
+			eventStore        goengine.ReadOnlyEventStore
+			streamName        goengine.StreamName
+			groupName         string
+			groupTable        string
+			deliveryTable     string
+			visibilityTimeout time.Duration
+			expectedError     string
+		}{
+			{"Invalid db", nil, store, "event_stream", "workers", "groups", "deliveries", time.Second, "db"},
+			{"Invalid event store", db, nil, "event_stream", "workers", "groups", "deliveries", time.Second, "eventStore"},
+			{"Invalid stream name", db, store, "", "workers", "groups", "deliveries", time.Second, "streamName"},
+			{"Invalid group name", db, store, "event_stream", " ", "groups", "deliveries", time.Second, "groupName"},
+			{"Invalid group table", db, store, "event_stream", "workers", "", "deliveries", time.Second, "groupTable"},
+			{"Invalid delivery table", db, store, "event_stream", "workers", "groups", "", time.Second, "deliveryTable"},
+			{"Invalid visibility timeout", db, store, "event_stream", "workers", "groups", "deliveries", time.Microsecond, "visibilityTimeout"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				group, err := postgres.NewConsumerGroup(
+					testCase.db,
+					testCase.eventStore,
+					testCase.streamName,
+					testCase.groupName,
+					testCase.groupTable,
+					testCase.deliveryTable,
+					testCase.visibilityTimeout,
+					nil,
+				)
+
+				assert.Nil(t, group)
+				assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedError), err)
+			})
+		}
+	})
+}
+
+func TestConsumerGroup_Receive(t *testing.T) {
+	test.RunWithMockDB(t, "Redeliver expired and deliver new messages", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+		messages := []goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 1, metadata.New(), time.Now()),
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 4, metadata.New(), time.Now()),
+		}
+
+		store := mocks.NewEventStore(ctrl)
+		redeliverCount, deliverCount := uint(1), uint(1)
+		store.EXPECT().Load(ctx, goengine.StreamName("event_stream"), int64(2), &redeliverCount, gomock.Any()).
+			Return(inmemory.NewEventStream(messages[:1], []int64{2}))
+		store.EXPECT().Load(ctx, goengine.StreamName("event_stream"), int64(4), &deliverCount, gomock.Any()).
+			Return(inmemory.NewEventStream(messages[1:], []int64{4}))
+
+		dbMock.ExpectExec(`INSERT INTO "groups" \(stream_name, name\) VALUES \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+			WithArgs("event_stream", "workers").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectBegin()
+		dbMock.ExpectQuery(`UPDATE "groups" SET checkpoint = COALESCE\(.+\) WHERE stream_name = \$1 AND name = \$2 RETURNING checkpoint`).
+			WithArgs("event_stream", "workers").
+			WillReturnRows(sqlmock.NewRows([]string{"checkpoint"}).AddRow(1))
+		dbMock.ExpectExec(`DELETE FROM "deliveries" WHERE stream_name = \$1 AND group_name = \$2 AND no <= \$3`).
+			WithArgs("event_stream", "workers", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectQuery(`UPDATE "deliveries" SET attempt = attempt \+ 1`).
+			WithArgs("event_stream", "workers", 2, 30000).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "attempt"}).AddRow(2, 2))
+		dbMock.ExpectQuery(`SELECT no FROM "deliveries" WHERE stream_name = \$1 AND group_name = \$2 AND attempt = 0`).
+			WithArgs("event_stream", "workers", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"no"}))
+		dbMock.ExpectQuery(`SELECT COALESCE\(MAX\(no\), \$3\) FROM "deliveries" WHERE stream_name = \$1 AND group_name = \$2`).
+			WithArgs("event_stream", "workers", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"no"}).AddRow(3))
+		dbMock.ExpectExec(`INSERT INTO "deliveries" \(stream_name, group_name, no, attempt, visible_at\) VALUES`).
+			WithArgs("event_stream", "workers", 4, 30000).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectCommit()
+
+		group, err := postgres.NewConsumerGroup(db, store, "event_stream", "workers", "groups", "deliveries", 30*time.Second, nil)
+		require.NoError(t, err)
+
+		deliveries, err := group.Receive(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+
+		message, no := deliveries[0].Message()
+		assert.Equal(t, messages[0], message)
+		assert.Equal(t, int64(2), no)
+		assert.Equal(t, 2, deliveries[0].Attempt())
+
+		message, no = deliveries[1].Message()
+		assert.Equal(t, messages[1], message)
+		assert.Equal(t, int64(4), no)
+		assert.Equal(t, 1, deliveries[1].Attempt())
+
+		dbMock.ExpectExec(`UPDATE "deliveries" SET acked = TRUE WHERE stream_name = \$1 AND group_name = \$2 AND no = \$3`).
+			WithArgs("event_stream", "workers", 4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, deliveries[1].Ack(ctx))
+
+		dbMock.ExpectExec(`UPDATE "deliveries" SET visible_at = NOW\(\) WHERE stream_name = \$1 AND group_name = \$2 AND no = \$3 AND attempt = \$4 AND NOT acked`).
+			WithArgs("event_stream", "workers", 2, 2).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.Equal(t, goengine.ErrDeliveryExpired, deliveries[0].Nack(ctx))
+
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "Track and deliver missing messages", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+		messages := []goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 1, metadata.New(), time.Now()),
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 2, metadata.New(), time.Now()),
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 3, metadata.New(), time.Now()),
+		}
+
+		store := mocks.NewEventStore(ctrl)
+		firstCount, gapCount, secondCount := uint(10), uint(1), uint(9)
+		gomock.InOrder(
+			// Message 2 and 3 are not visible yet when message 4 is
+			store.EXPECT().Load(ctx, goengine.StreamName("event_stream"), int64(2), &firstCount, gomock.Any()).
+				Return(inmemory.NewEventStream(messages[:1], []int64{4})),
+			// Message 2 became visible but message 3 did not
+			store.EXPECT().Load(ctx, goengine.StreamName("event_stream"), int64(2), &gapCount, gomock.Any()).
+				Return(inmemory.NewEventStream(messages[1:2], []int64{2})),
+			store.EXPECT().Load(ctx, goengine.StreamName("event_stream"), int64(3), &gapCount, gomock.Any()).
+				Return(inmemory.NewEventStream(messages[2:], []int64{4})),
+			store.EXPECT().Load(ctx, goengine.StreamName("event_stream"), int64(5), &secondCount, gomock.Any()).
+				Return(inmemory.NewEventStream(nil, nil)),
+		)
+
+		// The group is only created by the first Receive
+		dbMock.ExpectExec(`INSERT INTO "groups" \(stream_name, name\) VALUES \(\$1, \$2\) ON CONFLICT DO NOTHING`).
+			WithArgs("event_stream", "workers").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		expectReceive := func(gaps *sqlmock.Rows) {
+			dbMock.ExpectBegin()
+			dbMock.ExpectQuery(`UPDATE "groups" SET checkpoint`).
+				WithArgs("event_stream", "workers").
+				WillReturnRows(sqlmock.NewRows([]string{"checkpoint"}).AddRow(1))
+			dbMock.ExpectExec(`DELETE FROM "deliveries"`).
+				WithArgs("event_stream", "workers", 1).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			dbMock.ExpectQuery(`UPDATE "deliveries" SET attempt = attempt \+ 1`).
+				WithArgs("event_stream", "workers", 10, 30000).
+				WillReturnRows(sqlmock.NewRows([]string{"no", "attempt"}))
+			dbMock.ExpectQuery(`SELECT no FROM "deliveries" WHERE stream_name = \$1 AND group_name = \$2 AND attempt = 0`).
+				WithArgs("event_stream", "workers", 10).
+				WillReturnRows(gaps)
+		}
+
+		expectReceive(sqlmock.NewRows([]string{"no"}))
+		dbMock.ExpectQuery(`SELECT COALESCE\(MAX\(no\), \$3\) FROM "deliveries"`).
+			WithArgs("event_stream", "workers", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"no"}).AddRow(1))
+		dbMock.ExpectExec(`INSERT INTO "deliveries" \(stream_name, group_name, no, attempt, visible_at\)\s+SELECT \$1, \$2, generate_series\(\$3::BIGINT, \$4::BIGINT\), 0`).
+			WithArgs("event_stream", "workers", 2, 3, 10000).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		dbMock.ExpectExec(`INSERT INTO "deliveries" \(stream_name, group_name, no, attempt, visible_at\) VALUES`).
+			WithArgs("event_stream", "workers", 4, 30000).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectCommit()
+
+		expectReceive(sqlmock.NewRows([]string{"no"}).AddRow(2).AddRow(3))
+		dbMock.ExpectExec(`UPDATE "deliveries" SET attempt = 1`).
+			WithArgs("event_stream", "workers", 2, 30000).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectQuery(`SELECT COALESCE\(MAX\(no\), \$3\) FROM "deliveries"`).
+			WithArgs("event_stream", "workers", 1).
+			WillReturnRows(sqlmock.NewRows([]string{"no"}).AddRow(4))
+		dbMock.ExpectCommit()
+
+		group, err := postgres.NewConsumerGroup(db, store, "event_stream", "workers", "groups", "deliveries", 30*time.Second, nil)
+		require.NoError(t, err)
+
+		deliveries, err := group.Receive(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		_, no := deliveries[0].Message()
+		assert.Equal(t, int64(4), no)
+
+		deliveries, err = group.Receive(ctx, 10)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		message, no := deliveries[0].Message()
+		assert.Equal(t, messages[1], message)
+		assert.Equal(t, int64(2), no)
+		assert.Equal(t, 1, deliveries[0].Attempt())
+
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
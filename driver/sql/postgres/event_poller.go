@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// maxTrackedGaps is the maximum number of missing event numbers a eventPoller keeps track of
+const maxTrackedGaps = 1000
+
+// eventPoller keeps track of the position and missing event numbers while polling a event store table
+type eventPoller struct {
+	db         *sql.DB
+	batchSize  int
+	gapTimeout time.Duration
+	logger     goengine.Logger
+
+	queryEvents      string
+	queryEventsByNos string
+
+	position int64
+	// gaps contains the event numbers that where skipped and the time they where first seen missing.
+	// Event numbers are assigned when a transaction inserts and not when it commits so a lower number can become
+	// visible after a higher number.
+	gaps map[int64]time.Time
+}
+
+func newEventPoller(db *sql.DB, eventStoreTableQuoted string, batchSize int, gapTimeout time.Duration, logger goengine.Logger) *eventPoller {
+	/* #nosec G201 */
+	return &eventPoller{
+		db:         db,
+		batchSize:  batchSize,
+		gapTimeout: gapTimeout,
+		logger:     logger,
+
+		queryEvents: fmt.Sprintf(
+			`SELECT no, aggregate_id FROM %s WHERE no > $1 ORDER BY no LIMIT %d`,
+			eventStoreTableQuoted,
+			batchSize,
+		),
+		queryEventsByNos: fmt.Sprintf(
+			`SELECT no, aggregate_id FROM %s WHERE no IN (%%s) ORDER BY no`,
+			eventStoreTableQuoted,
+		),
+		gaps: map[int64]time.Time{},
+	}
+}
+
+// poll returns the notifications for the events appended since the last poll and if more events are available
+func (p *eventPoller) poll(ctx context.Context) ([]*driverSQL.ProjectionNotification, bool, error) {
+	notifications, err := p.pollGaps(ctx)
+	if err != nil {
+		return notifications, false, err
+	}
+
+	rows, err := p.db.QueryContext(ctx, p.queryEvents, p.position)
+	if err != nil {
+		return notifications, false, err
+	}
+
+	var found int
+	newNotifications, err := p.scan(rows, func(notification *driverSQL.ProjectionNotification) {
+		found++
+		p.trackGaps(notification.No)
+		p.position = notification.No
+	})
+	notifications = append(notifications, newNotifications...)
+
+	return notifications, err == nil && found == p.batchSize, err
+}
+
+// pollGaps returns the notifications for events that previously where missing and expires old gaps
+func (p *eventPoller) pollGaps(ctx context.Context) ([]*driverSQL.ProjectionNotification, error) {
+	if len(p.gaps) == 0 {
+		return nil, nil
+	}
+
+	expireBefore := time.Now().Add(-p.gapTimeout)
+	nos := make([]string, 0, len(p.gaps))
+	for no, missingSince := range p.gaps {
+		if missingSince.Before(expireBefore) {
+			delete(p.gaps, no)
+			continue
+		}
+		nos = append(nos, strconv.FormatInt(no, 10))
+	}
+	if len(nos) == 0 {
+		return nil, nil
+	}
+
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf(p.queryEventsByNos, strings.Join(nos, ",")))
+	if err != nil {
+		return nil, err
+	}
+
+	return p.scan(rows, func(notification *driverSQL.ProjectionNotification) {
+		delete(p.gaps, notification.No)
+	})
+}
+
+// scan reads the notifications from the rows and calls found for every notification
+func (p *eventPoller) scan(rows *sql.Rows, found func(*driverSQL.ProjectionNotification)) ([]*driverSQL.ProjectionNotification, error) {
+	defer func() {
+		if err := rows.Close(); err != nil {
+			p.logger.Warn("failed to close polling rows", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	var notifications []*driverSQL.ProjectionNotification
+	for rows.Next() {
+		notification := &driverSQL.ProjectionNotification{}
+		if err := rows.Scan(&notification.No, &notification.AggregateID); err != nil {
+			return notifications, err
+		}
+
+		found(notification)
+		notifications = append(notifications, notification)
+	}
+
+	return notifications, rows.Err()
+}
+
+// trackGaps registers the event numbers between the current position and the provided number as missing
+func (p *eventPoller) trackGaps(no int64) {
+	now := time.Now()
+	for missing := p.position + 1; missing < no && len(p.gaps) < maxTrackedGaps; missing++ {
+		p.gaps[missing] = now
+	}
+}
+
+// drain polls until all visible events appended since the last poll are read
+func (p *eventPoller) drain(ctx context.Context) error {
+	for {
+		_, full, err := p.poll(ctx)
+		if err != nil || !full {
+			return err
+		}
+	}
+}
@@ -19,11 +19,17 @@ var (
 	ErrTableAlreadyExists = errors.New("goengine: table already exists")
 	// ErrTableNameEmpty occurs when table cannot be created because it has an empty name
 	ErrTableNameEmpty = errors.New("goengine: table name could not be empty")
+	// ErrNoListenerFactory occurs when a subscription is started on a EventStore without a ListenerFactory
+	ErrNoListenerFactory = errors.New("goengine: no listener factory is configured for the event store")
 
 	// Ensure that we satisfy the eventstore.EventStore interface
 	_ goengine.EventStore = &EventStore{}
 	// Ensure that we satisfy the ReadOnlyEventStore interface
 	_ driverSQL.ReadOnlyEventStore = &EventStore{}
+	// Ensure that we satisfy the PartitionedReadOnlyEventStore interface
+	_ driverSQL.PartitionedReadOnlyEventStore = &EventStore{}
+	// Ensure that we satisfy the goengine.CatchUpSubscriber interface
+	_ goengine.CatchUpSubscriber = &EventStore{}
 )
 
 // EventStore a in postgres event store implementation
@@ -34,6 +40,7 @@ type EventStore struct {
 	insertColumns       string
 	columnCount         int
 	eventColumns        string
+	listenerFactory     ListenerFactory
 	logger              goengine.Logger
 }
 
@@ -79,6 +86,28 @@ func NewEventStore(
 	}, nil
 }
 
+// WithListenerFactory sets the ListenerFactory used by SubscribeFrom to be notified about appended events
+func (e *EventStore) WithListenerFactory(listenerFactory ListenerFactory) {
+	e.listenerFactory = listenerFactory
+}
+
+// SubscribeFrom starts a goengine.CatchUpSubscription on the stream beginning at the message with number fromNumber.
+// The subscription loads the events every time the Listener returned by the ListenerFactory is triggered.
+func (e *EventStore) SubscribeFrom(
+	ctx context.Context,
+	streamName goengine.StreamName,
+	fromNumber int64,
+	matcher metadata.Matcher,
+	handler goengine.SubscriptionHandler,
+	checkpoint goengine.SubscriptionCheckpoint,
+) (goengine.CatchUpSubscription, error) {
+	if e.listenerFactory == nil {
+		return nil, ErrNoListenerFactory
+	}
+
+	return subscribeFrom(ctx, e, e.listenerFactory, streamName, fromNumber, matcher, handler, checkpoint, e.logger)
+}
+
 // Create creates the database table, index etc needed for the event stream
 func (e *EventStore) Create(ctx context.Context, streamName goengine.StreamName) error {
 	tableName, err := e.tableName(streamName)
@@ -142,7 +171,7 @@ func (e *EventStore) Load(
 	count *uint,
 	matcher metadata.Matcher,
 ) (goengine.EventStream, error) {
-	return e.loadQuery(ctx, e.db, streamName, fromNumber, count, matcher)
+	return e.loadQuery(ctx, e.db, streamName, fromNumber, count, matcher, 0, 0)
 }
 
 // LoadWithConnection returns an eventstream based on the provided constraints using the provided sql.Conn
@@ -154,11 +183,33 @@ func (e *EventStore) LoadWithConnection(
 	count *uint,
 	matcher metadata.Matcher,
 ) (goengine.EventStream, error) {
-	return e.loadQuery(ctx, conn, streamName, fromNumber, count, matcher)
+	return e.loadQuery(ctx, conn, streamName, fromNumber, count, matcher, 0, 0)
+}
+
+// LoadPartitionWithConnection returns an eventstream containing the events of the aggregates belonging to the partition
+// using the provided sql.Conn.
+// The partition is calculated the same way as sql.AggregatePartition, using the first 4 bytes of the md5 hash of the
+// aggregate_id column.
+func (e *EventStore) LoadPartitionWithConnection(
+	ctx context.Context,
+	conn driverSQL.Queryer,
+	streamName goengine.StreamName,
+	fromNumber int64,
+	count *uint,
+	matcher metadata.Matcher,
+	partition uint32,
+	partitions uint32,
+) (goengine.EventStream, error) {
+	if partitions == 0 {
+		return nil, goengine.InvalidArgumentError("partitions")
+	}
+
+	return e.loadQuery(ctx, conn, streamName, fromNumber, count, matcher, partition, partitions)
 }
 
 // loadQuery returns an eventstream based on the provided constraints
-// This func is used by Load and LoadWithConnection.
+// This func is used by Load, LoadWithConnection and LoadPartitionWithConnection.
+// When partitions is 0 the events of all partitions are returned.
 func (e *EventStore) loadQuery(
 	ctx context.Context,
 	db driverSQL.Queryer,
@@ -166,6 +217,8 @@ func (e *EventStore) loadQuery(
 	fromNumber int64,
 	count *uint,
 	matcher metadata.Matcher,
+	partition uint32,
+	partitions uint32,
 ) (goengine.EventStream, error) {
 	tableName, err := e.tableName(streamName)
 	if err != nil {
@@ -189,6 +242,13 @@ func (e *EventStore) loadQuery(
 		selectQuery = append(selectQuery, searchPart...)
 		params = append(params, searchParams...)
 	}
+	if partitions > 0 {
+		selectQuery = append(selectQuery, " AND ('x' || substr(md5(aggregate_id::text), 1, 8))::bit(32)::bigint % $"...)
+		selectQuery = append(selectQuery, strconv.Itoa(len(params)+1)...)
+		selectQuery = append(selectQuery, " = $"...)
+		selectQuery = append(selectQuery, strconv.Itoa(len(params)+2)...)
+		params = append(params, partitions, partition)
+	}
 	selectQuery = append(selectQuery, " ORDER BY no "...)
 	if count != nil {
 		selectQuery = append(selectQuery, "LIMIT "...)
@@ -200,6 +260,10 @@ func (e *EventStore) loadQuery(
 		return nil, err
 	}
 
+	if factory, ok := e.messageFactory.(driverSQL.ContextMessageFactory); ok {
+		return factory.CreateEventStreamWithContext(ctx, rows)
+	}
+
 	return e.messageFactory.CreateEventStream(rows)
 }
 
@@ -220,7 +284,12 @@ func (e *EventStore) AppendToWithExecer(ctx context.Context, conn driverSQL.Exec
 		return err
 	}
 
-	data, err := e.persistenceStrategy.PrepareData(streamEvents)
+	var data []interface{}
+	if strategy, ok := e.persistenceStrategy.(driverSQL.ContextPersistenceStrategy); ok {
+		data, err = strategy.PrepareDataWithContext(ctx, streamEvents)
+	} else {
+		data, err = e.persistenceStrategy.PrepareData(streamEvents)
+	}
 	if err != nil {
 		return err
 	}
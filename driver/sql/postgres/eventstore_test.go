@@ -382,6 +382,40 @@ func TestEventStore_Load(t *testing.T) {
 	})
 }
 
+func TestEventStore_LoadPartitionWithConnection(t *testing.T) {
+	test.RunWithMockDB(t, "Load partition", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		columns := []string{"no", "payload", "metadata"}
+		matcher := metadata.WithConstraint(metadata.NewMatcher(), "version", metadata.GreaterThan, 1)
+		expectedStream := &mocks.EventStream{}
+
+		dbMock.ExpectQuery(
+			`SELECT "no", "payload", "metadata" FROM event_stream WHERE no >= \$1 AND version > \$2 ` +
+				`AND \('x' \|\| substr\(md5\(aggregate_id::text\), 1, 8\)\)::bit\(32\)::bigint % \$3 = \$4 ORDER BY no`,
+		).WithArgs(5, 1, 4, 2).WillReturnRows(sqlmock.NewRows(columns))
+
+		factory := mockSQL.NewMessageFactory(ctrl)
+		factory.EXPECT().CreateEventStream(gomock.AssignableToTypeOf(&sql.Rows{})).Return(expectedStream, nil).Times(1)
+
+		strategy := mockSQL.NewPersistenceStrategy(ctrl)
+		strategy.EXPECT().PrepareSearch(matcher).Return([]byte(" AND version > $2"), []interface{}{1}).Times(1)
+		strategy.EXPECT().InsertColumnNames().Return([]string{}).AnyTimes()
+		strategy.EXPECT().EventColumnNames().Return(columns).AnyTimes()
+		strategy.EXPECT().GenerateTableName(goengine.StreamName("event_stream")).Return("event_stream", nil).AnyTimes()
+
+		store, err := postgres.NewEventStore(strategy, db, factory, nil)
+		require.NoError(t, err)
+
+		stream, err := store.LoadPartitionWithConnection(context.Background(), db, "event_stream", 5, nil, matcher, 2, 4)
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedStream, stream)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
 func mockHasStreamQuery(result bool, mock sqlmock.Sqlmock) {
 	mockRows := sqlmock.NewRows([]string{"type"}).AddRow(result)
 	mock.ExpectQuery(`SELECT EXISTS\((.+)`).WithArgs("events_orders").WillReturnRows(mockRows)
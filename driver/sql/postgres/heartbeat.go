@@ -0,0 +1,28 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// heartbeatPayload is the payload of a heartbeat notification
+const heartbeatPayload = `{"no":0,"aggregate_id":""}`
+
+// NewNotifyHeartbeat returns a sql.Heartbeat that sends a heartbeat notification using NOTIFY on the channel
+func NewNotifyHeartbeat(db *sql.DB, channel string) (driverSQL.Heartbeat, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case strings.TrimSpace(channel) == "":
+		return nil, goengine.InvalidArgumentError("channel")
+	}
+
+	return func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, heartbeatPayload)
+		return err
+	}, nil
+}
@@ -0,0 +1,38 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNotifyHeartbeat(t *testing.T) {
+	test.RunWithMockDB(t, "Send heartbeat", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).
+			WithArgs("event_stream", `{"no":0,"aggregate_id":""}`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		heartbeat, err := postgres.NewNotifyHeartbeat(db, "event_stream")
+		require.NoError(t, err)
+
+		assert.NoError(t, heartbeat(context.Background()))
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "Invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		_, err := postgres.NewNotifyHeartbeat(nil, "event_stream")
+		assert.Equal(t, goengine.InvalidArgumentError("db"), err)
+
+		_, err = postgres.NewNotifyHeartbeat(db, " ")
+		assert.Equal(t, goengine.InvalidArgumentError("channel"), err)
+	})
+}
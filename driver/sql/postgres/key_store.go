@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hellofresh/goengine"
+)
+
+// Ensure KeyStore implements goengine.KeyStore
+var _ goengine.KeyStore = &KeyStore{}
+
+// KeyStore is a goengine.KeyStore that stores the keys of the data subjects in a postgres table
+type KeyStore struct {
+	db *sql.DB
+
+	queryKey         string
+	queryGetOrCreate string
+	queryDelete      string
+}
+
+// NewKeyStore returns a new KeyStore
+func NewKeyStore(db *sql.DB, keyTable string) (*KeyStore, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case strings.TrimSpace(keyTable) == "":
+		return nil, goengine.InvalidArgumentError("keyTable")
+	}
+
+	keyTableQuoted := QuoteIdentifier(keyTable)
+
+	/* #nosec G201 */
+	return &KeyStore{
+		db: db,
+
+		queryKey: fmt.Sprintf(
+			`SELECT key FROM %s WHERE subject = $1`,
+			keyTableQuoted,
+		),
+		// The no-op update makes sure the key of the subject is returned when it already exists
+		queryGetOrCreate: fmt.Sprintf(
+			`INSERT INTO %s (subject, key) VALUES ($1, $2)
+			 ON CONFLICT (subject) DO UPDATE SET subject = EXCLUDED.subject
+			 RETURNING key`,
+			keyTableQuoted,
+		),
+		queryDelete: fmt.Sprintf(
+			`DELETE FROM %s WHERE subject = $1`,
+			keyTableQuoted,
+		),
+	}, nil
+}
+
+// Key returns the key of the data subject or goengine.ErrKeyNotFound when the subject has no key
+func (s *KeyStore) Key(ctx context.Context, subject string) ([]byte, error) {
+	var key []byte
+	err := s.db.QueryRowContext(ctx, s.queryKey, subject).Scan(&key)
+	if err == sql.ErrNoRows {
+		return nil, goengine.ErrKeyNotFound
+	}
+
+	return key, err
+}
+
+// GetOrCreateKey returns the key of the data subject and creates a new key when the subject has no key
+func (s *KeyStore) GetOrCreateKey(ctx context.Context, subject string) ([]byte, error) {
+	newKey, err := goengine.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if err := s.db.QueryRowContext(ctx, s.queryGetOrCreate, subject, newKey).Scan(&key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// DeleteKey deletes the key of the data subject
+func (s *KeyStore) DeleteKey(ctx context.Context, subject string) error {
+	_, err := s.db.ExecContext(ctx, s.queryDelete, subject)
+	return err
+}
+
+// KeyStoreCreateSchema return the sql statement needed for the postgres database in order to use the KeyStore
+func KeyStoreCreateSchema(keyTable string) []string {
+	/* #nosec G201 */
+	return []string{
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				subject VARCHAR(255) NOT NULL,
+				key BYTEA NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				PRIMARY KEY (subject)
+			)`,
+			QuoteIdentifier(keyTable),
+		),
+	}
+}
@@ -0,0 +1,88 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewKeyStore(t *testing.T) {
+	test.RunWithMockDB(t, "invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		store, err := postgres.NewKeyStore(nil, "keys")
+		assert.Equal(t, goengine.InvalidArgumentError("db"), err)
+		assert.Nil(t, store)
+
+		store, err = postgres.NewKeyStore(db, " ")
+		assert.Equal(t, goengine.InvalidArgumentError("keyTable"), err)
+		assert.Nil(t, store)
+	})
+}
+
+func TestKeyStore_Key(t *testing.T) {
+	test.RunWithMockDB(t, "Key exists", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT key FROM "keys" WHERE subject = \$1`).
+			WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow([]byte("secret")))
+
+		store, err := postgres.NewKeyStore(db, "keys")
+		require.NoError(t, err)
+
+		key, err := store.Key(context.Background(), "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("secret"), key)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "No key", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT key FROM "keys" WHERE subject = \$1`).
+			WithArgs("alice").
+			WillReturnRows(sqlmock.NewRows([]string{"key"}))
+
+		store, err := postgres.NewKeyStore(db, "keys")
+		require.NoError(t, err)
+
+		key, err := store.Key(context.Background(), "alice")
+		assert.Equal(t, goengine.ErrKeyNotFound, err)
+		assert.Nil(t, key)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func TestKeyStore_GetOrCreateKey(t *testing.T) {
+	test.RunWithMockDB(t, "Return the stored key", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`INSERT INTO "keys" \(subject, key\) VALUES \(\$1, \$2\) ON CONFLICT \(subject\) DO UPDATE (.+) RETURNING key`).
+			WithArgs("alice", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow([]byte("secret")))
+
+		store, err := postgres.NewKeyStore(db, "keys")
+		require.NoError(t, err)
+
+		key, err := store.GetOrCreateKey(context.Background(), "alice")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("secret"), key)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func TestKeyStore_DeleteKey(t *testing.T) {
+	test.RunWithMockDB(t, "Delete the key", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectExec(`DELETE FROM "keys" WHERE subject = \$1`).
+			WithArgs("alice").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		store, err := postgres.NewKeyStore(db, "keys")
+		require.NoError(t, err)
+
+		assert.NoError(t, store.DeleteKey(context.Background(), "alice"))
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// Ensure LeaseStore implements sql.LeaseStore
+var _ driverSQL.LeaseStore = &LeaseStore{}
+
+// LeaseStore is a sql.LeaseStore that stores the leases in a postgres table
+type LeaseStore struct {
+	db *sql.DB
+
+	queryAcquire string
+	queryRelease string
+	queryOwner   string
+}
+
+// NewLeaseStore returns a new LeaseStore
+func NewLeaseStore(db *sql.DB, leaseTable string) (*LeaseStore, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case strings.TrimSpace(leaseTable) == "":
+		return nil, goengine.InvalidArgumentError("leaseTable")
+	}
+
+	leaseTableQuoted := QuoteIdentifier(leaseTable)
+
+	/* #nosec G201 */
+	return &LeaseStore{
+		db: db,
+
+		queryAcquire: fmt.Sprintf(
+			`INSERT INTO %[1]s AS lease (name, holder, expires_at) VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond')
+			 ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+			 WHERE lease.holder = EXCLUDED.holder OR lease.expires_at < NOW()
+			 RETURNING holder`,
+			leaseTableQuoted,
+		),
+		queryRelease: fmt.Sprintf(
+			`DELETE FROM %s WHERE name = $1 AND holder = $2`,
+			leaseTableQuoted,
+		),
+		queryOwner: fmt.Sprintf(
+			`SELECT holder, expires_at FROM %s WHERE name = $1`,
+			leaseTableQuoted,
+		),
+	}, nil
+}
+
+// Acquire acquires or renews the lease for the holder and returns true when the holder owns the lease
+func (s *LeaseStore) Acquire(ctx context.Context, name string, holder string, ttl time.Duration) (bool, error) {
+	var acquiredBy string
+	err := s.db.QueryRowContext(ctx, s.queryAcquire, name, holder, ttl.Nanoseconds()/int64(time.Millisecond)).Scan(&acquiredBy)
+	switch {
+	case err == sql.ErrNoRows:
+		// The lease is held by another holder
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return acquiredBy == holder, nil
+}
+
+// Release releases the lease when it's owned by the holder
+func (s *LeaseStore) Release(ctx context.Context, name string, holder string) error {
+	_, err := s.db.ExecContext(ctx, s.queryRelease, name, holder)
+	return err
+}
+
+// Owner returns the lease with the provided name
+func (s *LeaseStore) Owner(ctx context.Context, name string) (driverSQL.Lease, error) {
+	lease := driverSQL.Lease{Name: name}
+	err := s.db.QueryRowContext(ctx, s.queryOwner, name).Scan(&lease.Holder, &lease.ExpiresAt)
+	if err != nil && err != sql.ErrNoRows {
+		return lease, err
+	}
+
+	return lease, nil
+}
+
+// LeaseCreateSchema return the sql statement needed for the postgres database in order to use the LeaseStore
+func LeaseCreateSchema(leaseTable string) []string {
+	/* #nosec G201 */
+	return []string{
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				name VARCHAR(150) NOT NULL,
+				holder VARCHAR(255) NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (name)
+			)`,
+			QuoteIdentifier(leaseTable),
+		),
+	}
+}
@@ -0,0 +1,88 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLeaseStore(t *testing.T) {
+	test.RunWithMockDB(t, "invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		store, err := postgres.NewLeaseStore(nil, "leases")
+		assert.Equal(t, goengine.InvalidArgumentError("db"), err)
+		assert.Nil(t, store)
+
+		store, err = postgres.NewLeaseStore(db, " ")
+		assert.Equal(t, goengine.InvalidArgumentError("leaseTable"), err)
+		assert.Nil(t, store)
+	})
+}
+
+func TestLeaseStore_Acquire(t *testing.T) {
+	testCases := []struct {
+		title    string
+		rows     *sqlmock.Rows
+		acquired bool
+	}{
+		{"Acquire lease", sqlmock.NewRows([]string{"holder"}).AddRow("host-1"), true},
+		{"Lease held by another holder", sqlmock.NewRows([]string{"holder"}), false},
+	}
+
+	for _, testCase := range testCases {
+		test.RunWithMockDB(t, testCase.title, func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+			dbMock.ExpectQuery(`INSERT INTO "leases" AS lease \(name, holder, expires_at\) (.+) ON CONFLICT \(name\) DO UPDATE (.+) RETURNING holder`).
+				WithArgs("projection", "host-1", 1500).
+				WillReturnRows(testCase.rows)
+
+			store, err := postgres.NewLeaseStore(db, "leases")
+			require.NoError(t, err)
+
+			acquired, err := store.Acquire(context.Background(), "projection", "host-1", 1500*time.Millisecond)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.acquired, acquired)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestLeaseStore_Owner(t *testing.T) {
+	test.RunWithMockDB(t, "Lease exists", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		expiresAt := time.Now().Add(time.Second)
+		dbMock.ExpectQuery(`SELECT holder, expires_at FROM "leases" WHERE name = \$1`).
+			WithArgs("projection").
+			WillReturnRows(sqlmock.NewRows([]string{"holder", "expires_at"}).AddRow("host-1", expiresAt))
+
+		store, err := postgres.NewLeaseStore(db, "leases")
+		require.NoError(t, err)
+
+		lease, err := store.Owner(context.Background(), "projection")
+		assert.NoError(t, err)
+		assert.Equal(t, "projection", lease.Name)
+		assert.Equal(t, "host-1", lease.Holder)
+		assert.True(t, lease.Active(time.Now()))
+	})
+
+	test.RunWithMockDB(t, "No lease", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT holder, expires_at FROM "leases" WHERE name = \$1`).
+			WithArgs("projection").
+			WillReturnRows(sqlmock.NewRows([]string{"holder", "expires_at"}))
+
+		store, err := postgres.NewLeaseStore(db, "leases")
+		require.NoError(t, err)
+
+		lease, err := store.Owner(context.Background(), "projection")
+		assert.NoError(t, err)
+		assert.Equal(t, "", lease.Holder)
+		assert.False(t, lease.Active(time.Now()))
+	})
+}
@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// Ensure MembershipStore implements sql.MembershipStore
+var _ driverSQL.MembershipStore = &MembershipStore{}
+
+// MembershipStore is a sql.MembershipStore that stores the group members in a postgres table
+type MembershipStore struct {
+	db *sql.DB
+
+	logger goengine.Logger
+
+	queryHeartbeat string
+	queryLeave     string
+	queryMembers   string
+}
+
+// NewMembershipStore returns a new MembershipStore
+func NewMembershipStore(db *sql.DB, membershipTable string, logger goengine.Logger) (*MembershipStore, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case strings.TrimSpace(membershipTable) == "":
+		return nil, goengine.InvalidArgumentError("membershipTable")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	membershipTableQuoted := QuoteIdentifier(membershipTable)
+
+	/* #nosec G201 */
+	return &MembershipStore{
+		db:     db,
+		logger: logger,
+
+		queryHeartbeat: fmt.Sprintf(
+			`INSERT INTO %s (group_name, member, expires_at) VALUES ($1, $2, NOW() + $3 * INTERVAL '1 millisecond')
+			 ON CONFLICT (group_name, member) DO UPDATE SET expires_at = EXCLUDED.expires_at`,
+			membershipTableQuoted,
+		),
+		queryLeave: fmt.Sprintf(
+			`DELETE FROM %s WHERE group_name = $1 AND member = $2`,
+			membershipTableQuoted,
+		),
+		queryMembers: fmt.Sprintf(
+			`SELECT member FROM %s WHERE group_name = $1 AND expires_at > NOW() ORDER BY member`,
+			membershipTableQuoted,
+		),
+	}, nil
+}
+
+// Heartbeat registers the member as being alive for the ttl
+func (s *MembershipStore) Heartbeat(ctx context.Context, group string, member string, ttl time.Duration) error {
+	_, err := s.db.ExecContext(ctx, s.queryHeartbeat, group, member, ttl.Nanoseconds()/int64(time.Millisecond))
+	return err
+}
+
+// Leave removes the member from the group
+func (s *MembershipStore) Leave(ctx context.Context, group string, member string) error {
+	_, err := s.db.ExecContext(ctx, s.queryLeave, group, member)
+	return err
+}
+
+// Members returns the members of the group that are alive
+func (s *MembershipStore) Members(ctx context.Context, group string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, s.queryMembers, group)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			s.logger.Warn("failed to close members rows", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	var members []string
+	for rows.Next() {
+		var member string
+		if err := rows.Scan(&member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// MembershipCreateSchema return the sql statement needed for the postgres database in order to use the MembershipStore
+func MembershipCreateSchema(membershipTable string) []string {
+	/* #nosec G201 */
+	return []string{
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				group_name VARCHAR(150) NOT NULL,
+				member VARCHAR(255) NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (group_name, member)
+			)`,
+			QuoteIdentifier(membershipTable),
+		),
+	}
+}
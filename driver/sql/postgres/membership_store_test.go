@@ -0,0 +1,57 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMembershipStore(t *testing.T) {
+	test.RunWithMockDB(t, "invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		store, err := postgres.NewMembershipStore(nil, "members", nil)
+		assert.Equal(t, goengine.InvalidArgumentError("db"), err)
+		assert.Nil(t, store)
+
+		store, err = postgres.NewMembershipStore(db, "", nil)
+		assert.Equal(t, goengine.InvalidArgumentError("membershipTable"), err)
+		assert.Nil(t, store)
+	})
+}
+
+func TestMembershipStore(t *testing.T) {
+	test.RunWithMockDB(t, "Heartbeat and load members", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctx := context.Background()
+
+		dbMock.ExpectExec(`INSERT INTO "members" \(group_name, member, expires_at\) (.+) ON CONFLICT \(group_name, member\) DO UPDATE`).
+			WithArgs("projection", "host-1", 2000).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectQuery(`SELECT member FROM "members" WHERE group_name = \$1 AND expires_at > NOW\(\) ORDER BY member`).
+			WithArgs("projection").
+			WillReturnRows(sqlmock.NewRows([]string{"member"}).AddRow("host-1").AddRow("host-2"))
+		dbMock.ExpectExec(`DELETE FROM "members" WHERE group_name = \$1 AND member = \$2`).
+			WithArgs("projection", "host-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		store, err := postgres.NewMembershipStore(db, "members", nil)
+		require.NoError(t, err)
+
+		assert.NoError(t, store.Heartbeat(ctx, "projection", "host-1", 2*time.Second))
+
+		members, err := store.Members(ctx, "projection")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"host-1", "host-2"}, members)
+
+		assert.NoError(t, store.Leave(ctx, "projection", "host-1"))
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// Ensure PollingListener implements sql.Listener
+var _ driverSQL.Listener = &PollingListener{}
+
+// PollingListener is a Listener that polls the event store table for newly appended events.
+// It can be used in environments where LISTEN/NOTIFY is not available, for example when running behind PgBouncer in
+// transaction mode or when using a read replica.
+//
+// The event store table is expected to contain the `no` and `aggregate_id` columns.
+type PollingListener struct {
+	db *sql.DB
+
+	minPollInterval time.Duration
+	maxPollInterval time.Duration
+	gapTimeout      time.Duration
+	batchSize       int
+
+	logger  goengine.Logger
+	metrics driverSQL.Metrics
+
+	eventStoreTableQuoted string
+	queryPosition         string
+}
+
+// NewPollingListener returns a new PollingListener
+//
+// The poll interval starts at minPollInterval and is doubled, up to maxPollInterval, every time a poll found no new events.
+func NewPollingListener(
+	db *sql.DB,
+	eventStoreTable string,
+	minPollInterval time.Duration,
+	maxPollInterval time.Duration,
+	batchSize uint,
+	logger goengine.Logger,
+	metrics driverSQL.Metrics,
+) (*PollingListener, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case strings.TrimSpace(eventStoreTable) == "":
+		return nil, goengine.InvalidArgumentError("eventStoreTable")
+	case minPollInterval <= 0:
+		return nil, goengine.InvalidArgumentError("minPollInterval")
+	case maxPollInterval < minPollInterval:
+		return nil, goengine.InvalidArgumentError("maxPollInterval")
+	case batchSize == 0:
+		return nil, goengine.InvalidArgumentError("batchSize")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	if metrics == nil {
+		metrics = driverSQL.NopMetrics
+	}
+
+	eventStoreTableQuoted := QuoteIdentifier(eventStoreTable)
+
+	/* #nosec G201 */
+	return &PollingListener{
+		db:              db,
+		minPollInterval: minPollInterval,
+		maxPollInterval: maxPollInterval,
+		gapTimeout:      10 * maxPollInterval,
+		batchSize:       int(batchSize),
+		logger:          logger,
+		metrics:         metrics,
+
+		eventStoreTableQuoted: eventStoreTableQuoted,
+		queryPosition: fmt.Sprintf(
+			`SELECT COALESCE(MAX(no), 0) FROM %s`,
+			eventStoreTableQuoted,
+		),
+	}, nil
+}
+
+// Listen polls the event store table and calls the trigger for every event that was appended.
+// This includes an initial call to trigger with a nil notification.
+func (l *PollingListener) Listen(ctx context.Context, trigger driverSQL.ProjectionTrigger) error {
+	// Check if the context is expired
+	select {
+	default:
+	case <-ctx.Done():
+		return nil
+	}
+
+	// Fetch the current position before the initial run to avoid losing events appended during the run
+	var position int64
+	if err := l.db.QueryRowContext(ctx, l.queryPosition).Scan(&position); err != nil {
+		return err
+	}
+
+	// Execute an initial run of the projection.
+	l.metrics.ReceivedNotification(false)
+	if err := trigger(ctx, nil); err != nil {
+		return err
+	}
+
+	poller := newEventPoller(l.db, l.eventStoreTableQuoted, l.batchSize, l.gapTimeout, l.logger)
+	poller.position = position
+
+	interval := l.minPollInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			l.logger.Debug("context closed stopping polling", nil)
+			return nil
+		case <-timer.C:
+		}
+
+		notifications, full, err := poller.poll(ctx)
+		if err != nil {
+			l.logger.Warn("failed to poll event store", func(e goengine.LoggerEntry) {
+				e.Error(err)
+				e.Int64("position", poller.position)
+			})
+		}
+
+		for _, notification := range notifications {
+			l.metrics.ReceivedNotification(true)
+			if err := trigger(ctx, notification); err != nil {
+				return err
+			}
+		}
+
+		// Adapt the interval based on the activity in the event store
+		switch {
+		case full:
+			interval = 0
+		case len(notifications) > 0:
+			interval = l.minPollInterval
+		default:
+			interval *= 2
+			if interval > l.maxPollInterval {
+				interval = l.maxPollInterval
+			}
+			if interval == 0 {
+				interval = l.minPollInterval
+			}
+		}
+		timer.Reset(interval)
+	}
+}
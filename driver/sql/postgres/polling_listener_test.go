@@ -0,0 +1,100 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPollingListener(t *testing.T) {
+	test.RunWithMockDB(t, "invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		testCases := []struct {
+			title                 string
+			db                    *sql.DB
+			table                 string
+			minInterval           time.Duration
+			maxInterval           time.Duration
+			batchSize             uint
+			expectedArgumentError string
+		}{
+			{"No database", nil, "events", time.Millisecond, time.Second, 10, "db"},
+			{"No table", db, " ", time.Millisecond, time.Second, 10, "eventStoreTable"},
+			{"No min interval", db, "events", 0, time.Second, 10, "minPollInterval"},
+			{"Max interval smaller than min", db, "events", time.Second, time.Millisecond, 10, "maxPollInterval"},
+			{"No batch size", db, "events", time.Millisecond, time.Second, 0, "batchSize"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				listener, err := postgres.NewPollingListener(
+					testCase.db,
+					testCase.table,
+					testCase.minInterval,
+					testCase.maxInterval,
+					testCase.batchSize,
+					nil,
+					nil,
+				)
+
+				assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedArgumentError), err)
+				assert.Nil(t, listener)
+			})
+		}
+	})
+}
+
+func TestPollingListener_Listen(t *testing.T) {
+	test.RunWithMockDB(t, "Poll events and missing events", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer ctxCancel()
+
+		dbMock.ExpectQuery(`SELECT COALESCE\(MAX\(no\), 0\) FROM "events_orders"`).
+			WillReturnRows(sqlmock.NewRows([]string{"coalesce"}).AddRow(2))
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events_orders" WHERE no > \$1 ORDER BY no LIMIT 10`).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}).AddRow(3, "a").AddRow(5, "b"))
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events_orders" WHERE no IN \(4\) ORDER BY no`).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}).AddRow(4, "c"))
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events_orders" WHERE no > \$1 ORDER BY no LIMIT 10`).
+			WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}))
+
+		listener, err := postgres.NewPollingListener(db, "events_orders", time.Millisecond, time.Millisecond, 10, nil, nil)
+		require.NoError(t, err)
+
+		var notifications []*driverSQL.ProjectionNotification
+		err = listener.Listen(ctx, func(ctx context.Context, notification *driverSQL.ProjectionNotification) error {
+			notifications = append(notifications, notification)
+			if len(notifications) == 4 {
+				go func() {
+					// Wait for the next poll to finish
+					for dbMock.ExpectationsWereMet() != nil {
+						time.Sleep(time.Millisecond)
+					}
+					ctxCancel()
+				}()
+			}
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, []*driverSQL.ProjectionNotification{
+			nil,
+			{No: 3, AggregateID: "a"},
+			{No: 5, AggregateID: "b"},
+			{No: 4, AggregateID: "c"},
+		}, notifications)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
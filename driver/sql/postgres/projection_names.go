@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+// streamProjectionNames implements the sql.StreamProjectionNamesLoader methods for a stream projection table
+type streamProjectionNames struct {
+	queryNames string
+}
+
+func newStreamProjectionNames(projectionTableQuoted string) streamProjectionNames {
+	/* #nosec G201 */
+	return streamProjectionNames{
+		queryNames: fmt.Sprintf(
+			`SELECT name FROM %s WHERE substr(name, 1, length($1)) = $1 ORDER BY name`,
+			projectionTableQuoted,
+		),
+	}
+}
+
+// ProjectionNames returns the names of the stored projections that start with the prefix
+func (s *streamProjectionNames) ProjectionNames(ctx context.Context, conn driverSQL.Queryer, prefix string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, s.queryNames, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return names, rows.Err()
+}
@@ -0,0 +1,272 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/goengine"
+)
+
+const (
+	// rebuildBatchSize is the amount of event numbers a ProjectionRebuild reads at once to find the head of the stream
+	rebuildBatchSize = 1000
+	// rebuildGapTimeout is the time after which a missing event number is assumed to be rolled back
+	rebuildGapTimeout = 10 * time.Second
+	// rebuildGapInterval is the time to wait before checking if missing event numbers became visible
+	rebuildGapInterval = 100 * time.Millisecond
+	// rebuildSwapInterval is the time to wait before retrying a swap when a projector holds a projection lock
+	rebuildSwapInterval = 100 * time.Millisecond
+)
+
+// rebuildVersionRegex is used to validate the version of a rebuild since it's used as part of a table name
+var rebuildVersionRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// ProjectionRebuild rebuilds a projection into a shadow projection table while the current projection table keeps
+// being used. Once the shadow projection caught up with the event stream the tables are swapped.
+type ProjectionRebuild struct {
+	db *sql.DB
+
+	projectionTable string
+	shadowTable     string
+	retiredTable    string
+	createSchema    func(projectionTable string) []string
+
+	logger goengine.Logger
+
+	eventStoreTableQuoted string
+	queryHead             string
+	queryLockProjection   string
+}
+
+// NewProjectionRebuild returns a new ProjectionRebuild
+//
+// The shadow projection table is named after the projection table with the version as a suffix and is created using
+// the statements returned by createSchema.
+func NewProjectionRebuild(
+	db *sql.DB,
+	projectionTable string,
+	eventStoreTable string,
+	version string,
+	createSchema func(projectionTable string) []string,
+	logger goengine.Logger,
+) (*ProjectionRebuild, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case strings.TrimSpace(projectionTable) == "":
+		return nil, goengine.InvalidArgumentError("projectionTable")
+	case strings.TrimSpace(eventStoreTable) == "":
+		return nil, goengine.InvalidArgumentError("eventStoreTable")
+	case !rebuildVersionRegex.MatchString(version):
+		return nil, goengine.InvalidArgumentError("version")
+	case createSchema == nil:
+		return nil, goengine.InvalidArgumentError("createSchema")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	shadowTable := fmt.Sprintf("%s_%s", projectionTable, version)
+
+	/* #nosec G201 */
+	return &ProjectionRebuild{
+		db:              db,
+		projectionTable: projectionTable,
+		shadowTable:     shadowTable,
+		retiredTable:    fmt.Sprintf("%s_retired", shadowTable),
+		createSchema:    createSchema,
+		logger: logger.WithFields(func(e goengine.LoggerEntry) {
+			e.String("projection_table", projectionTable)
+			e.String("shadow_table", shadowTable)
+		}),
+
+		eventStoreTableQuoted: QuoteIdentifier(eventStoreTable),
+		queryHead: fmt.Sprintf(
+			`SELECT COALESCE(MAX(no), 0) FROM %s`,
+			QuoteIdentifier(eventStoreTable),
+		),
+		// The advisory lock projection storages lock a projection using the same key
+		queryLockProjection: fmt.Sprintf(
+			`SELECT COALESCE(bool_and(pg_try_advisory_xact_lock(%[2]s::regclass::oid::int, no)), TRUE) FROM %[1]s`,
+			QuoteIdentifier(projectionTable),
+			QuoteString(projectionTable),
+		),
+	}, nil
+}
+
+// ShadowTable returns the name of the shadow projection table
+func (r *ProjectionRebuild) ShadowTable() string {
+	return r.shadowTable
+}
+
+// Rebuild creates the shadow projection table and calls run until the shadow projection caught up with the head of
+// the event stream after which the shadow table replaces the projection table.
+// The run func must project the entire event stream into the provided shadow table, for example by calling Run on a
+// projector that uses a projector storage for the shadow table.
+//
+// Event numbers are assigned on insert, so a lower number can still be in flight while a higher number is visible.
+// Before every run the rebuild waits until the missing numbers below the head became visible or are assumed to be
+// rolled back, the shadow projection caught up when no events became visible while it was running.
+//
+// When the rebuild is interrupted it can be resumed by calling Rebuild again with the same version.
+func (r *ProjectionRebuild) Rebuild(ctx context.Context, run func(ctx context.Context, shadowTable string) error) error {
+	for _, query := range r.createSchema(r.shadowTable) {
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	head, err := r.head(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Numbers of transactions that are in flight are expected to be close to the head
+	poller := newEventPoller(r.db, r.eventStoreTableQuoted, rebuildBatchSize, rebuildGapTimeout, r.logger)
+	if head > maxTrackedGaps {
+		poller.position = head - maxTrackedGaps
+	}
+
+	for {
+		// Check if the context is expired
+		select {
+		default:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if err := r.waitForGaps(ctx, poller); err != nil {
+			return err
+		}
+		head := poller.position
+
+		if err := run(ctx, r.shadowTable); err != nil {
+			return err
+		}
+
+		if err := poller.drain(ctx); err != nil {
+			return err
+		}
+
+		// Events that become visible after this point are projected by the projector using the swapped table.
+		if poller.position == head && len(poller.gaps) == 0 {
+			break
+		}
+
+		r.logger.Debug("shadow projection is behind, running again", func(e goengine.LoggerEntry) {
+			e.Int64("head", poller.position)
+			e.Int64("previous_head", head)
+		})
+	}
+
+	return r.swap(ctx)
+}
+
+// head returns the number of the last event in the event stream
+func (r *ProjectionRebuild) head(ctx context.Context) (int64, error) {
+	var head int64
+	err := r.db.QueryRowContext(ctx, r.queryHead).Scan(&head)
+
+	return head, err
+}
+
+// waitForGaps reads the event numbers up to the head of the event stream and waits until the missing numbers became
+// visible or expired
+func (r *ProjectionRebuild) waitForGaps(ctx context.Context, poller *eventPoller) error {
+	for {
+		if err := poller.drain(ctx); err != nil {
+			return err
+		}
+
+		if len(poller.gaps) == 0 {
+			return nil
+		}
+
+		r.logger.Debug("waiting for missing events", func(e goengine.LoggerEntry) {
+			e.Int("missing", len(poller.gaps))
+			e.Int64("head", poller.position)
+		})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rebuildGapInterval):
+		}
+	}
+}
+
+// swap atomically replaces the projection table with the shadow table and drops the old projection table.
+// The swap waits until no projector is projecting using the projection table.
+func (r *ProjectionRebuild) swap(ctx context.Context) error {
+	for {
+		swapped, err := r.trySwap(ctx)
+		if err != nil || swapped {
+			return err
+		}
+
+		r.logger.Debug("projection is locked, retrying swap", nil)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(rebuildSwapInterval):
+		}
+	}
+}
+
+// trySwap replaces the projection table with the shadow table when the locks of all projections in the projection
+// table are acquired
+func (r *ProjectionRebuild) trySwap(ctx context.Context) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			r.logger.Error("could not rollback transaction", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	// The table lock waits for the projectors using row locks and blocks new projections.
+	// Projectors using advisory locks don't hold a table lock in between their queries, since such a projector would
+	// wait for the table lock the advisory locks are only tried to avoid a deadlock.
+	/* #nosec G201 */
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`LOCK TABLE %s IN ACCESS EXCLUSIVE MODE`, QuoteIdentifier(r.projectionTable)))
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	if err := tx.QueryRowContext(ctx, r.queryLockProjection).Scan(&locked); err != nil {
+		return false, err
+	}
+	if !locked {
+		return false, nil
+	}
+
+	/* #nosec G201 */
+	queries := []string{
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, QuoteIdentifier(r.projectionTable), QuoteIdentifier(r.retiredTable)),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, QuoteIdentifier(r.shadowTable), QuoteIdentifier(r.projectionTable)),
+		fmt.Sprintf(`DROP TABLE %s`, QuoteIdentifier(r.retiredTable)),
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	r.logger.Info("swapped projection table", nil)
+	return true, nil
+}
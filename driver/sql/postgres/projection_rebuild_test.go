@@ -0,0 +1,141 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProjectionRebuild(t *testing.T) {
+	createSchema := func(string) []string { return nil }
+
+	test.RunWithMockDB(t, "invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		testCases := []struct {
+			title                 string
+			db                    *sql.DB
+			projectionTable       string
+			eventStoreTable       string
+			version               string
+			createSchema          func(string) []string
+			expectedArgumentError string
+		}{
+			{"No database", nil, "projections", "events", "v2", createSchema, "db"},
+			{"No projection table", db, "", "events", "v2", createSchema, "projectionTable"},
+			{"No event store table", db, "projections", " ", "v2", createSchema, "eventStoreTable"},
+			{"No version", db, "projections", "events", "", createSchema, "version"},
+			{"Invalid version", db, "projections", "events", "v2; DROP", createSchema, "version"},
+			{"No schema", db, "projections", "events", "v2", nil, "createSchema"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				rebuild, err := postgres.NewProjectionRebuild(
+					testCase.db,
+					testCase.projectionTable,
+					testCase.eventStoreTable,
+					testCase.version,
+					testCase.createSchema,
+					nil,
+				)
+
+				assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedArgumentError), err)
+				assert.Nil(t, rebuild)
+			})
+		}
+	})
+}
+
+func TestProjectionRebuild_Rebuild(t *testing.T) {
+	createSchema := func(table string) []string {
+		return []string{`CREATE TABLE IF NOT EXISTS ` + postgres.QuoteIdentifier(table) + ` ()`}
+	}
+
+	test.RunWithMockDB(t, "Rebuild until caught up and swap", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectExec(`CREATE TABLE IF NOT EXISTS "projections_v2" \(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		dbMock.ExpectQuery(`SELECT COALESCE\(MAX\(no\), 0\) FROM "events"`).WillReturnRows(sqlmock.NewRows([]string{"no"}).AddRow(10))
+
+		// The first run falls behind
+		eventRows := sqlmock.NewRows([]string{"no", "aggregate_id"})
+		for no := 1; no <= 10; no++ {
+			eventRows.AddRow(no, "a")
+		}
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events" WHERE no > \$1 ORDER BY no LIMIT 1000`).
+			WithArgs(0).
+			WillReturnRows(eventRows)
+		// Event 11 is not yet visible when event 12 is
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events" WHERE no > \$1 ORDER BY no LIMIT 1000`).
+			WithArgs(10).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}).AddRow(12, "b"))
+
+		// The second run caught up after event 11 became visible
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events" WHERE no IN \(11\) ORDER BY no`).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}).AddRow(11, "c"))
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events" WHERE no > \$1 ORDER BY no LIMIT 1000`).
+			WithArgs(12).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}))
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events" WHERE no > \$1 ORDER BY no LIMIT 1000`).
+			WithArgs(12).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}))
+
+		// A projector is still projecting using the projection table
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(`LOCK TABLE "projections" IN ACCESS EXCLUSIVE MODE`).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectQuery(`SELECT COALESCE\(bool_and\(pg_try_advisory_xact_lock\('projections'::regclass::oid::int, no\)\), TRUE\) FROM "projections"`).
+			WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		dbMock.ExpectRollback()
+
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(`LOCK TABLE "projections" IN ACCESS EXCLUSIVE MODE`).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectQuery(`SELECT COALESCE\(bool_and\(pg_try_advisory_xact_lock\('projections'::regclass::oid::int, no\)\), TRUE\) FROM "projections"`).
+			WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		dbMock.ExpectExec(`ALTER TABLE "projections" RENAME TO "projections_v2_retired"`).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(`ALTER TABLE "projections_v2" RENAME TO "projections"`).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectExec(`DROP TABLE "projections_v2_retired"`).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectCommit()
+
+		rebuild, err := postgres.NewProjectionRebuild(db, "projections", "events", "v2", createSchema, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "projections_v2", rebuild.ShadowTable())
+
+		var runs int
+		err = rebuild.Rebuild(context.Background(), func(ctx context.Context, shadowTable string) error {
+			assert.Equal(t, "projections_v2", shadowTable)
+			runs++
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, runs)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "Keep the projection table when the run fails", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectExec(`CREATE TABLE IF NOT EXISTS "projections_v2" \(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectQuery(`SELECT COALESCE\(MAX\(no\), 0\) FROM "events"`).WillReturnRows(sqlmock.NewRows([]string{"no"}).AddRow(1500))
+		dbMock.ExpectQuery(`SELECT no, aggregate_id FROM "events" WHERE no > \$1 ORDER BY no LIMIT 1000`).
+			WithArgs(500).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "aggregate_id"}))
+
+		rebuild, err := postgres.NewProjectionRebuild(db, "projections", "events", "v2", createSchema, nil)
+		require.NoError(t, err)
+
+		expectedErr := errors.New("projection failed")
+		err = rebuild.Rebuild(context.Background(), func(context.Context, string) error {
+			return expectedErr
+		})
+
+		assert.Equal(t, expectedErr, err)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
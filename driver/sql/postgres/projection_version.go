@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+)
+
+// streamProjectionVersion implements the sql.VersionedProjectorStorage methods for a stream projection table
+type streamProjectionVersion struct {
+	projectionName string
+
+	queryVersion      string
+	querySetVersion   string
+	queryResetVersion string
+}
+
+func newStreamProjectionVersion(projectionName, projectionTableQuoted string) streamProjectionVersion {
+	/* #nosec G201 */
+	return streamProjectionVersion{
+		projectionName: projectionName,
+
+		queryVersion: fmt.Sprintf(
+			`SELECT version, position FROM %s WHERE name = $1`,
+			projectionTableQuoted,
+		),
+		querySetVersion: fmt.Sprintf(
+			`UPDATE %s SET version = $2 WHERE name = $1`,
+			projectionTableQuoted,
+		),
+		queryResetVersion: fmt.Sprintf(
+			`UPDATE %s SET position = 0, state = '{}', version = $2 WHERE name = $1`,
+			projectionTableQuoted,
+		),
+	}
+}
+
+// ProjectionVersionMismatch returns true when the projection was projected by another version
+func (s *streamProjectionVersion) ProjectionVersionMismatch(ctx context.Context, conn *sql.Conn, version uint) (bool, error) {
+	var (
+		storedVersion uint
+		position      int64
+	)
+	err := conn.QueryRowContext(ctx, s.queryVersion, s.projectionName).Scan(&storedVersion, &position)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		return false, err
+	case storedVersion == version:
+		return false, nil
+	case position > 0:
+		return true, nil
+	}
+
+	// The projection never ran so it's safe to use the version
+	_, err = conn.ExecContext(ctx, s.querySetVersion, s.projectionName, version)
+	return false, err
+}
+
+// ResetProjection resets the projection so that it's projected from the start using the provided version
+func (s *streamProjectionVersion) ResetProjection(ctx context.Context, conn *sql.Conn, version uint) error {
+	_, err := conn.ExecContext(ctx, s.queryResetVersion, s.projectionName, version)
+	return err
+}
+
+// aggregateProjectionVersion implements the sql.VersionedProjectorStorage methods for a aggregate projection table
+type aggregateProjectionVersion struct {
+	// version contains the version persisted with new projections or -1 when the projection is not versioned
+	version int64
+
+	querySetVersion   string
+	queryMismatch     string
+	queryResetVersion string
+}
+
+func newAggregateProjectionVersion(projectionTableQuoted string) *aggregateProjectionVersion {
+	/* #nosec G201 */
+	return &aggregateProjectionVersion{
+		version: -1,
+
+		querySetVersion: fmt.Sprintf(
+			`UPDATE %s SET version = $1 WHERE version <> $1 AND position = 0`,
+			projectionTableQuoted,
+		),
+		queryMismatch: fmt.Sprintf(
+			`SELECT EXISTS(SELECT 1 FROM %s WHERE version <> $1)`,
+			projectionTableQuoted,
+		),
+		queryResetVersion: fmt.Sprintf(
+			`UPDATE %s SET position = 0, state = 'null', failed = FALSE, version = $1 WHERE version <> $1`,
+			projectionTableQuoted,
+		),
+	}
+}
+
+// ProjectionVersionMismatch returns true when any aggregate was projected by another version
+func (a *aggregateProjectionVersion) ProjectionVersionMismatch(ctx context.Context, conn *sql.Conn, version uint) (bool, error) {
+	atomic.StoreInt64(&a.version, int64(version))
+
+	// Projections that never ran are safe to use the version
+	if _, err := conn.ExecContext(ctx, a.querySetVersion, version); err != nil {
+		return false, err
+	}
+
+	var mismatch bool
+	err := conn.QueryRowContext(ctx, a.queryMismatch, version).Scan(&mismatch)
+
+	return mismatch, err
+}
+
+// ResetProjection resets all aggregate projections that where projected by another version
+func (a *aggregateProjectionVersion) ResetProjection(ctx context.Context, conn *sql.Conn, version uint) error {
+	_, err := conn.ExecContext(ctx, a.queryResetVersion, version)
+	return err
+}
+
+// projectionVersion returns the version to persist with new projections and false when the projection is not versioned
+func (a *aggregateProjectionVersion) projectionVersion() (int64, bool) {
+	version := atomic.LoadInt64(&a.version)
+	return version, version >= 0
+}
@@ -0,0 +1,94 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	mockSQL "github.com/hellofresh/goengine/mocks/driver/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamProjectionStorage_ProjectionVersionMismatch(t *testing.T) {
+	testCases := []struct {
+		title            string
+		storedVersion    uint
+		position         int64
+		expectedMismatch bool
+		expectSetVersion bool
+	}{
+		{"Same version", 2, 10, false, false},
+		{"Other version", 1, 10, true, false},
+		{"Other version without projected events", 1, 0, false, true},
+	}
+
+	for _, testCase := range testCases {
+		test.RunWithMockDB(t, testCase.title, func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+
+			dbMock.ExpectQuery(`SELECT version, position FROM "projections" WHERE name = \$1`).
+				WithArgs("my_projection").
+				WillReturnRows(sqlmock.NewRows([]string{"version", "position"}).AddRow(testCase.storedVersion, testCase.position))
+			if testCase.expectSetVersion {
+				dbMock.ExpectExec(`UPDATE "projections" SET version = \$2 WHERE name = \$1`).
+					WithArgs("my_projection", 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			storage, err := postgres.NewRowLockStreamProjectionStorage("my_projection", "projections", mockSQL.NewProjectionStateSerialization(ctrl), nil)
+			require.NoError(t, err)
+
+			conn, err := db.Conn(ctx)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			mismatch, err := storage.ProjectionVersionMismatch(ctx, conn, 2)
+			assert.NoError(t, err)
+			assert.Equal(t, testCase.expectedMismatch, mismatch)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAggregateProjectionStorage_ResetProjection(t *testing.T) {
+	test.RunWithMockDB(t, "Reset aggregates projected by another version", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		dbMock.ExpectExec(`UPDATE "agg_projections" SET version = \$1 WHERE version <> \$1 AND position = 0`).
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		dbMock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM "agg_projections" WHERE version <> \$1\)`).
+			WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		dbMock.ExpectExec(`UPDATE "agg_projections" SET position = 0, state = 'null', failed = FALSE, version = \$1 WHERE version <> \$1`).
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+
+		storage, err := postgres.NewAdvisoryLockAggregateProjectionStorage("events", "agg_projections", mockSQL.NewProjectionStateSerialization(ctrl), false, nil)
+		require.NoError(t, err)
+
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		mismatch, err := storage.ProjectionVersionMismatch(ctx, conn, 3)
+		assert.NoError(t, err)
+		assert.True(t, mismatch)
+
+		assert.NoError(t, storage.ResetProjection(ctx, conn, 3))
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+var _ driverSQL.ProjectorTransaction = &rowLockProjectorTransaction{}
+
+// rowLockProjectorTransaction is a ProjectorTransaction that holds the projection row lock within a database transaction.
+// The projection state is persisted and the row lock is released when the transaction is closed.
+type rowLockProjectorTransaction struct {
+	tx                *sql.Tx
+	queryPersistState string
+
+	stateSerialization driverSQL.ProjectionStateSerialization
+	rawState           *driverSQL.ProjectionRawState
+
+	projectionID    string
+	projectionState driverSQL.ProjectionState
+
+	logger goengine.Logger
+}
+
+func (t *rowLockProjectorTransaction) AcquireState(ctx context.Context) (driverSQL.ProjectionState, error) {
+	if t.rawState == nil {
+		return t.projectionState, nil
+	}
+
+	state, err := decodeProjectionState(ctx, t.stateSerialization, t.rawState)
+	if err != nil {
+		return state, err
+	}
+
+	t.projectionState = state
+	t.rawState = nil
+
+	return t.projectionState, err
+}
+
+func (t *rowLockProjectorTransaction) CommitState(newState driverSQL.ProjectionState) error {
+	encodedState, err := t.stateSerialization.EncodeState(newState.ProjectionState)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.tx.ExecContext(context.Background(), t.queryPersistState, t.projectionID, newState.Position, encodedState)
+	if err != nil {
+		return err
+	}
+
+	t.projectionState = newState
+
+	t.logger.Debug("updated projection state", func(e goengine.LoggerEntry) {
+		e.String("projection_id", t.projectionID)
+		e.Int64("projection_position", newState.Position)
+		e.Any("state", newState)
+	})
+
+	return nil
+}
+
+func (t *rowLockProjectorTransaction) Close() error {
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+
+	t.logger.Debug("released projection row lock", func(e goengine.LoggerEntry) {
+		e.String("projection_id", t.projectionID)
+	})
+
+	return nil
+}
+
+// acquireRowLock begins a transaction on the connection and locks the projection row using the provided query.
+// When the row cannot be locked the projectionRequired query is used to determine if the row is locked by another
+// process or if no projection is required.
+func acquireRowLock(
+	ctx context.Context,
+	conn *sql.Conn,
+	queryAcquireLock string,
+	queryAcquireLockArgs []interface{},
+	queryProjectionRequired string,
+	scan func(row *sql.Row) error,
+	logger goengine.Logger,
+) (*sql.Tx, error) {
+	// The transaction is not bound to the context to allow the projector to persist it's progress on Close
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = scan(tx.QueryRowContext(ctx, queryAcquireLock, queryAcquireLockArgs...))
+	if err == nil {
+		return tx, nil
+	}
+
+	if rollbackErr := tx.Rollback(); rollbackErr != nil {
+		logger.Warn("failed to rollback projection transaction", func(e goengine.LoggerEntry) {
+			e.Error(rollbackErr)
+		})
+	}
+
+	if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// No rows are returned when the row is locked by another process or when the projector is already at the
+	// notification position
+	var required bool
+	if err := conn.QueryRowContext(ctx, queryProjectionRequired, queryAcquireLockArgs...).Scan(&required); err != nil {
+		return nil, err
+	}
+
+	if required {
+		return nil, driverSQL.ErrProjectionFailedToLock
+	}
+
+	return nil, driverSQL.ErrNoProjectionRequired
+}
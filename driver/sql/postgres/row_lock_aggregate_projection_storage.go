@@ -0,0 +1,173 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+var (
+	_ driverSQL.AggregateProjectorStorage = &RowLockAggregateProjectionStorage{}
+	_ driverSQL.VersionedProjectorStorage = &RowLockAggregateProjectionStorage{}
+)
+
+// RowLockAggregateProjectionStorage is a AggregateProjectorStorage that uses `SELECT ... FOR UPDATE SKIP LOCKED` within
+// a transaction to lock a projection.
+// Unlike the AdvisoryLockAggregateProjectionStorage it does not rely on session level locks which makes it usable with
+// transaction pooling (e.g. PgBouncer in transaction mode).
+type RowLockAggregateProjectionStorage struct {
+	*aggregateProjectionVersion
+
+	stateSerialization driverSQL.ProjectionStateSerialization
+
+	logger goengine.Logger
+
+	queryOutOfSyncProjections string
+	queryPersistState         string
+	queryPersistFailure       string
+	queryCreateProjection     string
+	queryCreateVersioned      string
+	queryAcquireLock          string
+	queryProjectionRequired   string
+}
+
+// NewRowLockAggregateProjectionStorage returns a new RowLockAggregateProjectionStorage
+func NewRowLockAggregateProjectionStorage(
+	eventStoreTable,
+	projectionTable string,
+	projectionStateSerialization driverSQL.ProjectionStateSerialization,
+	logger goengine.Logger,
+) (*RowLockAggregateProjectionStorage, error) {
+	switch {
+	case strings.TrimSpace(projectionTable) == "":
+		return nil, goengine.InvalidArgumentError("projectionTable")
+	case strings.TrimSpace(eventStoreTable) == "":
+		return nil, goengine.InvalidArgumentError("eventStoreTable")
+	case projectionStateSerialization == nil:
+		return nil, goengine.InvalidArgumentError("projectionStateSerialization")
+	}
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	projectionTableQuoted := QuoteIdentifier(projectionTable)
+	eventStoreTableQuoted := QuoteIdentifier(eventStoreTable)
+
+	/* #nosec G201 */
+	return &RowLockAggregateProjectionStorage{
+		aggregateProjectionVersion: newAggregateProjectionVersion(projectionTableQuoted),
+		stateSerialization:         projectionStateSerialization,
+		logger:                     logger,
+
+		queryOutOfSyncProjections: aggregateOutOfSyncProjectionsQuery(eventStoreTableQuoted, projectionTableQuoted),
+		queryPersistState: fmt.Sprintf(
+			`UPDATE %[1]s SET position = $2, state = $3 WHERE aggregate_id = $1`,
+			projectionTableQuoted,
+		),
+		queryPersistFailure: fmt.Sprintf(
+			`UPDATE %[1]s SET failed = TRUE WHERE aggregate_id = $1`,
+			projectionTableQuoted,
+		),
+		// The reason for using `INSERT SELECT` instead of `INSERT VALUES ON CONFLICT DO NOTHING` is that `ON CONFLICT` will
+		// increase the `no SERIAL` value.
+		queryCreateProjection: fmt.Sprintf(
+			`INSERT INTO %[1]s (aggregate_id, state) SELECT $1, 'null' WHERE NOT EXISTS (
+			   SELECT 1 FROM %[1]s WHERE aggregate_id = $1
+			 ) ON CONFLICT DO NOTHING`,
+			projectionTableQuoted,
+		),
+		queryCreateVersioned: fmt.Sprintf(
+			`INSERT INTO %[1]s (aggregate_id, state, version) SELECT $1, 'null', $2 WHERE NOT EXISTS (
+			   SELECT 1 FROM %[1]s WHERE aggregate_id = $1
+			 ) ON CONFLICT DO NOTHING`,
+			projectionTableQuoted,
+		),
+		queryAcquireLock: fmt.Sprintf(
+			`SELECT locked, failed, position, state FROM %[1]s WHERE aggregate_id = $1 AND (position < $2 OR failed) FOR UPDATE SKIP LOCKED`,
+			projectionTableQuoted,
+		),
+		queryProjectionRequired: fmt.Sprintf(
+			`SELECT EXISTS(SELECT 1 FROM %[1]s WHERE aggregate_id = $1 AND (position < $2 OR failed))`,
+			projectionTableQuoted,
+		),
+	}, nil
+}
+
+// LoadOutOfSync return a set of rows with the aggregate_id and number of the projection that are not in sync with the event store
+func (a *RowLockAggregateProjectionStorage) LoadOutOfSync(ctx context.Context, conn driverSQL.Queryer) (*sql.Rows, error) {
+	return conn.QueryContext(ctx, a.queryOutOfSyncProjections)
+}
+
+// PersistFailure marks the specified aggregate_id projection as failed
+func (a *RowLockAggregateProjectionStorage) PersistFailure(conn driverSQL.Execer, notification *driverSQL.ProjectionNotification) error {
+	_, err := conn.ExecContext(context.Background(), a.queryPersistFailure, notification.AggregateID)
+	return err
+}
+
+// Acquire returns a driverSQL.ProjectorTransaction and the position of the projection within the event stream when
+// the projection row of the specified aggregate_id is locked. Otherwise an error is returned indicating why the lock
+// could not be acquired.
+func (a *RowLockAggregateProjectionStorage) Acquire(
+	ctx context.Context,
+	conn *sql.Conn,
+	notification *driverSQL.ProjectionNotification,
+) (driverSQL.ProjectorTransaction, int64, error) {
+	logFields := func(e goengine.LoggerEntry) {
+		e.Int64("notification.no", notification.No)
+		e.String("projection_id", notification.AggregateID)
+	}
+	aggregateID := notification.AggregateID
+
+	// Ensure the projection row exists so it can be locked
+	var err error
+	if version, versioned := a.projectionVersion(); versioned {
+		_, err = conn.ExecContext(ctx, a.queryCreateVersioned, aggregateID, version)
+	} else {
+		_, err = conn.ExecContext(ctx, a.queryCreateProjection, aggregateID)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		locked, failed  bool
+		projectionState driverSQL.ProjectionRawState
+	)
+	args := []interface{}{aggregateID, notification.No}
+	tx, err := acquireRowLock(ctx, conn, a.queryAcquireLock, args, a.queryProjectionRequired, func(row *sql.Row) error {
+		return row.Scan(&locked, &failed, &projectionState.Position, &projectionState.ProjectionState)
+	}, a.logger)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if locked || failed {
+		// The projection was locked by another process that died and for this reason not unlocked
+		// In this case a application needs to decide what to do to avoid invalid projection states
+		if err := tx.Rollback(); err != nil {
+			a.logger.Error("failed to release row lock for a projection with a locked row", func(e goengine.LoggerEntry) {
+				logFields(e)
+				e.Error(err)
+			})
+		}
+
+		return nil, 0, driverSQL.ErrProjectionPreviouslyLocked
+	}
+
+	a.logger.Debug("acquired projection row lock", logFields)
+
+	return &rowLockProjectorTransaction{
+		tx:                tx,
+		queryPersistState: a.queryPersistState,
+
+		stateSerialization: a.stateSerialization,
+		rawState:           &projectionState,
+
+		projectionID: aggregateID,
+		logger:       a.logger,
+	}, projectionState.Position, nil
+}
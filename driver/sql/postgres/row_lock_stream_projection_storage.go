@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+)
+
+var (
+	_ driverSQL.StreamProjectorStorage      = &RowLockStreamProjectionStorage{}
+	_ driverSQL.VersionedProjectorStorage   = &RowLockStreamProjectionStorage{}
+	_ driverSQL.StreamProjectionNamesLoader = &RowLockStreamProjectionStorage{}
+)
+
+// RowLockStreamProjectionStorage is a StreamProjectorStorage that uses `SELECT ... FOR UPDATE SKIP LOCKED` within a
+// transaction to lock a projection.
+// Unlike the AdvisoryLockStreamProjectionStorage it does not rely on session level locks which makes it usable with
+// transaction pooling (e.g. PgBouncer in transaction mode).
+type RowLockStreamProjectionStorage struct {
+	streamProjectionVersion
+	streamProjectionNames
+
+	projectionName               string
+	projectionStateSerialization driverSQL.ProjectionStateSerialization
+
+	logger goengine.Logger
+
+	queryCreateProjection           string
+	queryAcquireLock                string
+	queryAcquirePositionLock        string
+	queryProjectionRequired         string
+	queryPositionProjectionRequired string
+	queryPersistState               string
+}
+
+// NewRowLockStreamProjectionStorage returns a new RowLockStreamProjectionStorage
+func NewRowLockStreamProjectionStorage(
+	projectionName,
+	projectionTable string,
+	projectionStateSerialization driverSQL.ProjectionStateSerialization,
+	logger goengine.Logger,
+) (*RowLockStreamProjectionStorage, error) {
+	switch {
+	case strings.TrimSpace(projectionName) == "":
+		return nil, goengine.InvalidArgumentError("projectionName")
+	case strings.TrimSpace(projectionTable) == "":
+		return nil, goengine.InvalidArgumentError("projectionTable")
+	case projectionStateSerialization == nil:
+		return nil, goengine.InvalidArgumentError("projectionStateSerialization")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	projectionTableQuoted := QuoteIdentifier(projectionTable)
+
+	/* #nosec G201 */
+	return &RowLockStreamProjectionStorage{
+		streamProjectionVersion:      newStreamProjectionVersion(projectionName, projectionTableQuoted),
+		streamProjectionNames:        newStreamProjectionNames(projectionTableQuoted),
+		projectionName:               projectionName,
+		projectionStateSerialization: projectionStateSerialization,
+		logger:                       logger,
+
+		queryCreateProjection: fmt.Sprintf(
+			`INSERT INTO %s (name) VALUES ($1) ON CONFLICT DO NOTHING`,
+			projectionTableQuoted,
+		),
+		queryAcquireLock: fmt.Sprintf(
+			`SELECT locked, position, state FROM %[1]s WHERE name = $1 FOR UPDATE SKIP LOCKED`,
+			projectionTableQuoted,
+		),
+		queryAcquirePositionLock: fmt.Sprintf(
+			`SELECT locked, position, state FROM %[1]s WHERE name = $1 AND position < $2 FOR UPDATE SKIP LOCKED`,
+			projectionTableQuoted,
+		),
+		queryProjectionRequired: fmt.Sprintf(
+			`SELECT EXISTS(SELECT 1 FROM %[1]s WHERE name = $1)`,
+			projectionTableQuoted,
+		),
+		queryPositionProjectionRequired: fmt.Sprintf(
+			`SELECT EXISTS(SELECT 1 FROM %[1]s WHERE name = $1 AND position < $2)`,
+			projectionTableQuoted,
+		),
+		queryPersistState: fmt.Sprintf(
+			`UPDATE %[1]s SET position = $2, state = $3 WHERE name = $1`,
+			projectionTableQuoted,
+		),
+	}, nil
+}
+
+// CreateProjection creates the row in the projection table for the stream projection
+func (s *RowLockStreamProjectionStorage) CreateProjection(ctx context.Context, conn driverSQL.Execer) error {
+	_, err := conn.ExecContext(ctx, s.queryCreateProjection, s.projectionName)
+	return err
+}
+
+// Acquire returns a driverSQL.ProjectorTransaction and the position of the projection within the event stream when
+// the projection row is locked. Otherwise an error is returned indicating why the lock could not be acquired.
+func (s *RowLockStreamProjectionStorage) Acquire(
+	ctx context.Context,
+	conn *sql.Conn,
+	notification *driverSQL.ProjectionNotification,
+) (driverSQL.ProjectorTransaction, int64, error) {
+	var (
+		queryAcquireLock        string
+		queryProjectionRequired string
+		args                    []interface{}
+		logFields               func(e goengine.LoggerEntry)
+	)
+	if notification == nil {
+		queryAcquireLock = s.queryAcquireLock
+		queryProjectionRequired = s.queryProjectionRequired
+		args = []interface{}{s.projectionName}
+		logFields = func(e goengine.LoggerEntry) {
+			e.Any("notification", nil)
+		}
+	} else {
+		queryAcquireLock = s.queryAcquirePositionLock
+		queryProjectionRequired = s.queryPositionProjectionRequired
+		args = []interface{}{s.projectionName, notification.No}
+		logFields = func(e goengine.LoggerEntry) {
+			e.Int64("notification.no", notification.No)
+			e.String("notification.aggregate_id", notification.AggregateID)
+		}
+	}
+
+	var (
+		locked          bool
+		projectionState driverSQL.ProjectionRawState
+	)
+	tx, err := acquireRowLock(ctx, conn, queryAcquireLock, args, queryProjectionRequired, func(row *sql.Row) error {
+		return row.Scan(&locked, &projectionState.Position, &projectionState.ProjectionState)
+	}, s.logger)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if locked {
+		// The projection was locked by another process that died and for this reason not unlocked
+		// In this case a application needs to decide what to do to avoid invalid projection states
+		if err := tx.Rollback(); err != nil {
+			s.logger.Error("failed to release row lock for a projection with a locked row", func(e goengine.LoggerEntry) {
+				logFields(e)
+				e.Error(err)
+			})
+		}
+
+		return nil, 0, driverSQL.ErrProjectionPreviouslyLocked
+	}
+
+	s.logger.Debug("acquired projection row lock", logFields)
+
+	return &rowLockProjectorTransaction{
+		tx:                tx,
+		queryPersistState: s.queryPersistState,
+
+		stateSerialization: s.projectionStateSerialization,
+		rawState:           &projectionState,
+
+		projectionID: s.projectionName,
+		logger:       s.logger,
+	}, projectionState.Position, nil
+}
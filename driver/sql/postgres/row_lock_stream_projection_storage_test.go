@@ -0,0 +1,175 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	mockSQL "github.com/hellofresh/goengine/mocks/driver/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRowLockStreamProjectionStorage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	serialization := mockSQL.NewProjectionStateSerialization(ctrl)
+	testCases := []struct {
+		title                 string
+		projectionName        string
+		projectionTable       string
+		serialization         driverSQL.ProjectionStateSerialization
+		expectedArgumentError string
+	}{
+		{"No projection name", "", "projections", serialization, "projectionName"},
+		{"No projection table", "my_projection", " ", serialization, "projectionTable"},
+		{"No serialization", "my_projection", "projections", nil, "projectionStateSerialization"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			storage, err := postgres.NewRowLockStreamProjectionStorage(
+				testCase.projectionName,
+				testCase.projectionTable,
+				testCase.serialization,
+				nil,
+			)
+
+			assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedArgumentError), err)
+			assert.Nil(t, storage)
+		})
+	}
+}
+
+func TestRowLockStreamProjectionStorage_Acquire(t *testing.T) {
+	notification := &driverSQL.ProjectionNotification{No: 3, AggregateID: "20a151cc-e44e-4133-9491-8dc341032d37"}
+
+	test.RunWithMockDB(t, "Acquire, commit and release", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+		serialization := mockSQL.NewProjectionStateSerialization(ctrl)
+		serialization.EXPECT().DecodeState([]byte(`{"total":1}`)).Return(1, nil)
+		serialization.EXPECT().EncodeState(2).Return([]byte(`{"total":2}`), nil)
+
+		dbMock.ExpectBegin()
+		dbMock.ExpectQuery(`SELECT locked, position, state FROM "projections" WHERE name = \$1 AND position < \$2 FOR UPDATE SKIP LOCKED`).
+			WithArgs("my_projection", 3).
+			WillReturnRows(sqlmock.NewRows([]string{"locked", "position", "state"}).AddRow(false, 2, []byte(`{"total":1}`)))
+		dbMock.ExpectExec(`UPDATE "projections" SET position = \$2, state = \$3 WHERE name = \$1`).
+			WithArgs("my_projection", 3, []byte(`{"total":2}`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectCommit()
+
+		storage, err := postgres.NewRowLockStreamProjectionStorage("my_projection", "projections", serialization, nil)
+		require.NoError(t, err)
+
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		tx, position, err := storage.Acquire(ctx, conn, notification)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), position)
+
+		state, err := tx.AcquireState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, driverSQL.ProjectionState{Position: 2, ProjectionState: 1}, state)
+
+		assert.NoError(t, tx.CommitState(driverSQL.ProjectionState{Position: 3, ProjectionState: 2}))
+		assert.NoError(t, tx.Close())
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	lockFailures := []struct {
+		title         string
+		required      bool
+		expectedError error
+	}{
+		{"Locked by another process", true, driverSQL.ErrProjectionFailedToLock},
+		{"No projection required", false, driverSQL.ErrNoProjectionRequired},
+	}
+	for _, testCase := range lockFailures {
+		test.RunWithMockDB(t, testCase.title, func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+
+			dbMock.ExpectBegin()
+			dbMock.ExpectQuery(`SELECT locked, position, state FROM "projections" WHERE name = \$1 AND position < \$2 FOR UPDATE SKIP LOCKED`).
+				WithArgs("my_projection", 3).
+				WillReturnRows(sqlmock.NewRows([]string{"locked", "position", "state"}))
+			dbMock.ExpectRollback()
+			dbMock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM "projections" WHERE name = \$1 AND position < \$2\)`).
+				WithArgs("my_projection", 3).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(testCase.required))
+
+			storage, err := postgres.NewRowLockStreamProjectionStorage("my_projection", "projections", mockSQL.NewProjectionStateSerialization(ctrl), nil)
+			require.NoError(t, err)
+
+			conn, err := db.Conn(ctx)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			tx, _, err := storage.Acquire(ctx, conn, notification)
+			assert.Equal(t, testCase.expectedError, err)
+			assert.Nil(t, tx)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+
+	test.RunWithMockDB(t, "Previously locked", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		ctx := context.Background()
+
+		dbMock.ExpectBegin()
+		dbMock.ExpectQuery(`SELECT locked, position, state FROM "projections" WHERE name = \$1 FOR UPDATE SKIP LOCKED`).
+			WithArgs("my_projection").
+			WillReturnRows(sqlmock.NewRows([]string{"locked", "position", "state"}).AddRow(true, 2, []byte(`{}`)))
+		dbMock.ExpectRollback()
+
+		storage, err := postgres.NewRowLockStreamProjectionStorage("my_projection", "projections", mockSQL.NewProjectionStateSerialization(ctrl), nil)
+		require.NoError(t, err)
+
+		conn, err := db.Conn(ctx)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		tx, _, err := storage.Acquire(ctx, conn, nil)
+		assert.Equal(t, driverSQL.ErrProjectionPreviouslyLocked, err)
+		assert.Nil(t, tx)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func TestRowLockStreamProjectionStorage_ProjectionNames(t *testing.T) {
+	test.RunWithMockDB(t, "Load projection names", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		dbMock.ExpectQuery(`SELECT name FROM "projections" WHERE substr\(name, 1, length\(\$1\)\) = \$1 ORDER BY name`).
+			WithArgs("orders#").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("orders#0/2").AddRow("orders#1/2"))
+
+		storage, err := postgres.NewRowLockStreamProjectionStorage("orders#0/2", "projections", mockSQL.NewProjectionStateSerialization(ctrl), nil)
+		require.NoError(t, err)
+
+		names, err := storage.ProjectionNames(context.Background(), db, "orders#")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"orders#0/2", "orders#1/2"}, names)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
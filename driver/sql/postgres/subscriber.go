@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/hellofresh/goengine"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/metadata"
+)
+
+// Ensure Subscriber implements goengine.CatchUpSubscriber
+var _ goengine.CatchUpSubscriber = &Subscriber{}
+
+// ListenerFactory returns a Listener that is triggered when events are appended to the stream
+type ListenerFactory func(streamName goengine.StreamName) (driverSQL.Listener, error)
+
+// Subscriber is a goengine.CatchUpSubscriber for the EventStore.
+// The subscriptions load the events from the EventStore every time the Listener of the stream is triggered.
+// It is the same as calling EventStore.SubscribeFrom after EventStore.WithListenerFactory.
+type Subscriber struct {
+	eventStore      *EventStore
+	listenerFactory ListenerFactory
+
+	logger goengine.Logger
+}
+
+// NewSubscriber returns a new Subscriber
+func NewSubscriber(eventStore *EventStore, listenerFactory ListenerFactory, logger goengine.Logger) (*Subscriber, error) {
+	switch {
+	case eventStore == nil:
+		return nil, goengine.InvalidArgumentError("eventStore")
+	case listenerFactory == nil:
+		return nil, goengine.InvalidArgumentError("listenerFactory")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	return &Subscriber{
+		eventStore:      eventStore,
+		listenerFactory: listenerFactory,
+		logger:          logger,
+	}, nil
+}
+
+// SubscribeFrom starts a goengine.CatchUpSubscription on the stream beginning at the message with number fromNumber
+func (s *Subscriber) SubscribeFrom(
+	ctx context.Context,
+	streamName goengine.StreamName,
+	fromNumber int64,
+	matcher metadata.Matcher,
+	handler goengine.SubscriptionHandler,
+	checkpoint goengine.SubscriptionCheckpoint,
+) (goengine.CatchUpSubscription, error) {
+	return subscribeFrom(ctx, s.eventStore, s.listenerFactory, streamName, fromNumber, matcher, handler, checkpoint, s.logger)
+}
+
+// subscribeFrom starts a goengine.CatchUpSubscription that loads the events every time the Listener is triggered
+func subscribeFrom(
+	ctx context.Context,
+	eventStore *EventStore,
+	listenerFactory ListenerFactory,
+	streamName goengine.StreamName,
+	fromNumber int64,
+	matcher metadata.Matcher,
+	handler goengine.SubscriptionHandler,
+	checkpoint goengine.SubscriptionCheckpoint,
+	logger goengine.Logger,
+) (goengine.CatchUpSubscription, error) {
+	listener, err := listenerFactory(streamName)
+	if err != nil {
+		return nil, err
+	}
+
+	// A Listener triggers once it started listening and for every appended event
+	notifier := func(ctx context.Context, notify func()) error {
+		return listener.Listen(ctx, func(context.Context, *driverSQL.ProjectionNotification) error {
+			notify()
+			return nil
+		})
+	}
+
+	return goengine.StartCatchUpSubscription(ctx, eventStore, notifier, streamName, fromNumber, matcher, handler, checkpoint, logger)
+}
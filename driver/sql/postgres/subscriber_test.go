@@ -0,0 +1,211 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	driverSQL "github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/mocks"
+	mockSQL "github.com/hellofresh/goengine/mocks/driver/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listenerStub func(ctx context.Context, trigger driverSQL.ProjectionTrigger) error
+
+func (l listenerStub) Listen(ctx context.Context, trigger driverSQL.ProjectionTrigger) error {
+	return l(ctx, trigger)
+}
+
+func TestNewSubscriber(t *testing.T) {
+	test.RunWithMockDB(t, "Invalid arguments", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := createSubscriberEventStore(t, ctrl, db)
+
+		subscriber, err := postgres.NewSubscriber(nil, func(goengine.StreamName) (driverSQL.Listener, error) {
+			return nil, nil
+		}, nil)
+		assert.Nil(t, subscriber)
+		assert.Equal(t, goengine.InvalidArgumentError("eventStore"), err)
+
+		subscriber, err = postgres.NewSubscriber(store, nil, nil)
+		assert.Nil(t, subscriber)
+		assert.Equal(t, goengine.InvalidArgumentError("listenerFactory"), err)
+	})
+}
+
+func TestSubscriber_SubscribeFrom(t *testing.T) {
+	test.RunWithMockDB(t, "Load messages when the listener is triggered", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		messages := []goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 1, metadata.New(), time.Now()),
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 2, metadata.New(), time.Now()),
+		}
+
+		stream := func() (goengine.EventStream, error) {
+			return inmemory.NewEventStream(messages, []int64{5, 6})
+		}
+
+		// The subscription loads the message numbers and the matching messages
+		for i := 0; i < 2; i++ {
+			dbMock.ExpectQuery(`SELECT "no", "payload", "metadata" FROM event_stream WHERE no >= \$1 ORDER BY no LIMIT 1000`).
+				WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"no", "payload", "metadata"}))
+		}
+
+		store := createSubscriberEventStore(t, ctrl, db, stream, stream)
+
+		subscriber, err := postgres.NewSubscriber(store, func(streamName goengine.StreamName) (driverSQL.Listener, error) {
+			assert.Equal(t, goengine.StreamName("event_stream"), streamName)
+
+			return listenerStub(func(ctx context.Context, trigger driverSQL.ProjectionTrigger) error {
+				if err := trigger(ctx, nil); err != nil {
+					return err
+				}
+
+				<-ctx.Done()
+				return nil
+			}), nil
+		}, nil)
+		require.NoError(t, err)
+
+		checkpoints := make(chan int64, 1)
+		subscription, err := subscriber.SubscribeFrom(
+			context.Background(),
+			"event_stream",
+			5,
+			nil,
+			func(context.Context, goengine.Message, int64) error { return nil },
+			func(ctx context.Context, messageNumber int64) error {
+				checkpoints <- messageNumber
+				return nil
+			},
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(6), <-checkpoints)
+		assert.NoError(t, subscription.Close())
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+
+	test.RunWithMockDB(t, "Listener factory failure", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		expectedErr := errors.New("no listener")
+		subscriber, err := postgres.NewSubscriber(createSubscriberEventStore(t, ctrl, db), func(goengine.StreamName) (driverSQL.Listener, error) {
+			return nil, expectedErr
+		}, nil)
+		require.NoError(t, err)
+
+		subscription, err := subscriber.SubscribeFrom(context.Background(), "event_stream", 1, nil, func(context.Context, goengine.Message, int64) error {
+			return nil
+		}, nil)
+
+		assert.Nil(t, subscription)
+		assert.Equal(t, expectedErr, err)
+	})
+}
+
+func TestEventStore_SubscribeFrom(t *testing.T) {
+	test.RunWithMockDB(t, "No listener factory", func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		store := createSubscriberEventStore(t, ctrl, db)
+
+		subscription, err := store.SubscribeFrom(context.Background(), "event_stream", 1, nil, func(context.Context, goengine.Message, int64) error {
+			return nil
+		}, nil)
+
+		assert.Nil(t, subscription)
+		assert.Equal(t, postgres.ErrNoListenerFactory, err)
+	})
+
+	test.RunWithMockDB(t, "Load messages when the listener is triggered", func(t *testing.T, db *sql.DB, dbMock sqlmock.Sqlmock) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		messages := []goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), 1, metadata.New(), time.Now()),
+		}
+
+		stream := func() (goengine.EventStream, error) {
+			return inmemory.NewEventStream(messages, []int64{1})
+		}
+
+		// The subscription loads the message numbers and the matching messages
+		for i := 0; i < 2; i++ {
+			dbMock.ExpectQuery(`SELECT "no", "payload", "metadata" FROM event_stream WHERE no >= \$1 ORDER BY no LIMIT 1000`).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"no", "payload", "metadata"}))
+		}
+
+		store := createSubscriberEventStore(t, ctrl, db, stream, stream)
+		store.WithListenerFactory(func(goengine.StreamName) (driverSQL.Listener, error) {
+			return listenerStub(func(ctx context.Context, trigger driverSQL.ProjectionTrigger) error {
+				if err := trigger(ctx, nil); err != nil {
+					return err
+				}
+
+				<-ctx.Done()
+				return nil
+			}), nil
+		})
+
+		handled := make(chan int64, 1)
+		subscription, err := store.SubscribeFrom(
+			context.Background(),
+			"event_stream",
+			1,
+			nil,
+			func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+				handled <- messageNumber
+				return nil
+			},
+			nil,
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), <-handled)
+		assert.NoError(t, subscription.Close())
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func createSubscriberEventStore(t *testing.T, ctrl *gomock.Controller, db *sql.DB, streams ...func() (goengine.EventStream, error)) *postgres.EventStore {
+	strategy := mockSQL.NewPersistenceStrategy(ctrl)
+	strategy.EXPECT().PrepareSearch(gomock.Any()).Return([]byte{}, []interface{}{}).AnyTimes()
+	strategy.EXPECT().InsertColumnNames().Return([]string{}).AnyTimes()
+	strategy.EXPECT().EventColumnNames().Return([]string{"no", "payload", "metadata"}).AnyTimes()
+	strategy.EXPECT().GenerateTableName(goengine.StreamName("event_stream")).Return("event_stream", nil).AnyTimes()
+
+	factory := mockSQL.NewMessageFactory(ctrl)
+	for _, stream := range streams {
+		stream := stream
+		factory.EXPECT().CreateEventStream(gomock.AssignableToTypeOf(&sql.Rows{})).DoAndReturn(func(*sql.Rows) (goengine.EventStream, error) {
+			return stream()
+		})
+	}
+
+	store, err := postgres.NewEventStore(strategy, db, factory, nil)
+	require.NoError(t, err)
+
+	return store
+}
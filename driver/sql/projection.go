@@ -18,6 +18,9 @@ type (
 		No          int64     `json:"no"`
 		AggregateID string    `json:"aggregate_id"`
 		ValidAfter  time.Time `json:"valid_after"`
+
+		// done is called once the notification was projected
+		done NotificationDone
 	}
 
 	// ProjectionTrigger triggers the notification for processing
@@ -79,6 +82,24 @@ type (
 		CreateProjection(ctx context.Context, conn Execer) error
 	}
 
+	// StreamProjectionNamesLoader is a StreamProjectorStorage that is able to load the names of the stored projections
+	StreamProjectionNamesLoader interface {
+		// ProjectionNames returns the names of the stored projections that start with the prefix
+		ProjectionNames(ctx context.Context, conn Queryer, prefix string) ([]string, error)
+	}
+
+	// VersionedProjectorStorage is a ProjectorStorage that persists the version of the projection with it's state
+	VersionedProjectorStorage interface {
+		ProjectorStorage
+
+		// ProjectionVersionMismatch returns true when projection state exists that was projected by another version.
+		// The provided version is persisted with any projection state created afterwards.
+		ProjectionVersionMismatch(ctx context.Context, conn *sql.Conn, version uint) (bool, error)
+
+		// ResetProjection resets the projection state so that it's projected from the start using the provided version
+		ResetProjection(ctx context.Context, conn *sql.Conn, version uint) error
+	}
+
 	// ProjectorTransaction is a transaction type object returned by the ProjectorStorage
 	ProjectorTransaction interface {
 		AcquireState(ctx context.Context) (ProjectionState, error)
@@ -88,6 +109,23 @@ type (
 	}
 )
 
+// IsHeartbeat returns true when the notification is a heartbeat send to check that a Listener receives notifications.
+// Event numbers start at 1 so a notification without a number is never the result of an appended event.
+func (p *ProjectionNotification) IsHeartbeat() bool {
+	return p != nil && p.No == 0
+}
+
+// projected calls the NotificationDone of the notification, if any, and removes it so that it's only called once
+func (p *ProjectionNotification) projected(err error) {
+	if p == nil || p.done == nil {
+		return
+	}
+
+	done := p.done
+	p.done = nil
+	done(err)
+}
+
 // UnmarshalJSON supports json.Unmarshaler interface
 func (p *ProjectionNotification) UnmarshalJSON(data []byte) error {
 	r := jlexer.Lexer{Data: data}
@@ -0,0 +1,109 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/hellofresh/goengine"
+)
+
+// VersionMismatchHandler is called when the projection state was projected by another version of the projection.
+// When the handler returns without an error the projector will check the projection version again.
+type VersionMismatchHandler func(ctx context.Context, conn *sql.Conn, storage VersionedProjectorStorage, version uint) error
+
+// VersionMismatchFail is a VersionMismatchHandler that fails with ErrProjectionVersionMismatch
+func VersionMismatchFail(context.Context, *sql.Conn, VersionedProjectorStorage, uint) error {
+	return ErrProjectionVersionMismatch
+}
+
+// VersionMismatchReset is a VersionMismatchHandler that resets the projection so it's projected from the start
+func VersionMismatchReset(ctx context.Context, conn *sql.Conn, storage VersionedProjectorStorage, version uint) error {
+	return storage.ResetProjection(ctx, conn, version)
+}
+
+// VersionMismatchRebuild returns a VersionMismatchHandler that calls rebuild.
+// This can be used to do a blue/green rebuild of the projection, for example by using postgres.ProjectionRebuild.
+func VersionMismatchRebuild(rebuild func(ctx context.Context) error) VersionMismatchHandler {
+	return func(ctx context.Context, _ *sql.Conn, _ VersionedProjectorStorage, _ uint) error {
+		return rebuild(ctx)
+	}
+}
+
+// projectionVersionChecker checks the version of a goengine.VersionedProjection against the stored projection state
+type projectionVersionChecker struct {
+	db      *sql.DB
+	storage VersionedProjectorStorage
+	version uint
+	handler VersionMismatchHandler
+
+	logger goengine.Logger
+}
+
+// newProjectionVersionChecker returns a projectionVersionChecker or nil when the projection or storage is not versioned
+func newProjectionVersionChecker(
+	db *sql.DB,
+	projection goengine.Projection,
+	storage ProjectorStorage,
+	logger goengine.Logger,
+) *projectionVersionChecker {
+	versionedProjection, ok := projection.(goengine.VersionedProjection)
+	if !ok {
+		return nil
+	}
+
+	versionedStorage, ok := storage.(VersionedProjectorStorage)
+	if !ok {
+		logger.Warn("projection is versioned but the projector storage does not support versions", nil)
+		return nil
+	}
+
+	return &projectionVersionChecker{
+		db:      db,
+		storage: versionedStorage,
+		version: versionedProjection.Version(),
+		handler: VersionMismatchFail,
+		logger:  logger,
+	}
+}
+
+// check ensures the stored projection state was projected by the version of the projection
+func (c *projectionVersionChecker) check(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+
+	conn, err := AcquireConn(ctx, c.db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			c.logger.Warn("failed to db close version connection", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	mismatch, err := c.storage.ProjectionVersionMismatch(ctx, conn, c.version)
+	if err != nil || !mismatch {
+		return err
+	}
+
+	c.logger.Info("projection version mismatch", func(e goengine.LoggerEntry) {
+		e.Int64("projection_version", int64(c.version))
+	})
+
+	if err := c.handler(ctx, conn, c.storage, c.version); err != nil {
+		return err
+	}
+
+	mismatch, err = c.storage.ProjectionVersionMismatch(ctx, conn, c.version)
+	if err != nil {
+		return err
+	}
+	if mismatch {
+		return ErrProjectionVersionMismatch
+	}
+
+	return nil
+}
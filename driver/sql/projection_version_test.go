@@ -0,0 +1,104 @@
+// +build unit
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/internal/test"
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedProjectionStub struct {
+	goengine.Projection
+	version uint
+}
+
+func (p *versionedProjectionStub) Version() uint {
+	return p.version
+}
+
+type storageStub struct {
+	ProjectorStorage
+}
+
+type versionedStorageStub struct {
+	ProjectorStorage
+
+	storedVersion uint
+	resets        int
+}
+
+func (s *versionedStorageStub) ProjectionVersionMismatch(_ context.Context, _ *sql.Conn, version uint) (bool, error) {
+	return s.storedVersion != version, nil
+}
+
+func (s *versionedStorageStub) ResetProjection(_ context.Context, _ *sql.Conn, version uint) error {
+	s.resets++
+	s.storedVersion = version
+	return nil
+}
+
+func TestNewProjectionVersionChecker(t *testing.T) {
+	t.Run("Projection is not versioned", func(t *testing.T) {
+		checker := newProjectionVersionChecker(nil, &streamPartitionProjection{}, &versionedStorageStub{}, goengine.NopLogger)
+
+		assert.Nil(t, checker)
+		assert.NoError(t, checker.check(context.Background()))
+	})
+
+	t.Run("Storage is not versioned", func(t *testing.T) {
+		checker := newProjectionVersionChecker(nil, &versionedProjectionStub{version: 2}, &storageStub{}, goengine.NopLogger)
+
+		assert.Nil(t, checker)
+	})
+}
+
+func TestProjectionVersionChecker_Check(t *testing.T) {
+	testCases := []struct {
+		title          string
+		storedVersion  uint
+		handler        VersionMismatchHandler
+		expectedError  error
+		expectedResets int
+	}{
+		{"Version matches", 2, VersionMismatchFail, nil, 0},
+		{"Fail on mismatch", 1, VersionMismatchFail, ErrProjectionVersionMismatch, 0},
+		{"Reset on mismatch", 1, VersionMismatchReset, nil, 1},
+		{
+			"Rebuild on mismatch",
+			1,
+			VersionMismatchRebuild(func(ctx context.Context) error {
+				return errors.New("rebuild failed")
+			}),
+			errors.New("rebuild failed"),
+			0,
+		},
+		{
+			"Fail when the mismatch was not handled",
+			1,
+			func(context.Context, *sql.Conn, VersionedProjectorStorage, uint) error { return nil },
+			ErrProjectionVersionMismatch,
+			0,
+		},
+	}
+
+	for _, testCase := range testCases {
+		test.RunWithMockDB(t, testCase.title, func(t *testing.T, db *sql.DB, _ sqlmock.Sqlmock) {
+			storage := &versionedStorageStub{storedVersion: testCase.storedVersion}
+
+			checker := newProjectionVersionChecker(db, &versionedProjectionStub{version: 2}, storage, goengine.NopLogger)
+			checker.handler = testCase.handler
+
+			err := checker.check(context.Background())
+
+			assert.Equal(t, testCase.expectedError, err)
+			assert.Equal(t, testCase.expectedResets, storage.resets)
+		})
+	}
+}
@@ -19,9 +19,13 @@ type AggregateProjector struct {
 	backgroundProcessor *ProjectionNotificationProcessor
 	executor            *notificationProjector
 	storage             AggregateProjectorStorage
+	version             *projectionVersionChecker
+	control             *projectorControl
 
 	projectionErrorHandler ProjectionErrorCallback
 
+	shard *ShardMembership
+
 	db *sql.DB
 
 	logger goengine.Logger
@@ -82,6 +86,8 @@ func NewAggregateProjector(
 		backgroundProcessor:    processor,
 		executor:               executor,
 		storage:                projectorStorage,
+		version:                newProjectionVersionChecker(db, projection, projectorStorage, logger),
+		control:                newProjectorControl(),
 		projectionErrorHandler: projectionErrorHandler,
 
 		db: db,
@@ -90,6 +96,75 @@ func NewAggregateProjector(
 	}, nil
 }
 
+// NewShardedAggregateProjector creates a new projector for a projection that only projects the aggregates assigned to
+// the shard of the current process.
+// The shards are rebalanced when members join or leave the shard group.
+func NewShardedAggregateProjector(
+	db *sql.DB,
+	eventLoader EventStreamLoader,
+	resolver goengine.MessagePayloadResolver,
+	projection goengine.Projection,
+	projectorStorage AggregateProjectorStorage,
+	projectionErrorHandler ProjectionErrorCallback,
+	shard *ShardMembership,
+	logger goengine.Logger,
+	metrics Metrics,
+	retryDelay time.Duration,
+) (*AggregateProjector, error) {
+	if shard == nil {
+		return nil, goengine.InvalidArgumentError("shard")
+	}
+
+	projector, err := NewAggregateProjector(
+		db,
+		eventLoader,
+		resolver,
+		projection,
+		projectorStorage,
+		projectionErrorHandler,
+		logger,
+		metrics,
+		retryDelay,
+	)
+	if err != nil {
+		return nil, err
+	}
+	projector.shard = shard
+
+	return projector, nil
+}
+
+// HandleVersionMismatch sets the handler that is used when the projection is a goengine.VersionedProjection and the
+// projection state was projected by another version. By default the projector fails with ErrProjectionVersionMismatch.
+func (a *AggregateProjector) HandleVersionMismatch(handler VersionMismatchHandler) {
+	a.Lock()
+	defer a.Unlock()
+
+	if a.version != nil && handler != nil {
+		a.version.handler = handler
+	}
+}
+
+// Pause stops the projector from projecting new notifications without stopping the listener.
+// The aggregates that received notifications while paused are projected once the projector is resumed.
+func (a *AggregateProjector) Pause() {
+	a.control.pause()
+	a.logger.Info("paused projector", nil)
+}
+
+// Resume resumes a paused projector
+func (a *AggregateProjector) Resume() {
+	a.control.resume()
+	a.logger.Info("resumed projector", nil)
+}
+
+// Shutdown stops RunAndListen from accepting new notifications and waits for the in-flight notifications to be
+// projected. When the context is done before the in-flight notifications are projected the projections are aborted.
+// In both cases the projection locks are released before Shutdown returns.
+func (a *AggregateProjector) Shutdown(ctx context.Context) error {
+	return a.control.shutdown(ctx)
+}
+
 // Run executes the projection and manages the state of the projection
 func (a *AggregateProjector) Run(ctx context.Context) error {
 	a.Lock()
@@ -102,6 +177,16 @@ func (a *AggregateProjector) Run(ctx context.Context) error {
 		return nil
 	}
 
+	if err := a.version.check(ctx); err != nil {
+		return err
+	}
+
+	if a.shard != nil {
+		if _, err := a.shard.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+
 	return a.backgroundProcessor.Execute(ctx, a.processNotification, nil)
 }
 
@@ -117,10 +202,80 @@ func (a *AggregateProjector) RunAndListen(ctx context.Context, listener Listener
 		return nil
 	}
 
-	stopExecutor := a.backgroundProcessor.Start(ctx, a.processNotification)
+	if err := a.version.check(ctx); err != nil {
+		return err
+	}
+
+	if a.shard != nil {
+		if _, err := a.shard.Refresh(ctx); err != nil {
+			return err
+		}
+	}
+
+	run := a.control.start(ctx, func() {
+		// Trigger the out of sync projections since notifications are ignored while paused
+		if err := a.backgroundProcessor.Queue(ctx, nil); err != nil {
+			a.logger.Warn("failed to queue resume notification", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	})
+	defer a.control.finish(run)
+
+	stopExecutor := a.backgroundProcessor.Start(run.workCtx, func(ctx context.Context, notification *ProjectionNotification, queue ProjectionTrigger) error {
+		// Notifications that are not started before the projector stops listening are projected during the next run
+		if !a.control.waitResumed(run.listenCtx) {
+			return nil
+		}
+
+		return a.processNotification(ctx, notification, queue)
+	})
 	defer stopExecutor()
 
-	return listener.Listen(ctx, a.backgroundProcessor.Queue)
+	if a.shard != nil {
+		shardDone := make(chan struct{})
+		defer func() {
+			run.stopListening()
+			<-shardDone
+		}()
+		go func() {
+			defer close(shardDone)
+			a.shard.Run(run.listenCtx, func(ctx context.Context) {
+				// Trigger the out of sync projections since aggregates may have been assigned to this shard
+				if err := a.backgroundProcessor.Queue(ctx, nil); err != nil {
+					a.logger.Warn("failed to queue rebalance notification", func(e goengine.LoggerEntry) {
+						e.Error(err)
+					})
+				}
+			})
+		}()
+	}
+
+	return listener.Listen(run.listenCtx, func(ctx context.Context, notification *ProjectionNotification) error {
+		if notification.IsHeartbeat() {
+			return nil
+		}
+
+		if notification != nil && a.shard != nil && !a.shard.Owns(notification.AggregateID) {
+			return nil
+		}
+
+		// Ignore notifications while paused, the aggregates are projected when the projector is resumed
+		if a.control.isPaused() {
+			return nil
+		}
+
+		if notification != nil {
+			notification.done = claimNotificationDone(ctx)
+		}
+
+		if err := a.backgroundProcessor.Queue(ctx, notification); err != nil {
+			notification.projected(err)
+			return err
+		}
+
+		return nil
+	})
 }
 
 func (a *AggregateProjector) processNotification(
@@ -148,6 +303,7 @@ func (a *AggregateProjector) processNotification(
 
 	// No error occurred during projection so return
 	if err == nil {
+		notification.projected(nil)
 		return nil
 	}
 
@@ -155,16 +311,23 @@ func (a *AggregateProjector) processNotification(
 	switch resolveErrorAction(a.projectionErrorHandler, notification, err) {
 	case errorFail:
 		a.logger.Debug("ProcessHandler->ErrorHandler: marking projection as failed", logFields)
+		notification.projected(err)
 		return a.markProjectionAsFailed(notification)
 	case errorIgnore:
 		a.logger.Debug("ProcessHandler->ErrorHandler: ignoring error", logFields)
+		notification.projected(nil)
 		return nil
 	case errorRetry:
 		a.logger.Debug("ProcessHandler->ErrorHandler: re-queueing notification", logFields)
-		return queue(ctx, notification)
+		if queueErr := queue(ctx, notification); queueErr != nil {
+			notification.projected(queueErr)
+			return queueErr
+		}
+		return nil
 	}
 
 	a.logger.Debug("ProcessHandler->ErrorHandler: error fallthrough", logFields)
+	notification.projected(err)
 	return err
 }
 
@@ -211,6 +374,10 @@ func (a *AggregateProjector) triggerOutOfSyncProjections(ctx context.Context, qu
 			return err
 		}
 
+		if a.shard != nil && !a.shard.Owns(aggregateID) {
+			continue
+		}
+
 		notification := &ProjectionNotification{
 			No:          position,
 			AggregateID: aggregateID,
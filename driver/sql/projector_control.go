@@ -0,0 +1,144 @@
+package sql
+
+import (
+	"context"
+	"sync"
+)
+
+// projectorControl provides the pause, resume and graceful shutdown functionality of a projector
+type projectorControl struct {
+	mux     sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	run     *projectorRun
+}
+
+// projectorRun contains the contexts of a running projector
+type projectorRun struct {
+	// listenCtx is used to listen for notifications and is done when the projector should stop accepting work
+	listenCtx     context.Context
+	stopListening context.CancelFunc
+	// workCtx is used to project notifications and is only done when in-flight work must be aborted
+	workCtx context.Context
+	abort   context.CancelFunc
+
+	// onResume is called when the projector is resumed
+	onResume func()
+
+	done chan struct{}
+}
+
+func newProjectorControl() *projectorControl {
+	resumed := make(chan struct{})
+	close(resumed)
+
+	return &projectorControl{
+		resumed: resumed,
+	}
+}
+
+// start registers a new run of the projector based on the provided context
+func (c *projectorControl) start(ctx context.Context, onResume func()) *projectorRun {
+	run := &projectorRun{
+		onResume: onResume,
+		done:     make(chan struct{}),
+	}
+	run.workCtx, run.abort = context.WithCancel(ctx)
+	run.listenCtx, run.stopListening = context.WithCancel(run.workCtx)
+
+	c.mux.Lock()
+	c.run = run
+	c.mux.Unlock()
+
+	return run
+}
+
+// finish marks the run as finished
+func (c *projectorControl) finish(run *projectorRun) {
+	run.stopListening()
+	run.abort()
+
+	c.mux.Lock()
+	if c.run == run {
+		c.run = nil
+	}
+	c.mux.Unlock()
+
+	close(run.done)
+}
+
+// pause stops new work from being started
+func (c *projectorControl) pause() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if c.paused {
+		return
+	}
+
+	c.paused = true
+	c.resumed = make(chan struct{})
+}
+
+// resume allows new work to be started
+func (c *projectorControl) resume() {
+	c.mux.Lock()
+	if !c.paused {
+		c.mux.Unlock()
+		return
+	}
+
+	c.paused = false
+	close(c.resumed)
+	run := c.run
+	c.mux.Unlock()
+
+	if run != nil && run.onResume != nil {
+		run.onResume()
+	}
+}
+
+// isPaused returns true when the projector is paused
+func (c *projectorControl) isPaused() bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.paused
+}
+
+// waitResumed blocks while the projector is paused and returns false when the context is done
+func (c *projectorControl) waitResumed(ctx context.Context) bool {
+	c.mux.Lock()
+	resumed := c.resumed
+	c.mux.Unlock()
+
+	select {
+	case <-resumed:
+		return ctx.Err() == nil
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shutdown stops the current run from accepting new work and waits for the in-flight work to finish.
+// When the context is done before the in-flight work finished the work is aborted.
+func (c *projectorControl) shutdown(ctx context.Context) error {
+	c.mux.Lock()
+	run := c.run
+	c.mux.Unlock()
+
+	if run == nil {
+		return nil
+	}
+
+	run.stopListening()
+
+	select {
+	case <-run.done:
+		return nil
+	case <-ctx.Done():
+		run.abort()
+		<-run.done
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,96 @@
+// +build unit
+
+package sql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProjectorControl_PauseAndResume(t *testing.T) {
+	control := newProjectorControl()
+
+	var resumed int
+	run := control.start(context.Background(), func() {
+		resumed++
+	})
+	defer control.finish(run)
+
+	assert.False(t, control.isPaused())
+	assert.True(t, control.waitResumed(run.listenCtx))
+
+	control.pause()
+	assert.True(t, control.isPaused())
+
+	waitDone := make(chan bool)
+	go func() {
+		waitDone <- control.waitResumed(run.listenCtx)
+	}()
+
+	select {
+	case <-waitDone:
+		t.Fatal("waitResumed returned while paused")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	control.resume()
+	assert.True(t, <-waitDone)
+	assert.False(t, control.isPaused())
+	assert.Equal(t, 1, resumed)
+
+	// Resuming a running projector is a no-op
+	control.resume()
+	assert.Equal(t, 1, resumed)
+}
+
+func TestProjectorControl_WaitResumedStopsWhenListeningStopped(t *testing.T) {
+	control := newProjectorControl()
+	run := control.start(context.Background(), nil)
+	defer control.finish(run)
+
+	control.pause()
+	run.stopListening()
+
+	assert.False(t, control.waitResumed(run.listenCtx))
+	assert.NoError(t, run.workCtx.Err())
+}
+
+func TestProjectorControl_Shutdown(t *testing.T) {
+	t.Run("No running projector", func(t *testing.T) {
+		control := newProjectorControl()
+
+		assert.NoError(t, control.shutdown(context.Background()))
+	})
+
+	t.Run("Wait for in-flight work", func(t *testing.T) {
+		control := newProjectorControl()
+		run := control.start(context.Background(), nil)
+
+		go func() {
+			<-run.listenCtx.Done()
+			// The in-flight work is allowed to finish
+			assert.NoError(t, run.workCtx.Err())
+			control.finish(run)
+		}()
+
+		assert.NoError(t, control.shutdown(context.Background()))
+	})
+
+	t.Run("Abort in-flight work when the deadline is exceeded", func(t *testing.T) {
+		control := newProjectorControl()
+		run := control.start(context.Background(), nil)
+
+		go func() {
+			<-run.workCtx.Done()
+			control.finish(run)
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.Equal(t, context.DeadlineExceeded, control.shutdown(ctx))
+	})
+}
@@ -17,6 +17,8 @@ type StreamProjector struct {
 	db       *sql.DB
 	executor *notificationProjector
 	storage  StreamProjectorStorage
+	version  *projectionVersionChecker
+	control  *projectorControl
 
 	projectionErrorHandler ProjectionErrorCallback
 
@@ -71,11 +73,44 @@ func NewStreamProjector(
 		db:                     db,
 		executor:               executor,
 		storage:                projectorStorage,
+		version:                newProjectionVersionChecker(db, projection, projectorStorage, logger),
+		control:                newProjectorControl(),
 		projectionErrorHandler: projectionErrorHandler,
 		logger:                 logger,
 	}, nil
 }
 
+// Pause stops the projector from projecting new notifications without stopping the listener.
+// The notifications received while paused are projected once the projector is resumed.
+func (s *StreamProjector) Pause() {
+	s.control.pause()
+	s.logger.Info("paused projector", nil)
+}
+
+// Resume resumes a paused projector
+func (s *StreamProjector) Resume() {
+	s.control.resume()
+	s.logger.Info("resumed projector", nil)
+}
+
+// Shutdown stops RunAndListen from accepting new notifications and waits for the in-flight notification to be
+// projected. When the context is done before the in-flight notification is projected the projection is aborted.
+// In both cases the projection lock is released before Shutdown returns.
+func (s *StreamProjector) Shutdown(ctx context.Context) error {
+	return s.control.shutdown(ctx)
+}
+
+// HandleVersionMismatch sets the handler that is used when the projection is a goengine.VersionedProjection and the
+// projection state was projected by another version. By default the projector fails with ErrProjectionVersionMismatch.
+func (s *StreamProjector) HandleVersionMismatch(handler VersionMismatchHandler) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.version != nil && handler != nil {
+		s.version.handler = handler
+	}
+}
+
 // Run executes the projection and manages the state of the projection
 func (s *StreamProjector) Run(ctx context.Context) error {
 	s.Lock()
@@ -92,6 +127,10 @@ func (s *StreamProjector) Run(ctx context.Context) error {
 		return err
 	}
 
+	if err := s.version.check(ctx); err != nil {
+		return err
+	}
+
 	return s.processNotification(ctx, nil)
 }
 
@@ -111,7 +150,49 @@ func (s *StreamProjector) RunAndListen(ctx context.Context, listener Listener) e
 		return err
 	}
 
-	return listener.Listen(ctx, s.processNotification)
+	if err := s.version.check(ctx); err != nil {
+		return err
+	}
+
+	run := s.control.start(ctx, nil)
+	defer s.control.finish(run)
+
+	// Project the notifications in the background so the listener is not blocked while the projector is paused
+	pending := newPendingNotification()
+	workerErr := make(chan error, 1)
+	go func() {
+		for {
+			notification, dones, ok := pending.wait(run.listenCtx)
+			if !ok || !s.control.waitResumed(run.listenCtx) {
+				workerErr <- nil
+				return
+			}
+
+			err := s.processNotification(run.workCtx, notification)
+			dones.projected(err)
+			if err != nil {
+				run.stopListening()
+				workerErr <- err
+				return
+			}
+		}
+	}()
+
+	err := listener.Listen(run.listenCtx, func(ctx context.Context, notification *ProjectionNotification) error {
+		if notification.IsHeartbeat() {
+			return nil
+		}
+
+		pending.add(notification, claimNotificationDone(ctx))
+		return nil
+	})
+
+	run.stopListening()
+	if workErr := <-workerErr; workErr != nil {
+		return workErr
+	}
+
+	return err
 }
 
 func (s *StreamProjector) processNotification(
@@ -0,0 +1,491 @@
+package sql
+
+import (
+	"context"
+	"crypto/md5" /* #nosec G501 */
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+)
+
+type (
+	// PartitionKeyFunc returns the key used to assign a message to a partition
+	PartitionKeyFunc func(message goengine.Message) string
+
+	// StreamProjectorStorageFactory returns the StreamProjectorStorage for the projection with the provided name
+	StreamProjectorStorageFactory func(projectionName string) (StreamProjectorStorage, error)
+)
+
+// PartitionByAggregateID is a PartitionKeyFunc that partitions messages by their aggregate id
+func PartitionByAggregateID(message goengine.Message) string {
+	switch id := message.Metadata().Value(aggregate.IDKey).(type) {
+	case string:
+		return id
+	case aggregate.ID:
+		return string(id)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(id)
+	}
+}
+
+// PartitionedStreamProjector is a projector used to execute a projection against an event stream using multiple
+// partitions in parallel.
+// Every message is assigned to a partition based on it's partition key which ensures that the messages with the same key
+// are projected in order. Every partition has it's own position, state and lock.
+type PartitionedStreamProjector struct {
+	sync.Mutex
+
+	projectionName  string
+	partitions      []*StreamProjector
+	routeByAggregID bool
+
+	logger goengine.Logger
+}
+
+// NewPartitionedStreamProjector creates a new partitioned projector for a projection
+//
+// The storage of every partition is created by the storageFactory using the name returned by PartitionName.
+// When partitionKey is nil the messages are partitioned by aggregate id, in this case a eventStore implementing
+// PartitionedReadOnlyEventStore only loads the events of the partition.
+// Once projected the amount of partitions can't be changed without removing the existing partitions, see
+// ErrPartitionCountChanged.
+func NewPartitionedStreamProjector(
+	db *sql.DB,
+	eventStore ReadOnlyEventStore,
+	streamName goengine.StreamName,
+	resolver goengine.MessagePayloadResolver,
+	projection goengine.Projection,
+	partitions uint,
+	partitionKey PartitionKeyFunc,
+	storageFactory StreamProjectorStorageFactory,
+	projectionErrorHandler ProjectionErrorCallback,
+	logger goengine.Logger,
+) (*PartitionedStreamProjector, error) {
+	switch {
+	case eventStore == nil:
+		return nil, goengine.InvalidArgumentError("eventStore")
+	case projection == nil:
+		return nil, goengine.InvalidArgumentError("projection")
+	case partitions == 0:
+		return nil, goengine.InvalidArgumentError("partitions")
+	case storageFactory == nil:
+		return nil, goengine.InvalidArgumentError("storageFactory")
+	}
+
+	routeByAggregID := partitionKey == nil
+	if routeByAggregID {
+		partitionKey = PartitionByAggregateID
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	projectors := make([]*StreamProjector, partitions)
+	for i := range projectors {
+		partitionProjection := &streamPartitionProjection{
+			Projection: projection,
+			name:       PartitionName(projection.Name(), uint(i), partitions),
+		}
+
+		storage, err := storageFactory(partitionProjection.name)
+		if err != nil {
+			return nil, err
+		}
+
+		var eventLoader EventStreamLoader
+		if partitionedEventStore, ok := eventStore.(PartitionedReadOnlyEventStore); ok && routeByAggregID {
+			eventLoader = aggregatePartitionEventStreamLoader(partitionedEventStore, streamName, uint32(i), uint32(partitions))
+		} else {
+			eventLoader = partitionEventStreamLoader(
+				StreamProjectionEventStreamLoader(eventStore, streamName),
+				partitionKey,
+				uint32(i),
+				uint32(partitions),
+			)
+		}
+
+		projectors[i], err = NewStreamProjector(
+			db,
+			eventLoader,
+			resolver,
+			partitionProjection,
+			storage,
+			projectionErrorHandler,
+			logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &PartitionedStreamProjector{
+		projectionName:  projection.Name(),
+		partitions:      projectors,
+		routeByAggregID: routeByAggregID,
+		logger: logger.WithFields(func(e goengine.LoggerEntry) {
+			e.String("projection", projection.Name())
+		}),
+	}, nil
+}
+
+// PartitionName returns the name of a partition of the projection
+func PartitionName(projectionName string, partition uint, partitions uint) string {
+	return fmt.Sprintf("%s#%d/%d", projectionName, partition, partitions)
+}
+
+// AggregatePartition returns the partition the aggregate belongs to.
+// The partition is based on the md5 hash of the aggregate id so it can be calculated by the database as well.
+func AggregatePartition(aggregateID string, partitions uint32) uint32 {
+	/* #nosec G401 */
+	hash := md5.Sum([]byte(aggregateID))
+	return binary.BigEndian.Uint32(hash[:4]) % partitions
+}
+
+// Run executes the projection for all partitions in parallel
+func (p *PartitionedStreamProjector) Run(ctx context.Context) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if err := p.checkPartitionCount(ctx); err != nil {
+		return err
+	}
+
+	return p.runPartitions(ctx, func(ctx context.Context, projector *StreamProjector, _ int) error {
+		return projector.Run(ctx)
+	})
+}
+
+// RunAndListen executes the projection for all partitions and listens to any changes to the event store
+func (p *PartitionedStreamProjector) RunAndListen(ctx context.Context, listener Listener) error {
+	p.Lock()
+	defer p.Unlock()
+
+	// Check if the context is expired
+	select {
+	default:
+	case <-ctx.Done():
+		return nil
+	}
+
+	if err := p.checkPartitionCount(ctx); err != nil {
+		return err
+	}
+
+	for _, projector := range p.partitions {
+		if err := projector.storage.CreateProjection(ctx, projector.db); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pending := make([]*pendingNotification, len(p.partitions))
+	for i := range pending {
+		pending[i] = newPendingNotification()
+	}
+
+	var (
+		errOnce sync.Once
+		runErr  error
+	)
+	workerErr := p.runPartitionsAsync(ctx, func(ctx context.Context, projector *StreamProjector, i int) error {
+		for {
+			notification, dones, ok := pending[i].wait(ctx)
+			if !ok {
+				return nil
+			}
+
+			err := projector.processNotification(ctx, notification)
+			dones.projected(err)
+			if err != nil {
+				return err
+			}
+		}
+	}, func(err error) {
+		errOnce.Do(func() {
+			runErr = err
+			cancel()
+		})
+	})
+
+	listenErr := listener.Listen(ctx, func(ctx context.Context, notification *ProjectionNotification) error {
+		if notification.IsHeartbeat() {
+			return nil
+		}
+
+		done := claimNotificationDone(ctx)
+		if notification != nil && p.routeByAggregID {
+			pending[partitionOf(notification.AggregateID, uint32(len(pending)))].add(notification, done)
+			return nil
+		}
+
+		// The notification is projected once every partition projected it
+		if done != nil {
+			done = notificationDoneAfter(len(pending), done)
+		}
+		for _, partition := range pending {
+			partition.add(notification, done)
+		}
+		return nil
+	})
+
+	cancel()
+	workerErr()
+
+	if runErr != nil {
+		return runErr
+	}
+	return listenErr
+}
+
+// checkPartitionCount returns ErrPartitionCountChanged when partitions exist for another amount of partitions.
+// Without this check the new partitions would silently project the stream from the start.
+func (p *PartitionedStreamProjector) checkPartitionCount(ctx context.Context) error {
+	projector := p.partitions[0]
+	loader, ok := projector.storage.(StreamProjectionNamesLoader)
+	if !ok {
+		return nil
+	}
+
+	names, err := loader.ProjectionNames(ctx, projector.db, p.projectionName+"#")
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		partitions, ok := partitionCountOf(p.projectionName, name)
+		if ok && partitions != uint(len(p.partitions)) {
+			p.logger.Error("projection was projected using another amount of partitions", func(e goengine.LoggerEntry) {
+				e.String("partition", name)
+				e.Int("partitions", len(p.partitions))
+			})
+			return ErrPartitionCountChanged
+		}
+	}
+
+	return nil
+}
+
+// runPartitions calls run for every partition in parallel and returns the first error
+func (p *PartitionedStreamProjector) runPartitions(
+	ctx context.Context,
+	run func(ctx context.Context, projector *StreamProjector, i int) error,
+) error {
+	var (
+		errOnce sync.Once
+		runErr  error
+	)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wait := p.runPartitionsAsync(ctx, run, func(err error) {
+		errOnce.Do(func() {
+			runErr = err
+			cancel()
+		})
+	})
+	wait()
+
+	return runErr
+}
+
+// runPartitionsAsync calls run for every partition in a separate go routine and returns a function to wait for them
+func (p *PartitionedStreamProjector) runPartitionsAsync(
+	ctx context.Context,
+	run func(ctx context.Context, projector *StreamProjector, i int) error,
+	onError func(err error),
+) func() {
+	var wg sync.WaitGroup
+	for i, projector := range p.partitions {
+		wg.Add(1)
+		go func(i int, projector *StreamProjector) {
+			defer wg.Done()
+
+			if err := run(ctx, projector, i); err != nil {
+				p.logger.Error("partition failed", func(e goengine.LoggerEntry) {
+					e.Error(err)
+					e.Int("partition", i)
+				})
+				onError(err)
+			}
+		}(i, projector)
+	}
+
+	return wg.Wait
+}
+
+// partitionOf returns the partition the key belongs to
+func partitionOf(key string, partitions uint32) uint32 {
+	return AggregatePartition(key, partitions)
+}
+
+// partitionCountOf returns the amount of partitions of a partition name returned by PartitionName
+func partitionCountOf(projectionName string, name string) (uint, bool) {
+	var partition, partitions uint
+	if _, err := fmt.Sscanf(strings.TrimPrefix(name, projectionName), "#%d/%d", &partition, &partitions); err != nil {
+		return 0, false
+	}
+
+	return partitions, PartitionName(projectionName, partition, partitions) == name
+}
+
+// streamPartitionProjection is a goengine.Projection with the name of the partition
+type streamPartitionProjection struct {
+	goengine.Projection
+	name string
+}
+
+// Name returns the name of the partition
+func (p *streamPartitionProjection) Name() string {
+	return p.name
+}
+
+// aggregatePartitionEventStreamLoader returns a EventStreamLoader that only loads the messages of the partition
+func aggregatePartitionEventStreamLoader(
+	eventStore PartitionedReadOnlyEventStore,
+	streamName goengine.StreamName,
+	partition, partitions uint32,
+) EventStreamLoader {
+	return func(ctx context.Context, conn *sql.Conn, notification *ProjectionNotification, position int64) (goengine.EventStream, error) {
+		return eventStore.LoadPartitionWithConnection(ctx, conn, streamName, position+1, nil, nil, partition, partitions)
+	}
+}
+
+// partitionEventStreamLoader returns a EventStreamLoader that skips the messages not belonging to the partition.
+// This is used when the partition key is not the aggregate id or the event store can't load a partition.
+func partitionEventStreamLoader(eventLoader EventStreamLoader, partitionKey PartitionKeyFunc, partition, partitions uint32) EventStreamLoader {
+	return func(ctx context.Context, conn *sql.Conn, notification *ProjectionNotification, position int64) (goengine.EventStream, error) {
+		stream, err := eventLoader(ctx, conn, notification, position)
+		if err != nil {
+			return nil, err
+		}
+
+		return &partitionEventStream{
+			EventStream:  stream,
+			partitionKey: partitionKey,
+			partition:    partition,
+			partitions:   partitions,
+		}, nil
+	}
+}
+
+// partitionEventStream is a goengine.EventStream that skips all messages not belonging to the partition
+type partitionEventStream struct {
+	goengine.EventStream
+
+	partitionKey PartitionKeyFunc
+	partition    uint32
+	partitions   uint32
+
+	err error
+}
+
+// Next prepares the next message of the partition for reading
+func (s *partitionEventStream) Next() bool {
+	for s.EventStream.Next() {
+		msg, _, err := s.EventStream.Message()
+		if err != nil {
+			s.err = err
+			return false
+		}
+
+		if partitionOf(s.partitionKey(msg), s.partitions) == s.partition {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Err returns the error, if any, that was encountered during iteration
+func (s *partitionEventStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.EventStream.Err()
+}
+
+// pendingNotification contains the notification a partition still needs to process.
+// Notifications are coalesced since a stream projection always projects up to the latest event.
+type pendingNotification struct {
+	sync.Mutex
+
+	notification *ProjectionNotification
+	dones        notificationDones
+	pending      bool
+	signal       chan struct{}
+}
+
+// notificationDones are the NotificationDone funcs of coalesced notifications
+type notificationDones []NotificationDone
+
+// projected calls every NotificationDone
+func (d notificationDones) projected(err error) {
+	for _, done := range d {
+		done(err)
+	}
+}
+
+func newPendingNotification() *pendingNotification {
+	return &pendingNotification{
+		signal: make(chan struct{}, 1),
+	}
+}
+
+// add adds the notification to the pending notification, done is called once the pending notification is projected
+func (p *pendingNotification) add(notification *ProjectionNotification, done NotificationDone) {
+	p.Lock()
+	switch {
+	case !p.pending:
+		p.notification = notification
+		p.pending = true
+	case p.notification == nil || notification == nil:
+		// A nil notification projects everything
+		p.notification = nil
+	case notification.No > p.notification.No:
+		p.notification = notification
+	}
+	if done != nil {
+		p.dones = append(p.dones, done)
+	}
+	p.Unlock()
+
+	select {
+	case p.signal <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits for a pending notification and returns false when the context is done
+func (p *pendingNotification) wait(ctx context.Context) (*ProjectionNotification, notificationDones, bool) {
+	for {
+		p.Lock()
+		if p.pending {
+			notification, dones := p.notification, p.dones
+			p.notification = nil
+			p.dones = nil
+			p.pending = false
+			p.Unlock()
+
+			return notification, dones, true
+		}
+		p.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, false
+		case <-p.signal:
+		}
+	}
+}
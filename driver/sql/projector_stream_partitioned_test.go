@@ -0,0 +1,197 @@
+// +build unit
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionByAggregateID(t *testing.T) {
+	id := aggregate.GenerateID()
+
+	testCases := []struct {
+		title    string
+		metadata metadata.Metadata
+		expected string
+	}{
+		{"aggregate.ID", metadata.WithValue(metadata.New(), aggregate.IDKey, id), string(id)},
+		{"string", metadata.WithValue(metadata.New(), aggregate.IDKey, string(id)), string(id)},
+		{"missing", metadata.New(), ""},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			msg, err := aggregate.ReconstituteChange(id, goengine.GenerateUUID(), struct{}{}, testCase.metadata, time.Now(), 1)
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.expected, PartitionByAggregateID(msg))
+		})
+	}
+}
+
+func TestPartitionEventStreamLoader(t *testing.T) {
+	var (
+		messages []goengine.Message
+		numbers  []int64
+	)
+	for i := 1; i <= 20; i++ {
+		id := aggregate.GenerateID()
+		msg, err := aggregate.ReconstituteChange(
+			id,
+			goengine.GenerateUUID(),
+			struct{}{},
+			metadata.WithValue(metadata.New(), aggregate.IDKey, id),
+			time.Now(),
+			1,
+		)
+		require.NoError(t, err)
+
+		messages = append(messages, msg)
+		numbers = append(numbers, int64(i))
+	}
+
+	loader := func(context.Context, *sql.Conn, *ProjectionNotification, int64) (goengine.EventStream, error) {
+		return inmemory.NewEventStream(messages, numbers)
+	}
+
+	const partitions = 3
+	seen := map[int64]uint32{}
+	for partition := uint32(0); partition < partitions; partition++ {
+		stream, err := partitionEventStreamLoader(loader, PartitionByAggregateID, partition, partitions)(context.Background(), nil, nil, 0)
+		require.NoError(t, err)
+
+		for stream.Next() {
+			msg, no, err := stream.Message()
+			require.NoError(t, err)
+
+			assert.Equal(t, partition, partitionOf(PartitionByAggregateID(msg), partitions))
+			seen[no] = partition
+		}
+		assert.NoError(t, stream.Err())
+		assert.NoError(t, stream.Close())
+	}
+
+	assert.Len(t, seen, len(messages), "expected every message to belong to a single partition")
+}
+
+func TestAggregatePartition(t *testing.T) {
+	// The md5 of "abc" starts with 90015098 which is 2416005272, the same value is calculated by postgres using
+	// ('x' || substr(md5('abc'), 1, 8))::bit(32)::bigint
+	assert.Equal(t, uint32(272), AggregatePartition("abc", 1000))
+	assert.Equal(t, uint32(0), AggregatePartition("abc", 1))
+}
+
+// projectionNamesStorageStub is a StreamProjectorStorage returning the provided projection names
+type projectionNamesStorageStub struct {
+	StreamProjectorStorage
+	names []string
+}
+
+func (s *projectionNamesStorageStub) ProjectionNames(_ context.Context, _ Queryer, prefix string) ([]string, error) {
+	var names []string
+	for _, name := range s.names {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func TestPartitionedStreamProjector_checkPartitionCount(t *testing.T) {
+	testCases := []struct {
+		title         string
+		names         []string
+		expectedError error
+	}{
+		{"No partitions", nil, nil},
+		{"Same amount of partitions", []string{"orders#0/2", "orders#1/2"}, nil},
+		{"Other projection", []string{"orders_v2#0/3"}, nil},
+		{"Not a partition", []string{"orders#rebuild"}, nil},
+		{"Other amount of partitions", []string{"orders#0/3", "orders#1/3", "orders#2/3"}, ErrPartitionCountChanged},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			storage := &projectionNamesStorageStub{names: testCase.names}
+			projector := &PartitionedStreamProjector{
+				projectionName: "orders",
+				partitions: []*StreamProjector{
+					{storage: storage},
+					{storage: storage},
+				},
+				logger: goengine.NopLogger,
+			}
+
+			assert.Equal(t, testCase.expectedError, projector.checkPartitionCount(context.Background()))
+		})
+	}
+}
+
+func TestPendingNotification(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("Coalesce to latest notification", func(t *testing.T) {
+		pending := newPendingNotification()
+		pending.add(&ProjectionNotification{No: 2}, nil)
+		pending.add(&ProjectionNotification{No: 5}, nil)
+		pending.add(&ProjectionNotification{No: 3}, nil)
+
+		notification, _, ok := pending.wait(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, &ProjectionNotification{No: 5}, notification)
+	})
+
+	t.Run("Coalesce to nil notification", func(t *testing.T) {
+		pending := newPendingNotification()
+		pending.add(&ProjectionNotification{No: 2}, nil)
+		pending.add(nil, nil)
+		pending.add(&ProjectionNotification{No: 5}, nil)
+
+		notification, _, ok := pending.wait(ctx)
+		assert.True(t, ok)
+		assert.Nil(t, notification)
+	})
+
+	t.Run("Collect the done funcs of coalesced notifications", func(t *testing.T) {
+		var projected []error
+		done := func(err error) {
+			projected = append(projected, err)
+		}
+
+		pending := newPendingNotification()
+		pending.add(&ProjectionNotification{No: 2}, done)
+		pending.add(&ProjectionNotification{No: 3}, nil)
+		pending.add(&ProjectionNotification{No: 5}, done)
+
+		notification, dones, ok := pending.wait(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, &ProjectionNotification{No: 5}, notification)
+
+		projectErr := errors.New("failed")
+		dones.projected(projectErr)
+		assert.Equal(t, []error{projectErr, projectErr}, projected)
+	})
+
+	t.Run("Stop waiting when the context is done", func(t *testing.T) {
+		pending := newPendingNotification()
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer waitCancel()
+
+		_, _, ok := pending.wait(waitCtx)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,252 @@
+package sql
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hellofresh/goengine"
+)
+
+// shardVirtualNodes is the amount of points every member has on the hash ring
+const shardVirtualNodes = 64
+
+type (
+	// MembershipStore persists the members of a group
+	MembershipStore interface {
+		// Heartbeat registers the member as being alive for the ttl
+		Heartbeat(ctx context.Context, group string, member string, ttl time.Duration) error
+		// Leave removes the member from the group
+		Leave(ctx context.Context, group string, member string) error
+		// Members returns the members of the group that are alive
+		Members(ctx context.Context, group string) ([]string, error)
+	}
+
+	// ShardFilter determines if an aggregate is handled by the current process
+	ShardFilter interface {
+		// Owns returns true when the aggregate belongs to the shard of the current process
+		Owns(aggregateID string) bool
+	}
+)
+
+// Ensure ShardMembership implements ShardFilter
+var _ ShardFilter = &ShardMembership{}
+
+// ShardMembership registers the current process as a member of a group and assigns aggregates to the members of the
+// group using consistent hashing.
+type ShardMembership struct {
+	store  MembershipStore
+	group  string
+	member string
+
+	ttl               time.Duration
+	heartbeatInterval time.Duration
+
+	mux     sync.RWMutex
+	members []string
+	ring    *hashRing
+
+	logger goengine.Logger
+}
+
+// NewShardMembership returns a new ShardMembership
+//
+// The member must be unique for every process, for example the hostname combined with the process id.
+// A member is considered gone when it did not send a heartbeat within the ttl.
+func NewShardMembership(
+	store MembershipStore,
+	group string,
+	member string,
+	ttl time.Duration,
+	heartbeatInterval time.Duration,
+	logger goengine.Logger,
+) (*ShardMembership, error) {
+	switch {
+	case store == nil:
+		return nil, goengine.InvalidArgumentError("store")
+	case strings.TrimSpace(group) == "":
+		return nil, goengine.InvalidArgumentError("group")
+	case strings.TrimSpace(member) == "":
+		return nil, goengine.InvalidArgumentError("member")
+	case ttl <= 0:
+		return nil, goengine.InvalidArgumentError("ttl")
+	case heartbeatInterval <= 0 || heartbeatInterval >= ttl:
+		return nil, goengine.InvalidArgumentError("heartbeatInterval")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	logger = logger.WithFields(func(e goengine.LoggerEntry) {
+		e.String("shard_group", group)
+		e.String("shard_member", member)
+	})
+
+	return &ShardMembership{
+		store:             store,
+		group:             group,
+		member:            member,
+		ttl:               ttl,
+		heartbeatInterval: heartbeatInterval,
+		logger:            logger,
+	}, nil
+}
+
+// Owns returns true when the aggregate is assigned to the current member.
+// Before the members are known every aggregate is considered to be owned.
+func (s *ShardMembership) Owns(aggregateID string) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	if s.ring == nil {
+		return true
+	}
+
+	return s.ring.owner(aggregateID) == s.member
+}
+
+// Members returns the known members of the group
+func (s *ShardMembership) Members() []string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	members := make([]string, len(s.members))
+	copy(members, s.members)
+	return members
+}
+
+// Refresh sends a heartbeat and reloads the members of the group.
+// It returns true when the members of the group changed.
+func (s *ShardMembership) Refresh(ctx context.Context) (bool, error) {
+	if err := s.store.Heartbeat(ctx, s.group, s.member, s.ttl); err != nil {
+		return false, err
+	}
+
+	members, err := s.store.Members(ctx, s.group)
+	if err != nil {
+		return false, err
+	}
+	sort.Strings(members)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.ring != nil && equalStrings(s.members, members) {
+		return false, nil
+	}
+
+	s.members = members
+	s.ring = newHashRing(members, shardVirtualNodes)
+
+	s.logger.Info("shard members changed", func(e goengine.LoggerEntry) {
+		e.Any("members", members)
+	})
+
+	return true, nil
+}
+
+// Run refreshes the membership every heartbeat interval until the context is done and calls rebalance when the
+// members of the group changed.
+// When the context is done the member leaves the group.
+func (s *ShardMembership) Run(ctx context.Context, rebalance func(ctx context.Context)) {
+	defer func() {
+		// Use a fresh context since the provided context is done
+		if err := s.store.Leave(context.Background(), s.group, s.member); err != nil {
+			s.logger.Warn("failed to leave shard group", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	ticker := time.NewTicker(s.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := s.Refresh(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			s.logger.Warn("failed to refresh shard membership", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+			continue
+		}
+
+		if changed {
+			rebalance(ctx)
+		}
+	}
+}
+
+// hashRing is a consistent hash ring used to assign keys to members
+type hashRing struct {
+	hashes  []uint32
+	members map[uint32]string
+}
+
+func newHashRing(members []string, virtualNodes int) *hashRing {
+	ring := &hashRing{
+		hashes:  make([]uint32, 0, len(members)*virtualNodes),
+		members: make(map[uint32]string, len(members)*virtualNodes),
+	}
+
+	for _, member := range members {
+		for i := 0; i < virtualNodes; i++ {
+			hash := hashKey(member + "#" + strconv.Itoa(i))
+			if _, found := ring.members[hash]; found {
+				continue
+			}
+
+			ring.hashes = append(ring.hashes, hash)
+			ring.members[hash] = member
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool { return ring.hashes[i] < ring.hashes[j] })
+
+	return ring
+}
+
+// owner returns the member owning the key or an empty string when the ring has no members
+func (r *hashRing) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+
+	hash := hashKey(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if i == len(r.hashes) {
+		i = 0
+	}
+
+	return r.members[r.hashes[i]]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,158 @@
+// +build unit
+
+package sql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type membershipStoreStub struct {
+	sync.Mutex
+
+	members map[string]bool
+}
+
+func (s *membershipStoreStub) Heartbeat(_ context.Context, _ string, member string, _ time.Duration) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.members[member] = true
+	return nil
+}
+
+func (s *membershipStoreStub) Leave(_ context.Context, _ string, member string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.members, member)
+	return nil
+}
+
+func (s *membershipStoreStub) Members(context.Context, string) ([]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var members []string
+	for member := range s.members {
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+func TestNewShardMembership(t *testing.T) {
+	store := &membershipStoreStub{members: map[string]bool{}}
+
+	testCases := []struct {
+		title                 string
+		store                 MembershipStore
+		group                 string
+		member                string
+		ttl                   time.Duration
+		heartbeatInterval     time.Duration
+		expectedArgumentError string
+	}{
+		{"No store", nil, "projection", "host-1", time.Second, time.Millisecond, "store"},
+		{"No group", store, "", "host-1", time.Second, time.Millisecond, "group"},
+		{"No member", store, "projection", " ", time.Second, time.Millisecond, "member"},
+		{"No ttl", store, "projection", "host-1", 0, time.Millisecond, "ttl"},
+		{"Heartbeat interval exceeds ttl", store, "projection", "host-1", time.Second, 2 * time.Second, "heartbeatInterval"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			membership, err := NewShardMembership(
+				testCase.store,
+				testCase.group,
+				testCase.member,
+				testCase.ttl,
+				testCase.heartbeatInterval,
+				nil,
+			)
+
+			assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedArgumentError), err)
+			assert.Nil(t, membership)
+		})
+	}
+}
+
+func TestShardMembership(t *testing.T) {
+	ctx := context.Background()
+	store := &membershipStoreStub{members: map[string]bool{}}
+
+	memberships := make([]*ShardMembership, 3)
+	for i := range memberships {
+		var err error
+		memberships[i], err = NewShardMembership(store, "projection", fmt.Sprintf("host-%d", i), time.Second, time.Millisecond, nil)
+		require.NoError(t, err)
+	}
+
+	t.Run("Own everything before the members are known", func(t *testing.T) {
+		assert.True(t, memberships[0].Owns("anything"))
+	})
+
+	// Register all members and load the members
+	for i := 0; i < 2; i++ {
+		for _, membership := range memberships {
+			_, err := membership.Refresh(ctx)
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("Every aggregate is owned by a single member", func(t *testing.T) {
+		owned := make([]int, len(memberships))
+		for i := 0; i < 1000; i++ {
+			aggregateID := goengine.GenerateUUID().String()
+
+			var owners int
+			for j, membership := range memberships {
+				if membership.Owns(aggregateID) {
+					owners++
+					owned[j]++
+				}
+			}
+			assert.Equal(t, 1, owners, "expected a single owner for %s", aggregateID)
+		}
+
+		for i, count := range owned {
+			assert.NotZero(t, count, "expected member %d to own aggregates", i)
+		}
+	})
+
+	t.Run("Rebalance when a member leaves", func(t *testing.T) {
+		require.NoError(t, store.Leave(ctx, "projection", "host-2"))
+
+		changed, err := memberships[0].Refresh(ctx)
+		require.NoError(t, err)
+		assert.True(t, changed)
+		assert.Equal(t, []string{"host-0", "host-1"}, memberships[0].Members())
+	})
+}
+
+func TestHashRing(t *testing.T) {
+	t.Run("Empty ring", func(t *testing.T) {
+		assert.Equal(t, "", newHashRing(nil, shardVirtualNodes).owner("key"))
+	})
+
+	t.Run("Minimal movement when a member joins", func(t *testing.T) {
+		before := newHashRing([]string{"a", "b", "c"}, shardVirtualNodes)
+		after := newHashRing([]string{"a", "b", "c", "d"}, shardVirtualNodes)
+
+		var moved int
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			if owner := after.owner(key); owner != before.owner(key) {
+				assert.Equal(t, "d", owner, "keys should only move to the new member")
+				moved++
+			}
+		}
+		assert.NotZero(t, moved)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hellofresh/goengine/strategy/json"
+	"github.com/hellofresh/goengine/strategy/json/cli"
+)
+
+type (
+	// BankAccountOpened is the payload of the event when a bank account is opened
+	BankAccountOpened struct {
+		AccountID string    `json:"account_id" personal:"subject"`
+		Owner     string    `json:"owner" personal:"data"`
+		OpenedAt  time.Time `json:"opened_at"`
+	}
+
+	// BankAccountCredited is the payload of the event when money is deposited into a bank account
+	BankAccountCredited struct {
+		Amount      uint   `json:"amount"`
+		Description string `json:"description,omitempty"`
+	}
+
+	// BankAccountDebited is the payload of the event when money is withdrawn from a bank account
+	BankAccountDebited struct {
+		Amount uint `json:"amount"`
+	}
+)
+
+// Prints the JSON Schemas of the payloads, run with `schema -payload bank_account_opened` or
+// `validate -payload bank_account_credited payload.json`
+func main() {
+	transformer := json.NewPayloadTransformer()
+	failOnErr(transformer.RegisterPayloads(map[string]json.PayloadInitiator{
+		"bank_account_opened": func() interface{} {
+			return BankAccountOpened{}
+		},
+		"bank_account_credited": func() interface{} {
+			return BankAccountCredited{}
+		},
+		"bank_account_debited": func() interface{} {
+			return BankAccountDebited{}
+		},
+	}))
+
+	args := os.Args[1:]
+	if len(args) == 0 {
+		args = []string{"schema"}
+	}
+
+	failOnErr(cli.Run(transformer, args, os.Stdout, os.Stderr))
+}
+
+func failOnErr(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -14,6 +14,15 @@ type NotificationChannel interface {
 	Qos(prefetchCount, prefetchSize int, global bool) error
 }
 
+// ConfirmChannel represents a NotificationChannel that supports publisher confirms and returns
+type ConfirmChannel interface {
+	NotificationChannel
+
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(returns chan amqp.Return) chan amqp.Return
+}
+
 // setup returns a connection and channel to be used for the Queue setup
 func setup(url, queue string) (io.Closer, NotificationChannel, error) {
 
@@ -24,10 +33,12 @@ func setup(url, queue string) (io.Closer, NotificationChannel, error) {
 
 	ch, err := conn.Channel()
 	if err != nil {
+		_ = conn.Close()
 		return nil, nil, err
 	}
 
 	if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
+		_ = conn.Close()
 		return nil, nil, err
 	}
 
@@ -3,6 +3,7 @@
 package amqp_test
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/hellofresh/goengine"
@@ -61,6 +62,57 @@ func (ch mockChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
 	return nil
 }
 
+// mockConfirmChannel is a ConfirmChannel, the publishings are confirmed, nacked or returned based on the nack and
+// unroutable flags
+type mockConfirmChannel struct {
+	mockChannel
+	sync.Mutex
+
+	nack       bool
+	unroutable bool
+	closed     bool
+	published  int
+	confirms   chan amqp.Confirmation
+	returns    chan amqp.Return
+}
+
+func (ch *mockConfirmChannel) Publish(
+	exchange string,
+	queue string,
+	mandatory bool,
+	immediate bool,
+	msg amqp.Publishing,
+) error {
+	ch.Lock()
+	defer ch.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+
+	ch.published++
+	if ch.unroutable {
+		ch.returns <- amqp.Return{ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE", RoutingKey: queue}
+	}
+	ch.confirms <- amqp.Confirmation{DeliveryTag: uint64(ch.published), Ack: !ch.nack}
+
+	return nil
+}
+
+func (ch *mockConfirmChannel) Confirm(noWait bool) error {
+	return nil
+}
+
+func (ch *mockConfirmChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	ch.confirms = confirm
+	return confirm
+}
+
+func (ch *mockConfirmChannel) NotifyReturn(returns chan amqp.Return) chan amqp.Return {
+	ch.returns = returns
+	return returns
+}
+
 func TestDirectQueueConsume(t *testing.T) {
 	t.Run("Invalid arguments", func(t *testing.T) {
 		_, err := goengineAmqp.DirectQueueConsume("http://localhost:5672/", "my-queue")
@@ -0,0 +1,403 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/streadway/amqp"
+)
+
+type (
+	// Topology describes the exchanges, queues and bindings declared by TopologyConsume
+	Topology struct {
+		// Exchange is the name of the exchange the events are published to
+		Exchange string
+		// ExchangeKind is the kind of the exchange, defaults to topic
+		ExchangeKind string
+		// Queue is the name of the queue to consume
+		Queue string
+		// BindingKeys are the keys used to bind the queue to the exchange, defaults to all keys (#)
+		BindingKeys []string
+		// DeadLetterExchange is the exchange undecodable deliveries are dead-lettered to, when empty they are dropped
+		DeadLetterExchange string
+		// DeadLetterQueue is the queue bound to the dead-letter exchange, when empty no queue is declared
+		DeadLetterQueue string
+		// PrefetchCount is the amount of unacknowledged deliveries the server sends, defaults to 1
+		PrefetchCount int
+	}
+
+	// TopologyChannel represents a channel used to declare a Topology
+	TopologyChannel interface {
+		ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+		QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+		QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	}
+
+	// Consumer consumes the events published by the OutboxRelay, reconstructs them into goengine.Message's and
+	// dispatches them to the message handler of the event.
+	//
+	// Deliveries that cannot be decoded are rejected without requeue so they end up in the dead-letter exchange of the
+	// queue. Deliveries for which the message handler fails are settled according to the DeliveryFailurePolicy, by
+	// default they're requeued with a back-off until they're redelivered DefaultMaxRedeliveries times after which
+	// they're dead-lettered.
+	Consumer struct {
+		consume              Consume
+		payloadFactory       goengine.MessagePayloadFactory
+		init                 func(ctx context.Context) (interface{}, error)
+		handlers             map[string]goengine.MessageHandler
+		minReconnectInterval time.Duration
+		maxReconnectInterval time.Duration
+		failurePolicy        DeliveryFailurePolicy
+		redeliveries         *redeliveries
+		logger               goengine.Logger
+	}
+)
+
+// DeclareTopology declares the exchanges, queues and bindings of the topology using the provided channel
+func DeclareTopology(ch TopologyChannel, topology Topology) error {
+	exchangeKind := topology.ExchangeKind
+	if exchangeKind == "" {
+		exchangeKind = amqp.ExchangeTopic
+	}
+
+	if err := ch.ExchangeDeclare(topology.Exchange, exchangeKind, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	var queueArgs amqp.Table
+	if topology.DeadLetterExchange != "" {
+		if err := ch.ExchangeDeclare(topology.DeadLetterExchange, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+			return err
+		}
+
+		if topology.DeadLetterQueue != "" {
+			if _, err := ch.QueueDeclare(topology.DeadLetterQueue, true, false, false, false, nil); err != nil {
+				return err
+			}
+			if err := ch.QueueBind(topology.DeadLetterQueue, "", topology.DeadLetterExchange, false, nil); err != nil {
+				return err
+			}
+		}
+
+		queueArgs = amqp.Table{"x-dead-letter-exchange": topology.DeadLetterExchange}
+	}
+
+	if _, err := ch.QueueDeclare(topology.Queue, true, false, false, false, queueArgs); err != nil {
+		return err
+	}
+
+	bindingKeys := topology.BindingKeys
+	if len(bindingKeys) == 0 {
+		bindingKeys = []string{"#"}
+	}
+	for _, key := range bindingKeys {
+		if err := ch.QueueBind(topology.Queue, key, topology.Exchange, false, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TopologyConsume returns a Consume func that will connect to the provided AMQP server, declare the topology and
+// consume the queue of the topology
+func TopologyConsume(amqpDSN string, topology Topology) (Consume, error) {
+	switch {
+	case len(topology.Exchange) == 0:
+		return nil, goengine.InvalidArgumentError("topology.Exchange")
+	case len(topology.Queue) == 0:
+		return nil, goengine.InvalidArgumentError("topology.Queue")
+	case topology.PrefetchCount < 0:
+		return nil, goengine.InvalidArgumentError("topology.PrefetchCount")
+	}
+	if _, err := amqp.ParseURI(amqpDSN); err != nil {
+		return nil, goengine.InvalidArgumentError("amqpDSN")
+	}
+
+	prefetchCount := topology.PrefetchCount
+	if prefetchCount == 0 {
+		prefetchCount = 1
+	}
+
+	return func() (io.Closer, <-chan amqp.Delivery, error) {
+		conn, err := amqp.Dial(amqpDSN)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ch, err := conn.Channel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		if err := DeclareTopology(ch, topology); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		if err := ch.Qos(prefetchCount, 0, false); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		deliveries, err := ch.Consume(topology.Queue, "", false, false, false, false, nil)
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		return conn, deliveries, nil
+	}, nil
+}
+
+// NewConsumer returns a new Consumer that dispatches the messages to the provided handlers by event name.
+// The handlers are called with a nil state.
+func NewConsumer(
+	consume Consume,
+	payloadFactory goengine.MessagePayloadFactory,
+	handlers map[string]goengine.MessageHandler,
+	minReconnectInterval time.Duration,
+	maxReconnectInterval time.Duration,
+	logger goengine.Logger,
+) (*Consumer, error) {
+	switch {
+	case consume == nil:
+		return nil, goengine.InvalidArgumentError("consume")
+	case payloadFactory == nil:
+		return nil, goengine.InvalidArgumentError("payloadFactory")
+	case len(handlers) == 0:
+		return nil, goengine.InvalidArgumentError("handlers")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	return &Consumer{
+		consume:        consume,
+		payloadFactory: payloadFactory,
+		init: func(context.Context) (interface{}, error) {
+			return nil, nil
+		},
+		handlers:             handlers,
+		minReconnectInterval: minReconnectInterval,
+		maxReconnectInterval: maxReconnectInterval,
+		failurePolicy:        MaxRedeliveriesFailurePolicy(DefaultMaxRedeliveries),
+		redeliveries:         newRedeliveries(),
+		logger:               logger,
+	}, nil
+}
+
+// NewProjectionConsumer returns a new Consumer that dispatches the messages to the handlers of the projection.
+// The projection state is initialized when Run is called and is only kept in memory.
+func NewProjectionConsumer(
+	consume Consume,
+	payloadFactory goengine.MessagePayloadFactory,
+	projection goengine.Query,
+	minReconnectInterval time.Duration,
+	maxReconnectInterval time.Duration,
+	logger goengine.Logger,
+) (*Consumer, error) {
+	if projection == nil {
+		return nil, goengine.InvalidArgumentError("projection")
+	}
+
+	consumer, err := NewConsumer(consume, payloadFactory, projection.Handlers(), minReconnectInterval, maxReconnectInterval, logger)
+	if err != nil {
+		return nil, err
+	}
+	consumer.init = projection.Init
+
+	return consumer, nil
+}
+
+// WithFailurePolicy sets the DeliveryFailurePolicy used when a message handler failed
+func (c *Consumer) WithFailurePolicy(policy DeliveryFailurePolicy) {
+	if policy != nil {
+		c.failurePolicy = policy
+	}
+}
+
+// Run consumes the deliveries and dispatches the messages until the context is done.
+// The error of the context is returned once it is done.
+func (c *Consumer) Run(ctx context.Context) error {
+	state, err := c.init(ctx)
+	if err != nil {
+		return err
+	}
+
+	var nextReconnect time.Time
+	reconnectInterval := c.minReconnectInterval
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		conn, deliveries, err := c.consume()
+		if err != nil {
+			c.logger.Error("failed to start consuming amqp messages", func(entry goengine.LoggerEntry) {
+				entry.Error(err)
+				entry.String("reconnect_in", reconnectInterval.String())
+			})
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(reconnectInterval):
+			}
+
+			reconnectInterval *= 2
+			if reconnectInterval > c.maxReconnectInterval {
+				reconnectInterval = c.maxReconnectInterval
+			}
+			continue
+		}
+		reconnectInterval = c.minReconnectInterval
+		nextReconnect = time.Now().Add(reconnectInterval)
+
+		state = c.consumeDeliveries(ctx, conn, deliveries, state)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(nextReconnect)):
+		}
+	}
+}
+
+func (c *Consumer) consumeDeliveries(ctx context.Context, conn io.Closer, deliveries <-chan amqp.Delivery, state interface{}) interface{} {
+	defer func() {
+		if conn == nil {
+			return
+		}
+
+		if err := conn.Close(); err != nil {
+			c.logger.Error("failed to close amqp connection", func(entry goengine.LoggerEntry) {
+				entry.Error(err)
+			})
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return state
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return state
+			}
+
+			state = c.handleDelivery(ctx, delivery, state)
+		}
+	}
+}
+
+func (c *Consumer) handleDelivery(ctx context.Context, delivery amqp.Delivery, state interface{}) interface{} {
+	envelope := Envelope{}
+	if err := json.Unmarshal(delivery.Body, &envelope); err != nil {
+		c.deadLetter(delivery, "failed to unmarshal delivery, dead-lettering message", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+		})
+		return state
+	}
+
+	logFields := func(entry goengine.LoggerEntry) {
+		entry.Int64("event.no", envelope.No)
+		entry.String("event.id", envelope.EventID)
+		entry.String("event.name", envelope.EventName)
+	}
+
+	handler, found := c.handlers[envelope.EventName]
+	if !found {
+		c.logger.Warn("no handler for event, skipping message", logFields)
+		c.ack(delivery, logFields)
+		return state
+	}
+
+	message, err := c.reconstructMessage(ctx, envelope)
+	if err != nil {
+		c.deadLetter(delivery, "failed to reconstruct message, dead-lettering message", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+			logFields(entry)
+		})
+		return state
+	}
+
+	newState, err := handler(ctx, state, message)
+	if err != nil {
+		redeliveries := c.redeliveries.count(delivery)
+		action := c.failurePolicy(err, redeliveries)
+		c.redeliveries.settled(delivery, action, redeliveries)
+
+		c.logger.Error("failed to handle message", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+			entry.Int64("redeliveries", redeliveries)
+			entry.Int("action", int(action))
+			logFields(entry)
+		})
+
+		settleFailedDelivery(delivery, action, redeliveries, c.logger, logFields)
+		return state
+	}
+
+	c.ack(delivery, logFields)
+	return newState
+}
+
+func (c *Consumer) reconstructMessage(ctx context.Context, envelope Envelope) (goengine.Message, error) {
+	eventID, err := uuid.Parse(envelope.EventID)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := metadata.UnmarshalJSON(envelope.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := goengine.CreateMessagePayloadWithContext(ctx, c.payloadFactory, envelope.EventName, []byte(envelope.Payload), meta)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregateID, ok := meta.Value(aggregate.IDKey).(string)
+	if !ok {
+		return nil, fmt.Errorf("goengine: metadata key %s is not set or not a string", aggregate.IDKey)
+	}
+	id, err := aggregate.IDFromString(aggregateID)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := metadata.Int64(meta, aggregate.VersionKey)
+	if err != nil || version <= 0 {
+		return nil, aggregate.ErrInvalidChangeVersion
+	}
+
+	return aggregate.ReconstituteChange(id, eventID, payload, meta, envelope.CreatedAt, uint(version))
+}
+
+func (c *Consumer) ack(delivery amqp.Delivery, logFields func(goengine.LoggerEntry)) {
+	c.redeliveries.acknowledged(delivery)
+	if err := delivery.Ack(false); err != nil {
+		c.logger.Error("failed to acknowledge delivery", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+			logFields(entry)
+		})
+	}
+}
+
+func (c *Consumer) deadLetter(delivery amqp.Delivery, msg string, fields func(goengine.LoggerEntry)) {
+	c.logger.Error(msg, fields)
+	settleFailedDelivery(delivery, DeliveryDeadLetter, 0, c.logger, fields)
+}
@@ -0,0 +1,391 @@
+// +build unit
+
+package amqp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	goengineAmqp "github.com/hellofresh/goengine/extension/amqp"
+	"github.com/hellofresh/goengine/strategy/json"
+	"github.com/sirupsen/logrus"
+	libamqp "github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type accountDeposited struct {
+	Amount int `json:"amount"`
+}
+
+type recordingAcknowledger struct {
+	sync.Mutex
+	acked          []uint64
+	nacked         []uint64
+	requeued       []uint64
+	onAcknowledged func()
+}
+
+func (r *recordingAcknowledger) Ack(tag uint64, multiple bool) error {
+	r.Lock()
+	r.acked = append(r.acked, tag)
+	r.Unlock()
+	r.onAcknowledged()
+	return nil
+}
+
+func (r *recordingAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	r.Lock()
+	if requeue {
+		r.requeued = append(r.requeued, tag)
+	} else {
+		r.nacked = append(r.nacked, tag)
+	}
+	r.Unlock()
+	r.onAcknowledged()
+	return nil
+}
+
+func (r *recordingAcknowledger) Reject(tag uint64, requeue bool) error {
+	return r.Nack(tag, false, requeue)
+}
+
+type topologyChannelStub struct {
+	exchanges map[string]string
+	queues    map[string]libamqp.Table
+	bindings  []string
+}
+
+func (ch *topologyChannelStub) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args libamqp.Table) error {
+	ch.exchanges[name] = kind
+	return nil
+}
+
+func (ch *topologyChannelStub) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args libamqp.Table) (libamqp.Queue, error) {
+	ch.queues[name] = args
+	return libamqp.Queue{Name: name}, nil
+}
+
+func (ch *topologyChannelStub) QueueBind(name, key, exchange string, noWait bool, args libamqp.Table) error {
+	ch.bindings = append(ch.bindings, exchange+"->"+name+":"+key)
+	return nil
+}
+
+func TestDeclareTopology(t *testing.T) {
+	t.Run("Declare with dead-lettering", func(t *testing.T) {
+		ch := &topologyChannelStub{exchanges: map[string]string{}, queues: map[string]libamqp.Table{}}
+
+		err := goengineAmqp.DeclareTopology(ch, goengineAmqp.Topology{
+			Exchange:           "bank_events",
+			Queue:              "mailer",
+			BindingKeys:        []string{"bank.deposited", "bank.withdrawn"},
+			DeadLetterExchange: "bank_events_dlx",
+			DeadLetterQueue:    "mailer_dead",
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"bank_events":     libamqp.ExchangeTopic,
+			"bank_events_dlx": libamqp.ExchangeFanout,
+		}, ch.exchanges)
+		assert.Equal(t, map[string]libamqp.Table{
+			"mailer":      {"x-dead-letter-exchange": "bank_events_dlx"},
+			"mailer_dead": nil,
+		}, ch.queues)
+		assert.Equal(t, []string{
+			"bank_events_dlx->mailer_dead:",
+			"bank_events->mailer:bank.deposited",
+			"bank_events->mailer:bank.withdrawn",
+		}, ch.bindings)
+	})
+
+	t.Run("Declare without dead-lettering", func(t *testing.T) {
+		ch := &topologyChannelStub{exchanges: map[string]string{}, queues: map[string]libamqp.Table{}}
+
+		err := goengineAmqp.DeclareTopology(ch, goengineAmqp.Topology{
+			Exchange:     "bank_events",
+			ExchangeKind: libamqp.ExchangeDirect,
+			Queue:        "mailer",
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"bank_events": libamqp.ExchangeDirect}, ch.exchanges)
+		assert.Equal(t, map[string]libamqp.Table{"mailer": nil}, ch.queues)
+		assert.Equal(t, []string{"bank_events->mailer:#"}, ch.bindings)
+	})
+}
+
+func TestTopologyConsume(t *testing.T) {
+	t.Run("Invalid arguments", func(t *testing.T) {
+		_, err := goengineAmqp.TopologyConsume("http://localhost:5672/", goengineAmqp.Topology{Exchange: "events", Queue: "queue"})
+		assert.Equal(t, goengine.InvalidArgumentError("amqpDSN"), err)
+
+		_, err = goengineAmqp.TopologyConsume("amqp://localhost:5672/", goengineAmqp.Topology{Queue: "queue"})
+		assert.Equal(t, goengine.InvalidArgumentError("topology.Exchange"), err)
+
+		_, err = goengineAmqp.TopologyConsume("amqp://localhost:5672/", goengineAmqp.Topology{Exchange: "events"})
+		assert.Equal(t, goengine.InvalidArgumentError("topology.Queue"), err)
+	})
+
+	t.Run("Returns amqp.Consume", func(t *testing.T) {
+		c, err := goengineAmqp.TopologyConsume("amqp://localhost:5672/", goengineAmqp.Topology{Exchange: "events", Queue: "queue"})
+		assert.NoError(t, err)
+		assert.NotNil(t, c)
+	})
+}
+
+func TestNewConsumer(t *testing.T) {
+	consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+		return nil, nil, nil
+	}
+	handlers := map[string]goengine.MessageHandler{
+		"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+			return state, nil
+		},
+	}
+
+	_, err := goengineAmqp.NewConsumer(nil, json.NewPayloadTransformer(), handlers, time.Millisecond, time.Millisecond, nil)
+	assert.Equal(t, goengine.InvalidArgumentError("consume"), err)
+
+	_, err = goengineAmqp.NewConsumer(consume, nil, handlers, time.Millisecond, time.Millisecond, nil)
+	assert.Equal(t, goengine.InvalidArgumentError("payloadFactory"), err)
+
+	_, err = goengineAmqp.NewConsumer(consume, json.NewPayloadTransformer(), nil, time.Millisecond, time.Millisecond, nil)
+	assert.Equal(t, goengine.InvalidArgumentError("handlers"), err)
+
+	_, err = goengineAmqp.NewProjectionConsumer(consume, json.NewPayloadTransformer(), nil, time.Millisecond, time.Millisecond, nil)
+	assert.Equal(t, goengine.InvalidArgumentError("projection"), err)
+}
+
+func TestConsumer_Run(t *testing.T) {
+	const aggregateID = "8150276e-34fe-49d9-aeae-a35af0040a4f"
+
+	t.Run("Reconstruct and dispatch messages", func(t *testing.T) {
+		ensure := require.New(t)
+
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Second)
+		defer ctxCancel()
+
+		bodies := []string{
+			`{"no":1,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01","event_name":"deposited","payload":{"amount":10},"metadata":{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1,"_aggregate_type":"bank_account"},"created_at":"2019-01-02T03:04:05Z"}`,
+			`not json`,
+			`{"no":2,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f02","event_name":"deposited","payload":{"amount":10},"metadata":{},"created_at":"2019-01-02T03:04:05Z"}`,
+			`{"no":3,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f03","event_name":"withdrawn","payload":{"amount":5},"metadata":{},"created_at":"2019-01-02T03:04:05Z"}`,
+			`{"no":4,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f04","event_name":"deposited","payload":{"amount":20},"metadata":{"_aggregate_id":"` + aggregateID + `","_aggregate_version":2},"created_at":"2019-01-02T03:04:05Z"}`,
+		}
+
+		acknowledger := &recordingAcknowledger{}
+		acknowledgements := 0
+		acknowledger.onAcknowledged = func() {
+			acknowledgements++
+			if acknowledgements == len(bodies) {
+				ctxCancel()
+			}
+		}
+
+		consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+			ch := make(chan libamqp.Delivery, len(bodies))
+			for i, body := range bodies {
+				ch <- libamqp.Delivery{Acknowledger: acknowledger, DeliveryTag: uint64(i + 1), Body: []byte(body)}
+			}
+			return nil, ch, nil
+		}
+
+		transformer := json.NewPayloadTransformer()
+		ensure.NoError(transformer.RegisterPayload("deposited", func() interface{} {
+			return accountDeposited{}
+		}))
+
+		var received []*aggregate.Changed
+		projection := &consumerProjection{
+			handlers: map[string]goengine.MessageHandler{
+				"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+					received = append(received, message.(*aggregate.Changed))
+					return state.(int) + message.Payload().(accountDeposited).Amount, nil
+				},
+			},
+		}
+
+		logger, loggerHook := getLogger()
+		consumer, err := goengineAmqp.NewProjectionConsumer(consume, transformer, projection, time.Millisecond, time.Millisecond, logger)
+		ensure.NoError(err)
+
+		err = consumer.Run(ctx)
+		ensure.Equal(context.Canceled, err)
+
+		ensure.Len(received, 2)
+		ensure.Equal(aggregate.ID(aggregateID), received[0].AggregateID())
+		ensure.Equal(uint(1), received[0].Version())
+		ensure.Equal("c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01", received[0].UUID().String())
+		ensure.Equal(accountDeposited{Amount: 10}, received[0].Payload())
+		ensure.Equal("bank_account", received[0].Metadata().Value(aggregate.TypeKey))
+		ensure.Equal(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC), received[0].CreatedAt())
+		ensure.Equal(uint(2), received[1].Version())
+
+		ensure.Equal([]uint64{1, 4, 5}, acknowledger.acked)
+		ensure.Equal([]uint64{2, 3}, acknowledger.nacked)
+		ensure.Empty(acknowledger.requeued)
+
+		logEntries := loggerHook.AllEntries()
+		ensure.Len(logEntries, 3)
+		ensure.Equal("no handler for event, skipping message", logEntries[2].Message)
+		ensure.Equal(logrus.WarnLevel, logEntries[2].Level)
+		ensure.Equal("withdrawn", logEntries[2].Data["event.name"])
+	})
+
+	t.Run("Upcast versioned payloads", func(t *testing.T) {
+		ensure := require.New(t)
+
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Second)
+		defer ctxCancel()
+
+		bodies := []string{
+			`{"no":1,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01","event_name":"deposited","payload":{"cents":1000},"metadata":{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1,"_payload_version":1},"created_at":"2019-01-02T03:04:05Z"}`,
+			`{"no":2,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f02","event_name":"deposited","payload":{"cents":1000},"metadata":{"_aggregate_id":"` + aggregateID + `","_aggregate_version":2,"_payload_version":"one"},"created_at":"2019-01-02T03:04:05Z"}`,
+		}
+
+		acknowledger := &recordingAcknowledger{}
+		acknowledgements := 0
+		acknowledger.onAcknowledged = func() {
+			acknowledgements++
+			if acknowledgements == len(bodies) {
+				ctxCancel()
+			}
+		}
+
+		consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+			ch := make(chan libamqp.Delivery, len(bodies))
+			for i, body := range bodies {
+				ch <- libamqp.Delivery{Acknowledger: acknowledger, DeliveryTag: uint64(i + 1), Body: []byte(body)}
+			}
+			return nil, ch, nil
+		}
+
+		transformer := json.NewPayloadTransformer()
+		ensure.NoError(transformer.RegisterPayload("deposited", func() interface{} {
+			return accountDeposited{}
+		}))
+		ensure.NoError(transformer.RegisterUpcaster("deposited", 1, func(data []byte) ([]byte, error) {
+			return []byte(`{"amount":10}`), nil
+		}))
+
+		var received []goengine.Message
+		consumer, err := goengineAmqp.NewConsumer(consume, transformer, map[string]goengine.MessageHandler{
+			"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+				received = append(received, message)
+				return nil, nil
+			},
+		}, time.Millisecond, time.Millisecond, nil)
+		ensure.NoError(err)
+
+		err = consumer.Run(ctx)
+		ensure.Equal(context.Canceled, err)
+
+		ensure.Len(received, 1)
+		ensure.Equal(accountDeposited{Amount: 10}, received[0].Payload())
+
+		ensure.Equal([]uint64{1}, acknowledger.acked)
+		ensure.Equal([]uint64{2}, acknowledger.nacked)
+	})
+
+	t.Run("Stop reconnecting when the context is done", func(t *testing.T) {
+		ctx, ctxCancel := context.WithCancel(context.Background())
+
+		consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+			ctxCancel()
+			return nil, nil, errors.New("connection refused")
+		}
+
+		consumer, err := goengineAmqp.NewConsumer(consume, json.NewPayloadTransformer(), map[string]goengine.MessageHandler{
+			"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+				return nil, nil
+			},
+		}, time.Hour, time.Hour, nil)
+		require.NoError(t, err)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- consumer.Run(ctx)
+		}()
+
+		select {
+		case err := <-done:
+			assert.Equal(t, context.Canceled, err)
+		case <-time.After(time.Second):
+			t.Fatal("consumer kept waiting to reconnect")
+		}
+	})
+
+	t.Run("Return the error of the context", func(t *testing.T) {
+		ctx, ctxCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer ctxCancel()
+
+		consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+			return nil, nil, errors.New("connection refused")
+		}
+
+		consumer, err := goengineAmqp.NewConsumer(consume, json.NewPayloadTransformer(), map[string]goengine.MessageHandler{
+			"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+				return nil, nil
+			},
+		}, time.Hour, time.Hour, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, context.DeadlineExceeded, consumer.Run(ctx))
+	})
+
+	t.Run("Requeue messages when the handler fails", func(t *testing.T) {
+		ensure := require.New(t)
+
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Second)
+		defer ctxCancel()
+
+		acknowledger := &recordingAcknowledger{onAcknowledged: ctxCancel}
+		consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+			ch := make(chan libamqp.Delivery, 1)
+			ch <- libamqp.Delivery{
+				Acknowledger: acknowledger,
+				DeliveryTag:  1,
+				Body:         []byte(`{"no":1,"stream":"bank","event_id":"c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01","event_name":"deposited","payload":{"amount":10},"metadata":{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1},"created_at":"2019-01-02T03:04:05Z"}`),
+			}
+			return nil, ch, nil
+		}
+
+		transformer := json.NewPayloadTransformer()
+		ensure.NoError(transformer.RegisterPayload("deposited", func() interface{} {
+			return accountDeposited{}
+		}))
+
+		consumer, err := goengineAmqp.NewConsumer(consume, transformer, map[string]goengine.MessageHandler{
+			"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+				return nil, errors.New("mail server unavailable")
+			},
+		}, time.Millisecond, time.Millisecond, nil)
+		ensure.NoError(err)
+
+		err = consumer.Run(ctx)
+		ensure.Equal(context.Canceled, err)
+
+		ensure.Empty(acknowledger.acked)
+		ensure.Empty(acknowledger.nacked)
+		ensure.Equal([]uint64{1}, acknowledger.requeued)
+	})
+}
+
+type consumerProjection struct {
+	handlers map[string]goengine.MessageHandler
+}
+
+func (p *consumerProjection) Init(ctx context.Context) (interface{}, error) {
+	return 0, nil
+}
+
+func (p *consumerProjection) Handlers() map[string]goengine.MessageHandler {
+	return p.handlers
+}
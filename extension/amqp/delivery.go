@@ -0,0 +1,221 @@
+package amqp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// DefaultMaxRedeliveries is the amount of times a failed delivery is redelivered by default before it's
+	// dead-lettered
+	DefaultMaxRedeliveries = 5
+
+	// minRequeueDelay is the delay before the first requeue of a failed delivery
+	minRequeueDelay = 100 * time.Millisecond
+	// maxRequeueDelay is the maximum delay before a failed delivery is requeued
+	maxRequeueDelay = 10 * time.Second
+
+	// maxTrackedRedeliveries is the maximum amount of requeued deliveries of which the redeliveries are tracked
+	maxTrackedRedeliveries = 10000
+)
+
+const (
+	// DeliveryRequeue indicates that the delivery should be negatively acknowledged and requeued
+	DeliveryRequeue DeliveryFailureAction = iota
+	// DeliveryDeadLetter indicates that the delivery should be rejected so it's routed to the dead-letter exchange
+	// of the queue or discarded when the queue has none
+	DeliveryDeadLetter DeliveryFailureAction = iota
+	// DeliveryAckAndLog indicates that the delivery should be acknowledged and the failure only logged
+	DeliveryAckAndLog DeliveryFailureAction = iota
+)
+
+type (
+	// DeliveryFailureAction is the action to take for a delivery that failed to be handled
+	DeliveryFailureAction int
+
+	// DeliveryFailurePolicy is a func used to determine what action to take for a delivery that failed to be handled
+	// based on the error and the amount of times the delivery was redelivered
+	DeliveryFailurePolicy func(err error, redeliveries int64) DeliveryFailureAction
+)
+
+// RequeueDeliveryFailurePolicy requeues every failed delivery, a delivery that always fails is requeued forever when
+// using this policy.
+func RequeueDeliveryFailurePolicy(error, int64) DeliveryFailureAction {
+	return DeliveryRequeue
+}
+
+// MaxRedeliveriesFailurePolicy returns a DeliveryFailurePolicy that requeues a failed delivery until it was
+// redelivered maxRedeliveries times after which the delivery is dead-lettered
+func MaxRedeliveriesFailurePolicy(maxRedeliveries int64) DeliveryFailurePolicy {
+	return func(err error, redeliveries int64) DeliveryFailureAction {
+		if redeliveries >= maxRedeliveries {
+			return DeliveryDeadLetter
+		}
+
+		return DeliveryRequeue
+	}
+}
+
+// RedeliveryCount returns the amount of times the delivery was redelivered according to the delivery.
+//
+// The count is based on the x-delivery-count header set by quorum queues or the x-death header set when a message
+// was dead-lettered. When neither header is available the redelivered flag of the delivery is used, in which case the
+// count is at most 1. For this reason the Listener and Consumer also count the deliveries they requeued themselves.
+func RedeliveryCount(delivery amqp.Delivery) int64 {
+	if count, ok := headerInt(delivery.Headers["x-delivery-count"]); ok {
+		return count
+	}
+
+	if deaths, ok := delivery.Headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		var count int64
+		for _, death := range deaths {
+			table, ok := death.(amqp.Table)
+			if !ok {
+				continue
+			}
+
+			if c, ok := headerInt(table["count"]); ok {
+				count += c
+			}
+		}
+		return count
+	}
+
+	if delivery.Redelivered {
+		return 1
+	}
+
+	return 0
+}
+
+func headerInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// requeueDelay returns the delay before a failed delivery is requeued, the delay doubles with every redelivery
+func requeueDelay(redeliveries int64) time.Duration {
+	delay := minRequeueDelay
+	for i := int64(0); i < redeliveries && delay < maxRequeueDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRequeueDelay {
+		return maxRequeueDelay
+	}
+	return delay
+}
+
+// settleFailedDelivery settles the delivery according to the action.
+// A requeued delivery is negatively acknowledged after a back-off based on the redeliveries so that a failing
+// delivery is not redelivered in a tight loop.
+func settleFailedDelivery(
+	delivery amqp.Delivery,
+	action DeliveryFailureAction,
+	redeliveries int64,
+	logger goengine.Logger,
+	logFields func(goengine.LoggerEntry),
+) {
+	logFailure := func(err error) {
+		if err == nil {
+			return
+		}
+
+		logger.Error("failed to settle failed delivery", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+			entry.Int("action", int(action))
+			logFields(entry)
+		})
+	}
+
+	switch action {
+	case DeliveryDeadLetter:
+		logFailure(delivery.Reject(false))
+	case DeliveryAckAndLog:
+		logFailure(delivery.Ack(false))
+	default:
+		time.AfterFunc(requeueDelay(redeliveries), func() {
+			logFailure(delivery.Nack(false, true))
+		})
+	}
+}
+
+// redeliveries keeps count of the failed deliveries that were requeued.
+// Classic queues don't count the redeliveries of a message, so without it a delivery that always fails would never
+// reach the maximum redeliveries of a DeliveryFailurePolicy.
+type redeliveries struct {
+	mux    sync.Mutex
+	counts map[string]int64
+}
+
+func newRedeliveries() *redeliveries {
+	return &redeliveries{counts: map[string]int64{}}
+}
+
+// count returns the amount of times the delivery was redelivered based on the delivery and the requeued deliveries
+func (r *redeliveries) count(delivery amqp.Delivery) int64 {
+	count := RedeliveryCount(delivery)
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if requeued := r.counts[deliveryKey(delivery)]; requeued > count {
+		return requeued
+	}
+	return count
+}
+
+// settled records how the delivery was settled, only requeued deliveries are kept count of
+func (r *redeliveries) settled(delivery amqp.Delivery, action DeliveryFailureAction, redeliveries int64) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	key := deliveryKey(delivery)
+	if action != DeliveryRequeue {
+		delete(r.counts, key)
+		return
+	}
+
+	if _, found := r.counts[key]; !found && len(r.counts) >= maxTrackedRedeliveries {
+		// A requeued delivery can be redelivered to another consumer, forget a delivery to bound the memory used
+		for k := range r.counts {
+			delete(r.counts, k)
+			break
+		}
+	}
+	r.counts[key] = redeliveries + 1
+}
+
+// acknowledged forgets the redeliveries of a delivery that was handled
+func (r *redeliveries) acknowledged(delivery amqp.Delivery) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if len(r.counts) > 0 {
+		delete(r.counts, deliveryKey(delivery))
+	}
+}
+
+// deliveryKey returns the key identifying the message of a delivery across redeliveries
+func deliveryKey(delivery amqp.Delivery) string {
+	if delivery.MessageId != "" {
+		return delivery.MessageId
+	}
+
+	return string(delivery.Body)
+}
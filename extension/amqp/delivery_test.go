@@ -0,0 +1,57 @@
+// +build unit
+
+package amqp_test
+
+import (
+	"testing"
+
+	"github.com/hellofresh/goengine/extension/amqp"
+	libamqp "github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedeliveryCount(t *testing.T) {
+	testCases := []struct {
+		title    string
+		delivery libamqp.Delivery
+		expected int64
+	}{
+		{
+			"New delivery",
+			libamqp.Delivery{},
+			0,
+		},
+		{
+			"Redelivered flag",
+			libamqp.Delivery{Redelivered: true},
+			1,
+		},
+		{
+			"Quorum queue delivery count",
+			libamqp.Delivery{Redelivered: true, Headers: libamqp.Table{"x-delivery-count": int32(4)}},
+			4,
+		},
+		{
+			"Dead-lettered deliveries",
+			libamqp.Delivery{Headers: libamqp.Table{"x-death": []interface{}{
+				libamqp.Table{"count": int64(2), "queue": "mailer"},
+				libamqp.Table{"count": int64(1), "queue": "mailer_retry"},
+			}}},
+			3,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, amqp.RedeliveryCount(testCase.delivery))
+		})
+	}
+}
+
+func TestMaxRedeliveriesFailurePolicy(t *testing.T) {
+	policy := amqp.MaxRedeliveriesFailurePolicy(2)
+
+	assert.Equal(t, amqp.DeliveryRequeue, policy(nil, 0))
+	assert.Equal(t, amqp.DeliveryRequeue, policy(nil, 1))
+	assert.Equal(t, amqp.DeliveryDeadLetter, policy(nil, 2))
+}
@@ -18,11 +18,21 @@ type (
 	// Consume returns a channel of amqp.Delivery's and a related closer or an error
 	Consume func() (io.Closer, <-chan amqp.Delivery, error)
 
-	// Listener consumes messages from an queue
+	// Listener consumes messages from an queue.
+	//
+	// A delivery is only acknowledged after the notification was projected. Projectors that project in the background
+	// settle the delivery once the notification was projected, see sql.WithNotificationDone. When the projection fails
+	// the DeliveryFailurePolicy determines what happens with the delivery, by default it's requeued with a back-off
+	// until it's redelivered DefaultMaxRedeliveries times after which it's dead-lettered.
+	//
+	// The queue declared by DirectQueueConsume has no dead-letter exchange, so dead-lettered notifications are
+	// discarded. The events of a discarded notification are projected once the projector is triggered again.
 	Listener struct {
 		consume              Consume
 		minReconnectInterval time.Duration
 		maxReconnectInterval time.Duration
+		failurePolicy        DeliveryFailurePolicy
+		redeliveries         *redeliveries
 		logger               goengine.Logger
 	}
 )
@@ -47,10 +57,19 @@ func NewListener(
 		consume:              consume,
 		minReconnectInterval: minReconnectInterval,
 		maxReconnectInterval: maxReconnectInterval,
+		failurePolicy:        MaxRedeliveriesFailurePolicy(DefaultMaxRedeliveries),
+		redeliveries:         newRedeliveries(),
 		logger:               logger,
 	}, nil
 }
 
+// WithFailurePolicy sets the DeliveryFailurePolicy used when a notification failed to be triggered
+func (l *Listener) WithFailurePolicy(policy DeliveryFailurePolicy) {
+	if policy != nil {
+		l.failurePolicy = policy
+	}
+}
+
 // Listen receives messages from a queue, transforms them into a sql.ProjectionNotification and calls the trigger
 func (l *Listener) Listen(ctx context.Context, trigger sql.ProjectionTrigger) error {
 	var nextReconnect time.Time
@@ -114,29 +133,58 @@ func (l *Listener) consumeMessages(ctx context.Context, conn io.Closer, deliveri
 
 			notification := &sql.ProjectionNotification{}
 			if err := easyjson.Unmarshal(msg.Body, notification); err != nil {
-				l.logger.Error("failed to unmarshal delivery, dropping message", func(entry goengine.LoggerEntry) {
+				l.logger.Error("failed to unmarshal delivery, dead-lettering message", func(entry goengine.LoggerEntry) {
 					entry.Error(err)
 				})
+				settleFailedDelivery(msg, DeliveryDeadLetter, 0, l.logger, func(goengine.LoggerEntry) {})
 				continue
 			}
 
-			if err := msg.Ack(false); err != nil {
-				l.logger.Error("failed to acknowledge notification delivery", func(entry goengine.LoggerEntry) {
-					entry.Error(err)
-					entry.Int64("notification.no", notification.No)
-					entry.String("notification.aggregate_id", notification.AggregateID)
-				})
+			logFields := func(entry goengine.LoggerEntry) {
+				entry.Int64("notification.no", notification.No)
+				entry.String("notification.aggregate_id", notification.AggregateID)
+			}
+
+			settle := l.settler(msg, logFields)
+			triggerCtx, claimed := sql.WithNotificationDone(ctx, settle)
+			err := trigger(triggerCtx, notification)
+
+			// The projector settles the delivery once the notification was projected
+			if claimed() {
 				continue
 			}
 
-			if err := trigger(ctx, notification); err != nil {
-				l.logger.Error("failed to project notification", func(entry goengine.LoggerEntry) {
+			settle(err)
+		}
+	}
+}
+
+// settler returns a sql.NotificationDone that acknowledges the delivery when the notification was projected and
+// otherwise settles it according to the DeliveryFailurePolicy
+func (l *Listener) settler(msg amqp.Delivery, logFields func(goengine.LoggerEntry)) sql.NotificationDone {
+	return func(err error) {
+		if err == nil {
+			l.redeliveries.acknowledged(msg)
+			if err := msg.Ack(false); err != nil {
+				l.logger.Error("failed to acknowledge notification delivery", func(entry goengine.LoggerEntry) {
 					entry.Error(err)
-					entry.Int64("notification.no", notification.No)
-					entry.String("notification.aggregate_id", notification.AggregateID)
+					logFields(entry)
 				})
 			}
-
+			return
 		}
+
+		redeliveries := l.redeliveries.count(msg)
+		action := l.failurePolicy(err, redeliveries)
+		l.redeliveries.settled(msg, action, redeliveries)
+
+		l.logger.Error("failed to project notification", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+			entry.Int64("redeliveries", redeliveries)
+			entry.Int("action", int(action))
+			logFields(entry)
+		})
+
+		settleFailedDelivery(msg, action, redeliveries, l.logger, logFields)
 	}
 }
@@ -4,15 +4,24 @@ package amqp_test
 
 import (
 	"context"
+	dbSQL "database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"testing"
 	"time"
 
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
 	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/driver/inmemory"
 	"github.com/hellofresh/goengine/driver/sql"
 	"github.com/hellofresh/goengine/extension/amqp"
 	goengineLogger "github.com/hellofresh/goengine/extension/logrus"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/strategy/json"
 	"github.com/sirupsen/logrus"
 	"github.com/sirupsen/logrus/hooks/test"
 	libamqp "github.com/streadway/amqp"
@@ -177,6 +186,355 @@ func TestListener_Listen(t *testing.T) {
 	})
 }
 
+func TestListener_FailurePolicy(t *testing.T) {
+	testCases := []struct {
+		title         string
+		policy        amqp.DeliveryFailurePolicy
+		expectedState string
+	}{
+		{
+			"Requeue by default",
+			nil,
+			"requeued",
+		},
+		{
+			"Dead-letter",
+			func(error, int64) amqp.DeliveryFailureAction {
+				return amqp.DeliveryDeadLetter
+			},
+			"rejected",
+		},
+		{
+			"Ack and log",
+			func(error, int64) amqp.DeliveryFailureAction {
+				return amqp.DeliveryAckAndLog
+			},
+			"acked",
+		},
+		{
+			"Dead-letter after max redeliveries",
+			amqp.MaxRedeliveriesFailurePolicy(3),
+			"rejected",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.title, func(t *testing.T) {
+			ensure := require.New(t)
+
+			ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer ctxCancel()
+
+			acknowledger := &settleAcknowledger{onSettled: ctxCancel}
+			consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+				ch := make(chan libamqp.Delivery, 1)
+				ch <- libamqp.Delivery{
+					Acknowledger: acknowledger,
+					Headers:      libamqp.Table{"x-delivery-count": int64(3)},
+					Body:         []byte(`{"no": 1, "aggregate_id": "8150276e-34fe-49d9-aeae-a35af0040a4f"}`),
+				}
+				return nil, ch, nil
+			}
+
+			logger, loggerHook := getLogger()
+
+			listener, err := amqp.NewListener(consume, time.Millisecond, time.Millisecond, logger)
+			ensure.NoError(err)
+			listener.WithFailurePolicy(testCase.policy)
+
+			err = listener.Listen(ctx, func(ctx context.Context, notification *sql.ProjectionNotification) error {
+				return errors.New("projection failed")
+			})
+
+			ensure.Equal(context.Canceled, err)
+			ensure.Equal(testCase.expectedState, acknowledger.state)
+
+			logEntries := loggerHook.AllEntries()
+			ensure.Len(logEntries, 1)
+			ensure.Equal("failed to project notification", logEntries[0].Message)
+			ensure.Equal(int64(3), logEntries[0].Data["redeliveries"])
+		})
+	}
+
+	t.Run("Dead-letter undecodable deliveries", func(t *testing.T) {
+		ensure := require.New(t)
+
+		ctx, ctxCancel := context.WithTimeout(context.Background(), time.Second)
+		defer ctxCancel()
+
+		acknowledger := &settleAcknowledger{onSettled: ctxCancel}
+		consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+			ch := make(chan libamqp.Delivery, 1)
+			ch <- libamqp.Delivery{Acknowledger: acknowledger, Body: []byte(`not json`)}
+			return nil, ch, nil
+		}
+
+		listener, err := amqp.NewListener(consume, time.Millisecond, time.Millisecond, nil)
+		ensure.NoError(err)
+
+		err = listener.Listen(ctx, func(ctx context.Context, notification *sql.ProjectionNotification) error {
+			ensure.Fail("Trigger should never be called")
+			return nil
+		})
+
+		ensure.Equal(context.Canceled, err)
+		ensure.Equal("rejected", acknowledger.state)
+	})
+}
+
+func TestListener_ClassicQueueRedeliveries(t *testing.T) {
+	ensure := require.New(t)
+
+	ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ctxCancel()
+
+	queue := &classicQueue{
+		deliveries: make(chan libamqp.Delivery, 1),
+		body:       []byte(`{"no": 1, "aggregate_id": "8150276e-34fe-49d9-aeae-a35af0040a4f"}`),
+		onSettled:  ctxCancel,
+	}
+	consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+		queue.deliver(false)
+		return nil, queue.deliveries, nil
+	}
+
+	listener, err := amqp.NewListener(consume, time.Millisecond, time.Millisecond, nil)
+	ensure.NoError(err)
+	listener.WithFailurePolicy(amqp.MaxRedeliveriesFailurePolicy(3))
+
+	err = listener.Listen(ctx, func(ctx context.Context, notification *sql.ProjectionNotification) error {
+		return errors.New("projection failed")
+	})
+	ensure.Equal(context.Canceled, err)
+
+	queue.mux.Lock()
+	defer queue.mux.Unlock()
+
+	// The message is delivered once and redelivered three times before it's dead-lettered
+	ensure.Equal("rejected", queue.state)
+	ensure.Equal(4, queue.delivered)
+}
+
+func TestListener_SettleAfterProjection(t *testing.T) {
+	testCases := []struct {
+		title         string
+		handlerErr    error
+		expectedState string
+	}{
+		{
+			"Acknowledge once the notification was projected",
+			nil,
+			"acked",
+		},
+		{
+			"Dead-letter when the projection fails",
+			errors.New("projection failed"),
+			"rejected",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.title, func(t *testing.T) {
+			ensure := require.New(t)
+
+			ctx, ctxCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer ctxCancel()
+
+			acknowledger := &settleAcknowledger{onSettled: ctxCancel}
+			consume := func() (io.Closer, <-chan libamqp.Delivery, error) {
+				ch := make(chan libamqp.Delivery, 1)
+				ch <- libamqp.Delivery{
+					Acknowledger: acknowledger,
+					Body:         []byte(`{"no": 1, "aggregate_id": "8150276e-34fe-49d9-aeae-a35af0040a4f"}`),
+				}
+				return nil, ch, nil
+			}
+
+			listener, err := amqp.NewListener(consume, time.Millisecond, time.Millisecond, nil)
+			ensure.NoError(err)
+			listener.WithFailurePolicy(func(error, int64) amqp.DeliveryFailureAction {
+				return amqp.DeliveryDeadLetter
+			})
+
+			db, _, err := sqlmock.New()
+			ensure.NoError(err)
+			defer db.Close()
+
+			transformer := json.NewPayloadTransformer()
+			ensure.NoError(transformer.RegisterPayload("deposited", func() interface{} {
+				return accountDeposited{}
+			}))
+
+			message, err := aggregate.ReconstituteChange(
+				aggregate.GenerateID(),
+				uuid.New(),
+				accountDeposited{Amount: 10},
+				metadata.New(),
+				time.Now().UTC(),
+				1,
+			)
+			ensure.NoError(err)
+
+			eventLoader := func(context.Context, *dbSQL.Conn, *sql.ProjectionNotification, int64) (goengine.EventStream, error) {
+				return inmemory.NewEventStream([]goengine.Message{message}, []int64{1})
+			}
+
+			projection := &listenerProjection{
+				handlers: map[string]goengine.MessageHandler{
+					"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+						// The delivery must not be settled before the notification is projected
+						ensure.Equal("", acknowledger.state)
+						return state, testCase.handlerErr
+					},
+				},
+			}
+
+			projector, err := sql.NewStreamProjector(
+				db,
+				eventLoader,
+				transformer,
+				projection,
+				&listenerProjectorStorage{},
+				func(error, *sql.ProjectionNotification) sql.ProjectionErrorAction {
+					return sql.ProjectionFail
+				},
+				nil,
+			)
+			ensure.NoError(err)
+
+			err = projector.RunAndListen(ctx, listener)
+			if testCase.handlerErr == nil {
+				ensure.Equal(context.Canceled, err)
+			} else {
+				ensure.Error(err)
+			}
+			ensure.Equal(testCase.expectedState, acknowledger.state)
+		})
+	}
+}
+
+type listenerProjection struct {
+	handlers map[string]goengine.MessageHandler
+}
+
+func (p *listenerProjection) Init(ctx context.Context) (interface{}, error) {
+	return nil, nil
+}
+
+func (p *listenerProjection) Handlers() map[string]goengine.MessageHandler {
+	return p.handlers
+}
+
+func (p *listenerProjection) Name() string {
+	return "listener_projection"
+}
+
+func (p *listenerProjection) FromStream() goengine.StreamName {
+	return "event_stream"
+}
+
+type listenerProjectorStorage struct{}
+
+func (s *listenerProjectorStorage) Acquire(context.Context, *dbSQL.Conn, *sql.ProjectionNotification) (sql.ProjectorTransaction, int64, error) {
+	return &listenerProjectorTransaction{}, 0, nil
+}
+
+func (s *listenerProjectorStorage) CreateProjection(context.Context, sql.Execer) error {
+	return nil
+}
+
+type listenerProjectorTransaction struct {
+	state sql.ProjectionState
+}
+
+func (t *listenerProjectorTransaction) AcquireState(context.Context) (sql.ProjectionState, error) {
+	return t.state, nil
+}
+
+func (t *listenerProjectorTransaction) CommitState(state sql.ProjectionState) error {
+	t.state = state
+	return nil
+}
+
+func (t *listenerProjectorTransaction) Close() error {
+	return nil
+}
+
+type settleAcknowledger struct {
+	state     string
+	onSettled func()
+}
+
+func (a *settleAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.state = "acked"
+	a.onSettled()
+	return nil
+}
+
+func (a *settleAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.state = "nacked"
+	if requeue {
+		a.state = "requeued"
+	}
+	a.onSettled()
+	return nil
+}
+
+func (a *settleAcknowledger) Reject(tag uint64, requeue bool) error {
+	a.state = "rejected"
+	a.onSettled()
+	return nil
+}
+
+// classicQueue redelivers requeued messages like the classic queue declared by DirectQueueConsume, which only sets
+// the redelivered flag and no x-delivery-count header
+type classicQueue struct {
+	deliveries chan libamqp.Delivery
+	body       []byte
+	onSettled  func()
+
+	mux       sync.Mutex
+	delivered int
+	state     string
+}
+
+func (q *classicQueue) deliver(redelivered bool) {
+	q.mux.Lock()
+	q.delivered++
+	q.mux.Unlock()
+
+	q.deliveries <- libamqp.Delivery{Acknowledger: q, Redelivered: redelivered, Body: q.body}
+}
+
+func (q *classicQueue) settle(state string) error {
+	q.mux.Lock()
+	q.state = state
+	q.mux.Unlock()
+
+	q.onSettled()
+	return nil
+}
+
+func (q *classicQueue) Ack(tag uint64, multiple bool) error {
+	return q.settle("acked")
+}
+
+func (q *classicQueue) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		q.deliver(true)
+		return nil
+	}
+	return q.settle("nacked")
+}
+
+func (q *classicQueue) Reject(tag uint64, requeue bool) error {
+	return q.settle("rejected")
+}
+
 func getLogger() (goengine.Logger, *test.Hook) {
 	logger, loggerHook := test.NewNullLogger()
 	logger.SetLevel(logrus.DebugLevel)
@@ -0,0 +1,487 @@
+package amqp
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	"github.com/hellofresh/goengine/metadata"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/streadway/amqp"
+)
+
+var (
+	// ErrPublishNotConfirmed occurs when the AMQP server did not confirm a published event
+	ErrPublishNotConfirmed = errors.New("goengine: the amqp server did not confirm the published event")
+	// ErrOutboxBlobStoreRequired occurs when the payload of a event is stored in a blob store but the OutboxRelay has
+	// no blob store
+	ErrOutboxBlobStoreRequired = errors.New("goengine: payload is stored in a blob store but the outbox relay has no blob store")
+
+	payloadCodecKeyJSON      = []byte(`"` + strategyJSON.PayloadCodecKey + `"`)
+	payloadClaimCheckKeyJSON = []byte(`"` + goengine.PayloadClaimCheckKey + `"`)
+)
+
+type (
+	// PublishChannel represents a channel in confirm mode used to publish events
+	PublishChannel interface {
+		Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+		NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	}
+
+	// OutboxConnect returns a PublishChannel in confirm mode and a related closer or an error
+	OutboxConnect func() (io.Closer, PublishChannel, error)
+
+	// RoutingKeyFunc returns the routing key used to publish a event
+	RoutingKeyFunc func(streamName goengine.StreamName, eventName string) string
+
+	// Envelope is the body of a message published by the OutboxRelay.
+	// The payload is always json, payloads stored in a goengine.BlobStore are loaded and payloads stored using a
+	// json.PayloadCodec are decoded by the OutboxRelay.
+	Envelope struct {
+		No        int64           `json:"no"`
+		Stream    string          `json:"stream"`
+		EventID   string          `json:"event_id"`
+		EventName string          `json:"event_name"`
+		Payload   json.RawMessage `json:"payload"`
+		Metadata  json.RawMessage `json:"metadata"`
+		CreatedAt time.Time       `json:"created_at"`
+	}
+
+	// OutboxRelay publishes the events of a postgres event store table to an AMQP exchange.
+	// Every event is published at least once, in order, using publisher confirms. The position of the last published
+	// event is stored in the position table after the events are confirmed.
+	//
+	// The event store table is expected to contain the columns of the json strategy. Only a single OutboxRelay should
+	// run for a stream and exchange, use a sql.LeaderElection when running multiple instances.
+	OutboxRelay struct {
+		db         *sql.DB
+		connect    OutboxConnect
+		exchange   string
+		streamName goengine.StreamName
+		routingKey RoutingKeyFunc
+
+		pollInterval time.Duration
+		gapTimeout   time.Duration
+		batchSize    int
+
+		blobStore goengine.BlobStore
+		logger    goengine.Logger
+
+		queryEvents       string
+		queryPosition     string
+		querySavePosition string
+	}
+)
+
+// DefaultRoutingKey returns a routing key in the format `<stream name>.<event name>`
+func DefaultRoutingKey(streamName goengine.StreamName, eventName string) string {
+	return fmt.Sprintf("%s.%s", streamName, eventName)
+}
+
+// TopicExchangeOutboxConnect returns a OutboxConnect func that will connect to the provided AMQP server, declare a
+// durable topic exchange and put the channel in confirm mode
+func TopicExchangeOutboxConnect(amqpDSN, exchange string) (OutboxConnect, error) {
+	if _, err := amqp.ParseURI(amqpDSN); err != nil {
+		return nil, goengine.InvalidArgumentError("amqpDSN")
+	}
+	if len(exchange) == 0 {
+		return nil, goengine.InvalidArgumentError("exchange")
+	}
+
+	return func() (io.Closer, PublishChannel, error) {
+		conn, err := amqp.Dial(amqpDSN)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ch, err := conn.Channel()
+		if err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		if err := ch.ExchangeDeclare(exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		if err := ch.Confirm(false); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+
+		return conn, ch, nil
+	}, nil
+}
+
+// NewOutboxRelay returns a new OutboxRelay
+func NewOutboxRelay(
+	db *sql.DB,
+	connect OutboxConnect,
+	exchange string,
+	streamName goengine.StreamName,
+	eventStoreTable string,
+	positionTable string,
+	pollInterval time.Duration,
+	batchSize uint,
+	logger goengine.Logger,
+) (*OutboxRelay, error) {
+	switch {
+	case db == nil:
+		return nil, goengine.InvalidArgumentError("db")
+	case connect == nil:
+		return nil, goengine.InvalidArgumentError("connect")
+	case len(exchange) == 0:
+		return nil, goengine.InvalidArgumentError("exchange")
+	case strings.TrimSpace(string(streamName)) == "":
+		return nil, goengine.InvalidArgumentError("streamName")
+	case strings.TrimSpace(eventStoreTable) == "":
+		return nil, goengine.InvalidArgumentError("eventStoreTable")
+	case strings.TrimSpace(positionTable) == "":
+		return nil, goengine.InvalidArgumentError("positionTable")
+	case pollInterval <= 0:
+		return nil, goengine.InvalidArgumentError("pollInterval")
+	case batchSize == 0:
+		return nil, goengine.InvalidArgumentError("batchSize")
+	}
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+	logger = logger.WithFields(func(e goengine.LoggerEntry) {
+		e.String("exchange", exchange)
+		e.String("stream", string(streamName))
+	})
+
+	positionTableQuoted := postgres.QuoteIdentifier(positionTable)
+
+	/* #nosec G201 */
+	return &OutboxRelay{
+		db:           db,
+		connect:      connect,
+		exchange:     exchange,
+		streamName:   streamName,
+		routingKey:   DefaultRoutingKey,
+		pollInterval: pollInterval,
+		gapTimeout:   10 * pollInterval,
+		batchSize:    int(batchSize),
+		logger:       logger,
+
+		queryEvents: fmt.Sprintf(
+			`SELECT no, event_id, event_name, payload, metadata, created_at FROM %s WHERE no > $1 ORDER BY no LIMIT %d`,
+			postgres.QuoteIdentifier(eventStoreTable),
+			batchSize,
+		),
+		queryPosition: fmt.Sprintf(
+			`SELECT position FROM %s WHERE stream_name = $1 AND exchange = $2`,
+			positionTableQuoted,
+		),
+		querySavePosition: fmt.Sprintf(
+			`INSERT INTO %s (stream_name, exchange, position) VALUES ($1, $2, $3)
+			 ON CONFLICT (stream_name, exchange) DO UPDATE SET position = EXCLUDED.position`,
+			positionTableQuoted,
+		),
+	}, nil
+}
+
+// WithRoutingKey sets the RoutingKeyFunc used to determine the routing key of a event
+func (r *OutboxRelay) WithRoutingKey(routingKey RoutingKeyFunc) {
+	if routingKey != nil {
+		r.routingKey = routingKey
+	}
+}
+
+// WithBlobStore sets the goengine.BlobStore used to load the payloads of the events stored using a claim check
+func (r *OutboxRelay) WithBlobStore(blobStore goengine.BlobStore) {
+	r.blobStore = blobStore
+}
+
+// Run publishes the events appended to the event store table until the context is done
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	position, err := r.loadPosition(ctx)
+	if err != nil {
+		return err
+	}
+
+	publisher := &outboxPublisher{relay: r}
+	defer publisher.close()
+
+	gaps := map[int64]time.Time{}
+	for {
+		events, err := r.loadEvents(ctx, position, gaps)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if len(events) > 0 {
+			if err := publisher.publish(ctx, events); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+
+				r.logger.Error("failed to publish events", func(e goengine.LoggerEntry) {
+					e.Error(err)
+					e.Int64("position", position)
+				})
+				publisher.close()
+			} else {
+				position = events[len(events)-1].No
+				if err := r.savePosition(ctx, position); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+
+				r.logger.Debug("published events", func(e goengine.LoggerEntry) {
+					e.Int("count", len(events))
+					e.Int64("position", position)
+				})
+
+				// Publish the next batch immediately when the batch was full
+				if len(events) == r.batchSize {
+					continue
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// resolveEventPayload returns the json payload and metadata of a event.
+// Payloads stored in a blob store are loaded and payloads stored using a json.PayloadCodec are decoded into json.
+// Since the published payload is neither a reference nor encoded the claim check and codec are removed from the metadata.
+func (r *OutboxRelay) resolveEventPayload(ctx context.Context, payload []byte, rawMetadata []byte) ([]byte, []byte, error) {
+	if !bytes.Contains(rawMetadata, payloadClaimCheckKeyJSON) && !bytes.Contains(rawMetadata, payloadCodecKeyJSON) {
+		return payload, rawMetadata, nil
+	}
+
+	meta, err := metadata.UnmarshalJSON(rawMetadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if reference, ok := meta.Value(goengine.PayloadClaimCheckKey).(string); ok {
+		if r.blobStore == nil {
+			return nil, nil, ErrOutboxBlobStoreRequired
+		}
+		if payload, err = r.blobStore.Get(ctx, reference); err != nil {
+			return nil, nil, err
+		}
+
+		meta = metadata.WithoutValue(meta, goengine.PayloadClaimCheckKey)
+	}
+
+	if codec, ok := meta.Value(strategyJSON.PayloadCodecKey).(string); ok {
+		if payload, err = strategyJSON.DecodePayload(codec, payload); err != nil {
+			return nil, nil, err
+		}
+
+		meta = metadata.WithoutValue(meta, strategyJSON.PayloadCodecKey)
+	}
+
+	typed, err := hasMetadataTypes(rawMetadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if typed {
+		rawMetadata, err = metadata.MarshalTypedJSON(meta)
+	} else {
+		rawMetadata, err = json.Marshal(meta)
+	}
+
+	return payload, rawMetadata, err
+}
+
+// hasMetadataTypes returns true when the metadata was marshaled using metadata.MarshalTypedJSON
+func hasMetadataTypes(rawMetadata []byte) (bool, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(rawMetadata, &values); err != nil {
+		return false, err
+	}
+
+	_, typed := values[metadata.TypesKey]
+	return typed, nil
+}
+
+func (r *OutboxRelay) loadPosition(ctx context.Context) (int64, error) {
+	var position int64
+	err := r.db.QueryRowContext(ctx, r.queryPosition, string(r.streamName), r.exchange).Scan(&position)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return position, err
+}
+
+func (r *OutboxRelay) savePosition(ctx context.Context, position int64) error {
+	_, err := r.db.ExecContext(ctx, r.querySavePosition, string(r.streamName), r.exchange, position)
+	return err
+}
+
+// loadEvents returns the events appended after the position.
+// Since a event number can become visible after a higher number the events after a gap are only returned once the gap
+// is older than the gap timeout.
+func (r *OutboxRelay) loadEvents(ctx context.Context, position int64, gaps map[int64]time.Time) ([]*Envelope, error) {
+	rows, err := r.db.QueryContext(ctx, r.queryEvents, position)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Warn("failed to close the outbox rows", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	now := time.Now()
+	expected := position + 1
+
+	var events []*Envelope
+	for rows.Next() {
+		event := &Envelope{Stream: string(r.streamName)}
+		var payload, metadata []byte
+		if err := rows.Scan(&event.No, &event.EventID, &event.EventName, &payload, &metadata, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if event.No != expected {
+			seenAt, found := gaps[expected]
+			if !found {
+				gaps[expected] = now
+				break
+			}
+			if now.Sub(seenAt) < r.gapTimeout {
+				break
+			}
+
+			r.logger.Warn("skipping event number gap", func(e goengine.LoggerEntry) {
+				e.Int64("from", expected)
+				e.Int64("to", event.No-1)
+			})
+		}
+
+		for no := range gaps {
+			if no <= event.No {
+				delete(gaps, no)
+			}
+		}
+
+		if payload, metadata, err = r.resolveEventPayload(ctx, payload, metadata); err != nil {
+			return nil, err
+		}
+		event.Payload = json.RawMessage(payload)
+		event.Metadata = json.RawMessage(metadata)
+
+		events = append(events, event)
+		expected = event.No + 1
+	}
+
+	return events, rows.Err()
+}
+
+// outboxPublisher publishes events using a PublishChannel in confirm mode
+type outboxPublisher struct {
+	relay *OutboxRelay
+
+	connection io.Closer
+	channel    PublishChannel
+	confirms   chan amqp.Confirmation
+}
+
+func (p *outboxPublisher) publish(ctx context.Context, events []*Envelope) error {
+	if p.channel == nil {
+		conn, ch, err := p.relay.connect()
+		if err != nil {
+			return err
+		}
+
+		p.connection = conn
+		p.channel = ch
+		p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, p.relay.batchSize))
+	}
+
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		err = p.channel.Publish(p.relay.exchange, p.relay.routingKey(p.relay.streamName, event.EventName), false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    event.EventID,
+			Type:         event.EventName,
+			Timestamp:    event.CreatedAt,
+			Body:         body,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Confirmations are received in the same order as the events where published
+	for range events {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case confirm, ok := <-p.confirms:
+			if !ok {
+				return amqp.ErrClosed
+			}
+			if !confirm.Ack {
+				return ErrPublishNotConfirmed
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *outboxPublisher) close() {
+	if p.connection != nil {
+		if err := p.connection.Close(); err != nil {
+			p.relay.logger.Warn("failed to close amqp connection", func(e goengine.LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}
+
+	p.connection = nil
+	p.channel = nil
+	p.confirms = nil
+}
+
+// OutboxCreateSchema return the sql statement needed for the postgres database in order to use the OutboxRelay
+func OutboxCreateSchema(positionTable string) []string {
+	/* #nosec G201 */
+	return []string{
+		fmt.Sprintf(
+			`CREATE TABLE IF NOT EXISTS %s (
+				stream_name VARCHAR(150) NOT NULL,
+				exchange VARCHAR(255) NOT NULL,
+				position BIGINT NOT NULL DEFAULT 0,
+				PRIMARY KEY (stream_name, exchange)
+			)`,
+			postgres.QuoteIdentifier(positionTable),
+		),
+	}
+}
@@ -0,0 +1,488 @@
+// +build unit
+
+package amqp_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	goengineAmqp "github.com/hellofresh/goengine/extension/amqp"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type publishedMessage struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+type confirmChannel struct {
+	sync.Mutex
+
+	nack      bool
+	published []publishedMessage
+	confirms  chan amqp.Confirmation
+	tag       uint64
+}
+
+func (ch *confirmChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	ch.Lock()
+	defer ch.Unlock()
+
+	ch.tag++
+	ch.published = append(ch.published, publishedMessage{exchange, key, msg})
+	ch.confirms <- amqp.Confirmation{DeliveryTag: ch.tag, Ack: !ch.nack}
+
+	return nil
+}
+
+func (ch *confirmChannel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	ch.confirms = confirm
+	return confirm
+}
+
+func (ch *confirmChannel) messages() []publishedMessage {
+	ch.Lock()
+	defer ch.Unlock()
+
+	return append([]publishedMessage(nil), ch.published...)
+}
+
+func TestNewOutboxRelay(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	connect := func() (io.Closer, goengineAmqp.PublishChannel, error) {
+		return nil, nil, nil
+	}
+
+	testCases := []struct {
+		title           string
+		db              *sql.DB
+		connect         goengineAmqp.OutboxConnect
+		exchange        string
+		streamName      goengine.StreamName
+		eventStoreTable string
+		positionTable   string
+		pollInterval    time.Duration
+		batchSize       uint
+		expectedError   string
+	}{
+		{"Invalid db", nil, connect, "events", "event_stream", "events_table", "positions", time.Second, 10, "db"},
+		{"Invalid connect", db, nil, "events", "event_stream", "events_table", "positions", time.Second, 10, "connect"},
+		{"Invalid exchange", db, connect, "", "event_stream", "events_table", "positions", time.Second, 10, "exchange"},
+		{"Invalid stream name", db, connect, "events", "", "events_table", "positions", time.Second, 10, "streamName"},
+		{"Invalid event store table", db, connect, "events", "event_stream", "", "positions", time.Second, 10, "eventStoreTable"},
+		{"Invalid position table", db, connect, "events", "event_stream", "events_table", "", time.Second, 10, "positionTable"},
+		{"Invalid poll interval", db, connect, "events", "event_stream", "events_table", "positions", 0, 10, "pollInterval"},
+		{"Invalid batch size", db, connect, "events", "event_stream", "events_table", "positions", time.Second, 0, "batchSize"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			relay, err := goengineAmqp.NewOutboxRelay(
+				testCase.db,
+				testCase.connect,
+				testCase.exchange,
+				testCase.streamName,
+				testCase.eventStoreTable,
+				testCase.positionTable,
+				testCase.pollInterval,
+				testCase.batchSize,
+				nil,
+			)
+
+			assert.Nil(t, relay)
+			assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedError), err)
+		})
+	}
+}
+
+func TestOutboxRelay_Run(t *testing.T) {
+	columns := []string{"no", "event_id", "event_name", "payload", "metadata", "created_at"}
+	createdAt := time.Date(2019, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Publish events and store the position", func(t *testing.T) {
+		db, dbMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dbMock.ExpectQuery(`SELECT position FROM "positions" WHERE stream_name = \$1 AND exchange = \$2`).
+			WithArgs("event_stream", "events").
+			WillReturnRows(sqlmock.NewRows([]string{"position"}).AddRow(4))
+		dbMock.ExpectQuery(`SELECT no, event_id, event_name, payload, metadata, created_at FROM "events_table" WHERE no > \$1 ORDER BY no LIMIT 10`).
+			WithArgs(4).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(5, "c5e1e5e8-3a3a-4a8e-9e6a-2f6d0b4c9a01", "account_credited", []byte(`{"amount":10}`), []byte(`{"_aggregate_version":1}`), createdAt).
+				AddRow(6, "c5e1e5e8-3a3a-4a8e-9e6a-2f6d0b4c9a02", "account_debited", []byte(`{"amount":5}`), []byte(`{"_aggregate_version":2}`), createdAt),
+			)
+		dbMock.ExpectExec(`INSERT INTO "positions" \(stream_name, exchange, position\) VALUES \(\$1, \$2, \$3\)`).
+			WithArgs("event_stream", "events", 6).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		logger, loggerHook := getLogger()
+		channel := &confirmChannel{}
+		relay, err := goengineAmqp.NewOutboxRelay(db, func() (io.Closer, goengineAmqp.PublishChannel, error) {
+			return mockConnection{}, channel, nil
+		}, "events", "event_stream", "events_table", "positions", time.Minute, 10, logger)
+		require.NoError(t, err)
+
+		done := make(chan error)
+		go func() {
+			done <- relay.Run(ctx)
+		}()
+
+		// Wait for the position to be stored
+		deadline := time.Now().Add(time.Second)
+		for !hasLogEntry(loggerHook.AllEntries(), "published events") && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		require.NoError(t, <-done)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+
+		published := channel.messages()
+		require.Len(t, published, 2)
+		assert.Equal(t, "events", published[0].exchange)
+		assert.Equal(t, "event_stream.account_credited", published[0].key)
+		assert.Equal(t, "event_stream.account_debited", published[1].key)
+		assert.Equal(t, "c5e1e5e8-3a3a-4a8e-9e6a-2f6d0b4c9a01", published[0].msg.MessageId)
+		assert.Equal(t, amqp.Persistent, published[0].msg.DeliveryMode)
+
+		var envelope goengineAmqp.Envelope
+		require.NoError(t, json.Unmarshal(published[0].msg.Body, &envelope))
+		assert.Equal(t, goengineAmqp.Envelope{
+			No:        5,
+			Stream:    "event_stream",
+			EventID:   "c5e1e5e8-3a3a-4a8e-9e6a-2f6d0b4c9a01",
+			EventName: "account_credited",
+			Payload:   json.RawMessage(`{"amount":10}`),
+			Metadata:  json.RawMessage(`{"_aggregate_version":1}`),
+			CreatedAt: createdAt,
+		}, envelope)
+	})
+
+	t.Run("Do not store the position when the events are not confirmed", func(t *testing.T) {
+		db, dbMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		dbMock.ExpectQuery(`SELECT position FROM "positions"`).
+			WillReturnError(sql.ErrNoRows)
+		dbMock.ExpectQuery(`SELECT no, event_id, event_name, payload, metadata, created_at FROM "events_table"`).
+			WithArgs(0).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, "c5e1e5e8-3a3a-4a8e-9e6a-2f6d0b4c9a01", "account_credited", []byte(`{}`), []byte(`{}`), createdAt),
+			)
+
+		logger, loggerHook := getLogger()
+		channel := &confirmChannel{nack: true}
+		relay, err := goengineAmqp.NewOutboxRelay(db, func() (io.Closer, goengineAmqp.PublishChannel, error) {
+			return mockConnection{}, channel, nil
+		}, "events", "event_stream", "events_table", "positions", time.Minute, 10, logger)
+		require.NoError(t, err)
+
+		done := make(chan error)
+		go func() {
+			done <- relay.Run(ctx)
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for !hasLogEntry(loggerHook.AllEntries(), "failed to publish events") && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		require.NoError(t, <-done)
+
+		assert.Len(t, channel.messages(), 1)
+		assert.NoError(t, dbMock.ExpectationsWereMet())
+	})
+}
+
+func TestOutboxRelay_PayloadCodec(t *testing.T) {
+	const aggregateID = "8150276e-34fe-49d9-aeae-a35af0040a4f"
+
+	ensure := require.New(t)
+
+	codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionGzip, 0)
+	ensure.NoError(err)
+
+	jsonPayload := []byte(`{"amount":10,"note":"` + strings.Repeat("deposit ", 32) + `"}`)
+	codecName, payload, err := codec.EncodePayload(jsonPayload)
+	ensure.NoError(err)
+	ensure.Equal("msgpack+gzip", codecName)
+
+	db, dbMock, err := sqlmock.New()
+	ensure.NoError(err)
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dbMock.ExpectQuery(`SELECT position FROM "positions"`).
+		WillReturnError(sql.ErrNoRows)
+	dbMock.ExpectQuery(`SELECT no, event_id, event_name, payload, metadata, created_at FROM "events_table"`).
+		WithArgs(0).
+		WillReturnRows(sqlmock.NewRows([]string{"no", "event_id", "event_name", "payload", "metadata", "created_at"}).
+			AddRow(1, "c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01", "deposited", payload, []byte(`{"_aggregate_id":"`+aggregateID+`","_aggregate_version":1,"_payload_codec":"msgpack+gzip"}`), time.Now().UTC()),
+		)
+	dbMock.ExpectExec(`INSERT INTO "positions"`).
+		WithArgs("event_stream", "events", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	logger, loggerHook := getLogger()
+	channel := &confirmChannel{}
+	relay, err := goengineAmqp.NewOutboxRelay(db, func() (io.Closer, goengineAmqp.PublishChannel, error) {
+		return mockConnection{}, channel, nil
+	}, "events", "event_stream", "events_table", "positions", time.Minute, 10, logger)
+	ensure.NoError(err)
+
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !hasLogEntry(loggerHook.AllEntries(), "published events") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	ensure.NoError(<-done)
+
+	published := channel.messages()
+	ensure.Len(published, 1)
+
+	var envelope goengineAmqp.Envelope
+	ensure.NoError(json.Unmarshal(published[0].msg.Body, &envelope))
+	ensure.JSONEq(string(jsonPayload), string(envelope.Payload))
+	ensure.NotContains(string(envelope.Metadata), strategyJSON.PayloadCodecKey)
+
+	// The published event is consumed like any other event
+	consumeCtx, consumeCancel := context.WithTimeout(context.Background(), time.Second)
+	defer consumeCancel()
+
+	acknowledger := &recordingAcknowledger{onAcknowledged: consumeCancel}
+	consume := func() (io.Closer, <-chan amqp.Delivery, error) {
+		ch := make(chan amqp.Delivery, 1)
+		ch <- amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 1, Body: published[0].msg.Body}
+		return nil, ch, nil
+	}
+
+	transformer := strategyJSON.NewPayloadTransformer()
+	ensure.NoError(transformer.RegisterPayload("deposited", func() interface{} {
+		return accountDeposited{}
+	}))
+
+	var received []interface{}
+	consumer, err := goengineAmqp.NewConsumer(consume, transformer, map[string]goengine.MessageHandler{
+		"deposited": func(ctx context.Context, state interface{}, message goengine.Message) (interface{}, error) {
+			received = append(received, message.Payload())
+			return state, nil
+		},
+	}, time.Millisecond, time.Millisecond, nil)
+	ensure.NoError(err)
+
+	ensure.Equal(context.Canceled, consumer.Run(consumeCtx))
+	ensure.Equal([]uint64{1}, acknowledger.acked)
+	ensure.Equal([]interface{}{accountDeposited{Amount: 10}}, received)
+}
+
+func TestOutboxRelay_ClaimCheck(t *testing.T) {
+	const aggregateID = "8150276e-34fe-49d9-aeae-a35af0040a4f"
+
+	codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingJSON, strategyJSON.PayloadCompressionGzip, 0)
+	require.NoError(t, err)
+
+	jsonPayload := []byte(`{"amount":10,"note":"` + strings.Repeat("deposit ", 32) + `"}`)
+	codecName, payload, err := codec.EncodePayload(jsonPayload)
+	require.NoError(t, err)
+
+	blobStore := inmemory.NewBlobStore()
+	reference, err := blobStore.Put(context.Background(), payload)
+	require.NoError(t, err)
+
+	expectLoadEvents := func(dbMock sqlmock.Sqlmock) {
+		dbMock.ExpectQuery(`SELECT position FROM "positions"`).
+			WillReturnError(sql.ErrNoRows)
+		dbMock.ExpectQuery(`SELECT no, event_id, event_name, payload, metadata, created_at FROM "events_table"`).
+			WithArgs(0).
+			WillReturnRows(sqlmock.NewRows([]string{"no", "event_id", "event_name", "payload", "metadata", "created_at"}).
+				AddRow(1, "c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01", "deposited", []byte("null"), []byte(`{"_aggregate_id":"`+aggregateID+`","_aggregate_version":1,"_payload_codec":"`+codecName+`","_payload_claim_check":"`+reference+`"}`), time.Now().UTC()),
+			)
+	}
+
+	t.Run("Publish the payload stored in the blob store", func(t *testing.T) {
+		ensure := require.New(t)
+
+		db, dbMock, err := sqlmock.New()
+		ensure.NoError(err)
+		defer db.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		expectLoadEvents(dbMock)
+		dbMock.ExpectExec(`INSERT INTO "positions"`).
+			WithArgs("event_stream", "events", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		logger, loggerHook := getLogger()
+		channel := &confirmChannel{}
+		relay, err := goengineAmqp.NewOutboxRelay(db, func() (io.Closer, goengineAmqp.PublishChannel, error) {
+			return mockConnection{}, channel, nil
+		}, "events", "event_stream", "events_table", "positions", time.Minute, 10, logger)
+		ensure.NoError(err)
+		relay.WithBlobStore(blobStore)
+
+		done := make(chan error)
+		go func() {
+			done <- relay.Run(ctx)
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for !hasLogEntry(loggerHook.AllEntries(), "published events") && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		ensure.NoError(<-done)
+
+		published := channel.messages()
+		ensure.Len(published, 1)
+
+		var envelope goengineAmqp.Envelope
+		ensure.NoError(json.Unmarshal(published[0].msg.Body, &envelope))
+		ensure.JSONEq(string(jsonPayload), string(envelope.Payload))
+		ensure.NotContains(string(envelope.Metadata), strategyJSON.PayloadCodecKey)
+		ensure.NotContains(string(envelope.Metadata), goengine.PayloadClaimCheckKey)
+		ensure.Contains(string(envelope.Metadata), aggregateID)
+	})
+
+	t.Run("Fail without a blob store", func(t *testing.T) {
+		ensure := require.New(t)
+
+		db, dbMock, err := sqlmock.New()
+		ensure.NoError(err)
+		defer db.Close()
+
+		expectLoadEvents(dbMock)
+
+		channel := &confirmChannel{}
+		relay, err := goengineAmqp.NewOutboxRelay(db, func() (io.Closer, goengineAmqp.PublishChannel, error) {
+			return mockConnection{}, channel, nil
+		}, "events", "event_stream", "events_table", "positions", time.Minute, 10, nil)
+		ensure.NoError(err)
+
+		ensure.Equal(goengineAmqp.ErrOutboxBlobStoreRequired, relay.Run(context.Background()))
+		ensure.Empty(channel.messages())
+	})
+}
+
+func TestOutboxRelay_MetadataTypes(t *testing.T) {
+	const aggregateID = "8150276e-34fe-49d9-aeae-a35af0040a4f"
+
+	codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionNone, 0)
+	require.NoError(t, err)
+
+	codecName, payload, err := codec.EncodePayload([]byte(`{"amount":10}`))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		title            string
+		metadata         string
+		expectedMetadata string
+	}{
+		{
+			"typed metadata",
+			`{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1,"_metadata_types":{"_aggregate_version":"uint64"},"_payload_codec":"` + codecName + `"}`,
+			`{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1,"_metadata_types":{"_aggregate_version":"uint64"}}`,
+		},
+		{
+			"types key in a value",
+			`{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1,"_payload_codec":"` + codecName + `","note":"_metadata_types","nested":{"_metadata_types":{}}}`,
+			`{"_aggregate_id":"` + aggregateID + `","_aggregate_version":1,"note":"_metadata_types","nested":{"_metadata_types":{}}}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.title, func(t *testing.T) {
+			ensure := require.New(t)
+
+			db, dbMock, err := sqlmock.New()
+			ensure.NoError(err)
+			defer db.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			dbMock.ExpectQuery(`SELECT position FROM "positions"`).
+				WillReturnError(sql.ErrNoRows)
+			dbMock.ExpectQuery(`SELECT no, event_id, event_name, payload, metadata, created_at FROM "events_table"`).
+				WithArgs(0).
+				WillReturnRows(sqlmock.NewRows([]string{"no", "event_id", "event_name", "payload", "metadata", "created_at"}).
+					AddRow(1, "c1f0b8e8-7a4c-4b7a-9a49-3c5d1a5b5f01", "deposited", payload, []byte(testCase.metadata), time.Now().UTC()),
+				)
+			dbMock.ExpectExec(`INSERT INTO "positions"`).
+				WithArgs("event_stream", "events", 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			logger, loggerHook := getLogger()
+			channel := &confirmChannel{}
+			relay, err := goengineAmqp.NewOutboxRelay(db, func() (io.Closer, goengineAmqp.PublishChannel, error) {
+				return mockConnection{}, channel, nil
+			}, "events", "event_stream", "events_table", "positions", time.Minute, 10, logger)
+			ensure.NoError(err)
+
+			done := make(chan error)
+			go func() {
+				done <- relay.Run(ctx)
+			}()
+
+			deadline := time.Now().Add(time.Second)
+			for !hasLogEntry(loggerHook.AllEntries(), "published events") && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			ensure.NoError(<-done)
+
+			published := channel.messages()
+			ensure.Len(published, 1)
+
+			var envelope goengineAmqp.Envelope
+			ensure.NoError(json.Unmarshal(published[0].msg.Body, &envelope))
+			ensure.JSONEq(`{"amount":10}`, string(envelope.Payload))
+			ensure.JSONEq(testCase.expectedMetadata, string(envelope.Metadata))
+		})
+	}
+}
+
+func hasLogEntry(entries []*logrus.Entry, message string) bool {
+	for _, entry := range entries {
+		if entry.Message == message {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package amqp
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"sync"
 	"time"
@@ -14,21 +15,73 @@ import (
 
 var _ sql.ProjectionTrigger = (&NotificationPublisher{}).Publish
 
-// NotificationPublisher is responsible of publishing a notification to queue
-type NotificationPublisher struct {
-	amqpDSN              string
-	queue                string
-	minReconnectInterval time.Duration
-	maxReconnectInterval time.Duration
-	logger               goengine.Logger
+// defaultPublisherPoolSize is the default amount of channels used by a NotificationPublisher
+const defaultPublisherPoolSize = 4
 
-	connection io.Closer
-	channel    NotificationChannel
+// ReturnedError occurs when a published notification could not be routed to a queue and was returned by the server
+type ReturnedError struct {
+	ReplyCode uint16
+	ReplyText string
+}
 
-	mux sync.Mutex
+func (e *ReturnedError) Error() string {
+	return fmt.Sprintf("goengine: the amqp server returned the notification: %d %s", e.ReplyCode, e.ReplyText)
 }
 
-// NewNotificationPublisher returns an instance of NotificationPublisher
+type (
+	// NotificationPublisher is responsible of publishing a notification to queue.
+	//
+	// The notifications are published using publisher confirms and the mandatory flag. Publish only returns after the
+	// server confirmed the notification and returns an error when the notification was not confirmed or returned.
+	// Concurrent calls to Publish use a pool of channels opened on a single connection, the size of the pool bounds the
+	// amount of notifications that are in-flight.
+	// When the connection fails Publish reconnects with an exponential back-off until the context is done.
+	NotificationPublisher struct {
+		amqpDSN              string
+		queue                string
+		minReconnectInterval time.Duration
+		maxReconnectInterval time.Duration
+		logger               goengine.Logger
+
+		connect    func() (publisherConnection, error)
+		connMux    sync.Mutex
+		connection publisherConnection
+
+		mux      sync.Mutex
+		poolSize int
+		open     int
+		idle     chan *publisherChannel
+	}
+
+	// publisherConnection is a connection used to open the channels of the NotificationPublisher pool
+	publisherConnection interface {
+		io.Closer
+
+		Channel() (NotificationChannel, error)
+		IsClosed() bool
+	}
+
+	// queueConnection is a publisherConnection that declares the queue on every channel it opens
+	queueConnection struct {
+		*amqp.Connection
+
+		queue string
+	}
+
+	// publisherChannel is a channel of the NotificationPublisher pool, the channel is in confirm mode when it's a
+	// ConfirmChannel
+	publisherChannel struct {
+		connection io.Closer
+		channel    NotificationChannel
+		confirms   chan amqp.Confirmation
+		returns    chan amqp.Return
+	}
+)
+
+// NewNotificationPublisher returns an instance of NotificationPublisher.
+// The connection and channel are optional, when provided they are used as the first channel of the pool and the
+// connection is closed once the channel is discarded.
+// A channel that is not a ConfirmChannel is used without publisher confirms.
 func NewNotificationPublisher(
 	amqpDSN,
 	queue string,
@@ -45,18 +98,68 @@ func NewNotificationPublisher(
 	if len(queue) == 0 {
 		return nil, goengine.InvalidArgumentError("queue")
 	}
-	return &NotificationPublisher{
+
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	p := &NotificationPublisher{
 		amqpDSN:              amqpDSN,
 		queue:                queue,
 		minReconnectInterval: minReconnectInterval,
 		maxReconnectInterval: maxReconnectInterval,
 		logger:               logger,
-		connection:           connection,
-		channel:              channel,
-	}, nil
+		connect: func() (publisherConnection, error) {
+			conn, err := amqp.Dial(amqpDSN)
+			if err != nil {
+				return nil, err
+			}
+
+			return &queueConnection{Connection: conn, queue: queue}, nil
+		},
+		poolSize: defaultPublisherPoolSize,
+		idle:     make(chan *publisherChannel, defaultPublisherPoolSize),
+	}
+
+	if connection != nil && channel != nil {
+		pc, err := newPublisherChannel(connection, channel)
+		if err != nil {
+			return nil, err
+		}
+
+		p.open++
+		p.idle <- pc
+	}
+
+	return p, nil
+}
+
+// WithPoolSize sets the maximum amount of channels used to publish notifications concurrently.
+// It must be called before the first notification is published.
+func (p *NotificationPublisher) WithPoolSize(size uint) {
+	if size == 0 {
+		return
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	idle := make(chan *publisherChannel, size)
+	for len(p.idle) > 0 {
+		pc := <-p.idle
+		if len(idle) == cap(idle) {
+			p.open--
+			p.discard(pc)
+			continue
+		}
+		idle <- pc
+	}
+
+	p.poolSize = int(size)
+	p.idle = idle
 }
 
-// Publish sends a ProjectionNotification to Queue
+// Publish sends a ProjectionNotification to Queue and waits for the server to confirm it
 func (p *NotificationPublisher) Publish(ctx context.Context, notification *sql.ProjectionNotification) error {
 	reconnectInterval := p.minReconnectInterval
 	// Ignore nil notifications since this is not supported
@@ -72,36 +175,230 @@ func (p *NotificationPublisher) Publish(ctx context.Context, notification *sql.P
 	}
 
 	for {
-		p.mux.Lock()
-		if p.connection == nil {
-			p.connection, p.channel, err = setup(p.amqpDSN, p.queue)
-			if err != nil {
+		pc, err := p.acquire(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			p.logger.Warn("failed to open amqp channel, reconnecting", func(entry goengine.LoggerEntry) {
+				entry.Error(err)
+				entry.String("reconnect_in", reconnectInterval.String())
+			})
+		} else {
+			err = pc.publish(ctx, p.queue, msgBody)
+			if err != amqp.ErrClosed && err != amqp.ErrFrame && err != amqp.ErrUnexpectedFrame {
+				// When the context is done the confirmation may still be delivered so the channel can't be reused
+				p.release(pc, err == ctx.Err() && err != nil)
+
 				return err
 			}
+			p.release(pc, true)
+
+			p.logger.Warn("amqp channel closed while publishing, reconnecting", func(entry goengine.LoggerEntry) {
+				entry.Error(err)
+				entry.String("reconnect_in", reconnectInterval.String())
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(reconnectInterval):
+		}
+
+		reconnectInterval *= 2
+		if reconnectInterval > p.maxReconnectInterval {
+			reconnectInterval = p.maxReconnectInterval
 		}
+	}
+}
+
+// acquire returns an idle channel of the pool, opens a new channel when the pool is not full or waits for a channel
+// to be released
+func (p *NotificationPublisher) acquire(ctx context.Context) (*publisherChannel, error) {
+	p.mux.Lock()
+	idle := p.idle
+	select {
+	case pc := <-idle:
 		p.mux.Unlock()
+		return pc, nil
+	default:
+	}
+
+	if p.open < p.poolSize {
+		p.open++
+		p.mux.Unlock()
+
+		pc, err := p.openChannel()
+		if err != nil {
+			p.mux.Lock()
+			p.open--
+			p.mux.Unlock()
+
+			return nil, err
+		}
+
+		return pc, nil
+	}
+	p.mux.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case pc := <-idle:
+		return pc, nil
+	}
+}
 
-		err = p.channel.Publish("", p.queue, true, false, amqp.Publishing{
-			Body: msgBody,
+// openChannel opens a new channel on the connection of the publisher, the connection is opened when there is none or
+// when it was closed
+func (p *NotificationPublisher) openChannel() (*publisherChannel, error) {
+	p.connMux.Lock()
+	defer p.connMux.Unlock()
+
+	if p.connection == nil || p.connection.IsClosed() {
+		conn, err := p.connect()
+		if err != nil {
+			return nil, err
+		}
+		p.connection = conn
+	}
+
+	ch, err := p.connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := newPublisherChannel(nil, ch)
+	if err != nil {
+		p.closeChannel(ch)
+		return nil, err
+	}
+
+	return pc, nil
+}
+
+// release returns the channel to the pool or closes it when it should be discarded
+func (p *NotificationPublisher) release(pc *publisherChannel, discard bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if discard || len(p.idle) == cap(p.idle) {
+		p.open--
+		p.discard(pc)
+		return
+	}
+
+	p.idle <- pc
+}
+
+// discard closes the channel and the connection that was provided with it
+func (p *NotificationPublisher) discard(pc *publisherChannel) {
+	p.closeChannel(pc.channel)
+
+	if pc.connection == nil {
+		return
+	}
+
+	if err := pc.connection.Close(); err != nil {
+		p.logger.Error("failed to close amqp connection", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
 		})
-		if err == amqp.ErrClosed || err == amqp.ErrFrame || err == amqp.ErrUnexpectedFrame {
-			if err := p.connection.Close(); err != nil {
-				p.logger.Error("failed to close amqp connection", func(entry goengine.LoggerEntry) {
-					entry.Error(err)
-				})
-			}
+	}
+}
 
-			time.Sleep(reconnectInterval)
-			reconnectInterval *= 2
-			if reconnectInterval > p.maxReconnectInterval {
-				reconnectInterval = p.maxReconnectInterval
-			}
+func (p *NotificationPublisher) closeChannel(channel NotificationChannel) {
+	closer, ok := channel.(io.Closer)
+	if !ok {
+		return
+	}
 
-			p.connection = nil
-			p.channel = nil
-			continue
+	// Closing a channel that was closed by the server is expected to fail
+	if err := closer.Close(); err != nil && err != amqp.ErrClosed {
+		p.logger.Warn("failed to close amqp channel", func(entry goengine.LoggerEntry) {
+			entry.Error(err)
+		})
+	}
+}
+
+// Channel opens a new channel and declares the queue
+func (c *queueConnection) Channel() (NotificationChannel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ch.QueueDeclare(c.queue, true, false, false, false, nil); err != nil {
+		_ = ch.Close()
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+func newPublisherChannel(connection io.Closer, channel NotificationChannel) (*publisherChannel, error) {
+	pc := &publisherChannel{
+		connection: connection,
+		channel:    channel,
+	}
+
+	if confirmChannel, ok := channel.(ConfirmChannel); ok {
+		if err := confirmChannel.Confirm(false); err != nil {
+			return nil, err
 		}
 
+		pc.confirms = confirmChannel.NotifyPublish(make(chan amqp.Confirmation, 1))
+		pc.returns = confirmChannel.NotifyReturn(make(chan amqp.Return, 1))
+	}
+
+	return pc, nil
+}
+
+// publish publishes the message and waits for the confirmation when the channel is in confirm mode
+func (pc *publisherChannel) publish(ctx context.Context, queue string, body []byte) error {
+	if err := pc.channel.Publish("", queue, true, false, amqp.Publishing{Body: body}); err != nil {
 		return err
 	}
+
+	if pc.confirms == nil {
+		return nil
+	}
+
+	var returned *amqp.Return
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case r, ok := <-pc.returns:
+			if !ok {
+				return amqp.ErrClosed
+			}
+			returned = &r
+		case confirm, ok := <-pc.confirms:
+			if !ok {
+				return amqp.ErrClosed
+			}
+
+			// The server sends the return before the confirmation
+			if returned == nil {
+				select {
+				case r, ok := <-pc.returns:
+					if ok {
+						returned = &r
+					}
+				default:
+				}
+			}
+
+			switch {
+			case returned != nil:
+				return &ReturnedError{ReplyCode: returned.ReplyCode, ReplyText: returned.ReplyText}
+			case !confirm.Ack:
+				return ErrPublishNotConfirmed
+			}
+
+			return nil
+		}
+	}
 }
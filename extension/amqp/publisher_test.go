@@ -4,6 +4,7 @@ package amqp_test
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,7 +20,7 @@ func TestNotificationPublisher_Publish(t *testing.T) {
 	ctx, ctxCancel := context.WithTimeout(context.Background(), time.Second)
 	defer ctxCancel()
 
-	channel := &mockChannel{}
+	channel := mockChannel{}
 	connection := &mockConnection{}
 
 	t.Run("Invalid arguments", func(t *testing.T) {
@@ -57,4 +58,88 @@ func TestNotificationPublisher_Publish(t *testing.T) {
 		ensure.NoError(err)
 		ensure.Len(loggerHook.Entries, 0)
 	})
+
+	t.Run("Publish Message confirmed", func(t *testing.T) {
+		ensure := require.New(t)
+
+		channel := &mockConfirmChannel{}
+		publisher, err := goengineAmqp.NewNotificationPublisher("amqp://localhost:5672/", "my-queue", 3, 4, nil, connection, channel)
+		ensure.NoError(err)
+
+		err = publisher.Publish(ctx, &sql.ProjectionNotification{No: 1, AggregateID: "8150276e-34fe-49d9-aeae-a35af0040a4f"})
+
+		ensure.NoError(err)
+		ensure.Equal(1, channel.published)
+	})
+
+	t.Run("Publish Message not confirmed", func(t *testing.T) {
+		ensure := require.New(t)
+
+		publisher, err := goengineAmqp.NewNotificationPublisher("amqp://localhost:5672/", "my-queue", 3, 4, nil, connection, &mockConfirmChannel{nack: true})
+		ensure.NoError(err)
+
+		err = publisher.Publish(ctx, &sql.ProjectionNotification{No: 1, AggregateID: "8150276e-34fe-49d9-aeae-a35af0040a4f"})
+
+		ensure.Equal(goengineAmqp.ErrPublishNotConfirmed, err)
+	})
+
+	t.Run("Publish Message returned", func(t *testing.T) {
+		ensure := require.New(t)
+
+		publisher, err := goengineAmqp.NewNotificationPublisher("amqp://localhost:5672/", "my-queue", 3, 4, nil, connection, &mockConfirmChannel{unroutable: true})
+		ensure.NoError(err)
+
+		err = publisher.Publish(ctx, &sql.ProjectionNotification{No: 1, AggregateID: "8150276e-34fe-49d9-aeae-a35af0040a4f"})
+
+		ensure.Equal(&goengineAmqp.ReturnedError{ReplyCode: 312, ReplyText: "NO_ROUTE"}, err)
+	})
+
+	t.Run("Publish Message on closed channel", func(t *testing.T) {
+		ensure := require.New(t)
+		logger, loggerHook := getLogger()
+
+		publisher, err := goengineAmqp.NewNotificationPublisher("amqp://localhost:1/", "my-queue", time.Millisecond, 4*time.Millisecond, logger, connection, &mockConfirmChannel{closed: true})
+		ensure.NoError(err)
+
+		publishCtx, publishCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer publishCancel()
+
+		err = publisher.Publish(publishCtx, &sql.ProjectionNotification{No: 1, AggregateID: "8150276e-34fe-49d9-aeae-a35af0040a4f"})
+
+		// The closed channel is discarded and connecting to the server is retried until the context is done
+		ensure.Equal(context.DeadlineExceeded, err)
+
+		logEntries := loggerHook.AllEntries()
+		ensure.True(len(logEntries) > 1)
+		ensure.Equal("amqp channel closed while publishing, reconnecting", logEntries[0].Message)
+		for _, entry := range logEntries[1:] {
+			ensure.Equal("failed to open amqp channel, reconnecting", entry.Message)
+		}
+	})
+
+	t.Run("Publish Messages concurrently", func(t *testing.T) {
+		ensure := require.New(t)
+
+		channel := &mockConfirmChannel{}
+		publisher, err := goengineAmqp.NewNotificationPublisher("amqp://localhost:5672/", "my-queue", 3, 4, nil, connection, channel)
+		ensure.NoError(err)
+		publisher.WithPoolSize(1)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 1; i <= 10; i++ {
+			wg.Add(1)
+			go func(no int64) {
+				defer wg.Done()
+				errs <- publisher.Publish(ctx, &sql.ProjectionNotification{No: no, AggregateID: "8150276e-34fe-49d9-aeae-a35af0040a4f"})
+			}(int64(i))
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			ensure.NoError(err)
+		}
+		ensure.Equal(10, channel.published)
+	})
 }
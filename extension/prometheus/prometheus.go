@@ -23,6 +23,7 @@ type Metrics struct {
 	notificationCounter            *prometheus.CounterVec
 	notificationQueueDuration      *prometheus.HistogramVec
 	notificationProcessingDuration *prometheus.HistogramVec
+	unknownPayloadCounter          *prometheus.CounterVec
 	notificationStartTimes         sync.Map
 	logger                         goengine.Logger
 }
@@ -63,6 +64,16 @@ func NewMetrics(logger goengine.Logger) *Metrics {
 			},
 			[]string{"success"},
 		),
+
+		// unknownPayloadCounter is used to expose 'unknown_payload_count' metric
+		unknownPayloadCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "unknown_payload_count",
+				Help:      "counter for number of events with an unknown payload type",
+			},
+			[]string{"event_name", "skipped"},
+		),
 		logger: logger,
 	}
 }
@@ -79,7 +90,12 @@ func (m *Metrics) RegisterMetrics(registry *prometheus.Registry) error {
 		return err
 	}
 
-	return registry.Register(m.notificationProcessingDuration)
+	err = registry.Register(m.notificationProcessingDuration)
+	if err != nil {
+		return err
+	}
+
+	return registry.Register(m.unknownPayloadCounter)
 }
 
 // ReceivedNotification counts received notifications
@@ -88,6 +104,12 @@ func (m *Metrics) ReceivedNotification(isNotification bool) {
 	m.notificationCounter.With(labels).Inc()
 }
 
+// UnknownPayload counts the events with an unknown payload type
+func (m *Metrics) UnknownPayload(eventName string, skipped bool) {
+	labels := prometheus.Labels{"event_name": eventName, "skipped": strconv.FormatBool(skipped)}
+	m.unknownPayloadCounter.With(labels).Inc()
+}
+
 // QueueNotification returns http handler for prometheus
 func (m *Metrics) QueueNotification(notification *sql.ProjectionNotification) {
 	if !m.storeStartTime(notificationQueueKeyPrefix, notification) {
@@ -131,6 +131,20 @@ func TestMetrics_ReceivedNotification(t *testing.T) {
 	})
 }
 
+func TestMetrics_UnknownPayload(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+
+	metrics := goenginePrometheus.NewMetrics(nil)
+	require.NoError(t, metrics.RegisterMetrics(registry))
+
+	metrics.UnknownPayload("account_closed", true)
+	metrics.UnknownPayload("account_frozen", false)
+
+	assertMetricsWhereCalled(t, registry, map[string]uint64{
+		"goengine_unknown_payload_count": 2,
+	})
+}
+
 func assertMetricsWhereCalled(t *testing.T, g prometheus.Gatherer, metricsCounts map[string]uint64) {
 	got, err := g.Gather()
 	require.NoError(t, err)
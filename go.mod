@@ -5,6 +5,7 @@ go 1.12
 require (
 	github.com/DATA-DOG/go-sqlmock v1.3.0
 	github.com/golang/mock v1.2.0
+	github.com/golang/protobuf v1.3.1
 	github.com/google/uuid v1.0.0
 	github.com/lib/pq v1.0.0
 	github.com/mailru/easyjson v0.0.0-20190221075403-6243d8e04c3f
@@ -0,0 +1,38 @@
+package goengine
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+)
+
+// ErrKeyNotFound occurs when the key of a data subject does not exist or was deleted
+var ErrKeyNotFound = errors.New("goengine: no key found for the data subject")
+
+// KeyStore stores the encryption keys used to encrypt the personal data of data subjects.
+//
+// Deleting the key of a data subject makes the personal data encrypted with the key unreadable, this is also known as
+// crypto-shredding.
+type KeyStore interface {
+	// Key returns the key of the data subject or ErrKeyNotFound when the subject has no key
+	Key(ctx context.Context, subject string) ([]byte, error)
+
+	// GetOrCreateKey returns the key of the data subject and creates a new key when the subject has no key
+	GetOrCreateKey(ctx context.Context, subject string) ([]byte, error)
+
+	// DeleteKey deletes the key of the data subject
+	DeleteKey(ctx context.Context, subject string) error
+}
+
+// KeySize is the size in bytes of the keys created by GenerateKey
+const KeySize = 32
+
+// GenerateKey returns a new random key to be stored in a KeyStore
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -1,5 +1,18 @@
 package goengine
 
+import (
+	"context"
+
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/pkg/errors"
+)
+
+// PayloadVersionKey is the metadata key containing the version of the payload
+const PayloadVersionKey = "_payload_version"
+
+// ErrUnknownPayloadType occurs when a MessagePayloadFactory is asked to create a payload of a type it does not know
+var ErrUnknownPayloadType = errors.New("goengine: unknown payload type provided")
+
 type (
 	// MessagePayloadConverter an interface describing converting payload data
 	MessagePayloadConverter interface {
@@ -7,15 +20,106 @@ type (
 		ConvertPayload(payload interface{}) (name string, data []byte, err error)
 	}
 
+	// ContextMessagePayloadConverter is a MessagePayloadConverter that uses the provided context to convert payloads
+	ContextMessagePayloadConverter interface {
+		// ConvertPayloadWithContext generates unique name for the event_name using the provided context
+		ConvertPayloadWithContext(ctx context.Context, payload interface{}) (name string, data []byte, err error)
+	}
+
 	// MessagePayloadFactory is used to reconstruct message payloads
 	MessagePayloadFactory interface {
 		// CreatePayload returns a reconstructed payload or a error
 		CreatePayload(payloadType string, data interface{}) (interface{}, error)
 	}
 
+	// ContextMessagePayloadFactory is a MessagePayloadFactory that uses the provided context to reconstruct payloads
+	ContextMessagePayloadFactory interface {
+		// CreatePayloadWithContext returns a reconstructed payload or a error using the provided context
+		CreatePayloadWithContext(ctx context.Context, payloadType string, data interface{}) (interface{}, error)
+	}
+
 	// MessagePayloadResolver is used resolve the event_name of a payload
 	MessagePayloadResolver interface {
 		// ResolveName resolves the name of the underlying payload type
 		ResolveName(payload interface{}) (string, error)
 	}
+
+	// MessagePayloadVersionResolver is used to resolve the current version of a payload type
+	MessagePayloadVersionResolver interface {
+		// ResolveVersion returns the current version of the payload type
+		ResolveVersion(payloadType string) uint
+	}
+
+	// VersionedMessagePayloadFactory is used to reconstruct message payloads that may have been stored using a previous
+	// version of the payload type
+	VersionedMessagePayloadFactory interface {
+		MessagePayloadFactory
+
+		// CreateVersionedPayload upcasts the data to the current version of the payload type and returns a
+		// reconstructed payload or a error
+		CreateVersionedPayload(payloadType string, version uint, data interface{}) (interface{}, error)
+	}
+
+	// ContextVersionedMessagePayloadFactory is a VersionedMessagePayloadFactory that uses the provided context to
+	// reconstruct payloads
+	ContextVersionedMessagePayloadFactory interface {
+		// CreateVersionedPayloadWithContext upcasts the data to the current version of the payload type and returns a
+		// reconstructed payload or a error using the provided context
+		CreateVersionedPayloadWithContext(ctx context.Context, payloadType string, version uint, data interface{}) (interface{}, error)
+	}
 )
+
+// IsUnknownPayloadType returns true when the cause of the error is ErrUnknownPayloadType
+func IsUnknownPayloadType(err error) bool {
+	return err != nil && errors.Cause(err) == ErrUnknownPayloadType
+}
+
+// ConvertMessagePayload converts the payload using the converter.
+// When the converter is a ContextMessagePayloadConverter the context is passed to the converter.
+func ConvertMessagePayload(ctx context.Context, converter MessagePayloadConverter, payload interface{}) (string, []byte, error) {
+	if contextConverter, ok := converter.(ContextMessagePayloadConverter); ok {
+		return contextConverter.ConvertPayloadWithContext(ctx, payload)
+	}
+
+	return converter.ConvertPayload(payload)
+}
+
+// CreateMessagePayload reconstructs the payload using the factory.
+// When the factory is a VersionedMessagePayloadFactory the payload version in the metadata is used, a payload stored
+// without a version is handled as version 0.
+func CreateMessagePayload(factory MessagePayloadFactory, payloadType string, data interface{}, meta metadata.Metadata) (interface{}, error) {
+	return CreateMessagePayloadWithContext(context.Background(), factory, payloadType, data, meta)
+}
+
+// CreateMessagePayloadWithContext reconstructs the payload using the factory like CreateMessagePayload.
+// When the factory supports a context the context is passed to the factory.
+func CreateMessagePayloadWithContext(
+	ctx context.Context,
+	factory MessagePayloadFactory,
+	payloadType string,
+	data interface{},
+	meta metadata.Metadata,
+) (interface{}, error) {
+	versionedFactory, ok := factory.(VersionedMessagePayloadFactory)
+	if !ok {
+		if contextFactory, ok := factory.(ContextMessagePayloadFactory); ok {
+			return contextFactory.CreatePayloadWithContext(ctx, payloadType, data)
+		}
+		return factory.CreatePayload(payloadType, data)
+	}
+
+	version, err := metadata.Int64(meta, PayloadVersionKey)
+	switch err.(type) {
+	case nil:
+	case metadata.MissingValueError:
+		// The payload was stored without a version
+		version = 0
+	default:
+		return nil, err
+	}
+
+	if contextFactory, ok := factory.(ContextVersionedMessagePayloadFactory); ok {
+		return contextFactory.CreateVersionedPayloadWithContext(ctx, payloadType, uint(version), data)
+	}
+	return versionedFactory.CreateVersionedPayload(payloadType, uint(version), data)
+}
@@ -0,0 +1,117 @@
+// +build unit
+
+package goengine_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/metadata"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type payloadFactoryStub struct {
+	version *uint
+}
+
+func (f *payloadFactoryStub) CreatePayload(payloadType string, data interface{}) (interface{}, error) {
+	return payloadType, nil
+}
+
+type versionedPayloadFactoryStub struct {
+	payloadFactoryStub
+}
+
+func (f *versionedPayloadFactoryStub) CreateVersionedPayload(payloadType string, version uint, data interface{}) (interface{}, error) {
+	f.version = &version
+	return payloadType, nil
+}
+
+type contextPayloadFactoryStub struct {
+	versionedPayloadFactoryStub
+	ctx context.Context
+}
+
+func (f *contextPayloadFactoryStub) CreateVersionedPayloadWithContext(
+	ctx context.Context,
+	payloadType string,
+	version uint,
+	data interface{},
+) (interface{}, error) {
+	f.ctx = ctx
+	return f.CreateVersionedPayload(payloadType, version, data)
+}
+
+func TestCreateMessagePayload(t *testing.T) {
+	t.Run("Unversioned factory", func(t *testing.T) {
+		factory := &payloadFactoryStub{}
+		meta := metadata.WithValue(metadata.New(), goengine.PayloadVersionKey, 2)
+
+		payload, err := goengine.CreateMessagePayload(factory, "deposited", []byte(`{}`), meta)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "deposited", payload)
+		assert.Nil(t, factory.version)
+	})
+
+	testCases := []struct {
+		title           string
+		metadata        metadata.Metadata
+		expectedVersion uint
+	}{
+		{"Versioned payload", metadata.WithValue(metadata.New(), goengine.PayloadVersionKey, 2), 2},
+		{"Payload without a version", metadata.New(), 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			factory := &versionedPayloadFactoryStub{}
+
+			payload, err := goengine.CreateMessagePayload(factory, "deposited", []byte(`{}`), testCase.metadata)
+
+			assert.NoError(t, err)
+			assert.Equal(t, "deposited", payload)
+			if assert.NotNil(t, factory.version) {
+				assert.Equal(t, testCase.expectedVersion, *factory.version)
+			}
+		})
+	}
+
+	t.Run("Invalid payload version", func(t *testing.T) {
+		factory := &versionedPayloadFactoryStub{}
+		meta := metadata.WithValue(metadata.New(), goengine.PayloadVersionKey, "one")
+
+		payload, err := goengine.CreateMessagePayload(factory, "deposited", []byte(`{}`), meta)
+
+		assert.Error(t, err)
+		assert.Nil(t, payload)
+		assert.Nil(t, factory.version)
+	})
+}
+
+func TestCreateMessagePayloadWithContext(t *testing.T) {
+	type ctxKey struct{}
+
+	factory := &contextPayloadFactoryStub{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "caller")
+	meta := metadata.WithValue(metadata.New(), goengine.PayloadVersionKey, 2)
+
+	payload, err := goengine.CreateMessagePayloadWithContext(ctx, factory, "deposited", []byte(`{}`), meta)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "deposited", payload)
+	assert.Equal(t, ctx, factory.ctx)
+	if assert.NotNil(t, factory.version) {
+		assert.Equal(t, uint(2), *factory.version)
+	}
+}
+
+func TestIsUnknownPayloadType(t *testing.T) {
+	assert.True(t, goengine.IsUnknownPayloadType(goengine.ErrUnknownPayloadType))
+	assert.True(t, goengine.IsUnknownPayloadType(pkgErrors.Wrap(goengine.ErrUnknownPayloadType, "failed to decode")))
+	assert.False(t, goengine.IsUnknownPayloadType(errors.New("goengine: unknown payload type provided")))
+	assert.False(t, goengine.IsUnknownPayloadType(nil))
+}
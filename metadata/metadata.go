@@ -2,11 +2,13 @@ package metadata
 
 import (
 	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
 
 	"github.com/mailru/easyjson"
 	"github.com/mailru/easyjson/jlexer"
 	"github.com/mailru/easyjson/jwriter"
-	"github.com/pkg/errors"
 )
 
 type (
@@ -21,202 +23,208 @@ type (
 		AsMap() map[string]interface{}
 	}
 
-	// jsonMarshaler is an interface used to speed up the json marshalling process
-	jsonMarshaler interface {
-		// MarshalJSONKeyValue writes the Metadata Key and Value and all it's parent Key Value pairs into the writer
-		// If last is true it MUST omit the `,` from the last Key Value pair
-		MarshalJSONKeyValue(out *jwriter.Writer, last bool)
+	// entry is a key value pair of the metadata or the removal of a key
+	entry struct {
+		key     string
+		val     interface{}
+		removed bool
 	}
 )
 
 // New return a new Metadata instance without any information
 func New() Metadata {
-	return new(emptyData)
+	return &data{}
 }
 
 // FromMap returns a new Metadata instance filled with the map data
-func FromMap(data map[string]interface{}) Metadata {
-	meta := New()
-	for k, v := range data {
-		meta = WithValue(meta, k, v)
+func FromMap(m map[string]interface{}) Metadata {
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		entries = append(entries, entry{key: k, val: v})
 	}
 
-	return meta
+	// Sort the entries so metadata with the same values has the same entries
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+
+	return &data{entries: entries}
 }
 
 // WithValue returns a copy of parent in which the value associated with key is val.
 func WithValue(parent Metadata, key string, val interface{}) Metadata {
-	return &valueData{parent, key, val}
+	return dataOf(parent).with(entry{key: key, val: val})
 }
 
-// emptyData represents the empty root of a metadata chain
-type emptyData int
-
-var (
-	// Ensure emptyData implements the Metadata interface
-	_ Metadata = new(emptyData)
-	// Ensure valueData implements the jsonMarshaler interface
-	_ jsonMarshaler = new(emptyData)
-	// Ensure emptyData implements the json.Marshaler interface
-	_ json.Marshaler = new(emptyData)
-	// Ensure emptyData implements the easyjson.Marshaler interface
-	_ easyjson.Marshaler = new(emptyData)
-)
-
-func (*emptyData) Value(key string) interface{} {
-	return nil
-}
+// WithoutValue returns a copy of parent without the key.
+// When parent has no value associated with key parent is returned.
+func WithoutValue(parent Metadata, key string) Metadata {
+	d := dataOf(parent)
+	if _, found := d.index().values[key]; !found {
+		if parent == nil {
+			return New()
+		}
+		return parent
+	}
 
-func (*emptyData) AsMap() map[string]interface{} {
-	return map[string]interface{}{}
+	return d.with(entry{key: key, removed: true})
 }
 
-func (v *emptyData) MarshalJSON() ([]byte, error) {
-	return []byte("{}"), nil
+// dataOf returns the metadata as data
+func dataOf(m Metadata) *data {
+	switch v := m.(type) {
+	case nil:
+		return &data{}
+	case *data:
+		return v
+	default:
+		return FromMap(m.AsMap()).(*data)
+	}
 }
 
-func (v *emptyData) MarshalEasyJSON(w *jwriter.Writer) {
-	w.RawByte('{')
-	w.RawByte('}')
-}
+// data is a persistent map of metadata.
+//
+// The entries are the values in the order they were set, a later entry of a key replaces the earlier entries of the
+// key. Entries are never modified, a copy of the metadata appends to the entries of the original. Since the entries of
+// a chain of copies share the same array, only the first copy can append to the array of the original.
+// The values and the sorted keys are indexed once they're used.
+type data struct {
+	entries []entry
+	// extended is set once a copy appended to the array of the entries
+	extended int32
 
-func (v *emptyData) MarshalJSONKeyValue(*jwriter.Writer, bool) {
+	indexOnce sync.Once
+	indexed   *index
+	// hasIndex is set once the index is built
+	hasIndex int32
 }
 
-// valueData represents a key, value pair in a metadata chain
-type valueData struct {
-	Metadata
-	key string
-	val interface{}
+// index contains the values of the metadata and the keys in sorted order
+type index struct {
+	values map[string]interface{}
+	keys   []string
 }
 
 var (
-	// Ensure valueData implements the Metadata interface
-	_ Metadata = new(valueData)
-	// Ensure valueData implements the jsonMarshaler interface
-	_ jsonMarshaler = new(valueData)
-	// Ensure valueData implements the json.Marshaler interface
-	_ json.Marshaler = new(valueData)
-	// Ensure valueData implements the easyjson.Marshaler interface
-	_ easyjson.Marshaler = new(valueData)
+	// Ensure data implements the Metadata interface
+	_ Metadata = &data{}
+	// Ensure data implements the json.Marshaler interface
+	_ json.Marshaler = &data{}
+	// Ensure data implements the easyjson.Marshaler interface
+	_ easyjson.Marshaler = &data{}
 )
 
-func (v *valueData) Value(key string) interface{} {
-	if v.key == key {
-		return v.val
+// with returns a copy of the metadata with the entry appended
+func (d *data) with(e entry) *data {
+	entries := d.entries
+
+	// Replaced and removed entries are dropped once they're the majority of the entries
+	if idx := d.indexIfBuilt(); idx != nil && len(entries) > 2*len(idx.keys) {
+		compacted := make([]entry, len(idx.keys), len(idx.keys)+1)
+		for i, key := range idx.keys {
+			compacted[i] = entry{key: key, val: idx.values[key]}
+		}
+
+		return &data{entries: append(compacted, e)}
+	}
+
+	if cap(entries) > len(entries) && !atomic.CompareAndSwapInt32(&d.extended, 0, 1) {
+		// Another copy already appended to the array so the entries are copied
+		entries = append(make([]entry, 0, len(entries)+1), entries...)
 	}
 
-	return v.Metadata.Value(key)
+	return &data{entries: append(entries, e)}
+}
+
+// index returns the index of the metadata and builds it when needed
+func (d *data) index() *index {
+	d.indexOnce.Do(func() {
+		values := make(map[string]interface{}, len(d.entries))
+		for _, e := range d.entries {
+			if e.removed {
+				delete(values, e.key)
+			} else {
+				values[e.key] = e.val
+			}
+		}
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		d.indexed = &index{values: values, keys: keys}
+		atomic.StoreInt32(&d.hasIndex, 1)
+	})
+
+	return d.indexed
 }
 
-func (v *valueData) AsMap() map[string]interface{} {
-	var m map[string]interface{}
-	if v.Metadata == nil {
-		m = map[string]interface{}{}
-	} else {
-		m = v.Metadata.AsMap()
+// indexIfBuilt returns the index of the metadata or nil when it's not yet built
+func (d *data) indexIfBuilt() *index {
+	if atomic.LoadInt32(&d.hasIndex) == 0 {
+		return nil
 	}
 
-	m[v.key] = v.val
+	return d.indexed
+}
 
-	return m
+func (d *data) Value(key string) interface{} {
+	return d.index().values[key]
 }
 
-func (v *valueData) MarshalJSON() ([]byte, error) {
+// AsMap returns the values of the metadata.
+// The map is shared by all calls and must not be modified.
+func (d *data) AsMap() map[string]interface{} {
+	return d.index().values
+}
+
+func (d *data) MarshalJSON() ([]byte, error) {
 	w := jwriter.Writer{}
-	v.MarshalEasyJSON(&w)
+	d.MarshalEasyJSON(&w)
 	return w.Buffer.BuildBytes(), w.Error
 }
 
-func (v *valueData) MarshalEasyJSON(w *jwriter.Writer) {
-	w.RawByte('{')
-	v.MarshalJSONKeyValue(w, true)
-	w.RawByte('}')
-}
+// MarshalEasyJSON writes the metadata as a json object with the keys in sorted order
+func (d *data) MarshalEasyJSON(out *jwriter.Writer) {
+	idx := d.index()
 
-func (v *valueData) MarshalJSONKeyValue(out *jwriter.Writer, last bool) {
-	marshalJSONKeyValues(out, v.Metadata)
+	out.RawByte('{')
+	for i, key := range idx.keys {
+		if i > 0 {
+			out.RawByte(',')
+		}
 
-	out.String(v.key)
-	out.RawByte(':')
-	if vm, ok := v.val.(easyjson.Marshaler); ok {
-		vm.MarshalEasyJSON(out)
-	} else if vm, ok := v.val.(json.Marshaler); ok {
-		out.Raw(vm.MarshalJSON())
-	} else {
-		out.Raw(json.Marshal(v.val))
-	}
+		out.String(key)
+		out.RawByte(':')
 
-	if !last {
-		out.RawByte(',')
+		val := idx.values[key]
+		if vm, ok := val.(easyjson.Marshaler); ok {
+			vm.MarshalEasyJSON(out)
+		} else if vm, ok := val.(json.Marshaler); ok {
+			out.Raw(vm.MarshalJSON())
+		} else {
+			out.Raw(json.Marshal(val))
+		}
 	}
+	out.RawByte('}')
 }
 
-// UnmarshalJSON unmarshals the provided json into a Metadata instance
+// UnmarshalJSON unmarshals the provided json into a Metadata instance.
+// When the json was marshaled using MarshalTypedJSON the values are reconstructed using their recorded types.
 func UnmarshalJSON(json []byte) (Metadata, error) {
 	in := jlexer.Lexer{Data: json}
-	metadata := New()
-
-	isTopLevel := in.IsStart()
 	if in.IsNull() {
-		if isTopLevel {
-			in.Consumed()
-		}
-		in.Skip()
-		return metadata, in.Error()
-	}
-
-	in.Delim('{')
-	for !in.IsDelim('}') {
-		key := in.UnsafeString()
-		in.WantColon()
-		metadata = WithValue(metadata, key, in.Interface())
-		in.WantComma()
-	}
-	in.Delim('}')
-
-	if isTopLevel {
 		in.Consumed()
+		in.Skip()
+		return New(), in.Error()
 	}
 
-	return metadata, in.Error()
+	return unmarshalObject(&in)
 }
 
-func marshalJSONKeyValues(out *jwriter.Writer, parent Metadata) {
-	if parent == nil {
-		return
-	}
-
-	if m, ok := parent.(jsonMarshaler); ok {
-		m.MarshalJSONKeyValue(out, false)
-		return
-	}
-
-	var (
-		parentJSON []byte
-		err        error
-	)
-	if vm, ok := parent.(easyjson.Marshaler); ok {
-		w := &jwriter.Writer{}
-		vm.MarshalEasyJSON(out)
-		parentJSON = w.Buffer.BuildBytes()
-		err = w.Error
-	} else if vm, ok := parent.(json.Marshaler); ok {
-		parentJSON, err = vm.MarshalJSON()
-	} else {
-		parentJSON, err = json.Marshal(parent)
-	}
-
-	if err != nil {
-		out.Raw(parentJSON, err)
-		return
-	}
-
-	plen := len(parentJSON)
-	if parentJSON[1] != '{' || parentJSON[plen-1] != '}' {
-		out.Raw(parentJSON, errors.Errorf("JSON unmarshal failed for Metadata of type %T", parent))
-		return
-	}
-
-	out.Raw(parentJSON[1:plen-2], nil)
+// fromEntries returns the metadata containing the entries, when a key occurs more than once the last value is used
+func fromEntries(entries []entry) Metadata {
+	return &data{entries: entries}
 }
@@ -4,6 +4,7 @@ package metadata_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -49,6 +50,41 @@ func TestWithValue(t *testing.T) {
 	})
 }
 
+func TestWithoutValue(t *testing.T) {
+	t.Run("remove a value", func(t *testing.T) {
+		asserts := assert.New(t)
+
+		m := metadata.FromMap(map[string]interface{}{"a": 1, "b": 2, "c": 3})
+		without := metadata.WithoutValue(m, "b")
+
+		asserts.Nil(without.Value("b"))
+		asserts.Equal(map[string]interface{}{"a": 1, "c": 3}, without.AsMap())
+		asserts.Equal(map[string]interface{}{"a": 1, "b": 2, "c": 3}, m.AsMap(), "the parent must not be modified")
+	})
+
+	t.Run("remove an unknown value", func(t *testing.T) {
+		m := metadata.FromMap(map[string]interface{}{"a": 1})
+
+		assert.True(t, m == metadata.WithoutValue(m, "b"))
+		assert.Equal(t, map[string]interface{}{}, metadata.WithoutValue(nil, "b").AsMap())
+	})
+}
+
+func TestWithValue_Overrides(t *testing.T) {
+	asserts := assert.New(t)
+
+	m := metadata.WithValue(metadata.New(), "b", 1)
+	m = metadata.WithValue(m, "a", 1)
+	overridden := metadata.WithValue(m, "b", 2)
+
+	asserts.Equal(2, overridden.Value("b"))
+	asserts.Equal(1, m.Value("b"), "the parent must not be modified")
+
+	data, err := json.Marshal(overridden)
+	asserts.NoError(err)
+	asserts.Equal(`{"a":1,"b":2}`, string(data))
+}
+
 func TestFromMap(t *testing.T) {
 	type mapTestCase struct {
 		title string
@@ -171,8 +207,8 @@ var jsonTestCases = []struct {
 			return metadata.WithValue(m, "another", "value")
 		},
 		`{
-			"test": null,
-			"another": "value"
+			"another": "value",
+			"test": null
 		}`,
 	},
 	{
@@ -191,12 +227,12 @@ var jsonTestCases = []struct {
 			return m
 		},
 		`{
-			"test": null,
 			"another": "value",
 			"arr": [ "a", "b", "c" ],
 			"arrInArr": [ "a", [ "b" ] ],
 			"obj": { "a": 1 },
-			"objInObj": { "a": 1, "b": {"a": 2} }
+			"objInObj": { "a": 1, "b": {"a": 2} },
+			"test": null
 		}`,
 	},
 }
@@ -228,7 +264,7 @@ func TestUnmarshalJSON(t *testing.T) {
 
 			// Need to use AsMap otherwise we can have inconsistent tests results.
 			if assert.NoError(t, err) {
-				assert.Equal(t, testCase.metadata(), m)
+				assert.Equal(t, testCase.metadata().AsMap(), m.AsMap())
 			}
 		})
 	}
@@ -246,6 +282,21 @@ func BenchmarkUnmarshalJSON(b *testing.B) {
 	}
 }
 
+func BenchmarkValue(b *testing.B) {
+	m := metadata.New()
+	m = metadata.WithValue(m, "_aggregate_id", "b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5")
+	m = metadata.WithValue(m, "_aggregate_type", "bank_account")
+	m = metadata.WithValue(m, "_aggregate_version", 1)
+	m = metadata.WithValue(m, "_payload_version", 1)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if m.Value("_aggregate_id") == nil {
+			b.Fail()
+		}
+	}
+}
+
 func BenchmarkMarshalJSON(b *testing.B) {
 	m := metadata.New()
 	m = metadata.WithValue(m, "_aggregate_id", "b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5")
@@ -260,3 +311,38 @@ func BenchmarkMarshalJSON(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkAsMap(b *testing.B) {
+	m := metadata.New()
+	m = metadata.WithValue(m, "_aggregate_id", "b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5")
+	m = metadata.WithValue(m, "_aggregate_type", "bank_account")
+	m = metadata.WithValue(m, "_aggregate_version", 1)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if len(m.AsMap()) != 3 {
+			b.Fail()
+		}
+	}
+}
+
+func BenchmarkWithValue(b *testing.B) {
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key_%d", (i*37)%len(keys))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m := metadata.New()
+		for _, key := range keys {
+			m = metadata.WithValue(m, key, i)
+		}
+
+		if m.Value(keys[0]) != i {
+			b.Fail()
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mailru/easyjson/jlexer"
+)
+
+// TypesKey is the metadata key containing the types of the values when the metadata is marshaled using
+// MarshalTypedJSON
+const TypesKey = "_metadata_types"
+
+const (
+	typeInt64  = "int64"
+	typeUint64 = "uint64"
+	typeTime   = "time"
+	typeUUID   = "uuid"
+)
+
+type (
+	// MissingValueError occurs when no value is associated with the metadata key
+	MissingValueError string
+
+	// InvalidValueTypeError occurs when the value associated with the metadata key can't be used as the requested type
+	InvalidValueTypeError struct {
+		Key      string
+		Value    interface{}
+		Expected string
+	}
+)
+
+func (e MissingValueError) Error() string {
+	return "goengine: metadata key " + string(e) + " is not set or nil"
+}
+
+func (e *InvalidValueTypeError) Error() string {
+	return fmt.Sprintf("goengine: metadata key %s with value %v was expected to be of type %s", e.Key, e.Value, e.Expected)
+}
+
+// MarshalTypedJSON marshals the metadata into json and records the types of the values that json can't represent
+// in the TypesKey. Integers, time.Time and uuid.UUID values are reconstructed by UnmarshalJSON as int64, uint64,
+// time.Time and uuid.UUID instead of float64 and string values.
+func MarshalTypedJSON(m Metadata) ([]byte, error) {
+	types := map[string]string{}
+	for key, val := range m.AsMap() {
+		if t := typeOf(val); t != "" {
+			types[key] = t
+		}
+	}
+
+	if len(types) > 0 {
+		m = WithValue(m, TypesKey, types)
+	}
+
+	return json.Marshal(m)
+}
+
+func typeOf(val interface{}) string {
+	switch val.(type) {
+	case int, int8, int16, int32, int64:
+		return typeInt64
+	case uint, uint8, uint16, uint32, uint64:
+		return typeUint64
+	case time.Time:
+		return typeTime
+	case uuid.UUID:
+		return typeUUID
+	default:
+		return ""
+	}
+}
+
+// unmarshalObject unmarshals a json object into metadata.
+// Only a TypesKey of the object itself records the types of the values, since it can be anywhere in the object the
+// values are decoded once all keys are read.
+func unmarshalObject(in *jlexer.Lexer) (Metadata, error) {
+	type rawValue struct {
+		key string
+		raw []byte
+	}
+
+	var (
+		values []rawValue
+		types  map[string]string
+	)
+	in.Delim('{')
+	for !in.IsDelim('}') {
+		key := in.String()
+		in.WantColon()
+		if key == TypesKey {
+			in.AddError(json.Unmarshal(in.Raw(), &types))
+		} else {
+			values = append(values, rawValue{key, in.Raw()})
+		}
+		in.WantComma()
+	}
+	in.Delim('}')
+	in.Consumed()
+
+	if err := in.Error(); err != nil {
+		return nil, err
+	}
+
+	var entries []entry
+	for _, v := range values {
+		val, err := unmarshalTypedValue(types[v.key], v.raw)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry{key: v.key, val: val})
+	}
+
+	return fromEntries(entries), nil
+}
+
+func unmarshalTypedValue(t string, raw []byte) (interface{}, error) {
+	in := jlexer.Lexer{Data: raw}
+
+	switch t {
+	case typeInt64:
+		return strconv.ParseInt(string(bytes.TrimSpace(raw)), 10, 64)
+	case typeUint64:
+		return strconv.ParseUint(string(bytes.TrimSpace(raw)), 10, 64)
+	case typeTime:
+		str := in.String()
+		if err := in.Error(); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, str)
+	case typeUUID:
+		str := in.String()
+		if err := in.Error(); err != nil {
+			return nil, err
+		}
+		return uuid.Parse(str)
+	default:
+		// Unknown types are decoded as plain json so metadata written by a newer version can still be read
+		val := in.Interface()
+		return val, in.Error()
+	}
+}
+
+// Int64 returns the value of the key as an int64.
+// Besides integers a float64 without a fraction is accepted since metadata without types contains float64 numbers.
+func Int64(m Metadata, key string) (int64, error) {
+	switch val := m.Value(key).(type) {
+	case nil:
+		return 0, MissingValueError(key)
+	case int:
+		return int64(val), nil
+	case int8:
+		return int64(val), nil
+	case int16:
+		return int64(val), nil
+	case int32:
+		return int64(val), nil
+	case int64:
+		return val, nil
+	case uint:
+		return uintToInt64(key, uint64(val))
+	case uint8:
+		return int64(val), nil
+	case uint16:
+		return int64(val), nil
+	case uint32:
+		return int64(val), nil
+	case uint64:
+		return uintToInt64(key, val)
+	case float64:
+		if val != math.Trunc(val) || val < math.MinInt64 || val >= math.MaxInt64 {
+			return 0, &InvalidValueTypeError{Key: key, Value: val, Expected: typeInt64}
+		}
+		return int64(val), nil
+	case json.Number:
+		i, err := val.Int64()
+		if err != nil {
+			return 0, &InvalidValueTypeError{Key: key, Value: val, Expected: typeInt64}
+		}
+		return i, nil
+	default:
+		return 0, &InvalidValueTypeError{Key: key, Value: val, Expected: typeInt64}
+	}
+}
+
+func uintToInt64(key string, val uint64) (int64, error) {
+	if val > math.MaxInt64 {
+		return 0, &InvalidValueTypeError{Key: key, Value: val, Expected: typeInt64}
+	}
+
+	return int64(val), nil
+}
+
+// String returns the value of the key as a string
+func String(m Metadata, key string) (string, error) {
+	switch val := m.Value(key).(type) {
+	case nil:
+		return "", MissingValueError(key)
+	case string:
+		return val, nil
+	default:
+		return "", &InvalidValueTypeError{Key: key, Value: val, Expected: "string"}
+	}
+}
+
+// Time returns the value of the key as a time.Time.
+// Besides a time.Time a RFC 3339 string is accepted since metadata without types contains the time as a string.
+func Time(m Metadata, key string) (time.Time, error) {
+	switch val := m.Value(key).(type) {
+	case nil:
+		return time.Time{}, MissingValueError(key)
+	case time.Time:
+		return val, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil {
+			return time.Time{}, &InvalidValueTypeError{Key: key, Value: val, Expected: typeTime}
+		}
+		return t, nil
+	default:
+		return time.Time{}, &InvalidValueTypeError{Key: key, Value: val, Expected: typeTime}
+	}
+}
+
+// UUID returns the value of the key as a uuid.UUID.
+// Besides a uuid.UUID a string is accepted since metadata without types contains the uuid as a string.
+func UUID(m Metadata, key string) (uuid.UUID, error) {
+	switch val := m.Value(key).(type) {
+	case nil:
+		return uuid.Nil, MissingValueError(key)
+	case uuid.UUID:
+		return val, nil
+	case string:
+		id, err := uuid.Parse(val)
+		if err != nil {
+			return uuid.Nil, &InvalidValueTypeError{Key: key, Value: val, Expected: typeUUID}
+		}
+		return id, nil
+	default:
+		return uuid.Nil, &InvalidValueTypeError{Key: key, Value: val, Expected: typeUUID}
+	}
+}
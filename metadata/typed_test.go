@@ -0,0 +1,162 @@
+// +build unit
+
+package metadata_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalTypedJSON(t *testing.T) {
+	createdAt := time.Date(2019, 3, 4, 10, 11, 12, 123456789, time.UTC)
+	id, err := uuid.Parse("b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5")
+	require.NoError(t, err)
+
+	m := metadata.New()
+	m = metadata.WithValue(m, "_aggregate_version", uint(3))
+	m = metadata.WithValue(m, "large", int64(math.MaxInt64))
+	m = metadata.WithValue(m, "created_at", createdAt)
+	m = metadata.WithValue(m, "id", id)
+	m = metadata.WithValue(m, "name", "alice")
+	m = metadata.WithValue(m, "ratio", 1.5)
+
+	data, err := metadata.MarshalTypedJSON(m)
+	require.NoError(t, err)
+
+	t.Run("values are marshaled as plain json", func(t *testing.T) {
+		var values map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &values))
+
+		asserts := assert.New(t)
+		asserts.Equal(float64(3), values["_aggregate_version"])
+		asserts.Equal("2019-03-04T10:11:12.123456789Z", values["created_at"])
+		asserts.Equal("b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5", values["id"])
+		asserts.Equal(map[string]interface{}{
+			"_aggregate_version": "uint64",
+			"large":              "int64",
+			"created_at":         "time",
+			"id":                 "uuid",
+		}, values[metadata.TypesKey])
+	})
+
+	t.Run("types are preserved", func(t *testing.T) {
+		result, err := metadata.UnmarshalJSON(data)
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{
+			"_aggregate_version": uint64(3),
+			"large":              int64(math.MaxInt64),
+			"created_at":         createdAt,
+			"id":                 id,
+			"name":               "alice",
+			"ratio":              1.5,
+		}, result.AsMap())
+	})
+
+	t.Run("types key is not the first key", func(t *testing.T) {
+		result, err := metadata.UnmarshalJSON([]byte(`{"v": 9007199254740993, "_metadata_types": {"v": "int64", "x": "unknown"}, "x": 1}`))
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{"v": int64(9007199254740993), "x": float64(1)}, result.AsMap())
+	})
+
+	t.Run("only the types key of the metadata is used", func(t *testing.T) {
+		result, err := metadata.UnmarshalJSON([]byte(`{"nested": {"_metadata_types": {"v": "int64"}}, "note": "\"_metadata_types\"", "v": 1}`))
+		require.NoError(t, err)
+
+		assert.Equal(t, map[string]interface{}{
+			"nested": map[string]interface{}{"_metadata_types": map[string]interface{}{"v": "int64"}},
+			"note":   `"_metadata_types"`,
+			"v":      float64(1),
+		}, result.AsMap())
+	})
+
+	t.Run("invalid typed value", func(t *testing.T) {
+		_, err := metadata.UnmarshalJSON([]byte(`{"v": "abc", "_metadata_types": {"v": "int64"}}`))
+
+		assert.Error(t, err)
+	})
+
+	t.Run("metadata without values to type", func(t *testing.T) {
+		data, err := metadata.MarshalTypedJSON(metadata.WithValue(metadata.New(), "name", "alice"))
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"name":"alice"}`, string(data))
+	})
+}
+
+func TestTypedAccessors(t *testing.T) {
+	createdAt := time.Date(2019, 3, 4, 10, 11, 12, 0, time.UTC)
+	id, err := uuid.Parse("b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5")
+	require.NoError(t, err)
+
+	m := metadata.FromMap(map[string]interface{}{
+		"int":          42,
+		"uint64":       uint64(42),
+		"large_uint64": uint64(math.MaxUint64),
+		"float":        float64(42),
+		"fraction":     4.2,
+		"string":       "alice",
+		"time":         createdAt,
+		"time_string":  "2019-03-04T10:11:12Z",
+		"uuid":         id,
+		"uuid_string":  "b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5",
+	})
+
+	t.Run("Int64", func(t *testing.T) {
+		for _, key := range []string{"int", "uint64", "float"} {
+			v, err := metadata.Int64(m, key)
+			assert.NoError(t, err, key)
+			assert.Equal(t, int64(42), v, key)
+		}
+
+		for _, key := range []string{"large_uint64", "fraction", "string"} {
+			_, err := metadata.Int64(m, key)
+			assert.IsType(t, &metadata.InvalidValueTypeError{}, err, key)
+		}
+	})
+
+	t.Run("String", func(t *testing.T) {
+		v, err := metadata.String(m, "string")
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", v)
+
+		_, err = metadata.String(m, "int")
+		assert.Equal(t, &metadata.InvalidValueTypeError{Key: "int", Value: 42, Expected: "string"}, err)
+	})
+
+	t.Run("Time", func(t *testing.T) {
+		for _, key := range []string{"time", "time_string"} {
+			v, err := metadata.Time(m, key)
+			assert.NoError(t, err, key)
+			assert.True(t, createdAt.Equal(v), key)
+		}
+
+		_, err := metadata.Time(m, "string")
+		assert.IsType(t, &metadata.InvalidValueTypeError{}, err)
+	})
+
+	t.Run("UUID", func(t *testing.T) {
+		for _, key := range []string{"uuid", "uuid_string"} {
+			v, err := metadata.UUID(m, key)
+			assert.NoError(t, err, key)
+			assert.Equal(t, id, v, key)
+		}
+
+		_, err := metadata.UUID(m, "string")
+		assert.IsType(t, &metadata.InvalidValueTypeError{}, err)
+	})
+
+	t.Run("missing value", func(t *testing.T) {
+		_, err := metadata.Int64(m, "missing")
+		assert.Equal(t, metadata.MissingValueError("missing"), err)
+		assert.EqualError(t, err, "goengine: metadata key missing is not set or nil")
+	})
+}
@@ -61,4 +61,13 @@ type (
 		// EncodeState encode the given object for storage
 		EncodeState(obj interface{}) ([]byte, error)
 	}
+
+	// VersionedProjection is a projection that has a version.
+	// The version should be increased whenever a change to the projection invalidates the projected state.
+	VersionedProjection interface {
+		Projection
+
+		// Version returns the version of the projection
+		Version() uint
+	}
 )
@@ -0,0 +1,143 @@
+// Package cli provides the commands to share the schemas of the payloads registered with a json.PayloadTransformer.
+//
+// Since the payload types are only known to the application the commands are run by a binary of the application:
+//
+//	func main() {
+//		transformer := json.NewPayloadTransformer()
+//		// register the payloads
+//
+//		if err := cli.Run(transformer, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+//			fmt.Fprintln(os.Stderr, err)
+//			os.Exit(1)
+//		}
+//	}
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+)
+
+// Usage is the usage of the commands
+const Usage = `Usage:
+  schema [-payload name] [-out dir]
+        print the JSON Schemas of the payloads or write them to dir as <payload>.schema.json
+  validate -payload name [file]
+        validate the json data in file or stdin against the JSON Schema of the payload
+`
+
+// ErrUnknownCommand occurs when the command is not known
+var ErrUnknownCommand = errors.New("goengine: unknown command")
+
+// Run runs the command in args using the payloads registered with the transformer
+func Run(transformer *strategyJSON.PayloadTransformer, args []string, stdout io.Writer, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, Usage)
+		return ErrUnknownCommand
+	}
+
+	switch args[0] {
+	case "schema":
+		return runSchema(transformer, args[1:], stdout, stderr)
+	case "validate":
+		return runValidate(transformer, args[1:], os.Stdin, stdout, stderr)
+	default:
+		fmt.Fprint(stderr, Usage)
+		return ErrUnknownCommand
+	}
+}
+
+func runSchema(transformer *strategyJSON.PayloadTransformer, args []string, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	payload := flags.String("payload", "", "the name of the payload, all payloads when empty")
+	out := flags.String("out", "", "the directory to write the schemas to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	schemas := transformer.Schemas()
+	if *payload != "" {
+		schema, err := transformer.Schema(*payload)
+		if err != nil {
+			return err
+		}
+		schemas = map[string]*strategyJSON.Schema{*payload: schema}
+	}
+
+	if *out == "" {
+		var value interface{} = schemas
+		if *payload != "" {
+			value = schemas[*payload]
+		}
+
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(stdout, "%s\n", data)
+		return err
+	}
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := json.MarshalIndent(schemas[name], "", "  ")
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(*out, name+".schema.json")
+		if err := ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, file)
+	}
+
+	return nil
+}
+
+func runValidate(transformer *strategyJSON.PayloadTransformer, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	payload := flags.String("payload", "", "the name of the payload")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	schema, err := transformer.Schema(*payload)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if flags.NArg() > 0 {
+		data, err = ioutil.ReadFile(flags.Arg(0))
+	} else {
+		data, err = ioutil.ReadAll(stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := schema.Validate(data); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "payload %s is valid\n", *payload)
+	return err
+}
@@ -0,0 +1,112 @@
+// +build unit
+
+package cli_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/hellofresh/goengine/strategy/json/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type nameChanged struct {
+	Name string `json:"name"`
+}
+
+func newTransformer(t *testing.T) *strategyJSON.PayloadTransformer {
+	transformer := strategyJSON.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayloads(map[string]strategyJSON.PayloadInitiator{
+		"name_changed": func() interface{} {
+			return nameChanged{}
+		},
+		"name_removed": func() interface{} {
+			return struct{}{}
+		},
+	}))
+
+	return transformer
+}
+
+func TestRun(t *testing.T) {
+	t.Run("print schema", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := cli.Run(newTransformer(t), []string{"schema", "-payload", "name_changed"}, &stdout, &stderr)
+
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"title": "name_changed",
+			"type": "object",
+			"properties": {"name": {"type": "string"}},
+			"required": ["name"]
+		}`, stdout.String())
+	})
+
+	t.Run("print all schemas", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := cli.Run(newTransformer(t), []string{"schema"}, &stdout, &stderr)
+
+		assert.NoError(t, err)
+		assert.Contains(t, stdout.String(), `"name_changed": {`)
+		assert.Contains(t, stdout.String(), `"name_removed": {`)
+	})
+
+	t.Run("write schemas", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "goengine-schemas")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		var stdout, stderr bytes.Buffer
+		err = cli.Run(newTransformer(t), []string{"schema", "-out", dir}, &stdout, &stderr)
+		require.NoError(t, err)
+
+		files, err := filepath.Glob(filepath.Join(dir, "*.schema.json"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(dir, "name_changed.schema.json"),
+			filepath.Join(dir, "name_removed.schema.json"),
+		}, files)
+
+		data, err := ioutil.ReadFile(files[0])
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"title": "name_changed"`)
+	})
+
+	t.Run("validate payload", func(t *testing.T) {
+		file, err := ioutil.TempFile("", "goengine-payload")
+		require.NoError(t, err)
+		defer os.Remove(file.Name())
+
+		_, err = file.WriteString(`{"name":1}`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		var stdout, stderr bytes.Buffer
+		err = cli.Run(newTransformer(t), []string{"validate", "-payload", "name_changed", file.Name()}, &stdout, &stderr)
+
+		assert.EqualError(t, err, "goengine: payload name_changed is invalid: field name must be of type string but is integer")
+	})
+
+	t.Run("unknown payload", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		err := cli.Run(newTransformer(t), []string{"schema", "-payload", "name_set"}, &stdout, &stderr)
+
+		assert.Equal(t, strategyJSON.ErrUnknownPayloadType, err)
+	})
+
+	t.Run("unknown command", func(t *testing.T) {
+		for _, args := range [][]string{nil, {"generate"}} {
+			var stdout, stderr bytes.Buffer
+			err := cli.Run(newTransformer(t), args, &stdout, &stderr)
+
+			assert.Equal(t, cli.ErrUnknownCommand, err)
+			assert.Equal(t, cli.Usage, stderr.String())
+		}
+	})
+}
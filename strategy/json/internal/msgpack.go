@@ -0,0 +1,638 @@
+package internal
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"unicode/utf8"
+)
+
+// msgpackNumberExt is the MessagePack extension type used for JSON numbers that can't be represented as an integer or
+// float64 without losing precision, the extension data is the JSON number as is
+const msgpackNumberExt = 1
+
+// maxNestingDepth is the maximum depth of nested objects and arrays, which is the same as the limit of encoding/json
+const maxNestingDepth = 10000
+
+var (
+	// ErrInvalidJSON occurs when the data to transcode is not valid JSON
+	ErrInvalidJSON = errors.New("goengine: invalid json data")
+	// ErrInvalidMessagePack occurs when the data to transcode is not valid or unsupported MessagePack
+	ErrInvalidMessagePack = errors.New("goengine: invalid or unsupported messagepack data")
+)
+
+// JSONToMessagePack appends the MessagePack encoding of the JSON data to dst.
+// The order of object keys is kept and numbers are encoded as integers, float64 or when that would lose precision as
+// an extension containing the JSON number.
+func JSONToMessagePack(dst []byte, data []byte) ([]byte, error) {
+	s := jsonScanner{data: data}
+	dst, err := s.value(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	s.skipWhitespace()
+	if s.pos != len(s.data) {
+		return nil, ErrInvalidJSON
+	}
+
+	return dst, nil
+}
+
+type jsonScanner struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (s *jsonScanner) skipWhitespace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *jsonScanner) value(dst []byte) ([]byte, error) {
+	s.skipWhitespace()
+	if s.pos >= len(s.data) {
+		return nil, ErrInvalidJSON
+	}
+
+	switch c := s.data[s.pos]; {
+	case c == '{':
+		return s.object(dst)
+	case c == '[':
+		return s.array(dst)
+	case c == '"':
+		return s.string(dst)
+	case c == '-' || (c >= '0' && c <= '9'):
+		return s.number(dst)
+	case s.literal("true"):
+		return append(dst, 0xc3), nil
+	case s.literal("false"):
+		return append(dst, 0xc2), nil
+	case s.literal("null"):
+		return append(dst, 0xc0), nil
+	default:
+		return nil, ErrInvalidJSON
+	}
+}
+
+func (s *jsonScanner) literal(lit string) bool {
+	if len(s.data)-s.pos < len(lit) || string(s.data[s.pos:s.pos+len(lit)]) != lit {
+		return false
+	}
+
+	s.pos += len(lit)
+	return true
+}
+
+func (s *jsonScanner) object(dst []byte) ([]byte, error) {
+	s.pos++ // {
+	if s.depth++; s.depth > maxNestingDepth {
+		return nil, ErrInvalidJSON
+	}
+
+	// The amount of elements is unknown so space for the largest header is reserved
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0)
+
+	var (
+		count int
+		err   error
+	)
+	for {
+		s.skipWhitespace()
+		if s.pos < len(s.data) && s.data[s.pos] == '}' && count == 0 {
+			s.pos++
+			break
+		}
+
+		if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+			return nil, ErrInvalidJSON
+		}
+		if dst, err = s.string(dst); err != nil {
+			return nil, err
+		}
+
+		s.skipWhitespace()
+		if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+			return nil, ErrInvalidJSON
+		}
+		s.pos++
+
+		if dst, err = s.value(dst); err != nil {
+			return nil, err
+		}
+		count++
+
+		s.skipWhitespace()
+		if s.pos >= len(s.data) {
+			return nil, ErrInvalidJSON
+		}
+		s.pos++
+		if s.data[s.pos-1] == '}' {
+			break
+		}
+		if s.data[s.pos-1] != ',' {
+			return nil, ErrInvalidJSON
+		}
+	}
+
+	s.depth--
+	return writeContainerHeader(dst, start, count, 0x80, 0xde), nil
+}
+
+func (s *jsonScanner) array(dst []byte) ([]byte, error) {
+	s.pos++ // [
+	if s.depth++; s.depth > maxNestingDepth {
+		return nil, ErrInvalidJSON
+	}
+
+	// The amount of elements is unknown so space for the largest header is reserved
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0, 0)
+
+	var (
+		count int
+		err   error
+	)
+	for {
+		s.skipWhitespace()
+		if s.pos < len(s.data) && s.data[s.pos] == ']' && count == 0 {
+			s.pos++
+			break
+		}
+
+		if dst, err = s.value(dst); err != nil {
+			return nil, err
+		}
+		count++
+
+		s.skipWhitespace()
+		if s.pos >= len(s.data) {
+			return nil, ErrInvalidJSON
+		}
+		s.pos++
+		if s.data[s.pos-1] == ']' {
+			break
+		}
+		if s.data[s.pos-1] != ',' {
+			return nil, ErrInvalidJSON
+		}
+	}
+
+	s.depth--
+	return writeContainerHeader(dst, start, count, 0x90, 0xdc), nil
+}
+
+// writeContainerHeader writes the smallest map or array header into the 5 bytes reserved at start and moves the
+// elements to directly follow the header
+func writeContainerHeader(dst []byte, start int, count int, fixType byte, type16 byte) []byte {
+	var (
+		header [5]byte
+		n      int
+	)
+	switch {
+	case count < 16:
+		header[0], n = fixType|byte(count), 1
+	case count <= math.MaxUint16:
+		header[0], header[1], header[2], n = type16, byte(count>>8), byte(count), 3
+	default:
+		header[0], n = type16+1, 5
+		binary.BigEndian.PutUint32(header[1:], uint32(count))
+	}
+
+	copy(dst[start:], header[:n])
+	if n < 5 {
+		copy(dst[start+n:], dst[start+5:])
+		dst = dst[:len(dst)-5+n]
+	}
+
+	return dst
+}
+
+func (s *jsonScanner) string(dst []byte) ([]byte, error) {
+	start := s.pos
+	s.pos++ // "
+
+	escaped := false
+	for {
+		if s.pos >= len(s.data) {
+			return nil, ErrInvalidJSON
+		}
+
+		c := s.data[s.pos]
+		s.pos++
+		if c == '"' {
+			break
+		}
+		if c < 0x20 {
+			return nil, ErrInvalidJSON
+		}
+		if c == '\\' {
+			escaped = true
+			s.pos++
+		}
+	}
+
+	str := s.data[start+1 : s.pos-1]
+	if escaped {
+		var unescaped string
+		if err := json.Unmarshal(s.data[start:s.pos], &unescaped); err != nil {
+			return nil, ErrInvalidJSON
+		}
+		str = []byte(unescaped)
+	}
+
+	return appendMessagePackString(dst, str), nil
+}
+
+func appendMessagePackString(dst []byte, str []byte) []byte {
+	switch l := len(str); {
+	case l < 32:
+		dst = append(dst, 0xa0|byte(l))
+	case l <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(l))
+	case l <= math.MaxUint16:
+		dst = append(dst, 0xda, byte(l>>8), byte(l))
+	default:
+		dst = append(dst, 0xdb, byte(l>>24), byte(l>>16), byte(l>>8), byte(l))
+	}
+
+	return append(dst, str...)
+}
+
+func (s *jsonScanner) number(dst []byte) ([]byte, error) {
+	start := s.pos
+	isInteger := true
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		if c == '.' || c == 'e' || c == 'E' {
+			isInteger = false
+		} else if c != '-' && c != '+' && (c < '0' || c > '9') {
+			break
+		}
+		s.pos++
+	}
+
+	number := s.data[start:s.pos]
+	if !isJSONNumber(number) {
+		return nil, ErrInvalidJSON
+	}
+
+	switch {
+	case isInteger && string(number) == "-0":
+		// An integer can't represent negative zero
+	case isInteger:
+		if i, err := strconv.ParseInt(string(number), 10, 64); err == nil {
+			return appendMessagePackInt(dst, i), nil
+		}
+		if u, err := strconv.ParseUint(string(number), 10, 64); err == nil {
+			return append(dst, 0xcf, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32), byte(u>>24), byte(u>>16), byte(u>>8), byte(u)), nil
+		}
+	default:
+		if f, err := strconv.ParseFloat(string(number), 64); err == nil && isShortestFloat(f, number) {
+			dst = append(dst, 0xcb, 0, 0, 0, 0, 0, 0, 0, 0)
+			binary.BigEndian.PutUint64(dst[len(dst)-8:], math.Float64bits(f))
+			return dst, nil
+		}
+	}
+
+	// Keep the number as is since it can't be represented without losing precision
+	switch l := len(number); {
+	case l == 1 || l == 2 || l == 4 || l == 8 || l == 16:
+		dst = append(dst, 0xd4+byte(bits.TrailingZeros(uint(l))), msgpackNumberExt)
+	case l <= math.MaxUint8:
+		dst = append(dst, 0xc7, byte(l), msgpackNumberExt)
+	default:
+		dst = append(dst, 0xc8, byte(l>>8), byte(l), msgpackNumberExt)
+	}
+
+	return append(dst, number...), nil
+}
+
+// isShortestFloat returns true when the number is the shortest representation of f as formatted by easyjson or
+// encoding/json, in which case no precision is lost by storing f
+func isShortestFloat(f float64, number []byte) bool {
+	var buf [32]byte
+	return string(strconv.AppendFloat(buf[:0], f, 'g', -1, 64)) == string(number) ||
+		string(appendFloat(buf[:0], f)) == string(number)
+}
+
+// appendFloat appends the float the same way as encoding/json
+func appendFloat(dst []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+
+	return dst
+}
+
+// isJSONNumber returns true when the number matches the JSON number grammar
+func isJSONNumber(number []byte) bool {
+	i := 0
+	digits := func() int {
+		start := i
+		for i < len(number) && number[i] >= '0' && number[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+
+	if i < len(number) && number[i] == '-' {
+		i++
+	}
+	if i < len(number) && number[i] == '0' {
+		i++
+	} else if digits() == 0 {
+		return false
+	}
+	if i < len(number) && number[i] == '.' {
+		i++
+		if digits() == 0 {
+			return false
+		}
+	}
+	if i < len(number) && (number[i] == 'e' || number[i] == 'E') {
+		i++
+		if i < len(number) && (number[i] == '+' || number[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+
+	return i == len(number)
+}
+
+func appendMessagePackInt(dst []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(dst, byte(i))
+	case i < 0 && i >= -32:
+		return append(dst, byte(i))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(dst, 0xd0, byte(i))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return append(dst, 0xd1, byte(i>>8), byte(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return append(dst, 0xd2, byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	default:
+		return append(dst, 0xd3, byte(i>>56), byte(i>>48), byte(i>>40), byte(i>>32), byte(i>>24), byte(i>>16), byte(i>>8), byte(i))
+	}
+}
+
+// MessagePackToJSON appends the JSON encoding of the MessagePack data to dst.
+// Only the MessagePack produced by JSONToMessagePack is supported.
+func MessagePackToJSON(dst []byte, data []byte) ([]byte, error) {
+	r := msgpackReader{data: data}
+	dst, err := r.value(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.pos != len(r.data) {
+		return nil, ErrInvalidMessagePack
+	}
+
+	return dst, nil
+}
+
+type msgpackReader struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+// next returns the next n bytes
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data)-r.pos < n {
+		return nil, ErrInvalidMessagePack
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+// length reads a big endian length of n bytes
+func (r *msgpackReader) length(n int) (int, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var l uint64
+	for _, c := range b {
+		l = l<<8 | uint64(c)
+	}
+	return int(l), nil
+}
+
+func (r *msgpackReader) value(dst []byte) ([]byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return strconv.AppendInt(dst, int64(c), 10), nil
+	case c >= 0xe0:
+		return strconv.AppendInt(dst, int64(int8(c)), 10), nil
+	case c >= 0x80 && c <= 0x8f:
+		return r.object(dst, int(c&0x0f))
+	case c >= 0x90 && c <= 0x9f:
+		return r.array(dst, int(c&0x0f))
+	case c >= 0xa0 && c <= 0xbf:
+		return r.string(dst, int(c&0x1f))
+	case c == 0xc0:
+		return append(dst, "null"...), nil
+	case c == 0xc2:
+		return append(dst, "false"...), nil
+	case c == 0xc3:
+		return append(dst, "true"...), nil
+	case c == 0xd9 || c == 0xda || c == 0xdb:
+		l, err := r.length(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.string(dst, l)
+	case c == 0xdc || c == 0xdd:
+		l, err := r.length(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.array(dst, l)
+	case c == 0xde || c == 0xdf:
+		l, err := r.length(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.object(dst, l)
+	case c >= 0xd0 && c <= 0xd3:
+		n := 1 << (c - 0xd0)
+		v, err := r.length(n)
+		if err != nil {
+			return nil, err
+		}
+		// Sign extend the value
+		shift := uint(64 - 8*n)
+		return strconv.AppendInt(dst, int64(uint64(v)<<shift)>>shift, 10), nil
+	case c >= 0xcc && c <= 0xcf:
+		b, err := r.next(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, c := range b {
+			u = u<<8 | uint64(c)
+		}
+		return strconv.AppendUint(dst, u, 10), nil
+	case c == 0xcb:
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return appendFloat(dst, math.Float64frombits(binary.BigEndian.Uint64(b))), nil
+	case c >= 0xd4 && c <= 0xd8:
+		return r.ext(dst, 1<<(c-0xd4))
+	case c == 0xc7 || c == 0xc8:
+		l, err := r.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return r.ext(dst, l)
+	default:
+		return nil, ErrInvalidMessagePack
+	}
+}
+
+func (r *msgpackReader) ext(dst []byte, l int) ([]byte, error) {
+	b, err := r.next(l + 1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != msgpackNumberExt {
+		return nil, ErrInvalidMessagePack
+	}
+
+	return append(dst, b[1:]...), nil
+}
+
+func (r *msgpackReader) object(dst []byte, count int) ([]byte, error) {
+	if r.depth++; r.depth > maxNestingDepth {
+		return nil, ErrInvalidMessagePack
+	}
+
+	dst = append(dst, '{')
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+
+		// Only string keys are supported since JSON only has string keys
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		r.pos--
+		if !(b[0] >= 0xa0 && b[0] <= 0xbf) && (b[0] < 0xd9 || b[0] > 0xdb) {
+			return nil, ErrInvalidMessagePack
+		}
+
+		if dst, err = r.value(dst); err != nil {
+			return nil, err
+		}
+		dst = append(dst, ':')
+		if dst, err = r.value(dst); err != nil {
+			return nil, err
+		}
+	}
+
+	r.depth--
+	return append(dst, '}'), nil
+}
+
+func (r *msgpackReader) array(dst []byte, count int) ([]byte, error) {
+	if r.depth++; r.depth > maxNestingDepth {
+		return nil, ErrInvalidMessagePack
+	}
+
+	dst = append(dst, '[')
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+
+		var err error
+		if dst, err = r.value(dst); err != nil {
+			return nil, err
+		}
+	}
+
+	r.depth--
+	return append(dst, ']'), nil
+}
+
+const hex = "0123456789abcdef"
+
+func (r *msgpackReader) string(dst []byte, l int) ([]byte, error) {
+	str, err := r.next(l)
+	if err != nil {
+		return nil, err
+	}
+
+	dst = append(dst, '"')
+	for i := 0; i < len(str); {
+		c := str[i]
+		if c >= utf8.RuneSelf {
+			ru, size := utf8.DecodeRune(str[i:])
+			if ru == utf8.RuneError && size == 1 {
+				dst = append(dst, `\ufffd`...)
+			} else {
+				dst = append(dst, str[i:i+size]...)
+			}
+			i += size
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\\':
+			dst = append(dst, '\\', c)
+		case c == '\n':
+			dst = append(dst, '\\', 'n')
+		case c == '\r':
+			dst = append(dst, '\\', 'r')
+		case c == '\t':
+			dst = append(dst, '\\', 't')
+		case c < 0x20:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			dst = append(dst, c)
+		}
+		i++
+	}
+
+	return append(dst, '"'), nil
+}
@@ -0,0 +1,291 @@
+// +build unit
+
+package internal_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hellofresh/goengine/strategy/json/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONToMessagePack(t *testing.T) {
+	// The expected encodings follow the MessagePack specification
+	testCases := []struct {
+		title       string
+		json        string
+		messagePack string
+	}{
+		{"positive fixint", `127`, "7f"},
+		{"negative fixint", `-32`, "e0"},
+		{"int8", `-128`, "d080"},
+		{"int16", `-32768`, "d18000"},
+		{"int32", `2147483647`, "d27fffffff"},
+		{"max int64", `9223372036854775807`, "d37fffffffffffffff"},
+		{"min int64", `-9223372036854775808`, "d38000000000000000"},
+		{"max uint64", `18446744073709551615`, "cfffffffffffffffff"},
+		{"integer larger than uint64", `18446744073709551616`, "c714013138343436373434303733373039353531363136"},
+		{"integer smaller than int64", `-9223372036854775809`, "c714012d39323233333732303336383534373735383039"},
+		{"negative zero", `-0`, "d5012d30"},
+		{"float64", `0.1`, "cb3fb999999999999a"},
+		{"smallest float64", `5e-324`, "cb0000000000000001"},
+		{"largest float64", `1.7976931348623157e+308`, "cb7fefffffffffffff"},
+		{"float with trailing zero", `1.0`, "c70301312e30"},
+		{"float out of range", `1e400`, "c705013165343030"},
+		{"fixstr", `"a"`, "a161"},
+		{"str8", `"` + strings.Repeat("a", 32) + `"`, "d920" + strings.Repeat("61", 32)},
+		{"fixmap", `{"a":true}`, "81a161c3"},
+		{"fixarray", `[null,false]`, "92c0c2"},
+		{"array16", `[` + strings.TrimSuffix(strings.Repeat("1,", 16), ",") + `]`, "dc0010" + strings.Repeat("01", 16)},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			messagePack, err := internal.JSONToMessagePack(nil, []byte(testCase.json))
+			require.NoError(t, err)
+			assert.Equal(t, testCase.messagePack, hex.EncodeToString(messagePack))
+
+			data, err := internal.MessagePackToJSON(nil, messagePack)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.json, string(data))
+		})
+	}
+}
+
+func TestMessagePackRoundTrip(t *testing.T) {
+	testCases := []struct {
+		title string
+		json  string
+	}{
+		{"big integers", `[9223372036854775807,9223372036854775808,-9223372036854775808,-9223372036854775809,123456789012345678901234567890]`},
+		{"float precision", `[0.1,0.30000000000000004,1e-7,1e+21,123456789.12345679,1.0,1E5,2.50,1e400,-0.0]`},
+		{"invalid utf-8", "[\"\xff\",\"a\xc3\",\"\xed\xa0\x80\",\"\\ud800\",\"\\udc00x\"]"},
+		{"control characters", `"\u0000\u001f\b\f"`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			assertRoundTrip(t, []byte(testCase.json))
+		})
+	}
+
+	t.Run("deep nesting", func(t *testing.T) {
+		depth := 10000
+		nested := []byte(strings.Repeat(`[{"a":`, depth/2) + `1` + strings.Repeat(`}]`, depth/2))
+		assertRoundTrip(t, nested)
+
+		tooDeep := []byte(`[` + string(nested) + `]`)
+		assert.False(t, json.Valid(tooDeep))
+		_, err := internal.JSONToMessagePack(nil, tooDeep)
+		assert.Equal(t, internal.ErrInvalidJSON, err)
+
+		messagePack := append(bytes.Repeat([]byte{0x91}, 1000000), 0x01)
+		_, err = internal.MessagePackToJSON(nil, messagePack)
+		assert.Equal(t, internal.ErrInvalidMessagePack, err)
+	})
+}
+
+// TestMessagePackFuzz transcodes random and mutated JSON documents and checks the results against encoding/json
+func TestMessagePackFuzz(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	t.Run("random documents", func(t *testing.T) {
+		for i := 0; i < 500; i++ {
+			data := appendRandomJSON(nil, rnd, 0)
+			require.True(t, json.Valid(data), "generated invalid json: %s", data)
+
+			assertRoundTrip(t, data)
+		}
+	})
+
+	t.Run("mutated documents", func(t *testing.T) {
+		const significant = "{}[]\",:\\ -+.eE0123456789tfnul\x00\x1f\x7f\xc3\xff"
+		for i := 0; i < 5000; i++ {
+			data := appendRandomJSON(nil, rnd, 0)
+			for n := rnd.Intn(3) + 1; n > 0; n-- {
+				pos := rnd.Intn(len(data) + 1)
+				switch c := significant[rnd.Intn(len(significant))]; rnd.Intn(3) {
+				case 0:
+					data = append(data[:pos], append([]byte{c}, data[pos:]...)...)
+				case 1:
+					if pos < len(data) {
+						data = append(data[:pos], data[pos+1:]...)
+					}
+				default:
+					if pos < len(data) {
+						data[pos] = c
+					}
+				}
+			}
+
+			messagePack, err := internal.JSONToMessagePack(nil, data)
+			if !json.Valid(data) {
+				assert.Equal(t, internal.ErrInvalidJSON, err, "expected invalid json: %q", data)
+				continue
+			}
+
+			require.NoError(t, err, "expected valid json: %q", data)
+			assertEquivalentJSON(t, data, messagePack)
+		}
+	})
+
+	t.Run("random messagepack", func(t *testing.T) {
+		for i := 0; i < 5000; i++ {
+			messagePack := make([]byte, rnd.Intn(32))
+			rnd.Read(messagePack)
+
+			data, err := internal.MessagePackToJSON(nil, messagePack)
+			if err != nil {
+				assert.Equal(t, internal.ErrInvalidMessagePack, err)
+				continue
+			}
+
+			assert.True(t, json.Valid(data), "messagepack %x resulted in invalid json: %q", messagePack, data)
+		}
+	})
+}
+
+// assertRoundTrip asserts that the JSON is valid MessagePack and transcodes back to equivalent JSON
+func assertRoundTrip(t *testing.T, data []byte) {
+	messagePack, err := internal.JSONToMessagePack(nil, data)
+	require.NoError(t, err, "json: %q", data)
+
+	assertEquivalentJSON(t, data, messagePack)
+}
+
+// assertEquivalentJSON asserts that the MessagePack transcodes to JSON that is decoded to the same value as the JSON
+// including the exact representation of every number
+func assertEquivalentJSON(t *testing.T, data []byte, messagePack []byte) {
+	transcoded, err := internal.MessagePackToJSON(nil, messagePack)
+	require.NoError(t, err, "json: %q", data)
+
+	assert.Equal(t, decodeJSON(t, data), decodeJSON(t, transcoded), "json: %q transcoded: %q", data, transcoded)
+}
+
+// decodeJSON decodes the JSON keeping the representation of numbers.
+// Floats formatted by easyjson are transcoded using the format of encoding/json so they're normalized to that format.
+func decodeJSON(t *testing.T, data []byte) interface{} {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	require.NoError(t, decoder.Decode(&value), "json: %q", data)
+
+	return normalizeFloats(value)
+}
+
+func normalizeFloats(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = normalizeFloats(val)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeFloats(val)
+		}
+	case json.Number:
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil && strconv.FormatFloat(f, 'g', -1, 64) == string(v) {
+			data, err := json.Marshal(f)
+			if err == nil {
+				return json.Number(data)
+			}
+		}
+	}
+
+	return value
+}
+
+// appendRandomJSON appends a random JSON value with random whitespace
+func appendRandomJSON(dst []byte, rnd *rand.Rand, depth int) []byte {
+	kind := rnd.Intn(8)
+	if depth > 4 && kind >= 6 {
+		kind = rnd.Intn(6)
+	}
+
+	switch kind {
+	case 0:
+		return append(dst, [...]string{"true", "false", "null"}[rnd.Intn(3)]...)
+	case 1:
+		return strconv.AppendInt(dst, randomInt(rnd), 10)
+	case 2:
+		f := math.Float64frombits(rnd.Uint64())
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			f = rnd.NormFloat64()
+		}
+		data, _ := json.Marshal(f)
+		return append(dst, data...)
+	case 3:
+		// Numbers of which the representation can't be kept by an integer or float64
+		numbers := [...]string{"1.0", "-0", "-0.0", "1E5", "2.50", "1e400", "18446744073709551616", "0.1000000000000000055511151231257827"}
+		return append(dst, numbers[rnd.Intn(len(numbers))]...)
+	case 4, 5:
+		return appendRandomString(dst, rnd)
+	case 6:
+		dst = append(dst, '[')
+		for i, n := 0, rnd.Intn(10); i < n; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendWhitespace(dst, rnd)
+			dst = appendRandomJSON(dst, rnd, depth+1)
+			dst = appendWhitespace(dst, rnd)
+		}
+		return append(dst, ']')
+	default:
+		dst = append(dst, '{')
+		for i, n := 0, rnd.Intn(10); i < n; i++ {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendWhitespace(dst, rnd)
+			dst = appendRandomString(dst, rnd)
+			dst = appendWhitespace(dst, rnd)
+			dst = append(dst, ':')
+			dst = appendRandomJSON(dst, rnd, depth+1)
+		}
+		return append(dst, '}')
+	}
+}
+
+func randomInt(rnd *rand.Rand) int64 {
+	switch rnd.Intn(3) {
+	case 0:
+		return rnd.Int63n(256) - 128
+	case 1:
+		return rnd.Int63n(1<<32) - 1<<31
+	default:
+		return int64(rnd.Uint64())
+	}
+}
+
+// appendRandomString appends a JSON string with random characters, escapes and invalid UTF-8
+func appendRandomString(dst []byte, rnd *rand.Rand) []byte {
+	parts := [...]string{"a", "Z", " ", "é", "😀", `\"`, `\\`, `\/`, `\n`, `\t`, `\u0000`, `\u00e9`, `\ud83d\ude00`, `\ud800`, "\xff", "\xc3", "\xed\xa0\x80", "\x7f"}
+
+	dst = append(dst, '"')
+	n := rnd.Intn(8)
+	if rnd.Intn(20) == 0 {
+		n = rnd.Intn(400)
+	}
+	for i := 0; i < n; i++ {
+		dst = append(dst, parts[rnd.Intn(len(parts))]...)
+	}
+
+	return append(dst, '"')
+}
+
+func appendWhitespace(dst []byte, rnd *rand.Rand) []byte {
+	for n := rnd.Intn(3); n > 0; n-- {
+		dst = append(dst, " \t\n\r"[rnd.Intn(4)])
+	}
+	return dst
+}
@@ -0,0 +1,72 @@
+package json
+
+import (
+	"context"
+	"sync"
+)
+
+const (
+	// ClaimCheckEager indicates that a payload stored in a goengine.BlobStore is loaded when the message is
+	// reconstructed
+	ClaimCheckEager ClaimCheckPolicy = iota
+	// ClaimCheckLazy indicates that a payload stored in a goengine.BlobStore is reconstructed as a LazyPayload which
+	// loads the payload when it's needed.
+	// Message handlers, like the handlers of a projection, receive a *LazyPayload as the payload of these messages
+	// instead of the payload itself. They're dispatched using the payload type of the LazyPayload and must use
+	// LoadPayload, or Load, to get the payload.
+	ClaimCheckLazy ClaimCheckPolicy = iota
+)
+
+type (
+	// ClaimCheckPolicy determines when payloads stored in a goengine.BlobStore are loaded
+	ClaimCheckPolicy int
+
+	// LazyPayload is the payload of an event that is stored in a goengine.BlobStore and is only loaded when Load is
+	// called. It contains the name of the payload type and the reference of the payload in the blob store.
+	LazyPayload struct {
+		Type      string
+		Reference string
+
+		load func(ctx context.Context) (interface{}, error)
+
+		mu      sync.Mutex
+		payload interface{}
+	}
+)
+
+// NewLazyPayload returns a new LazyPayload which uses load to load the payload
+func NewLazyPayload(payloadType string, reference string, load func(ctx context.Context) (interface{}, error)) *LazyPayload {
+	return &LazyPayload{
+		Type:      payloadType,
+		Reference: reference,
+		load:      load,
+	}
+}
+
+// Load loads and returns the payload, once loaded the payload is kept so it's only loaded once
+func (p *LazyPayload) Load(ctx context.Context) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.payload != nil {
+		return p.payload, nil
+	}
+
+	payload, err := p.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.payload = payload
+
+	return payload, nil
+}
+
+// LoadPayload returns the loaded payload when the payload is a LazyPayload and otherwise the payload itself.
+// This allows message handlers to get the payload regardless of the ClaimCheckPolicy.
+func LoadPayload(ctx context.Context, payload interface{}) (interface{}, error) {
+	if lazy, ok := payload.(*LazyPayload); ok {
+		return lazy.Load(ctx)
+	}
+
+	return payload, nil
+}
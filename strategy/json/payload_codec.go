@@ -0,0 +1,183 @@
+package json
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/strategy/json/internal"
+)
+
+// PayloadCodecKey is the metadata key containing the codec used to encode the payload of an event.
+// When the key is not set the payload is stored as JSON.
+const PayloadCodecKey = "_payload_codec"
+
+const (
+	// PayloadEncodingJSON stores the payload as JSON
+	PayloadEncodingJSON PayloadEncoding = "json"
+	// PayloadEncodingMessagePack stores the payload as MessagePack
+	PayloadEncodingMessagePack PayloadEncoding = "msgpack"
+
+	// PayloadCompressionNone doesn't compress the payload
+	PayloadCompressionNone PayloadCompression = ""
+	// PayloadCompressionGzip compresses the payload using gzip
+	PayloadCompressionGzip PayloadCompression = "gzip"
+)
+
+var (
+	// ErrUnknownPayloadCodec occurs when the codec of a payload is not known
+	ErrUnknownPayloadCodec = errors.New("goengine: unknown payload codec")
+
+	gzipWriters = sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(nil)
+		},
+	}
+	gzipReaders sync.Pool
+)
+
+type (
+	// PayloadEncoding is the encoding used to store the json data of a payload
+	PayloadEncoding string
+
+	// PayloadCompression is the compression used to store the encoded data of a payload
+	PayloadCompression string
+
+	// PayloadCodec encodes the json data of a payload into a more compact representation.
+	//
+	// The name of the codec that was used is returned when encoding so it can be stored with the event using
+	// PayloadCodecKey. DecodePayload uses the name to decode the data back into json.
+	PayloadCodec struct {
+		encoding             PayloadEncoding
+		compression          PayloadCompression
+		compressionThreshold int
+	}
+)
+
+// NewPayloadCodec returns a new PayloadCodec.
+// The data is compressed when the encoded data is at least compressionThreshold bytes and compressing it makes it
+// smaller.
+func NewPayloadCodec(encoding PayloadEncoding, compression PayloadCompression, compressionThreshold int) (*PayloadCodec, error) {
+	switch {
+	case encoding != PayloadEncodingJSON && encoding != PayloadEncodingMessagePack:
+		return nil, goengine.InvalidArgumentError("encoding")
+	case compression != PayloadCompressionNone && compression != PayloadCompressionGzip:
+		return nil, goengine.InvalidArgumentError("compression")
+	case compressionThreshold < 0:
+		return nil, goengine.InvalidArgumentError("compressionThreshold")
+	}
+
+	return &PayloadCodec{
+		encoding:             encoding,
+		compression:          compression,
+		compressionThreshold: compressionThreshold,
+	}, nil
+}
+
+// EncodePayload encodes the json data and returns the name of the codec that was used and the encoded data
+func (c *PayloadCodec) EncodePayload(data []byte) (string, []byte, error) {
+	codec := string(c.encoding)
+	if c.encoding == PayloadEncodingMessagePack {
+		var err error
+		if data, err = internal.JSONToMessagePack(make([]byte, 0, len(data)), data); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if c.compression == PayloadCompressionGzip && len(data) >= c.compressionThreshold {
+		compressed, err := gzipCompress(data)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if len(compressed) < len(data) {
+			codec += "+" + string(c.compression)
+			data = compressed
+		}
+	}
+
+	return codec, data, nil
+}
+
+// DecodePayload decodes the data encoded by the named codec into json.
+// An empty codec name is handled as json since it indicates the data was stored without a codec.
+func DecodePayload(codec string, data []byte) ([]byte, error) {
+	if codec == "" {
+		return data, nil
+	}
+
+	encoding, compression := PayloadEncoding(codec), PayloadCompressionNone
+	if i := strings.IndexByte(codec, '+'); i >= 0 {
+		encoding, compression = PayloadEncoding(codec[:i]), PayloadCompression(codec[i+1:])
+	}
+
+	switch {
+	case encoding != PayloadEncodingJSON && encoding != PayloadEncodingMessagePack:
+		return nil, ErrUnknownPayloadCodec
+	case compression != PayloadCompressionNone && compression != PayloadCompressionGzip:
+		return nil, ErrUnknownPayloadCodec
+	}
+
+	if compression == PayloadCompressionGzip {
+		var err error
+		if data, err = gzipDecompress(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if encoding == PayloadEncodingMessagePack {
+		return internal.MessagePackToJSON(make([]byte, 0, len(data)*2), data)
+	}
+
+	return data, nil
+}
+
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(data) / 2)
+
+	w := gzipWriters.Get().(*gzip.Writer)
+	defer gzipWriters.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func gzipDecompress(data []byte) ([]byte, error) {
+	var (
+		r   *gzip.Reader
+		err error
+	)
+	if pooled, ok := gzipReaders.Get().(*gzip.Reader); ok {
+		r = pooled
+		err = r.Reset(bytes.NewReader(data))
+	} else {
+		r, err = gzip.NewReader(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer gzipReaders.Put(r)
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) * 2)
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,309 @@
+// +build unit
+
+package json_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hellofresh/goengine"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/mailru/easyjson/jlexer"
+	"github.com/mailru/easyjson/jwriter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPayloadCodec(t *testing.T) {
+	testCases := []struct {
+		title       string
+		encoding    strategyJSON.PayloadEncoding
+		compression strategyJSON.PayloadCompression
+		threshold   int
+		expectedErr error
+	}{
+		{"unknown encoding", strategyJSON.PayloadEncoding("cbor"), strategyJSON.PayloadCompressionNone, 0, goengine.InvalidArgumentError("encoding")},
+		{"unknown compression", strategyJSON.PayloadEncodingJSON, strategyJSON.PayloadCompression("snappy"), 0, goengine.InvalidArgumentError("compression")},
+		{"negative threshold", strategyJSON.PayloadEncodingJSON, strategyJSON.PayloadCompressionGzip, -1, goengine.InvalidArgumentError("compressionThreshold")},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			codec, err := strategyJSON.NewPayloadCodec(testCase.encoding, testCase.compression, testCase.threshold)
+
+			assert.Equal(t, testCase.expectedErr, err)
+			assert.Nil(t, codec)
+		})
+	}
+}
+
+func TestPayloadCodec(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		testCases := []struct {
+			title    string
+			data     string
+			expected string
+		}{
+			{"empty object", `{}`, `{}`},
+			{"empty array", `[]`, `[]`},
+			{"literals", `[true,false,null]`, `[true,false,null]`},
+			{"key order", `{"b":1,"a":{"d":[1,2],"c":""}}`, `{"b":1,"a":{"d":[1,2],"c":""}}`},
+			{"whitespace", " {\n\t\"a\" : [ 1 , 2 ] } ", `{"a":[1,2]}`},
+			{
+				"integers",
+				`[0,-1,-32,-33,127,128,255,65536,-2147483649,9223372036854775807,-9223372036854775808,18446744073709551615]`,
+				`[0,-1,-32,-33,127,128,255,65536,-2147483649,9223372036854775807,-9223372036854775808,18446744073709551615]`,
+			},
+			{
+				"floats",
+				`[1.5,0.1,-273.15,1234567.5,1.2345675e+06,1e-7,1e+21]`,
+				`[1.5,0.1,-273.15,1234567.5,1234567.5,1e-7,1e+21]`,
+			},
+			{
+				"numbers that would lose precision",
+				`[123456789012345678901234567890,1.0,0.10000000000000000001,1E3,0.5e1]`,
+				`[123456789012345678901234567890,1.0,0.10000000000000000001,1E3,0.5e1]`,
+			},
+			{"escaped strings", `"a\"b\\c\n\r\t\u0001/é"`, `"a\"b\\c\n\r\t\u0001/é"`},
+			{"unicode escapes", `"\u00e9\/\ud83d\ude00"`, `"é/😀"`},
+			{"long strings", `["` + strings.Repeat("a", 31) + `","` + strings.Repeat("b", 300) + `","` + strings.Repeat("c", 70000) + `"]`, ``},
+			{"large containers", `[` + strings.TrimSuffix(strings.Repeat(`{"a":1},`, 70000), ",") + `]`, ``},
+		}
+
+		codecs := map[string]*strategyJSON.PayloadCodec{}
+		for _, encoding := range []strategyJSON.PayloadEncoding{strategyJSON.PayloadEncodingJSON, strategyJSON.PayloadEncodingMessagePack} {
+			for _, compression := range []strategyJSON.PayloadCompression{strategyJSON.PayloadCompressionNone, strategyJSON.PayloadCompressionGzip} {
+				codec, err := strategyJSON.NewPayloadCodec(encoding, compression, 0)
+				require.NoError(t, err)
+
+				codecs[string(encoding)+"+"+string(compression)] = codec
+			}
+		}
+
+		for _, testCase := range testCases {
+			for name, codec := range codecs {
+				testCase, codec := testCase, codec
+				t.Run(testCase.title+" "+name, func(t *testing.T) {
+					expected := testCase.expected
+					if expected == "" {
+						expected = testCase.data
+					}
+
+					codecName, encoded, err := codec.EncodePayload([]byte(testCase.data))
+					require.NoError(t, err)
+
+					decoded, err := strategyJSON.DecodePayload(codecName, encoded)
+					require.NoError(t, err)
+
+					if strings.HasPrefix(codecName, string(strategyJSON.PayloadEncodingJSON)) {
+						expected = testCase.data
+					}
+					assert.Equal(t, expected, string(decoded))
+				})
+			}
+		}
+	})
+
+	t.Run("messagepack is more compact", func(t *testing.T) {
+		codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionNone, 0)
+		require.NoError(t, err)
+
+		data := []byte(`{"name":"alice","balance":1500,"rate":0.25,"active":true,"tags":["a","b"]}`)
+		codecName, encoded, err := codec.EncodePayload(data)
+
+		require.NoError(t, err)
+		assert.Equal(t, "msgpack", codecName)
+		assert.True(t, len(encoded) < len(data))
+	})
+
+	t.Run("compress above threshold", func(t *testing.T) {
+		codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionGzip, 256)
+		require.NoError(t, err)
+
+		codecName, _, err := codec.EncodePayload([]byte(`{"name":"alice"}`))
+		require.NoError(t, err)
+		assert.Equal(t, "msgpack", codecName)
+
+		codecName, _, err = codec.EncodePayload([]byte(`{"name":"` + strings.Repeat("alice", 100) + `"}`))
+		require.NoError(t, err)
+		assert.Equal(t, "msgpack+gzip", codecName)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionNone, 0)
+		require.NoError(t, err)
+
+		for _, data := range []string{``, `{"a":}`, `{"a":1,}`, `[1,]`, `[1 2]`, `01`, `1.`, `-`, `"abc`, `tru`, `{"a":1}x`, `{1:2}`} {
+			_, _, err := codec.EncodePayload([]byte(data))
+			assert.Error(t, err, data)
+		}
+	})
+}
+
+func TestDecodePayload(t *testing.T) {
+	t.Run("without codec", func(t *testing.T) {
+		decoded, err := strategyJSON.DecodePayload("", []byte(`{"a":1}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(`{"a":1}`), decoded)
+	})
+
+	t.Run("unknown codec", func(t *testing.T) {
+		for _, codec := range []string{"cbor", "msgpack+snappy", "cbor+gzip"} {
+			decoded, err := strategyJSON.DecodePayload(codec, []byte{0x80})
+
+			assert.Equal(t, strategyJSON.ErrUnknownPayloadCodec, err, codec)
+			assert.Nil(t, decoded)
+		}
+	})
+
+	t.Run("invalid data", func(t *testing.T) {
+		for codec, data := range map[string][]byte{
+			"msgpack":      {0x82, 0xa1, 'a'},
+			"msgpack+gzip": {0x1f, 0x8b},
+		} {
+			_, err := strategyJSON.DecodePayload(codec, data)
+			assert.Error(t, err, codec)
+		}
+	})
+}
+
+type benchmarkPayload struct {
+	ID          string
+	Owner       string
+	Balance     int64
+	Rate        float64
+	Tags        []string
+	Description string
+}
+
+func (p benchmarkPayload) MarshalEasyJSON(w *jwriter.Writer) {
+	w.RawString(`{"id":`)
+	w.String(p.ID)
+	w.RawString(`,"owner":`)
+	w.String(p.Owner)
+	w.RawString(`,"balance":`)
+	w.Int64(p.Balance)
+	w.RawString(`,"rate":`)
+	w.Float64(p.Rate)
+	w.RawString(`,"tags":[`)
+	for i, tag := range p.Tags {
+		if i > 0 {
+			w.RawByte(',')
+		}
+		w.String(tag)
+	}
+	w.RawString(`],"description":`)
+	w.String(p.Description)
+	w.RawByte('}')
+}
+
+func (p *benchmarkPayload) UnmarshalEasyJSON(l *jlexer.Lexer) {
+	l.Delim('{')
+	for !l.IsDelim('}') {
+		key := l.UnsafeString()
+		l.WantColon()
+		switch key {
+		case "id":
+			p.ID = l.String()
+		case "owner":
+			p.Owner = l.String()
+		case "balance":
+			p.Balance = l.Int64()
+		case "rate":
+			p.Rate = l.Float64()
+		case "tags":
+			p.Tags = p.Tags[:0]
+			l.Delim('[')
+			for !l.IsDelim(']') {
+				p.Tags = append(p.Tags, l.String())
+				l.WantComma()
+			}
+			l.Delim(']')
+		case "description":
+			p.Description = l.String()
+		default:
+			l.SkipRecursive()
+		}
+		l.WantComma()
+	}
+	l.Delim('}')
+}
+
+func BenchmarkPayloadCodec(b *testing.B) {
+	transformer := strategyJSON.NewPayloadTransformer()
+	require.NoError(b, transformer.RegisterPayload("account_opened", func() interface{} {
+		return &benchmarkPayload{}
+	}))
+
+	payloads := map[string]*benchmarkPayload{
+		"small": {
+			ID:      "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8",
+			Owner:   "alice",
+			Balance: 1500,
+			Rate:    0.25,
+			Tags:    []string{"savings", "personal"},
+		},
+		"large": {
+			ID:          "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8",
+			Owner:       "alice",
+			Balance:     1500,
+			Rate:        0.25,
+			Tags:        []string{"savings", "personal"},
+			Description: strings.Repeat("A savings account opened by alice. ", 50),
+		},
+	}
+
+	codecs := []struct {
+		name        string
+		encoding    strategyJSON.PayloadEncoding
+		compression strategyJSON.PayloadCompression
+	}{
+		{"msgpack", strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionNone},
+		{"json+gzip", strategyJSON.PayloadEncodingJSON, strategyJSON.PayloadCompressionGzip},
+		{"msgpack+gzip", strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionGzip},
+	}
+
+	for size, payload := range payloads {
+		payload := payload
+
+		b.Run(size+"/easyjson", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				payloadType, data, err := transformer.ConvertPayload(payload)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := transformer.CreatePayload(payloadType, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		for _, c := range codecs {
+			codec, err := strategyJSON.NewPayloadCodec(c.encoding, c.compression, 512)
+			require.NoError(b, err)
+
+			b.Run(size+"/"+c.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					payloadType, data, err := transformer.ConvertPayload(payload)
+					if err != nil {
+						b.Fatal(err)
+					}
+					codecName, encoded, err := codec.EncodePayload(data)
+					if err != nil {
+						b.Fatal(err)
+					}
+					decoded, err := strategyJSON.DecodePayload(codecName, encoded)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, err := transformer.CreatePayload(payloadType, decoded); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package json
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/hellofresh/goengine"
+)
+
+const (
+	// PersonalDataTag is the struct tag used to mark the fields of a payload containing personal data.
+	// The field containing the id of the data subject is tagged `personal:"subject"` and the fields containing
+	// personal data of the subject are tagged `personal:"data"`.
+	PersonalDataTag = "personal"
+
+	personalDataTagSubject = "subject"
+	personalDataTagData    = "data"
+)
+
+var (
+	// ErrDataSubjectNotTagged occurs when a payload has personal data fields but no data subject field
+	ErrDataSubjectNotTagged = errors.New("goengine: payload with personal data must have a string field tagged as data subject")
+	// ErrEmptyDataSubject occurs when the data subject of a payload with personal data is empty
+	ErrEmptyDataSubject = errors.New("goengine: data subject of the payload is empty")
+	// ErrKeyStoreRequired occurs when a payload with encrypted personal data is reconstructed without a KeyStore
+	ErrKeyStoreRequired = errors.New("goengine: a key store is required to decrypt the personal data of the payload")
+
+	encryptedValueKey = []byte(`"_encrypted"`)
+)
+
+type (
+	// personalData contains the fields of a payload type containing personal data
+	personalData struct {
+		subjectField []int
+		dataFields   []string
+	}
+
+	// encryptedValue is the json representation of an encrypted field
+	encryptedValue struct {
+		Encrypted []byte `json:"_encrypted"`
+		Subject   string `json:"_subject"`
+	}
+)
+
+// WithEncryption enables the encryption of the personal data in payloads using the keys of the data subjects in the
+// KeyStore. When the key of a data subject is deleted the personal data of the subject is redacted when reconstructing
+// the payload, resulting in the zero value of the fields.
+func (p *PayloadTransformer) WithEncryption(keyStore goengine.KeyStore) {
+	p.keyStore = keyStore
+}
+
+// personalDataOf returns the personal data fields of the payload type or nil when the type has no personal data
+func personalDataOf(t reflect.Type) (*personalData, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var pd personalData
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		switch field.Tag.Get(PersonalDataTag) {
+		case personalDataTagSubject:
+			if field.Type.Kind() != reflect.String {
+				return nil, ErrDataSubjectNotTagged
+			}
+			pd.subjectField = field.Index
+		case personalDataTagData:
+			if name := jsonFieldName(field); name != "" {
+				pd.dataFields = append(pd.dataFields, name)
+			}
+		}
+	}
+
+	if len(pd.dataFields) == 0 {
+		return nil, nil
+	}
+	if pd.subjectField == nil {
+		return nil, ErrDataSubjectNotTagged
+	}
+
+	return &pd, nil
+}
+
+// jsonFieldName returns the name of the field in json or an empty string when the field is not marshaled
+func jsonFieldName(field reflect.StructField) string {
+	if field.PkgPath != "" {
+		return ""
+	}
+
+	name := field.Tag.Get("json")
+	if i := strings.IndexByte(name, ','); i >= 0 {
+		name = name[:i]
+	}
+
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	default:
+		return name
+	}
+}
+
+// encryptPersonalData encrypts the personal data fields in the json data of the payload
+func (p *PayloadTransformer) encryptPersonalData(ctx context.Context, pd *personalData, payload interface{}, data []byte) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(payload))
+	subject := rv.FieldByIndex(pd.subjectField).String()
+	if subject == "" {
+		return nil, ErrEmptyDataSubject
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	key, err := p.keyStore.GetOrCreateKey(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range pd.dataFields {
+		value, found := fields[name]
+		if !found {
+			continue
+		}
+
+		nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(value)+gcm.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		encrypted, err := json.Marshal(encryptedValue{
+			Encrypted: gcm.Seal(nonce, nonce, value, []byte(subject)),
+			Subject:   subject,
+		})
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = encrypted
+	}
+
+	return json.Marshal(fields)
+}
+
+// decryptPersonalData decrypts the encrypted personal data fields in the json data of the payload.
+// Only the fields tagged as personal data are decrypted, other fields are kept as is even when they look encrypted.
+// Fields of which the key of the data subject was deleted are redacted by replacing the value with null.
+// ErrKeyStoreRequired is returned when a field is encrypted but no KeyStore is configured.
+func (p *PayloadTransformer) decryptPersonalData(ctx context.Context, pd *personalData, data []byte) ([]byte, error) {
+	if !bytes.Contains(data, encryptedValueKey) {
+		return data, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		// Only the fields of a json object are encrypted
+		return data, nil
+	}
+
+	ciphers := map[string]cipher.AEAD{}
+	for _, name := range pd.dataFields {
+		value, found := fields[name]
+		if !found || len(value) == 0 || value[0] != '{' || !bytes.Contains(value, encryptedValueKey) {
+			continue
+		}
+
+		var encrypted encryptedValue
+		if err := json.Unmarshal(value, &encrypted); err != nil || len(encrypted.Encrypted) == 0 {
+			continue
+		}
+		if p.keyStore == nil {
+			return nil, ErrKeyStoreRequired
+		}
+
+		gcm, found := ciphers[encrypted.Subject]
+		if !found {
+			key, err := p.keyStore.Key(ctx, encrypted.Subject)
+			switch {
+			case err == goengine.ErrKeyNotFound:
+			case err != nil:
+				return nil, err
+			default:
+				if gcm, err = newGCM(key); err != nil {
+					return nil, err
+				}
+			}
+			ciphers[encrypted.Subject] = gcm
+		}
+
+		fields[name] = decrypt(gcm, encrypted)
+	}
+
+	return json.Marshal(fields)
+}
+
+// decrypt returns the decrypted value or null when the value can't be decrypted because the key was deleted or
+// replaced by a new key
+func decrypt(gcm cipher.AEAD, encrypted encryptedValue) json.RawMessage {
+	if gcm == nil || len(encrypted.Encrypted) < gcm.NonceSize() {
+		return json.RawMessage("null")
+	}
+
+	nonce, ciphertext := encrypted.Encrypted[:gcm.NonceSize()], encrypted.Encrypted[gcm.NonceSize():]
+	value, err := gcm.Open(nil, nonce, ciphertext, []byte(encrypted.Subject))
+	if err != nil {
+		return json.RawMessage("null")
+	}
+
+	return value
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,247 @@
+// +build unit
+
+package json_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type customerRegistered struct {
+	CustomerID string `json:"customer_id" personal:"subject"`
+	Name       string `json:"name" personal:"data"`
+	Address    struct {
+		Street string `json:"street"`
+	} `json:"address" personal:"data"`
+	Country string `json:"country"`
+}
+
+type failingKeyStore struct {
+	goengine.KeyStore
+	err error
+}
+
+func (s *failingKeyStore) Key(ctx context.Context, subject string) ([]byte, error) {
+	return nil, s.err
+}
+
+func (s *failingKeyStore) GetOrCreateKey(ctx context.Context, subject string) ([]byte, error) {
+	return nil, s.err
+}
+
+type contextKey struct{}
+
+// contextKeyStore is a key store that records the value of contextKey of the contexts it's called with
+type contextKeyStore struct {
+	*inmemory.KeyStore
+	values []interface{}
+}
+
+func (s *contextKeyStore) Key(ctx context.Context, subject string) ([]byte, error) {
+	s.values = append(s.values, ctx.Value(contextKey{}))
+	return s.KeyStore.Key(ctx, subject)
+}
+
+func (s *contextKeyStore) GetOrCreateKey(ctx context.Context, subject string) ([]byte, error) {
+	s.values = append(s.values, ctx.Value(contextKey{}))
+	return s.KeyStore.GetOrCreateKey(ctx, subject)
+}
+
+func newCustomerRegistered() customerRegistered {
+	payload := customerRegistered{CustomerID: "alice-id", Name: "Alice", Country: "NL"}
+	payload.Address.Street = "Prinsengracht"
+
+	return payload
+}
+
+func TestPayloadTransformer_WithEncryption(t *testing.T) {
+	newTransformer := func(t *testing.T, keyStore goengine.KeyStore) *strategyJSON.PayloadTransformer {
+		transformer := strategyJSON.NewPayloadTransformer()
+		transformer.WithEncryption(keyStore)
+		require.NoError(t, transformer.RegisterPayload("customer_registered", func() interface{} {
+			return customerRegistered{}
+		}))
+
+		return transformer
+	}
+
+	t.Run("encrypt and decrypt personal data", func(t *testing.T) {
+		transformer := newTransformer(t, inmemory.NewKeyStore())
+
+		payloadType, data, err := transformer.ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+
+		asserts := assert.New(t)
+		asserts.Equal("customer_registered", payloadType)
+		asserts.False(bytes.Contains(data, []byte("Alice")))
+		asserts.False(bytes.Contains(data, []byte("Prinsengracht")))
+		asserts.True(bytes.Contains(data, []byte(`"country":"NL"`)))
+		asserts.True(bytes.Contains(data, []byte(`"_subject":"alice-id"`)))
+
+		payload, err := transformer.CreatePayload(payloadType, data)
+		asserts.NoError(err)
+		asserts.Equal(newCustomerRegistered(), payload)
+	})
+
+	t.Run("redact personal data when the key is deleted", func(t *testing.T) {
+		keyStore := inmemory.NewKeyStore()
+		transformer := newTransformer(t, keyStore)
+
+		payloadType, data, err := transformer.ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+
+		require.NoError(t, keyStore.DeleteKey(context.Background(), "alice-id"))
+
+		payload, err := transformer.CreatePayload(payloadType, data)
+		assert.NoError(t, err)
+		assert.Equal(t, customerRegistered{CustomerID: "alice-id", Country: "NL"}, payload)
+
+		// A new key for the subject can't decrypt the personal data encrypted with the deleted key
+		_, err = keyStore.GetOrCreateKey(context.Background(), "alice-id")
+		require.NoError(t, err)
+
+		payload, err = transformer.CreatePayload(payloadType, data)
+		assert.NoError(t, err)
+		assert.Equal(t, customerRegistered{CustomerID: "alice-id", Country: "NL"}, payload)
+	})
+
+	t.Run("decrypt before upcasting", func(t *testing.T) {
+		transformer := newTransformer(t, inmemory.NewKeyStore())
+		require.NoError(t, transformer.RegisterUpcaster("customer_registered", 1, func(data []byte) ([]byte, error) {
+			if !bytes.Contains(data, []byte("Alice")) {
+				return nil, errors.New("personal data is encrypted")
+			}
+			return data, nil
+		}))
+
+		payloadType, data, err := transformer.ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+
+		payload, err := transformer.CreateVersionedPayload(payloadType, 1, data)
+		assert.NoError(t, err)
+		assert.Equal(t, newCustomerRegistered(), payload)
+	})
+
+	t.Run("decrypt renamed payload types", func(t *testing.T) {
+		transformer := newTransformer(t, inmemory.NewKeyStore())
+		require.NoError(t, transformer.RegisterRenameUpcaster("customer_created", 1, "customer_registered", 1, nil))
+
+		_, data, err := transformer.ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+
+		payload, err := transformer.CreateVersionedPayload("customer_created", 1, data)
+		assert.NoError(t, err)
+		assert.Equal(t, newCustomerRegistered(), payload)
+	})
+
+	t.Run("only decrypt fields tagged as personal data", func(t *testing.T) {
+		type customerNoted struct {
+			CustomerID string          `json:"customer_id" personal:"subject"`
+			Name       string          `json:"name" personal:"data"`
+			Note       json.RawMessage `json:"note"`
+		}
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		transformer.WithEncryption(inmemory.NewKeyStore())
+		require.NoError(t, transformer.RegisterPayload("customer_noted", func() interface{} {
+			return customerNoted{}
+		}))
+
+		note := json.RawMessage(`{"_encrypted":"bm90IGVuY3J5cHRlZA==","_subject":"alice-id"}`)
+		payloadType, data, err := transformer.ConvertPayload(customerNoted{CustomerID: "alice-id", Name: "Alice", Note: note})
+		require.NoError(t, err)
+
+		payload, err := transformer.CreatePayload(payloadType, data)
+		assert.NoError(t, err)
+		assert.Equal(t, customerNoted{CustomerID: "alice-id", Name: "Alice", Note: note}, payload)
+	})
+
+	t.Run("no encryption without a key store", func(t *testing.T) {
+		transformer := newTransformer(t, nil)
+
+		_, data, err := transformer.ConvertPayload(newCustomerRegistered())
+		assert.NoError(t, err)
+		assert.True(t, bytes.Contains(data, []byte(`"name":"Alice"`)))
+	})
+
+	t.Run("decrypt without a key store", func(t *testing.T) {
+		payloadType, data, err := newTransformer(t, inmemory.NewKeyStore()).ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+
+		payload, err := newTransformer(t, nil).CreatePayload(payloadType, data)
+		assert.Nil(t, payload)
+		assert.Equal(t, strategyJSON.ErrKeyStoreRequired, err)
+	})
+
+	t.Run("pass the context to the key store", func(t *testing.T) {
+		keyStore := &contextKeyStore{KeyStore: inmemory.NewKeyStore()}
+		transformer := newTransformer(t, keyStore)
+		ctx := context.WithValue(context.Background(), contextKey{}, "caller")
+
+		payloadType, data, err := transformer.ConvertPayloadWithContext(ctx, newCustomerRegistered())
+		require.NoError(t, err)
+
+		payload, err := transformer.CreatePayloadWithContext(ctx, payloadType, data)
+		assert.NoError(t, err)
+		assert.Equal(t, newCustomerRegistered(), payload)
+
+		payload, err = transformer.CreateVersionedPayloadWithContext(ctx, payloadType, 1, data)
+		assert.NoError(t, err)
+		assert.Equal(t, newCustomerRegistered(), payload)
+
+		assert.Equal(t, []interface{}{"caller", "caller", "caller"}, keyStore.values)
+	})
+
+	t.Run("empty data subject", func(t *testing.T) {
+		transformer := newTransformer(t, inmemory.NewKeyStore())
+
+		_, _, err := transformer.ConvertPayload(customerRegistered{Name: "Alice"})
+		assert.Equal(t, strategyJSON.ErrEmptyDataSubject, err)
+	})
+
+	t.Run("key store failure", func(t *testing.T) {
+		expectedErr := errors.New("key store failure")
+
+		payloadType, data, err := newTransformer(t, inmemory.NewKeyStore()).ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+
+		transformer := newTransformer(t, &failingKeyStore{err: expectedErr})
+
+		_, _, err = transformer.ConvertPayload(newCustomerRegistered())
+		assert.Equal(t, expectedErr, err)
+
+		_, err = transformer.CreatePayload(payloadType, data)
+		assert.Equal(t, expectedErr, err)
+	})
+
+	t.Run("invalid personal data tags", func(t *testing.T) {
+		type withoutSubject struct {
+			Name string `personal:"data"`
+		}
+		type invalidSubject struct {
+			ID   int    `personal:"subject"`
+			Name string `personal:"data"`
+		}
+
+		transformer := strategyJSON.NewPayloadTransformer()
+
+		err := transformer.RegisterPayload("without_subject", func() interface{} {
+			return withoutSubject{}
+		})
+		assert.Equal(t, strategyJSON.ErrDataSubjectNotTagged, err)
+
+		err = transformer.RegisterPayload("invalid_subject", func() interface{} {
+			return &invalidSubject{}
+		})
+		assert.Equal(t, strategyJSON.ErrDataSubjectNotTagged, err)
+	})
+}
@@ -0,0 +1,380 @@
+package json
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mailru/easyjson"
+)
+
+// SchemaVersion is the JSON Schema version of the generated schemas
+const SchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	easyjsonType      = reflect.TypeOf((*easyjson.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+type (
+	// Schema is a JSON Schema describing the json data of a payload type.
+	// Only the subset of JSON Schema needed to describe go types is supported. The schema is generated based on the
+	// json struct tags the same way encoding/json marshals a type.
+	Schema struct {
+		Schema               string             `json:"$schema,omitempty"`
+		Title                string             `json:"title,omitempty"`
+		Type                 SchemaType         `json:"type,omitempty"`
+		Format               string             `json:"format,omitempty"`
+		ContentEncoding      string             `json:"contentEncoding,omitempty"`
+		Minimum              *float64           `json:"minimum,omitempty"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+		Items                *Schema            `json:"items,omitempty"`
+	}
+
+	// SchemaType is the list of json types allowed by a Schema, an empty SchemaType allows any type
+	SchemaType []string
+
+	// PayloadValidationError occurs when the json data of a payload does not match the Schema of the payload type
+	PayloadValidationError struct {
+		PayloadType string
+		Field       string
+		Reason      string
+	}
+)
+
+// MarshalJSON returns a string when the SchemaType contains one type and an array otherwise
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON unmarshals a single type or a list of types
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func (e *PayloadValidationError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("goengine: payload %s is invalid: %s", e.PayloadType, e.Reason)
+	}
+
+	return fmt.Sprintf("goengine: payload %s is invalid: field %s %s", e.PayloadType, e.Field, e.Reason)
+}
+
+// WithSchemaValidation enables the validation of the json data of payloads against the Schema of the payload type in
+// ConvertPayload and CreatePayload. An invalid payload results in a PayloadValidationError.
+func (p *PayloadTransformer) WithSchemaValidation() {
+	p.validateSchema = true
+}
+
+// Schema returns the Schema of the registered payload type or the payload type of the alias
+func (p *PayloadTransformer) Schema(payloadType string) (*Schema, error) {
+	payloadType = p.ResolveAlias(payloadType)
+	t, found := p.types[payloadType]
+	if !found {
+		return nil, ErrUnknownPayloadType
+	}
+
+	schema := *t.schema
+	schema.Schema = SchemaVersion
+	schema.Title = payloadType
+
+	return &schema, nil
+}
+
+// Schemas returns the Schema of every registered payload type
+func (p *PayloadTransformer) Schemas() map[string]*Schema {
+	schemas := make(map[string]*Schema, len(p.types))
+	for payloadType := range p.types {
+		schemas[payloadType], _ = p.Schema(payloadType)
+	}
+
+	return schemas
+}
+
+// validate validates the json data when schema validation is enabled
+func (p *PayloadTransformer) validate(payloadType string, schema *Schema, data []byte) error {
+	if !p.validateSchema {
+		return nil
+	}
+
+	field, reason := schema.validate(data)
+	if reason == "" {
+		return nil
+	}
+
+	return &PayloadValidationError{PayloadType: payloadType, Field: field, Reason: reason}
+}
+
+// payloadSchema returns the Schema of a payload type.
+// The personal data fields are nullable since they are null once redacted.
+func payloadSchema(t reflect.Type, pd *personalData) *Schema {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	schema := schemaOf(t, map[reflect.Type]bool{})
+	if pd == nil {
+		return schema
+	}
+
+	for _, name := range pd.dataFields {
+		if property, ok := schema.Properties[name]; ok && len(property.Type) > 0 && !property.allows("null") {
+			nullable := *property
+			nullable.Type = append(append(SchemaType{}, property.Type...), "null")
+			schema.Properties[name] = &nullable
+		}
+	}
+
+	return schema
+}
+
+// schemaOf generates the Schema of the type the same way encoding/json marshals the type
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if t.Kind() == reflect.Ptr {
+		schema := schemaOf(t.Elem(), visiting)
+		if len(schema.Type) > 0 && !schema.allows("null") {
+			schema.Type = append(schema.Type, "null")
+		}
+		return schema
+	}
+
+	// Structs implementing a json marshaler are still described by their fields since the marshalers are mostly
+	// generated by easyjson based on the fields
+	marshaler := implements(t, jsonMarshalerType) || implements(t, easyjsonType)
+	switch {
+	case t == timeType:
+		return &Schema{Type: SchemaType{"string"}, Format: "date-time"}
+	case marshaler && t.Kind() != reflect.Struct:
+		// The json is unknown so any value is allowed
+		return &Schema{}
+	case !marshaler && implements(t, textMarshalerType):
+		return &Schema{Type: SchemaType{"string"}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: SchemaType{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: SchemaType{"integer"}}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		minimum := float64(0)
+		return &Schema{Type: SchemaType{"integer"}, Minimum: &minimum}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: SchemaType{"number"}}
+	case reflect.String:
+		return &Schema{Type: SchemaType{"string"}}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 && !implements(t.Elem(), jsonMarshalerType) {
+			return &Schema{Type: SchemaType{"string", "null"}, ContentEncoding: "base64"}
+		}
+		return &Schema{Type: SchemaType{"array", "null"}, Items: schemaOf(t.Elem(), visiting)}
+	case reflect.Array:
+		return &Schema{Type: SchemaType{"array"}, Items: schemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: SchemaType{"object", "null"}, AdditionalProperties: schemaOf(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			// Recursive types are not described
+			return &Schema{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &Schema{Type: SchemaType{"object"}, Properties: map[string]*Schema{}}
+		addStructProperties(schema, t, visiting)
+		sort.Strings(schema.Required)
+		return schema
+	default:
+		// Interfaces allow any value
+		return &Schema{}
+	}
+}
+
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func addStructProperties(schema *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, options = tag[:i], tag[i:]
+		}
+
+		fieldType := field.Type
+		if field.Anonymous && name == "" {
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			// The fields of embedded structs are promoted
+			if fieldType.Kind() == reflect.Struct {
+				addStructProperties(schema, fieldType, visiting)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOf(fieldType, visiting)
+		if strings.Contains(options, ",string") {
+			switch fieldType.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+				reflect.Float32, reflect.Float64, reflect.String:
+				property = &Schema{Type: SchemaType{"string"}}
+			}
+		}
+
+		schema.Properties[name] = property
+		if !strings.Contains(options, ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+func (s *Schema) allows(jsonType string) bool {
+	if len(s.Type) == 0 {
+		return true
+	}
+
+	for _, t := range s.Type {
+		if t == jsonType || (jsonType == "integer" && t == "number") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate validates the json data against the schema and returns a PayloadValidationError when the data is invalid
+func (s *Schema) Validate(data []byte) error {
+	field, reason := s.validate(data)
+	if reason == "" {
+		return nil
+	}
+
+	return &PayloadValidationError{PayloadType: s.Title, Field: field, Reason: reason}
+}
+
+// validate validates the json data and returns the invalid field and the reason when the data is invalid
+func (s *Schema) validate(data []byte) (string, string) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return "", "is not valid json: " + err.Error()
+	}
+
+	return s.validateValue("", value)
+}
+
+func (s *Schema) validateValue(field string, value interface{}) (string, string) {
+	var jsonType string
+	switch v := value.(type) {
+	case nil:
+		jsonType = "null"
+	case bool:
+		jsonType = "boolean"
+	case string:
+		jsonType = "string"
+	case json.Number:
+		// Only numbers without a fraction or exponent can be unmarshaled into an integer
+		jsonType = "integer"
+		if strings.ContainsAny(string(v), ".eE") {
+			jsonType = "number"
+		}
+	case []interface{}:
+		jsonType = "array"
+	case map[string]interface{}:
+		jsonType = "object"
+	}
+
+	if !s.allows(jsonType) {
+		return field, fmt.Sprintf("must be of type %s but is %s", strings.Join(s.Type, " or "), jsonType)
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		if s.Minimum != nil {
+			if f, err := v.Float64(); err == nil && f < *s.Minimum {
+				return field, fmt.Sprintf("must be at least %v", *s.Minimum)
+			}
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return "", ""
+		}
+		for i, item := range v {
+			if field, reason := s.Items.validateValue(fmt.Sprintf("%s[%d]", field, i), item); reason != "" {
+				return field, reason
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return joinField(field, name), "is required"
+			}
+		}
+
+		// Iterate in a fixed order so the same error is reported for the same data
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			if !ok {
+				property = s.AdditionalProperties
+			}
+			if property == nil {
+				continue
+			}
+
+			if field, reason := property.validateValue(joinField(field, name), v[name]); reason != "" {
+				return field, reason
+			}
+		}
+	}
+
+	return "", ""
+}
+
+func joinField(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+
+	return parent + "." + name
+}
@@ -0,0 +1,199 @@
+// +build unit
+
+package json_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine/driver/inmemory"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	schemaAuditFields struct {
+		CreatedBy string `json:"created_by"`
+	}
+
+	schemaLine struct {
+		SKU      string `json:"sku"`
+		Quantity uint   `json:"quantity"`
+	}
+
+	orderPlaced struct {
+		schemaAuditFields
+
+		OrderID   string            `json:"order_id"`
+		Total     float64           `json:"total"`
+		Paid      bool              `json:"paid"`
+		Lines     []schemaLine      `json:"lines"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		Coupon    *string           `json:"coupon"`
+		Reference int64             `json:"reference,string"`
+		PlacedAt  time.Time         `json:"placed_at"`
+		Extra     interface{}       `json:"extra,omitempty"`
+		Ignored   string            `json:"-"`
+		internal  string
+	}
+)
+
+func TestPayloadTransformer_Schema(t *testing.T) {
+	transformer := strategyJSON.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayload("order_placed", func() interface{} {
+		return &orderPlaced{}
+	}))
+
+	t.Run("generate schema", func(t *testing.T) {
+		schema, err := transformer.Schema("order_placed")
+		require.NoError(t, err)
+
+		data, err := json.Marshal(schema)
+		require.NoError(t, err)
+
+		assert.JSONEq(t, `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"title": "order_placed",
+			"type": "object",
+			"properties": {
+				"created_by": {"type": "string"},
+				"order_id": {"type": "string"},
+				"total": {"type": "number"},
+				"paid": {"type": "boolean"},
+				"lines": {
+					"type": ["array", "null"],
+					"items": {
+						"type": "object",
+						"properties": {
+							"sku": {"type": "string"},
+							"quantity": {"type": "integer", "minimum": 0}
+						},
+						"required": ["quantity", "sku"]
+					}
+				},
+				"labels": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+				"coupon": {"type": ["string", "null"]},
+				"reference": {"type": "string"},
+				"placed_at": {"type": "string", "format": "date-time"},
+				"extra": {}
+			},
+			"required": ["coupon", "created_by", "lines", "order_id", "paid", "placed_at", "reference", "total"]
+		}`, string(data))
+
+		assert.Equal(t, map[string]*strategyJSON.Schema{"order_placed": schema}, transformer.Schemas())
+	})
+
+	t.Run("unknown payload type", func(t *testing.T) {
+		schema, err := transformer.Schema("order_cancelled")
+
+		assert.Equal(t, strategyJSON.ErrUnknownPayloadType, err)
+		assert.Nil(t, schema)
+	})
+}
+
+func TestPayloadTransformer_WithSchemaValidation(t *testing.T) {
+	transformer := strategyJSON.NewPayloadTransformer()
+	transformer.WithSchemaValidation()
+	require.NoError(t, transformer.RegisterPayload("order_placed", func() interface{} {
+		return &orderPlaced{}
+	}))
+
+	t.Run("valid payload", func(t *testing.T) {
+		payload := &orderPlaced{
+			OrderID:   "order-1",
+			Lines:     []schemaLine{{SKU: "apple", Quantity: 2}},
+			Reference: 42,
+			PlacedAt:  time.Now().UTC(),
+		}
+
+		payloadType, data, err := transformer.ConvertPayload(payload)
+		require.NoError(t, err)
+
+		reconstructed, err := transformer.CreatePayload(payloadType, data)
+		assert.NoError(t, err)
+		assert.Equal(t, payload.OrderID, reconstructed.(*orderPlaced).OrderID)
+	})
+
+	t.Run("invalid payload", func(t *testing.T) {
+		valid := `"order_id":"order-1","created_by":"","total":1,"paid":false,"coupon":null,"reference":"42","placed_at":"2019-01-01T00:00:00Z"`
+
+		testCases := []struct {
+			title         string
+			data          string
+			expectedField string
+			expectedError string
+		}{
+			{
+				"missing field",
+				`{"order_id":"order-1"}`,
+				"coupon",
+				"goengine: payload order_placed is invalid: field coupon is required",
+			},
+			{
+				"wrong type",
+				`{` + valid + `,"lines":[{"sku":"apple","quantity":"2"}]}`,
+				"lines[0].quantity",
+				"goengine: payload order_placed is invalid: field lines[0].quantity must be of type integer but is string",
+			},
+			{
+				"number instead of integer",
+				`{` + valid + `,"lines":[{"sku":"apple","quantity":1.5}]}`,
+				"lines[0].quantity",
+				"goengine: payload order_placed is invalid: field lines[0].quantity must be of type integer but is number",
+			},
+			{
+				"below minimum",
+				`{` + valid + `,"lines":[{"sku":"apple","quantity":-1}]}`,
+				"lines[0].quantity",
+				"goengine: payload order_placed is invalid: field lines[0].quantity must be at least 0",
+			},
+			{
+				"invalid map value",
+				`{` + valid + `,"lines":null,"labels":{"color":1}}`,
+				"labels.color",
+				"goengine: payload order_placed is invalid: field labels.color must be of type string but is integer",
+			},
+			{
+				"not an object",
+				`[]`,
+				"",
+				"goengine: payload order_placed is invalid: must be of type object but is array",
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				payload, err := transformer.CreatePayload("order_placed", []byte(testCase.data))
+
+				assert.Nil(t, payload)
+				if assert.IsType(t, &strategyJSON.PayloadValidationError{}, err) {
+					validationErr := err.(*strategyJSON.PayloadValidationError)
+					assert.Equal(t, "order_placed", validationErr.PayloadType)
+					assert.Equal(t, testCase.expectedField, validationErr.Field)
+					assert.EqualError(t, err, testCase.expectedError)
+				}
+			})
+		}
+	})
+
+	t.Run("redacted personal data is valid", func(t *testing.T) {
+		keyStore := inmemory.NewKeyStore()
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		transformer.WithSchemaValidation()
+		transformer.WithEncryption(keyStore)
+		require.NoError(t, transformer.RegisterPayload("customer_registered", func() interface{} {
+			return customerRegistered{}
+		}))
+
+		payloadType, data, err := transformer.ConvertPayload(newCustomerRegistered())
+		require.NoError(t, err)
+		require.NoError(t, keyStore.DeleteKey(context.Background(), "alice-id"))
+
+		_, err = transformer.CreatePayload(payloadType, data)
+		assert.NoError(t, err)
+	})
+}
@@ -2,6 +2,7 @@ package json
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"reflect"
@@ -18,12 +19,18 @@ var (
 	ErrPayloadCannotBeSerialized = errors.New("goengine: payload cannot be serialized")
 	// ErrPayloadNotRegistered occurs when the payload is not registered
 	ErrPayloadNotRegistered = errors.New("goengine: payload is not registered")
-	// ErrUnknownPayloadType occurs when a payload type is unknown
-	ErrUnknownPayloadType = errors.New("goengine: unknown payload type provided")
+	// ErrUnknownPayloadType occurs when a payload type is unknown, it is the shared goengine.ErrUnknownPayloadType
+	ErrUnknownPayloadType = goengine.ErrUnknownPayloadType
 	// ErrInitiatorInvalidResult occurs when a PayloadInitiator returns a reference to nil
 	ErrInitiatorInvalidResult = errors.New("goengine: initializer must return a pointer that is not nil")
 	// ErrDuplicatePayloadType occurs when a payload type is already registered
 	ErrDuplicatePayloadType = errors.New("goengine: payload type is already registered")
+	// ErrInvalidPayloadVersion occurs when a payload version of zero is provided
+	ErrInvalidPayloadVersion = errors.New("goengine: payload version must be greater than zero")
+	// ErrDuplicateUpcaster occurs when a upcaster is already registered for the payload type and version
+	ErrDuplicateUpcaster = errors.New("goengine: upcaster is already registered for the payload type and version")
+	// ErrUpcasterCycle occurs when the upcasters of a payload type result in a cycle
+	ErrUpcasterCycle = errors.New("goengine: upcasters of payload type contain a cycle")
 
 	// Ensure that PayloadTransformer satisfies the MessagePayloadFactory interface
 	_ goengine.MessagePayloadFactory = &PayloadTransformer{}
@@ -31,17 +38,52 @@ var (
 	_ goengine.MessagePayloadConverter = &PayloadTransformer{}
 	// Ensure that PayloadTransformer satisfies the MessagePayloadResolver interface
 	_ goengine.MessagePayloadResolver = &PayloadTransformer{}
+	// Ensure that PayloadTransformer satisfies the MessagePayloadVersionResolver interface
+	_ goengine.MessagePayloadVersionResolver = &PayloadTransformer{}
+	// Ensure that PayloadTransformer satisfies the VersionedMessagePayloadFactory interface
+	_ goengine.VersionedMessagePayloadFactory = &PayloadTransformer{}
+)
+
+const (
+	// UnknownPayloadFail indicates that reconstructing a payload of an unknown type results in ErrUnknownPayloadType
+	UnknownPayloadFail UnknownPayloadPolicy = iota
+	// UnknownPayloadSkip indicates that events with a payload of an unknown type are skipped.
+	// Since a payload can't be skipped the PayloadTransformer handles this as UnknownPayloadFail and it's up to the
+	// message factory to skip the event.
+	UnknownPayloadSkip UnknownPayloadPolicy = iota
+	// UnknownPayloadSurface indicates that a payload of an unknown type is reconstructed as a UnknownPayload
+	UnknownPayloadSurface UnknownPayloadPolicy = iota
 )
 
 type (
+	// UnknownPayloadPolicy determines how payloads of a unknown type are handled
+	UnknownPayloadPolicy int
+
+	// UnknownPayload is the payload of an event for which the payload type is unknown, for example because the type
+	// was removed. It contains the name of the payload type and the raw json data.
+	UnknownPayload struct {
+		Type string
+		Data json.RawMessage
+	}
+
 	// PayloadInitiator creates a new empty instance of a Payload
 	// this instance can then be used to Unmarshal
 	PayloadInitiator func() interface{}
 
+	// Upcaster transforms the json data of a payload into the data of the next version of the payload
+	Upcaster func(data []byte) ([]byte, error)
+
 	// PayloadTransformer is a payload factory that can reconstruct payload from and to JSON
 	PayloadTransformer struct {
-		types map[string]PayloadType
-		names map[string]string
+		types     map[string]PayloadType
+		names     map[string]string
+		aliases   map[string]string
+		versions  map[string]uint
+		upcasters map[payloadVersion]upcast
+
+		unknownPayloadPolicy UnknownPayloadPolicy
+		keyStore             goengine.KeyStore
+		validateSchema       bool
 	}
 
 	// PayloadType represents a payload and the way to create it
@@ -49,19 +91,59 @@ type (
 		initiator      PayloadInitiator
 		isPtr          bool
 		reflectionType reflect.Type
+		personalData   *personalData
+		schema         *Schema
+	}
+
+	// payloadVersion is a version of a payload type
+	payloadVersion struct {
+		payloadType string
+		version     uint
+	}
+
+	// upcast transforms a payload version into another payload version
+	upcast struct {
+		to       payloadVersion
+		upcaster Upcaster
 	}
 )
 
 // NewPayloadTransformer returns a new instance of the PayloadTransformer
 func NewPayloadTransformer() *PayloadTransformer {
 	return &PayloadTransformer{
-		types: map[string]PayloadType{},
-		names: map[string]string{},
+		types:     map[string]PayloadType{},
+		names:     map[string]string{},
+		aliases:   map[string]string{},
+		versions:  map[string]uint{},
+		upcasters: map[payloadVersion]upcast{},
 	}
 }
 
+// WithUnknownPayloadPolicy sets the UnknownPayloadPolicy used when reconstructing a payload of an unknown type
+func (p *PayloadTransformer) WithUnknownPayloadPolicy(policy UnknownPayloadPolicy) {
+	p.unknownPayloadPolicy = policy
+}
+
 // ConvertPayload marshall the payload into JSON returning the payload fullpkgPath and the serialized data.
+// A LazyPayload is loaded before it's converted.
 func (p *PayloadTransformer) ConvertPayload(payload interface{}) (string, []byte, error) {
+	return p.ConvertPayloadWithContext(context.Background(), payload)
+}
+
+// ConvertPayloadWithContext marshall the payload into JSON like ConvertPayload.
+// The context is used to load a LazyPayload and to get the keys used to encrypt personal data.
+func (p *PayloadTransformer) ConvertPayloadWithContext(ctx context.Context, payload interface{}) (string, []byte, error) {
+	switch v := payload.(type) {
+	case UnknownPayload:
+		return v.Type, v.Data, nil
+	case *LazyPayload:
+		loaded, err := v.Load(ctx)
+		if err != nil {
+			return "", nil, err
+		}
+		return p.ConvertPayloadWithContext(ctx, loaded)
+	}
+
 	payloadName, err := p.ResolveName(payload)
 	if err != nil {
 		return "", nil, err
@@ -72,11 +154,29 @@ func (p *PayloadTransformer) ConvertPayload(payload interface{}) (string, []byte
 		return "", nil, ErrPayloadCannotBeSerialized
 	}
 
+	if err := p.validate(payloadName, p.types[payloadName].schema, data); err != nil {
+		return "", nil, err
+	}
+
+	if pd := p.types[payloadName].personalData; pd != nil && p.keyStore != nil {
+		if data, err = p.encryptPersonalData(ctx, pd, payload, data); err != nil {
+			return "", nil, err
+		}
+	}
+
 	return payloadName, data, nil
 }
 
-// ResolveName returns the payloadType name of the provided payload
+// ResolveName returns the payloadType name of the provided payload.
+// An UnknownPayload or LazyPayload resolves to the name of it's payload type.
 func (p *PayloadTransformer) ResolveName(payload interface{}) (string, error) {
+	switch v := payload.(type) {
+	case UnknownPayload:
+		return v.Type, nil
+	case *LazyPayload:
+		return p.ResolveAlias(v.Type), nil
+	}
+
 	payloadName, ok := p.names[reflectUtil.FullTypeNameOf(payload)]
 	if !ok {
 		return "", ErrPayloadNotRegistered
@@ -87,7 +187,7 @@ func (p *PayloadTransformer) ResolveName(payload interface{}) (string, error) {
 
 // RegisterPayload registers a payload type and the way to initialize it with the factory
 func (p *PayloadTransformer) RegisterPayload(payloadType string, initiator PayloadInitiator) error {
-	if _, known := p.types[payloadType]; known {
+	if p.isRegistered(payloadType) {
 		return ErrDuplicatePayloadType
 	}
 
@@ -102,12 +202,19 @@ func (p *PayloadTransformer) RegisterPayload(payloadType string, initiator Paylo
 		return ErrInitiatorInvalidResult
 	}
 
+	pd, err := personalDataOf(rv.Type())
+	if err != nil {
+		return err
+	}
+
 	p.names[reflectUtil.FullTypeName(rv.Type())] = payloadType
 
 	p.types[payloadType] = PayloadType{
 		initiator:      initiator,
 		isPtr:          isPtr,
 		reflectionType: rv.Type(),
+		personalData:   pd,
+		schema:         payloadSchema(rv.Type(), pd),
 	}
 
 	return nil
@@ -124,24 +231,189 @@ func (p *PayloadTransformer) RegisterPayloads(payloads map[string]PayloadInitiat
 	return nil
 }
 
+// RegisterAlias registers an alias of a registered payload type.
+// Payloads stored under the alias, for example the name the payload type had before it was renamed, are reconstructed
+// as the payload type while new payloads are always converted under the name of the payload type.
+func (p *PayloadTransformer) RegisterAlias(alias string, payloadType string) error {
+	if _, known := p.types[payloadType]; !known {
+		return ErrUnknownPayloadType
+	}
+	if p.isRegistered(alias) {
+		return ErrDuplicatePayloadType
+	}
+
+	p.aliases[alias] = payloadType
+
+	return nil
+}
+
+// ResolveAlias returns the name of the payload type the alias belongs to or the name itself when it is not an alias
+func (p *PayloadTransformer) ResolveAlias(name string) string {
+	if payloadType, ok := p.aliases[name]; ok {
+		return payloadType
+	}
+
+	return name
+}
+
+// isRegistered returns true when the name is used by a payload type or an alias
+func (p *PayloadTransformer) isRegistered(name string) bool {
+	if _, known := p.types[name]; known {
+		return true
+	}
+	_, known := p.aliases[name]
+
+	return known
+}
+
+// RegisterUpcaster registers a upcaster that transforms the data of version fromVersion of the payload type into the
+// data of version fromVersion+1
+func (p *PayloadTransformer) RegisterUpcaster(payloadType string, fromVersion uint, upcaster Upcaster) error {
+	if upcaster == nil {
+		return goengine.InvalidArgumentError("upcaster")
+	}
+
+	return p.registerUpcast(
+		payloadVersion{payloadType, fromVersion},
+		payloadVersion{payloadType, fromVersion + 1},
+		upcaster,
+	)
+}
+
+// RegisterRenameUpcaster registers a upcaster that transforms the data of version fromVersion of the payload type into
+// the data of version toVersion of a renamed payload type. A nil upcaster keeps the data as is.
+func (p *PayloadTransformer) RegisterRenameUpcaster(
+	payloadType string,
+	fromVersion uint,
+	toPayloadType string,
+	toVersion uint,
+	upcaster Upcaster,
+) error {
+	if payloadType == toPayloadType {
+		return goengine.InvalidArgumentError("toPayloadType")
+	}
+
+	return p.registerUpcast(
+		payloadVersion{payloadType, fromVersion},
+		payloadVersion{toPayloadType, toVersion},
+		upcaster,
+	)
+}
+
+func (p *PayloadTransformer) registerUpcast(from payloadVersion, to payloadVersion, upcaster Upcaster) error {
+	if from.version == 0 || to.version == 0 {
+		return ErrInvalidPayloadVersion
+	}
+	if _, known := p.upcasters[from]; known {
+		return ErrDuplicateUpcaster
+	}
+
+	p.upcasters[from] = upcast{to: to, upcaster: upcaster}
+	if p.versions[to.payloadType] < to.version {
+		p.versions[to.payloadType] = to.version
+	}
+
+	return nil
+}
+
+// ResolveVersion returns the current version of the payload type, which is 1 unless upcasters are registered
+func (p *PayloadTransformer) ResolveVersion(payloadType string) uint {
+	if version, ok := p.versions[payloadType]; ok {
+		return version
+	}
+
+	return 1
+}
+
 // CreatePayload reconstructs a payload based on it's type and the json data
 func (p *PayloadTransformer) CreatePayload(typeName string, data interface{}) (interface{}, error) {
-	var dataBytes []byte
-	switch d := data.(type) {
-	case []byte:
-		dataBytes = d
-	case json.RawMessage:
-		dataBytes = d
-	case string:
-		dataBytes = bytes.NewBufferString(d).Bytes()
-	default:
-		return nil, ErrUnsupportedJSONPayloadData
+	return p.CreatePayloadWithContext(context.Background(), typeName, data)
+}
+
+// CreatePayloadWithContext reconstructs a payload like CreatePayload.
+// The context is used to get the keys used to decrypt personal data.
+func (p *PayloadTransformer) CreatePayloadWithContext(ctx context.Context, typeName string, data interface{}) (interface{}, error) {
+	dataBytes, err := p.decryptedPayloadData(ctx, typeName, typeName, data)
+	if err != nil {
+		return nil, err
 	}
 
-	payloadType, found := p.types[typeName]
+	return p.createPayload(typeName, dataBytes)
+}
+
+// CreateVersionedPayload upcasts the json data to the current version of the payload type and reconstructs the payload.
+// A version of zero is handled as version 1 since it indicates the data was stored without a version.
+// The upcasters registered for an alias are applied before the upcasters of the payload type of the alias.
+func (p *PayloadTransformer) CreateVersionedPayload(typeName string, version uint, data interface{}) (interface{}, error) {
+	return p.CreateVersionedPayloadWithContext(context.Background(), typeName, version, data)
+}
+
+// CreateVersionedPayloadWithContext upcasts and reconstructs a payload like CreateVersionedPayload.
+// The context is used to get the keys used to decrypt personal data.
+func (p *PayloadTransformer) CreateVersionedPayloadWithContext(
+	ctx context.Context,
+	typeName string,
+	version uint,
+	data interface{},
+) (interface{}, error) {
+	if version == 0 {
+		version = 1
+	}
+
+	var upcasters []Upcaster
+	current := payloadVersion{typeName, version}
+	for {
+		up, found := p.upcasters[current]
+		if !found {
+			// An alias always resolves to a payload type that is not an alias so this can't result in a cycle
+			payloadType, isAlias := p.aliases[current.payloadType]
+			if !isAlias {
+				break
+			}
+			current.payloadType = payloadType
+			continue
+		}
+		if len(upcasters) == len(p.upcasters) {
+			return nil, ErrUpcasterCycle
+		}
+
+		upcasters = append(upcasters, up.upcaster)
+		current = up.to
+	}
+
+	// The personal data is decrypted before upcasting since the upcasters expect the stored data
+	dataBytes, err := p.decryptedPayloadData(ctx, typeName, current.payloadType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, upcaster := range upcasters {
+		if upcaster == nil {
+			continue
+		}
+
+		if dataBytes, err = upcaster(dataBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.createPayload(current.payloadType, dataBytes)
+}
+
+func (p *PayloadTransformer) createPayload(typeName string, dataBytes []byte) (interface{}, error) {
+	name := p.ResolveAlias(typeName)
+	payloadType, found := p.types[name]
 	if !found {
+		if p.unknownPayloadPolicy == UnknownPayloadSurface {
+			return UnknownPayload{Type: typeName, Data: dataBytes}, nil
+		}
+
 		return nil, ErrUnknownPayloadType
 	}
+	if err := p.validate(name, payloadType.schema, dataBytes); err != nil {
+		return nil, err
+	}
+
 	payload := payloadType.initiator()
 
 	// Pointer we can handle nicely
@@ -160,3 +432,36 @@ func (p *PayloadTransformer) CreatePayload(typeName string, data interface{}) (i
 
 	return vp.Elem().Interface(), nil
 }
+
+// decryptedPayloadData returns the json data with the personal data of the stored payload type decrypted.
+// When the stored payload type is no longer registered, because it was renamed, the personal data of the current
+// payload type is used.
+func (p *PayloadTransformer) decryptedPayloadData(ctx context.Context, storedType string, currentType string, data interface{}) ([]byte, error) {
+	dataBytes, err := payloadData(data)
+	if err != nil {
+		return nil, err
+	}
+
+	payloadType, found := p.types[p.ResolveAlias(storedType)]
+	if !found {
+		payloadType, found = p.types[p.ResolveAlias(currentType)]
+	}
+	if !found || payloadType.personalData == nil {
+		return dataBytes, nil
+	}
+
+	return p.decryptPersonalData(ctx, payloadType.personalData, dataBytes)
+}
+
+func payloadData(data interface{}) ([]byte, error) {
+	switch d := data.(type) {
+	case []byte:
+		return d, nil
+	case json.RawMessage:
+		return d, nil
+	case string:
+		return bytes.NewBufferString(d).Bytes(), nil
+	default:
+		return nil, ErrUnsupportedJSONPayloadData
+	}
+}
@@ -3,9 +3,13 @@
 package json_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 
+	"github.com/hellofresh/goengine"
 	anotherpayload "github.com/hellofresh/goengine/internal/mocks/another/payload"
 	"github.com/hellofresh/goengine/internal/mocks/payload"
 	strategyJSON "github.com/hellofresh/goengine/strategy/json"
@@ -331,3 +335,232 @@ func TestPayloadTransformer_RegisterMultiplePayloads(t *testing.T) {
 		})
 	})
 }
+
+func TestPayloadTransformer_CreateVersionedPayload(t *testing.T) {
+	type accountOpened struct {
+		Owner   string `json:"owner"`
+		Balance int    `json:"balance"`
+	}
+
+	newTransformer := func(t *testing.T) *strategyJSON.PayloadTransformer {
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("account_opened", func() interface{} {
+			return accountOpened{}
+		}))
+
+		// Version 1 was named "account_created" and had a "name" instead of an "owner"
+		require.NoError(t, transformer.RegisterRenameUpcaster("account_created", 1, "account_opened", 2, func(data []byte) ([]byte, error) {
+			return bytes.Replace(data, []byte(`"name"`), []byte(`"owner"`), 1), nil
+		}))
+		// Version 3 introduced the balance
+		require.NoError(t, transformer.RegisterUpcaster("account_opened", 2, func(data []byte) ([]byte, error) {
+			return append(data[:len(data)-1], []byte(`,"balance":100}`)...), nil
+		}))
+
+		return transformer
+	}
+
+	t.Run("resolve version", func(t *testing.T) {
+		transformer := newTransformer(t)
+
+		assert.Equal(t, uint(3), transformer.ResolveVersion("account_opened"))
+		assert.Equal(t, uint(1), transformer.ResolveVersion("unknown"))
+	})
+
+	testCases := []struct {
+		title       string
+		payloadType string
+		version     uint
+		data        string
+	}{
+		{"upcast renamed payload", "account_created", 1, `{"name":"John"}`},
+		{"upcast payload", "account_opened", 2, `{"owner":"John"}`},
+		{"current payload", "account_opened", 3, `{"owner":"John","balance":100}`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.title, func(t *testing.T) {
+			transformer := newTransformer(t)
+
+			res, err := transformer.CreateVersionedPayload(testCase.payloadType, testCase.version, testCase.data)
+
+			assert.NoError(t, err)
+			assert.Equal(t, accountOpened{Owner: "John", Balance: 100}, res)
+		})
+	}
+
+	t.Run("unversioned payload", func(t *testing.T) {
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("account_opened", func() interface{} {
+			return accountOpened{}
+		}))
+
+		res, err := transformer.CreateVersionedPayload("account_opened", 0, `{"owner":"John"}`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, accountOpened{Owner: "John"}, res)
+	})
+
+	t.Run("upcaster failure", func(t *testing.T) {
+		transformer := strategyJSON.NewPayloadTransformer()
+		upcastErr := errors.New("upcast failed")
+		require.NoError(t, transformer.RegisterUpcaster("account_opened", 1, func([]byte) ([]byte, error) {
+			return nil, upcastErr
+		}))
+
+		res, err := transformer.CreateVersionedPayload("account_opened", 1, `{}`)
+
+		assert.Equal(t, upcastErr, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("upcaster cycle", func(t *testing.T) {
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterRenameUpcaster("a", 1, "b", 1, nil))
+		require.NoError(t, transformer.RegisterRenameUpcaster("b", 1, "a", 1, nil))
+
+		res, err := transformer.CreateVersionedPayload("a", 1, `{}`)
+
+		assert.Equal(t, strategyJSON.ErrUpcasterCycle, err)
+		assert.Nil(t, res)
+	})
+}
+
+func TestPayloadTransformer_RegisterUpcaster(t *testing.T) {
+	upcaster := func(data []byte) ([]byte, error) {
+		return data, nil
+	}
+
+	transformer := strategyJSON.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterUpcaster("account_opened", 1, upcaster))
+
+	assert.Equal(t, strategyJSON.ErrDuplicateUpcaster, transformer.RegisterUpcaster("account_opened", 1, upcaster))
+	assert.Equal(t, strategyJSON.ErrInvalidPayloadVersion, transformer.RegisterUpcaster("account_opened", 0, upcaster))
+	assert.Equal(t, strategyJSON.ErrInvalidPayloadVersion, transformer.RegisterRenameUpcaster("account_created", 1, "account_opened", 0, nil))
+	assert.Equal(t, goengine.InvalidArgumentError("upcaster"), transformer.RegisterUpcaster("account_opened", 2, nil))
+	assert.Equal(t, goengine.InvalidArgumentError("toPayloadType"), transformer.RegisterRenameUpcaster("account_opened", 2, "account_opened", 3, nil))
+}
+
+func TestPayloadTransformer_UnknownPayloadPolicy(t *testing.T) {
+	t.Run("fail by default", func(t *testing.T) {
+		transformer := strategyJSON.NewPayloadTransformer()
+
+		res, err := transformer.CreatePayload("account_closed", `{"reason":"fraud"}`)
+
+		assert.Equal(t, strategyJSON.ErrUnknownPayloadType, err)
+		assert.Nil(t, res)
+	})
+
+	t.Run("surface unknown payloads", func(t *testing.T) {
+		asserts := assert.New(t)
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		transformer.WithUnknownPayloadPolicy(strategyJSON.UnknownPayloadSurface)
+
+		res, err := transformer.CreatePayload("account_closed", `{"reason":"fraud"}`)
+
+		asserts.NoError(err)
+		asserts.Equal(strategyJSON.UnknownPayload{Type: "account_closed", Data: json.RawMessage(`{"reason":"fraud"}`)}, res)
+
+		name, err := transformer.ResolveName(res)
+		asserts.NoError(err)
+		asserts.Equal("account_closed", name)
+
+		name, data, err := transformer.ConvertPayload(res)
+		asserts.NoError(err)
+		asserts.Equal("account_closed", name)
+		asserts.Equal([]byte(`{"reason":"fraud"}`), data)
+	})
+}
+
+func TestPayloadTransformer_RegisterAlias(t *testing.T) {
+	type accountOpened struct {
+		Owner   string `json:"owner"`
+		Balance int    `json:"balance"`
+	}
+
+	newTransformer := func(t *testing.T) *strategyJSON.PayloadTransformer {
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("account_opened", func() interface{} {
+			return accountOpened{}
+		}))
+		require.NoError(t, transformer.RegisterAlias("account_created", "account_opened"))
+
+		return transformer
+	}
+
+	t.Run("create payload stored under an alias", func(t *testing.T) {
+		asserts := assert.New(t)
+		transformer := newTransformer(t)
+
+		res, err := transformer.CreatePayload("account_created", `{"owner":"John","balance":100}`)
+		asserts.NoError(err)
+		asserts.Equal(accountOpened{Owner: "John", Balance: 100}, res)
+
+		name, err := transformer.ResolveName(res)
+		asserts.NoError(err)
+		asserts.Equal("account_opened", name)
+
+		asserts.Equal("account_opened", transformer.ResolveAlias("account_created"))
+		asserts.Equal("account_opened", transformer.ResolveAlias("account_opened"))
+	})
+
+	t.Run("upcast payload stored under an alias", func(t *testing.T) {
+		transformer := newTransformer(t)
+		require.NoError(t, transformer.RegisterUpcaster("account_created", 1, func(data []byte) ([]byte, error) {
+			return bytes.Replace(data, []byte(`"name"`), []byte(`"owner"`), 1), nil
+		}))
+		require.NoError(t, transformer.RegisterUpcaster("account_opened", 2, func(data []byte) ([]byte, error) {
+			return bytes.Replace(data, []byte(`"amount"`), []byte(`"balance"`), 1), nil
+		}))
+
+		res, err := transformer.CreateVersionedPayload("account_created", 1, `{"name":"John","amount":100}`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, accountOpened{Owner: "John", Balance: 100}, res)
+	})
+
+	t.Run("invalid aliases", func(t *testing.T) {
+		transformer := newTransformer(t)
+
+		assert.Equal(t, strategyJSON.ErrUnknownPayloadType, transformer.RegisterAlias("account_made", "account_closed"))
+		assert.Equal(t, strategyJSON.ErrDuplicatePayloadType, transformer.RegisterAlias("account_created", "account_opened"))
+		assert.Equal(t, strategyJSON.ErrDuplicatePayloadType, transformer.RegisterAlias("account_opened", "account_opened"))
+		assert.Equal(t, strategyJSON.ErrDuplicatePayloadType, transformer.RegisterPayload("account_created", func() interface{} {
+			return simpleType{}
+		}))
+	})
+}
+
+func TestPayloadTransformer_LazyPayload(t *testing.T) {
+	transformer := strategyJSON.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayload("simple", func() interface{} {
+		return simpleType{}
+	}))
+	require.NoError(t, transformer.RegisterAlias("simple_created", "simple"))
+
+	lazy := strategyJSON.NewLazyPayload("simple_created", "ref", func(ctx context.Context) (interface{}, error) {
+		return transformer.CreatePayload("simple_created", `{"Test":"lazy","Order":1}`)
+	})
+
+	asserts := assert.New(t)
+
+	name, err := transformer.ResolveName(lazy)
+	asserts.NoError(err)
+	asserts.Equal("simple", name)
+
+	name, data, err := transformer.ConvertPayload(lazy)
+	asserts.NoError(err)
+	asserts.Equal("simple", name)
+	asserts.JSONEq(`{"Test":"lazy","Order":1}`, string(data))
+
+	t.Run("load failure", func(t *testing.T) {
+		loadErr := errors.New("blob not found")
+		lazy := strategyJSON.NewLazyPayload("simple", "ref", func(ctx context.Context) (interface{}, error) {
+			return nil, loadErr
+		})
+
+		_, _, err := transformer.ConvertPayload(lazy)
+		assert.Equal(t, loadErr, err)
+	})
+}
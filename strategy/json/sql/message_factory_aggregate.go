@@ -1,7 +1,9 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,15 +11,36 @@ import (
 	"github.com/hellofresh/goengine/aggregate"
 	driverSQL "github.com/hellofresh/goengine/driver/sql"
 	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/strategy/json"
 )
 
-// Ensure that AggregateChangedFactory satisfies the MessageFactory interface
-var _ driverSQL.MessageFactory = &AggregateChangedFactory{}
+var (
+	// ErrBlobStoreRequired occurs when a payload is stored in a blob store but the factory has no blob store
+	ErrBlobStoreRequired = errors.New("goengine: payload is stored in a blob store but no blob store is configured")
 
-// AggregateChangedFactory reconstructs aggregate.Changed messages
-type AggregateChangedFactory struct {
-	payloadFactory goengine.MessagePayloadFactory
-}
+	// Ensure that AggregateChangedFactory satisfies the ContextMessageFactory interface
+	_ driverSQL.ContextMessageFactory = &AggregateChangedFactory{}
+)
+
+type (
+	// AggregateChangedFactory reconstructs aggregate.Changed messages
+	AggregateChangedFactory struct {
+		payloadFactory goengine.MessagePayloadFactory
+
+		unknownPayloadPolicy  json.UnknownPayloadPolicy
+		unknownPayloadMetrics UnknownPayloadMetrics
+		logger                goengine.Logger
+
+		blobStore        goengine.BlobStore
+		claimCheckPolicy json.ClaimCheckPolicy
+	}
+
+	// UnknownPayloadMetrics is used to keep count of the events with a payload of an unknown type
+	UnknownPayloadMetrics interface {
+		// UnknownPayload is called for every event with a payload of an unknown type that is skipped or surfaced
+		UnknownPayload(eventName string, skipped bool)
+	}
+)
 
 // NewAggregateChangedFactory returns a new instance of an AggregateChangedFactory
 func NewAggregateChangedFactory(factory goengine.MessagePayloadFactory) (*AggregateChangedFactory, error) {
@@ -26,19 +49,47 @@ func NewAggregateChangedFactory(factory goengine.MessagePayloadFactory) (*Aggreg
 	}
 
 	return &AggregateChangedFactory{
-		factory,
+		payloadFactory: factory,
+		logger:         goengine.NopLogger,
 	}, nil
 }
 
+// WithUnknownPayloadPolicy sets the json.UnknownPayloadPolicy used for events with a payload of an unknown type.
+// Skipped and surfaced events are logged and counted using the optional logger and metrics.
+func (f *AggregateChangedFactory) WithUnknownPayloadPolicy(policy json.UnknownPayloadPolicy, logger goengine.Logger, metrics UnknownPayloadMetrics) {
+	if logger == nil {
+		logger = goengine.NopLogger
+	}
+
+	f.unknownPayloadPolicy = policy
+	f.unknownPayloadMetrics = metrics
+	f.logger = logger
+}
+
+// WithClaimCheck sets the goengine.BlobStore used to load the payloads that are stored in a blob store and the
+// json.ClaimCheckPolicy determining when the payloads are loaded
+func (f *AggregateChangedFactory) WithClaimCheck(blobStore goengine.BlobStore, policy json.ClaimCheckPolicy) {
+	f.blobStore = blobStore
+	f.claimCheckPolicy = policy
+}
+
 // CreateEventStream reconstruct the aggregate.Changed messages from the sql.Rows
 func (f *AggregateChangedFactory) CreateEventStream(rows *sql.Rows) (goengine.EventStream, error) {
+	return f.CreateEventStreamWithContext(context.Background(), rows)
+}
+
+// CreateEventStreamWithContext reconstruct the aggregate.Changed messages from the sql.Rows.
+// The context is used to load the payloads that are stored in a blob store when they are loaded eagerly and to
+// reconstruct the payloads.
+func (f *AggregateChangedFactory) CreateEventStreamWithContext(ctx context.Context, rows *sql.Rows) (goengine.EventStream, error) {
 	if rows == nil {
 		return nil, goengine.InvalidArgumentError("rows")
 	}
 
 	return &aggregateChangedEventStream{
-		payloadFactory: f.payloadFactory,
-		rows:           rows,
+		ctx:     ctx,
+		factory: f,
+		rows:    rows,
 	}, nil
 }
 
@@ -46,12 +97,25 @@ func (f *AggregateChangedFactory) CreateEventStream(rows *sql.Rows) (goengine.Ev
 var _ goengine.EventStream = &aggregateChangedEventStream{}
 
 type aggregateChangedEventStream struct {
-	payloadFactory goengine.MessagePayloadFactory
-	rows           *sql.Rows
+	ctx     context.Context
+	factory *AggregateChangedFactory
+	rows    *sql.Rows
+
+	message     goengine.Message
+	eventNumber int64
+	err         error
 }
 
 func (a *aggregateChangedEventStream) Next() bool {
-	return a.rows.Next()
+	for a.rows.Next() {
+		var skipped bool
+		a.message, a.eventNumber, skipped, a.err = a.readMessage()
+		if !skipped {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (a *aggregateChangedEventStream) Err() error {
@@ -63,6 +127,15 @@ func (a *aggregateChangedEventStream) Close() error {
 }
 
 func (a *aggregateChangedEventStream) Message() (goengine.Message, int64, error) {
+	if a.err != nil {
+		return nil, 0, a.err
+	}
+
+	return a.message, a.eventNumber, nil
+}
+
+// readMessage reconstructs the message of the current row or indicates that the message was skipped
+func (a *aggregateChangedEventStream) readMessage() (goengine.Message, int64, bool, error) {
 	var (
 		eventNumber  int64
 		eventID      goengine.UUID
@@ -74,30 +147,83 @@ func (a *aggregateChangedEventStream) Message() (goengine.Message, int64, error)
 
 	err := a.rows.Scan(&eventNumber, &eventID, &eventName, &jsonPayload, &jsonMetadata, &createdAt)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, false, err
 	}
 
 	meta, err := metadata.UnmarshalJSON(jsonMetadata)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, false, err
 	}
 
-	payload, err := a.payloadFactory.CreatePayload(eventName, jsonPayload)
+	f := a.factory
+	reference, err := claimCheckReference(meta)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, false, err
+	}
+	if reference != "" {
+		if f.blobStore == nil {
+			return nil, 0, false, ErrBlobStoreRequired
+		}
+
+		if f.claimCheckPolicy == json.ClaimCheckLazy {
+			payload := json.NewLazyPayload(eventName, reference, func(ctx context.Context) (interface{}, error) {
+				data, err := f.blobStore.Get(ctx, reference)
+				if err != nil {
+					return nil, err
+				}
+				if data, err = decodePayload(data, meta); err != nil {
+					return nil, err
+				}
+
+				return goengine.CreateMessagePayloadWithContext(ctx, f.payloadFactory, eventName, data, meta)
+			})
+
+			aggr, err := reconstituteChange(eventID, payload, meta, createdAt)
+			return aggr, eventNumber, false, err
+		}
+
+		if jsonPayload, err = f.blobStore.Get(a.ctx, reference); err != nil {
+			return nil, 0, false, err
+		}
 	}
 
+	jsonPayload, err = decodePayload(jsonPayload, meta)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	payload, err := goengine.CreateMessagePayloadWithContext(a.ctx, f.payloadFactory, eventName, jsonPayload, meta)
+	if goengine.IsUnknownPayloadType(err) && f.unknownPayloadPolicy != json.UnknownPayloadFail {
+		if f.unknownPayloadPolicy == json.UnknownPayloadSkip {
+			f.reportUnknownPayload(eventName, eventNumber, true)
+			return nil, 0, true, nil
+		}
+
+		payload, err = json.UnknownPayload{Type: eventName, Data: jsonPayload}, nil
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if _, unknown := payload.(json.UnknownPayload); unknown {
+		f.reportUnknownPayload(eventName, eventNumber, false)
+	}
+
+	aggr, err := reconstituteChange(eventID, payload, meta, createdAt)
+	return aggr, eventNumber, false, err
+}
+
+func reconstituteChange(eventID goengine.UUID, payload interface{}, meta metadata.Metadata, createdAt time.Time) (*aggregate.Changed, error) {
 	aggregateID, err := aggregateIDFromMetadata(meta)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
 	aggregateVersion, err := aggregateVersionFromMetadata(meta)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 
-	aggr, err := aggregate.ReconstituteChange(
+	return aggregate.ReconstituteChange(
 		aggregateID,
 		eventID,
 		payload,
@@ -105,8 +231,47 @@ func (a *aggregateChangedEventStream) Message() (goengine.Message, int64, error)
 		createdAt,
 		aggregateVersion,
 	)
+}
+
+func (f *AggregateChangedFactory) reportUnknownPayload(eventName string, eventNumber int64, skipped bool) {
+	msg := "surfacing event with unknown payload type"
+	if skipped {
+		msg = "skipping event with unknown payload type"
+	}
 
-	return aggr, eventNumber, err
+	f.logger.Warn(msg, func(e goengine.LoggerEntry) {
+		e.String("event_name", eventName)
+		e.Int64("event_number", eventNumber)
+	})
+
+	if f.unknownPayloadMetrics != nil {
+		f.unknownPayloadMetrics.UnknownPayload(eventName, skipped)
+	}
+}
+
+// decodePayload decodes the payload into json when the payload was stored using a json.PayloadCodec
+func decodePayload(payload []byte, meta metadata.Metadata) ([]byte, error) {
+	switch val := meta.Value(json.PayloadCodecKey).(type) {
+	case nil:
+		return payload, nil
+	case string:
+		return json.DecodePayload(val, payload)
+	default:
+		return nil, &InvalidMetadataValueTypeError{key: json.PayloadCodecKey, value: val, expected: "string"}
+	}
+}
+
+// claimCheckReference returns the reference of the payload in the blob store or an empty string when the payload is
+// not stored in a blob store
+func claimCheckReference(meta metadata.Metadata) (string, error) {
+	switch val := meta.Value(goengine.PayloadClaimCheckKey).(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	default:
+		return "", &InvalidMetadataValueTypeError{key: goengine.PayloadClaimCheckKey, value: val, expected: "string"}
+	}
 }
 
 func aggregateIDFromMetadata(meta metadata.Metadata) (aggregate.ID, error) {
@@ -124,21 +289,22 @@ func aggregateIDFromMetadata(meta metadata.Metadata) (aggregate.ID, error) {
 }
 
 func aggregateVersionFromMetadata(meta metadata.Metadata) (uint, error) {
-	val := meta.Value(aggregate.VersionKey)
-	if val == nil {
+	version, err := metadata.Int64(meta, aggregate.VersionKey)
+	switch err := err.(type) {
+	case nil:
+	case metadata.MissingValueError:
 		return 0, MissingMetadataError(aggregate.VersionKey)
+	case *metadata.InvalidValueTypeError:
+		return 0, &InvalidMetadataValueTypeError{key: aggregate.VersionKey, value: err.Value, expected: "float64"}
+	default:
+		return 0, err
 	}
 
-	float, ok := val.(float64)
-	if !ok {
-		return 0, &InvalidMetadataValueTypeError{key: aggregate.VersionKey, value: val, expected: "float64"}
-	}
-
-	if float <= 0 {
+	if version <= 0 {
 		return 0, aggregate.ErrInvalidChangeVersion
 	}
 
-	return uint(float), nil
+	return uint(version), nil
 }
 
 // MissingMetadataError is an error indicating the requested metadata was nil.
@@ -3,7 +3,10 @@
 package sql_test
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,10 +14,16 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/hellofresh/goengine"
 	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	goengineLogger "github.com/hellofresh/goengine/extension/logrus"
 	"github.com/hellofresh/goengine/metadata"
 	"github.com/hellofresh/goengine/mocks"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
 	"github.com/hellofresh/goengine/strategy/json/internal"
 	"github.com/hellofresh/goengine/strategy/json/sql"
+	"github.com/hellofresh/goengine/strategy/protobuf"
+	pkgErrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +32,26 @@ type nameChanged struct {
 	name string
 }
 
+type unknownPayloadMetrics struct {
+	eventNames []string
+}
+
+func (m *unknownPayloadMetrics) UnknownPayload(eventName string, skipped bool) {
+	m.eventNames = append(m.eventNames, eventName)
+}
+
+// contextBlobStore records the context used to load the payloads
+type contextBlobStore struct {
+	*inmemory.BlobStore
+
+	ctx context.Context
+}
+
+func (s *contextBlobStore) Get(ctx context.Context, reference string) ([]byte, error) {
+	s.ctx = ctx
+	return s.BlobStore.Get(ctx, reference)
+}
+
 func TestAggregateChangedFactory_CreateFromRows(t *testing.T) {
 	rowColumns := []string{"no", "event_id", "event_name", "payload", "metadata", "created_at"}
 
@@ -116,6 +145,384 @@ func TestAggregateChangedFactory_CreateFromRows(t *testing.T) {
 		}
 	})
 
+	t.Run("upcast versioned payloads", func(t *testing.T) {
+		type nameSet struct {
+			FullName string `json:"full_name"`
+		}
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("name_set", func() interface{} {
+			return nameSet{}
+		}))
+		require.NoError(t, transformer.RegisterRenameUpcaster("name_changed", 1, "name_set", 2, func(data []byte) ([]byte, error) {
+			return bytes.Replace(data, []byte(`"name"`), []byte(`"full_name"`), 1), nil
+		}))
+
+		mockRows := sqlmock.NewRows(rowColumns)
+		for i, rowMetadata := range []string{
+			`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 1}`,
+			`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 2, "_payload_version": 1}`,
+		} {
+			uuid, _ := goengine.GenerateUUID().MarshalBinary()
+			mockRows.AddRow(i+1, uuid, "name_changed", []byte(`{"name":"alice"}`), []byte(rowMetadata), time.Now().UTC())
+		}
+		uuid, _ := goengine.GenerateUUID().MarshalBinary()
+		mockRows.AddRow(
+			3,
+			uuid,
+			"name_set",
+			[]byte(`{"full_name":"bob"}`),
+			[]byte(`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 3, "_payload_version": 2}`),
+			time.Now().UTC(),
+		)
+
+		db, dbMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+		rows, err := db.Query("SELECT")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		messageFactory, err := sql.NewAggregateChangedFactory(transformer)
+		require.NoError(t, err)
+
+		stream, err := messageFactory.CreateEventStream(rows)
+		require.NoError(t, err)
+		defer stream.Close()
+
+		messages, _, err := goengine.ReadEventStream(stream)
+		require.NoError(t, err)
+		require.Len(t, messages, 3)
+
+		assert.Equal(t, nameSet{FullName: "alice"}, messages[0].Payload())
+		assert.Equal(t, nameSet{FullName: "alice"}, messages[1].Payload())
+		assert.Equal(t, nameSet{FullName: "bob"}, messages[2].Payload())
+	})
+
+	t.Run("decode payloads stored using a codec", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		codecs := []struct {
+			name        string
+			encoding    strategyJSON.PayloadEncoding
+			compression strategyJSON.PayloadCompression
+		}{
+			{"msgpack", strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionNone},
+			{"json+gzip", strategyJSON.PayloadEncodingJSON, strategyJSON.PayloadCompressionGzip},
+			{"msgpack+gzip", strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionGzip},
+		}
+
+		payload := []byte(`{"name":"` + strings.Repeat("alice", 20) + `"}`)
+		mockRows := sqlmock.NewRows(rowColumns)
+
+		// An event stored without a codec
+		uuid, _ := goengine.GenerateUUID().MarshalBinary()
+		mockRows.AddRow(1, uuid, "name_changed", payload, []byte(`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 1}`), time.Now().UTC())
+
+		for i, c := range codecs {
+			codec, err := strategyJSON.NewPayloadCodec(c.encoding, c.compression, 0)
+			require.NoError(t, err)
+
+			codecName, rowPayload, err := codec.EncodePayload(payload)
+			require.NoError(t, err)
+			require.Equal(t, c.name, codecName)
+
+			uuid, _ := goengine.GenerateUUID().MarshalBinary()
+			rowMetadata := `{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 1, "_payload_codec": "` + codecName + `"}`
+			mockRows.AddRow(i+2, uuid, "name_changed", rowPayload, []byte(rowMetadata), time.Now().UTC())
+		}
+
+		payloadFactory := mocks.NewMessagePayloadFactory(ctrl)
+		payloadFactory.EXPECT().CreatePayload("name_changed", payload).Return(nameChanged{"alice"}, nil).Times(4)
+
+		db, dbMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+		rows, err := db.Query("SELECT")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		messageFactory, err := sql.NewAggregateChangedFactory(payloadFactory)
+		require.NoError(t, err)
+
+		stream, err := messageFactory.CreateEventStream(rows)
+		require.NoError(t, err)
+		defer stream.Close()
+
+		messages, _, err := goengine.ReadEventStream(stream)
+		require.NoError(t, err)
+		assert.Len(t, messages, 4)
+	})
+
+	t.Run("reconstruct messages with typed metadata", func(t *testing.T) {
+		type nameSet struct {
+			FullName string `json:"full_name"`
+		}
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("name_set", func() interface{} {
+			return nameSet{}
+		}))
+		require.NoError(t, transformer.RegisterUpcaster("name_set", 1, func(data []byte) ([]byte, error) {
+			return nil, errors.New("version 2 must not be upcasted")
+		}))
+
+		meta := metadata.FromMap(map[string]interface{}{
+			"_aggregate_id":      "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8",
+			"_aggregate_version": uint(3),
+			"_payload_version":   uint(2),
+		})
+		rowMetadata, err := metadata.MarshalTypedJSON(meta)
+		require.NoError(t, err)
+
+		uuid, _ := goengine.GenerateUUID().MarshalBinary()
+		mockRows := sqlmock.NewRows(rowColumns)
+		mockRows.AddRow(1, uuid, "name_set", []byte(`{"full_name":"alice"}`), rowMetadata, time.Now().UTC())
+
+		db, dbMock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+
+		dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+		rows, err := db.Query("SELECT")
+		require.NoError(t, err)
+		defer rows.Close()
+
+		messageFactory, err := sql.NewAggregateChangedFactory(transformer)
+		require.NoError(t, err)
+
+		stream, err := messageFactory.CreateEventStream(rows)
+		require.NoError(t, err)
+		defer stream.Close()
+
+		messages, _, err := goengine.ReadEventStream(stream)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+
+		asserts := assert.New(t)
+		asserts.Equal(nameSet{FullName: "alice"}, messages[0].Payload())
+		asserts.Equal(uint(3), messages[0].(*aggregate.Changed).Version())
+		asserts.Equal(uint64(3), messages[0].Metadata().Value("_aggregate_version"))
+	})
+
+	t.Run("load payloads stored in a blob store", func(t *testing.T) {
+		payload := []byte(`{"name":"alice"}`)
+		blobStore := inmemory.NewBlobStore()
+		reference, err := blobStore.Put(context.Background(), payload)
+		require.NoError(t, err)
+
+		readMessages := func(t *testing.T, ctx context.Context, factory goengine.MessagePayloadFactory, configure func(*sql.AggregateChangedFactory)) ([]goengine.Message, error) {
+			uuid, _ := goengine.GenerateUUID().MarshalBinary()
+			rowMetadata := `{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 1, "_payload_claim_check": "` + reference + `"}`
+			mockRows := sqlmock.NewRows(rowColumns)
+			mockRows.AddRow(1, uuid, "name_changed", []byte("null"), []byte(rowMetadata), time.Now().UTC())
+
+			db, dbMock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer db.Close()
+
+			dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+			rows, err := db.Query("SELECT")
+			require.NoError(t, err)
+			defer rows.Close()
+
+			messageFactory, err := sql.NewAggregateChangedFactory(factory)
+			require.NoError(t, err)
+			configure(messageFactory)
+
+			stream, err := messageFactory.CreateEventStreamWithContext(ctx, rows)
+			require.NoError(t, err)
+			defer stream.Close()
+
+			messages, _, err := goengine.ReadEventStream(stream)
+			return messages, err
+		}
+
+		t.Run("eager", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			payloadFactory := mocks.NewMessagePayloadFactory(ctrl)
+			payloadFactory.EXPECT().CreatePayload("name_changed", payload).Return(nameChanged{"alice"}, nil)
+
+			messages, err := readMessages(t, context.Background(), payloadFactory, func(f *sql.AggregateChangedFactory) {
+				f.WithClaimCheck(blobStore, strategyJSON.ClaimCheckEager)
+			})
+
+			require.NoError(t, err)
+			require.Len(t, messages, 1)
+			assert.Equal(t, nameChanged{"alice"}, messages[0].Payload())
+		})
+
+		t.Run("eager using the context of the caller", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			payloadFactory := mocks.NewMessagePayloadFactory(ctrl)
+			payloadFactory.EXPECT().CreatePayload("name_changed", payload).Return(nameChanged{"alice"}, nil)
+
+			type ctxKey struct{}
+			ctx := context.WithValue(context.Background(), ctxKey{}, "caller")
+			ctxBlobStore := &contextBlobStore{BlobStore: blobStore}
+
+			messages, err := readMessages(t, ctx, payloadFactory, func(f *sql.AggregateChangedFactory) {
+				f.WithClaimCheck(ctxBlobStore, strategyJSON.ClaimCheckEager)
+			})
+
+			require.NoError(t, err)
+			require.Len(t, messages, 1)
+			assert.Equal(t, ctx, ctxBlobStore.ctx)
+		})
+
+		t.Run("lazy", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			payloadFactory := mocks.NewMessagePayloadFactory(ctrl)
+
+			messages, err := readMessages(t, context.Background(), payloadFactory, func(f *sql.AggregateChangedFactory) {
+				f.WithClaimCheck(blobStore, strategyJSON.ClaimCheckLazy)
+			})
+			require.NoError(t, err)
+			require.Len(t, messages, 1)
+
+			lazy, ok := messages[0].Payload().(*strategyJSON.LazyPayload)
+			require.True(t, ok)
+			assert.Equal(t, "name_changed", lazy.Type)
+			assert.Equal(t, reference, lazy.Reference)
+
+			// The payload is only created once it's loaded
+			payloadFactory.EXPECT().CreatePayload("name_changed", payload).Return(nameChanged{"alice"}, nil).Times(1)
+
+			loaded, err := lazy.Load(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, nameChanged{"alice"}, loaded)
+
+			loaded, err = lazy.Load(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, nameChanged{"alice"}, loaded)
+		})
+
+		t.Run("no blob store", func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			messages, err := readMessages(t, context.Background(), mocks.NewMessagePayloadFactory(ctrl), func(*sql.AggregateChangedFactory) {})
+
+			assert.Equal(t, sql.ErrBlobStoreRequired, err)
+			assert.Empty(t, messages)
+		})
+	})
+
+	t.Run("unknown payload policy", func(t *testing.T) {
+		testCases := []struct {
+			title            string
+			policy           strategyJSON.UnknownPayloadPolicy
+			payloadErr       error
+			expectedPayloads []interface{}
+			expectedError    error
+			expectedLog      string
+		}{
+			{
+				"fail",
+				strategyJSON.UnknownPayloadFail,
+				strategyJSON.ErrUnknownPayloadType,
+				nil,
+				strategyJSON.ErrUnknownPayloadType,
+				"",
+			},
+			{
+				"skip",
+				strategyJSON.UnknownPayloadSkip,
+				strategyJSON.ErrUnknownPayloadType,
+				[]interface{}{nameChanged{"alice"}},
+				nil,
+				"skipping event with unknown payload type",
+			},
+			{
+				"skip wrapped unknown payload type",
+				strategyJSON.UnknownPayloadSkip,
+				pkgErrors.Wrap(goengine.ErrUnknownPayloadType, "failed to decode payload"),
+				[]interface{}{nameChanged{"alice"}},
+				nil,
+				"skipping event with unknown payload type",
+			},
+			{
+				"surface",
+				strategyJSON.UnknownPayloadSurface,
+				protobuf.ErrUnknownPayloadType,
+				[]interface{}{
+					strategyJSON.UnknownPayload{Type: "account_closed", Data: []byte(`{"reason":"fraud"}`)},
+					nameChanged{"alice"},
+				},
+				nil,
+				"surfacing event with unknown payload type",
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				rowMetadata := []byte(`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": 1}`)
+				uuid1, _ := goengine.GenerateUUID().MarshalBinary()
+				uuid2, _ := goengine.GenerateUUID().MarshalBinary()
+				mockRows := sqlmock.NewRows(rowColumns)
+				mockRows.AddRow(1, uuid1, "account_closed", []byte(`{"reason":"fraud"}`), rowMetadata, time.Now().UTC())
+				mockRows.AddRow(2, uuid2, "name_changed", []byte(`{}`), rowMetadata, time.Now().UTC())
+
+				payloadFactory := mocks.NewMessagePayloadFactory(ctrl)
+				payloadFactory.EXPECT().CreatePayload("account_closed", []byte(`{"reason":"fraud"}`)).Return(nil, testCase.payloadErr)
+				payloadFactory.EXPECT().CreatePayload("name_changed", []byte(`{}`)).Return(nameChanged{"alice"}, nil).AnyTimes()
+
+				db, dbMock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close()
+
+				dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+				rows, err := db.Query("SELECT")
+				require.NoError(t, err)
+				defer rows.Close()
+
+				logger, loggerHook := test.NewNullLogger()
+				metrics := &unknownPayloadMetrics{}
+
+				messageFactory, err := sql.NewAggregateChangedFactory(payloadFactory)
+				require.NoError(t, err)
+				messageFactory.WithUnknownPayloadPolicy(testCase.policy, goengineLogger.Wrap(logger), metrics)
+
+				stream, err := messageFactory.CreateEventStream(rows)
+				require.NoError(t, err)
+				defer stream.Close()
+
+				messages, _, err := goengine.ReadEventStream(stream)
+
+				asserts := assert.New(t)
+				asserts.Equal(testCase.expectedError, err)
+				if testCase.expectedError != nil {
+					asserts.Empty(metrics.eventNames)
+					return
+				}
+
+				var payloads []interface{}
+				for _, msg := range messages {
+					payloads = append(payloads, msg.Payload())
+				}
+				asserts.Equal(testCase.expectedPayloads, payloads)
+				asserts.Equal([]string{"account_closed"}, metrics.eventNames)
+				if asserts.Len(loggerHook.AllEntries(), 1) {
+					asserts.Equal(testCase.expectedLog, loggerHook.LastEntry().Message)
+				}
+			})
+		}
+	})
+
 	t.Run("no rows", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -186,6 +593,24 @@ func TestAggregateChangedFactory_CreateFromRows(t *testing.T) {
 				},
 				"bad payload",
 			},
+			{
+				"unknown payload codec",
+				func(ctrl *gomock.Controller) (*sqlmock.Rows, *mocks.MessagePayloadFactory) {
+					uuid, _ := goengine.GenerateUUID().MarshalBinary()
+					mockRows := sqlmock.NewRows(rowColumns)
+					mockRows.AddRow(
+						1,
+						uuid,
+						"some",
+						[]byte("{}"),
+						[]byte(`{"_payload_codec": "cbor"}`),
+						time.Now().UTC(),
+					)
+
+					return mockRows, mocks.NewMessagePayloadFactory(ctrl)
+				},
+				"goengine: unknown payload codec",
+			},
 			{
 				"missing aggregate id",
 				func(ctrl *gomock.Controller) (*sqlmock.Rows, *mocks.MessagePayloadFactory) {
@@ -315,6 +740,58 @@ func TestAggregateChangedFactory_CreateFromRows(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("invalid aggregate version error types", func(t *testing.T) {
+		testCases := []struct {
+			title        string
+			metadata     string
+			expectedType error
+		}{
+			{
+				"missing aggregate version",
+				`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8"}`,
+				sql.MissingMetadataError(""),
+			},
+			{
+				"invalid aggregate version type",
+				`{"_aggregate_id": "00c5ca66-df07-4fcc-8866-5ca6ba1a10b8", "_aggregate_version": "string"}`,
+				&sql.InvalidMetadataValueTypeError{},
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				uuid, _ := goengine.GenerateUUID().MarshalBinary()
+				mockRows := sqlmock.NewRows(rowColumns)
+				mockRows.AddRow(1, uuid, "some", []byte("{}"), []byte(testCase.metadata), time.Now().UTC())
+
+				payloadFactory := mocks.NewMessagePayloadFactory(ctrl)
+				payloadFactory.EXPECT().CreatePayload("some", []byte("{}")).Return(struct{}{}, nil).Times(1)
+
+				db, dbMock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer db.Close()
+
+				dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+				rows, err := db.Query("SELECT")
+				require.NoError(t, err)
+				defer rows.Close()
+
+				messageFactory, err := sql.NewAggregateChangedFactory(payloadFactory)
+				require.NoError(t, err)
+
+				stream, err := messageFactory.CreateEventStream(rows)
+				require.NoError(t, err)
+				defer stream.Close()
+
+				_, _, err = goengine.ReadEventStream(stream)
+				assert.IsType(t, testCase.expectedType, err)
+			})
+		}
+	})
 }
 
 func createAggregateChangedMessage(payload interface{}, version uint) (*aggregate.Changed, error) {
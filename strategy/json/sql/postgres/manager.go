@@ -15,8 +15,8 @@ import (
 type SingleStreamManager struct {
 	db                  *sql.DB
 	payloadTransformer  *json.PayloadTransformer
-	persistenceStrategy driverSQL.PersistenceStrategy
-	messageFactory      driverSQL.MessageFactory
+	persistenceStrategy *SingleStreamStrategy
+	messageFactory      *strategySQL.AggregateChangedFactory
 
 	logger  goengine.Logger
 	metrics driverSQL.Metrics
@@ -51,7 +51,7 @@ func NewSingleStreamManager(db *sql.DB, logger goengine.Logger, metrics driverSQ
 	return &SingleStreamManager{
 		db:                  db,
 		payloadTransformer:  payloadTransformer,
-		persistenceStrategy: persistenceStrategy,
+		persistenceStrategy: persistenceStrategy.(*SingleStreamStrategy),
 		messageFactory:      messageFactory,
 		logger:              logger,
 		metrics:             metrics,
@@ -74,6 +74,62 @@ func (m *SingleStreamManager) RegisterPayloads(initiators map[string]json.Payloa
 	return m.payloadTransformer.RegisterPayloads(initiators)
 }
 
+// RegisterAlias registers an alias, like a previous name, under which events of a payload type are stored
+func (m *SingleStreamManager) RegisterAlias(alias string, payloadType string) error {
+	return m.payloadTransformer.RegisterAlias(alias, payloadType)
+}
+
+// RegisterUpcaster registers a upcaster that transforms version fromVersion of a payload type into the next version
+func (m *SingleStreamManager) RegisterUpcaster(payloadType string, fromVersion uint, upcaster json.Upcaster) error {
+	return m.payloadTransformer.RegisterUpcaster(payloadType, fromVersion, upcaster)
+}
+
+// RegisterRenameUpcaster registers a upcaster that transforms version fromVersion of a payload type into version
+// toVersion of a renamed payload type
+func (m *SingleStreamManager) RegisterRenameUpcaster(payloadType string, fromVersion uint, toPayloadType string, toVersion uint, upcaster json.Upcaster) error {
+	return m.payloadTransformer.RegisterRenameUpcaster(payloadType, fromVersion, toPayloadType, toVersion, upcaster)
+}
+
+// WithUnknownPayloadPolicy sets the policy used for events with a payload of an unknown type.
+// Skipped and surfaced events are logged and counted when the metrics implement sql.UnknownPayloadMetrics.
+func (m *SingleStreamManager) WithUnknownPayloadPolicy(policy json.UnknownPayloadPolicy) {
+	metrics, _ := m.metrics.(strategySQL.UnknownPayloadMetrics)
+	m.messageFactory.WithUnknownPayloadPolicy(policy, m.logger, metrics)
+}
+
+// WithSchemaValidation enables the validation of payloads against the JSON Schema of the payload type
+func (m *SingleStreamManager) WithSchemaValidation() {
+	m.payloadTransformer.WithSchemaValidation()
+}
+
+// Schemas returns the JSON Schemas of the registered payload types
+func (m *SingleStreamManager) Schemas() map[string]*json.Schema {
+	return m.payloadTransformer.Schemas()
+}
+
+// WithEncryption enables the encryption of the personal data in payloads using the keys in the KeyStore
+func (m *SingleStreamManager) WithEncryption(keyStore goengine.KeyStore) {
+	m.payloadTransformer.WithEncryption(keyStore)
+}
+
+// WithPayloadCodec sets the codec used to encode the payloads of new events.
+// Events are loaded using the codec recorded with the event so events stored without a codec can still be loaded.
+func (m *SingleStreamManager) WithPayloadCodec(codec *json.PayloadCodec) {
+	m.persistenceStrategy.WithPayloadCodec(codec)
+}
+
+// WithClaimCheck stores the payloads of new events of at least threshold bytes in the goengine.BlobStore.
+// The policy determines if the payloads are loaded when the event is loaded or as a json.LazyPayload when needed.
+func (m *SingleStreamManager) WithClaimCheck(blobStore goengine.BlobStore, threshold int, policy json.ClaimCheckPolicy) {
+	m.persistenceStrategy.WithClaimCheck(blobStore, threshold)
+	m.messageFactory.WithClaimCheck(blobStore, policy)
+}
+
+// WithTypedMetadata records the types of the metadata values of new events so they keep their type when loaded
+func (m *SingleStreamManager) WithTypedMetadata() {
+	m.persistenceStrategy.WithTypedMetadata()
+}
+
 // PersistenceStrategy returns the sql persistence strategy
 func (m *SingleStreamManager) PersistenceStrategy() driverSQL.PersistenceStrategy {
 	return m.persistenceStrategy
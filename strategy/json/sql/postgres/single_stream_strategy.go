@@ -1,6 +1,7 @@
 package postgres
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -10,19 +11,30 @@ import (
 	"github.com/hellofresh/goengine/driver/sql"
 	"github.com/hellofresh/goengine/driver/sql/postgres"
 	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/strategy/json"
 	"github.com/hellofresh/goengine/strategy/json/internal"
 )
 
 var (
-	// Ensure SingleStreamStrategy implements strategy.PersistenceStrategy
-	_ sql.PersistenceStrategy = &SingleStreamStrategy{}
+	// Ensure SingleStreamStrategy implements strategy.ContextPersistenceStrategy
+	_ sql.ContextPersistenceStrategy = &SingleStreamStrategy{}
 
 	tableNameInvalidCharRegex = regexp.MustCompile("[^a-z0-9_]+")
+
+	// claimCheckPayload is stored in the payload column when the payload is stored in a blob store
+	claimCheckPayload = []byte("null")
 )
 
 // SingleStreamStrategy struct represents eventstore with single stream
 type SingleStreamStrategy struct {
-	converter goengine.MessagePayloadConverter
+	converter       goengine.MessagePayloadConverter
+	versionResolver goengine.MessagePayloadVersionResolver
+	codec           *json.PayloadCodec
+
+	blobStore           goengine.BlobStore
+	claimCheckThreshold int
+
+	typedMetadata bool
 }
 
 // NewSingleStreamStrategy is the constructor postgres for PersistenceStrategy interface
@@ -31,20 +43,50 @@ func NewSingleStreamStrategy(converter goengine.MessagePayloadConverter) (sql.Pe
 		return nil, goengine.InvalidArgumentError("converter")
 	}
 
-	return &SingleStreamStrategy{converter: converter}, nil
+	// When the converter knows the payload versions the version is recorded in the metadata
+	versionResolver, _ := converter.(goengine.MessagePayloadVersionResolver)
+
+	return &SingleStreamStrategy{converter: converter, versionResolver: versionResolver}, nil
+}
+
+// WithPayloadCodec sets the json.PayloadCodec used to encode the payloads.
+// The codec used is recorded in the metadata of every event so events stored with and without a codec can be loaded.
+// Since the encoded payloads are binary the payload column must be a BYTEA column, the statements of
+// PayloadCodecMigrateSchema change the payload column of an event stream table created without a codec.
+func (s *SingleStreamStrategy) WithPayloadCodec(codec *json.PayloadCodec) {
+	s.codec = codec
+}
+
+// WithClaimCheck stores the payloads of at least threshold bytes in the goengine.BlobStore.
+// Only the reference to the payload is recorded in the metadata of the event and the payload column contains null.
+// Since the blob is stored before the event is appended, a failing append can leave an unreferenced blob behind.
+func (s *SingleStreamStrategy) WithClaimCheck(blobStore goengine.BlobStore, threshold int) {
+	s.blobStore = blobStore
+	s.claimCheckThreshold = threshold
+}
+
+// WithTypedMetadata records the types of the metadata values using metadata.MarshalTypedJSON so integer, time and
+// uuid values keep their type when the event is loaded
+func (s *SingleStreamStrategy) WithTypedMetadata() {
+	s.typedMetadata = true
 }
 
 // CreateSchema returns a valid set of SQL statements to create the event store tables and indexes
 func (s *SingleStreamStrategy) CreateSchema(tableName string) []string {
 	tableName = postgres.QuoteIdentifier(tableName)
 
+	payloadColumnType := "JSON"
+	if s.codec != nil {
+		payloadColumnType = "BYTEA"
+	}
+
 	statements := make([]string, 3)
 	statements[0] = fmt.Sprintf(
 		`CREATE TABLE %s (
     no BIGSERIAL,
     event_id UUID NOT NULL,
     event_name VARCHAR(100) NOT NULL,
-    payload JSON NOT NULL,
+    payload %s NOT NULL,
     metadata JSONB NOT NULL, 
     aggregate_type VARCHAR(50) NOT NULL,
 	aggregate_id UUID NOT NULL,
@@ -54,6 +96,7 @@ func (s *SingleStreamStrategy) CreateSchema(tableName string) []string {
     UNIQUE (event_id)
 );`,
 		tableName,
+		payloadColumnType,
 	)
 	statements[1] = fmt.Sprintf(`CREATE UNIQUE INDEX ON %s (aggregate_type, aggregate_id, aggregate_version);`, tableName)
 	statements[2] = fmt.Sprintf(`CREATE INDEX ON %s (aggregate_type, aggregate_id, no);`, tableName)
@@ -73,15 +116,56 @@ func (s *SingleStreamStrategy) InsertColumnNames() []string {
 
 // PrepareData transforms a slice of messaging into a flat interface slice with the correct column order
 func (s *SingleStreamStrategy) PrepareData(messages []goengine.Message) ([]interface{}, error) {
+	return s.PrepareDataWithContext(context.Background(), messages)
+}
+
+// PrepareDataWithContext transforms a slice of messaging into a flat interface slice with the correct column order.
+// The context is used to convert the payloads and to store them in the blob store.
+func (s *SingleStreamStrategy) PrepareDataWithContext(ctx context.Context, messages []goengine.Message) ([]interface{}, error) {
 	var out = make([]interface{}, 0, len(messages)*5) // optimization for the number of columns
 	for _, msg := range messages {
-		payloadType, payloadData, err := s.converter.ConvertPayload(msg.Payload())
+		payloadType, payloadData, err := goengine.ConvertMessagePayload(ctx, s.converter, msg.Payload())
 		if err != nil {
 			return nil, err
 		}
 
 		msgMetadata := msg.Metadata()
-		meta, err := internal.MarshalJSON(msgMetadata)
+		// Payloads stored without a version are version 1, so the version is only recorded once upcasters are registered
+		if s.versionResolver != nil {
+			if version := s.versionResolver.ResolveVersion(payloadType); version > 1 {
+				msgMetadata = metadata.WithValue(msgMetadata, goengine.PayloadVersionKey, version)
+			}
+		}
+
+		if s.codec != nil {
+			var codec string
+			codec, payloadData, err = s.codec.EncodePayload(payloadData)
+			if err != nil {
+				return nil, err
+			}
+
+			// Plain json is not recorded since it's the default
+			if codec != string(json.PayloadEncodingJSON) {
+				msgMetadata = metadata.WithValue(msgMetadata, json.PayloadCodecKey, codec)
+			}
+		}
+
+		if s.blobStore != nil && len(payloadData) >= s.claimCheckThreshold {
+			reference, err := s.blobStore.Put(ctx, payloadData)
+			if err != nil {
+				return nil, err
+			}
+
+			msgMetadata = metadata.WithValue(msgMetadata, goengine.PayloadClaimCheckKey, reference)
+			payloadData = claimCheckPayload
+		}
+
+		var meta []byte
+		if s.typedMetadata {
+			meta, err = metadata.MarshalTypedJSON(msgMetadata)
+		} else {
+			meta, err = internal.MarshalJSON(msgMetadata)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -3,21 +3,37 @@
 package postgres_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
 	"github.com/hellofresh/goengine/metadata"
 	"github.com/hellofresh/goengine/mocks"
+	strategyJSON "github.com/hellofresh/goengine/strategy/json"
 	"github.com/hellofresh/goengine/strategy/json/internal"
 	"github.com/hellofresh/goengine/strategy/json/sql/postgres"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// contextBlobStore records the context used to store the payloads
+type contextBlobStore struct {
+	*inmemory.BlobStore
+
+	ctx context.Context
+}
+
+func (s *contextBlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	s.ctx = ctx
+	return s.BlobStore.Put(ctx, data)
+}
+
 func TestNewPostgresStrategy(t *testing.T) {
 	t.Run("error on no converter provided", func(t *testing.T) {
 		strategy, err := postgres.NewSingleStreamStrategy(nil)
@@ -159,6 +175,20 @@ func TestCreateSchema(t *testing.T) {
 
 		assert.Equal(t, 3, len(cs))
 		assert.Contains(t, cs[0], `CREATE TABLE "abc"`)
+		assert.Contains(t, cs[0], "payload JSON NOT NULL")
+	})
+
+	t.Run("binary payload column when using a codec", func(t *testing.T) {
+		codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionNone, 0)
+		require.NoError(t, err)
+
+		strategy, err := postgres.NewSingleStreamStrategy(&mocks.MessagePayloadConverter{})
+		require.NoError(t, err)
+		strategy.(*postgres.SingleStreamStrategy).WithPayloadCodec(codec)
+
+		cs := strategy.CreateSchema("abc")
+
+		assert.Contains(t, cs[0], "payload BYTEA NOT NULL")
 	})
 }
 
@@ -206,6 +236,183 @@ func TestPrepareData(t *testing.T) {
 		assert.Equal(t, expectedColumns, data)
 	})
 
+	t.Run("Record payload version", func(t *testing.T) {
+		type accountOpened struct {
+			Owner string
+		}
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("account_opened", func() interface{} {
+			return accountOpened{}
+		}))
+		require.NoError(t, transformer.RegisterUpcaster("account_opened", 1, func(data []byte) ([]byte, error) {
+			return data, nil
+		}))
+
+		strategy, err := postgres.NewSingleStreamStrategy(transformer)
+		require.NoError(t, err)
+
+		data, err := strategy.PrepareData([]goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), accountOpened{Owner: "alice"}, metadata.New(), time.Now()),
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "account_opened", data[1])
+		assert.JSONEq(t, `{"_payload_version":2}`, string(data[3].([]byte)))
+	})
+
+	t.Run("Do not record the version of payloads without upcasters", func(t *testing.T) {
+		type accountClosed struct {
+			Reason string
+		}
+
+		transformer := strategyJSON.NewPayloadTransformer()
+		require.NoError(t, transformer.RegisterPayload("account_closed", func() interface{} {
+			return accountClosed{}
+		}))
+
+		strategy, err := postgres.NewSingleStreamStrategy(transformer)
+		require.NoError(t, err)
+
+		data, err := strategy.PrepareData([]goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), accountClosed{Reason: "moved"}, metadata.New(), time.Now()),
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, "account_closed", data[1])
+		assert.JSONEq(t, `{}`, string(data[3].([]byte)))
+	})
+
+	t.Run("Record metadata types", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		payload := []byte(`{"name":"alice"}`)
+
+		pc := mocks.NewMessagePayloadConverter(ctrl)
+		pc.EXPECT().ConvertPayload(payload).Return("name_changed", payload, nil)
+
+		strategy, err := postgres.NewSingleStreamStrategy(pc)
+		require.NoError(t, err)
+		strategy.(*postgres.SingleStreamStrategy).WithTypedMetadata()
+
+		data, err := strategy.PrepareData([]goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), payload, metadata.FromMap(map[string]interface{}{
+				"_aggregate_version": uint(2),
+				"_aggregate_type":    "bank_account",
+			}), time.Now()),
+		})
+		require.NoError(t, err)
+
+		asserts := assert.New(t)
+		asserts.JSONEq(
+			`{"_aggregate_version":2,"_aggregate_type":"bank_account","_metadata_types":{"_aggregate_version":"uint64"}}`,
+			string(data[3].([]byte)),
+		)
+
+		meta, err := metadata.UnmarshalJSON(data[3].([]byte))
+		asserts.NoError(err)
+		asserts.Equal(uint64(2), meta.Value("_aggregate_version"))
+	})
+
+	t.Run("Encode payload using codec", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		payload := []byte(`{"name":"alice"}`)
+		largePayload := []byte(`{"name":"` + strings.Repeat("alice", 100) + `"}`)
+
+		pc := mocks.NewMessagePayloadConverter(ctrl)
+		pc.EXPECT().ConvertPayload(payload).Return("name_changed", payload, nil)
+		pc.EXPECT().ConvertPayload(largePayload).Return("name_changed", largePayload, nil)
+
+		codec, err := strategyJSON.NewPayloadCodec(strategyJSON.PayloadEncodingMessagePack, strategyJSON.PayloadCompressionGzip, 100)
+		require.NoError(t, err)
+
+		strategy, err := postgres.NewSingleStreamStrategy(pc)
+		require.NoError(t, err)
+		strategy.(*postgres.SingleStreamStrategy).WithPayloadCodec(codec)
+
+		data, err := strategy.PrepareData([]goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), payload, metadata.New(), time.Now()),
+			mocks.NewDummyMessage(goengine.GenerateUUID(), largePayload, metadata.New(), time.Now()),
+		})
+		require.NoError(t, err)
+
+		asserts := assert.New(t)
+		asserts.Equal([]byte("\x81\xa4name\xa5alice"), data[2])
+		asserts.JSONEq(`{"_payload_codec":"msgpack"}`, string(data[3].([]byte)))
+
+		asserts.JSONEq(`{"_payload_codec":"msgpack+gzip"}`, string(data[11].([]byte)))
+		decoded, err := strategyJSON.DecodePayload("msgpack+gzip", data[10].([]byte))
+		asserts.NoError(err)
+		asserts.Equal(largePayload, decoded)
+	})
+
+	t.Run("Store large payloads in a blob store", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		payload := []byte(`{"name":"alice"}`)
+		largePayload := []byte(`{"name":"` + strings.Repeat("alice", 100) + `"}`)
+
+		pc := mocks.NewMessagePayloadConverter(ctrl)
+		pc.EXPECT().ConvertPayload(payload).Return("name_changed", payload, nil)
+		pc.EXPECT().ConvertPayload(largePayload).Return("name_changed", largePayload, nil)
+
+		blobStore := inmemory.NewBlobStore()
+
+		strategy, err := postgres.NewSingleStreamStrategy(pc)
+		require.NoError(t, err)
+		strategy.(*postgres.SingleStreamStrategy).WithClaimCheck(blobStore, 100)
+
+		data, err := strategy.PrepareData([]goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), payload, metadata.New(), time.Now()),
+			mocks.NewDummyMessage(goengine.GenerateUUID(), largePayload, metadata.New(), time.Now()),
+		})
+		require.NoError(t, err)
+
+		asserts := assert.New(t)
+		asserts.Equal(payload, data[2])
+		asserts.JSONEq(`{}`, string(data[3].([]byte)))
+
+		asserts.Equal([]byte("null"), data[10])
+
+		var meta map[string]interface{}
+		require.NoError(t, internal.UnmarshalJSON(data[11].([]byte), &meta))
+		reference, ok := meta[goengine.PayloadClaimCheckKey].(string)
+		require.True(t, ok)
+
+		stored, err := blobStore.Get(context.Background(), reference)
+		asserts.NoError(err)
+		asserts.Equal(largePayload, stored)
+	})
+
+	t.Run("Store payloads using the context of the caller", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		payload := []byte(`{"name":"alice"}`)
+
+		pc := mocks.NewMessagePayloadConverter(ctrl)
+		pc.EXPECT().ConvertPayload(payload).Return("name_changed", payload, nil)
+
+		blobStore := &contextBlobStore{BlobStore: inmemory.NewBlobStore()}
+
+		strategy, err := postgres.NewSingleStreamStrategy(pc)
+		require.NoError(t, err)
+		strategy.(*postgres.SingleStreamStrategy).WithClaimCheck(blobStore, 0)
+
+		type ctxKey struct{}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "caller")
+
+		_, err = strategy.(*postgres.SingleStreamStrategy).PrepareDataWithContext(ctx, []goengine.Message{
+			mocks.NewDummyMessage(goengine.GenerateUUID(), payload, metadata.New(), time.Now()),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, ctx, blobStore.ctx)
+	})
+
 	t.Run("Converter error", func(t *testing.T) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -235,3 +442,39 @@ func TestPrepareData(t *testing.T) {
 		assert.Nil(t, data)
 	})
 }
+
+func BenchmarkSingleStreamStrategy_PrepareData(b *testing.B) {
+	type accountCredited struct {
+		Amount uint `json:"amount"`
+	}
+
+	transformer := strategyJSON.NewPayloadTransformer()
+	if err := transformer.RegisterPayload("account_credited", func() interface{} {
+		return accountCredited{}
+	}); err != nil {
+		b.Fatal(err)
+	}
+
+	strategy, err := postgres.NewSingleStreamStrategy(transformer)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	messages := make([]goengine.Message, 10)
+	for i := range messages {
+		meta := metadata.New()
+		meta = metadata.WithValue(meta, "_aggregate_id", "b9ebca7a-c1eb-40dd-94a4-fac7c5e84fb5")
+		meta = metadata.WithValue(meta, "_aggregate_type", "bank_account")
+		meta = metadata.WithValue(meta, "_aggregate_version", uint(i+1))
+
+		messages[i] = mocks.NewDummyMessage(goengine.GenerateUUID(), accountCredited{Amount: 100}, meta, time.Now())
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := strategy.PrepareData(messages); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
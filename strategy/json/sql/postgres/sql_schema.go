@@ -59,6 +59,15 @@ func sqlTriggerEventStreamNotifyTemplate(eventStreamName goengine.StreamName, ev
 	)
 }
 
+// sqlProjectionVersionColumnTemplate a helper to add the version column to projection tables created before it existed
+func sqlProjectionVersionColumnTemplate(projectionTable string) string {
+	/* #nosec G201 */
+	return fmt.Sprintf(
+		`ALTER TABLE %s ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0`,
+		postgres.QuoteIdentifier(projectionTable),
+	)
+}
+
 // StreamProjectorCreateSchema return the sql statement needed for the postgres database in order to use the StreamProjector
 func StreamProjectorCreateSchema(projectionTable string, streamName goengine.StreamName, streamTable string) []string {
 	/* #nosec G201 */
@@ -73,10 +82,12 @@ func StreamProjectorCreateSchema(projectionTable string, streamName goengine.Str
 				position BIGINT NOT NULL DEFAULT 0,
 				state JSONB NOT NULL DEFAULT ('{}'),
 				locked BOOLEAN NOT NULL DEFAULT (FALSE), 
+				version INTEGER NOT NULL DEFAULT 0,
 				PRIMARY KEY (no)
 			)`,
 			postgres.QuoteIdentifier(projectionTable),
 		),
+		sqlProjectionVersionColumnTemplate(projectionTable),
 	}
 }
 
@@ -95,9 +106,38 @@ func AggregateProjectorCreateSchema(projectionTable string, streamName goengine.
   				state JSONB,
 				locked BOOLEAN NOT NULL DEFAULT (FALSE),
 				failed BOOLEAN NOT NULL DEFAULT (FALSE),
+				version INTEGER NOT NULL DEFAULT 0,
   				PRIMARY KEY (no)
 			)`,
 			postgres.QuoteIdentifier(projectionTable),
 		),
+		sqlProjectionVersionColumnTemplate(projectionTable),
+	}
+}
+
+// PayloadCodecMigrateSchema return the sql statements needed for the postgres database in order to use a
+// json.PayloadCodec with an event stream table that was created without one.
+// The JSON payload column is changed into a BYTEA column containing the UTF8 bytes of the existing payloads, these are
+// still loaded as JSON since no codec is recorded in their metadata.
+func PayloadCodecMigrateSchema(eventStreamTable string) []string {
+	/* #nosec G201 */
+	return []string{
+		fmt.Sprintf(
+			`DO LANGUAGE plpgsql $EXIST$
+			 BEGIN
+			   IF EXISTS(
+			     SELECT TRUE FROM pg_attribute WHERE
+			       attrelid = %[1]s::regclass AND
+			       attname = 'payload' AND
+			       atttypid IN ('json'::regtype, 'jsonb'::regtype)
+			   )
+			   THEN
+			     ALTER TABLE %[2]s ALTER COLUMN payload TYPE BYTEA USING convert_to(payload::text, 'UTF8');
+			   END IF;
+			 END;
+			 $EXIST$`,
+			postgres.QuoteString(eventStreamTable),
+			postgres.QuoteIdentifier(eventStreamTable),
+		),
 	}
 }
@@ -0,0 +1,152 @@
+package protobuf
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hellofresh/goengine"
+	reflectUtil "github.com/hellofresh/goengine/internal/reflect"
+)
+
+var (
+	// ErrUnsupportedProtobufPayloadData occurs when the data type is not supported by the PayloadTransformer
+	ErrUnsupportedProtobufPayloadData = errors.New("goengine: payload data was expected to be a []byte")
+	// ErrPayloadNotProtoMessage occurs when the payload is not a proto.Message
+	ErrPayloadNotProtoMessage = errors.New("goengine: payload is not a proto.Message")
+	// ErrPayloadCannotBeSerialized occurs when the payload cannot be serialized
+	ErrPayloadCannotBeSerialized = errors.New("goengine: payload cannot be serialized")
+	// ErrPayloadNotRegistered occurs when the payload is not registered
+	ErrPayloadNotRegistered = errors.New("goengine: payload is not registered")
+	// ErrUnknownPayloadType occurs when a payload type is unknown, it is the shared goengine.ErrUnknownPayloadType
+	ErrUnknownPayloadType = goengine.ErrUnknownPayloadType
+	// ErrInitiatorInvalidResult occurs when a PayloadInitiator returns a reference to nil
+	ErrInitiatorInvalidResult = errors.New("goengine: initializer must return a pointer that is not nil")
+	// ErrDuplicatePayloadType occurs when a payload type is already registered
+	ErrDuplicatePayloadType = errors.New("goengine: payload type is already registered")
+
+	// Ensure that PayloadTransformer satisfies the MessagePayloadFactory interface
+	_ goengine.MessagePayloadFactory = &PayloadTransformer{}
+	// Ensure that PayloadTransformer satisfies the MessagePayloadConverter interface
+	_ goengine.MessagePayloadConverter = &PayloadTransformer{}
+	// Ensure that PayloadTransformer satisfies the MessagePayloadResolver interface
+	_ goengine.MessagePayloadResolver = &PayloadTransformer{}
+)
+
+type (
+	// PayloadInitiator creates a new empty instance of a protobuf message
+	// this instance can then be used to Unmarshal
+	PayloadInitiator func() proto.Message
+
+	// PayloadTransformer is a payload factory that can reconstruct protobuf message payloads from and to the protobuf
+	// wire format
+	PayloadTransformer struct {
+		types map[string]PayloadInitiator
+		names map[string]string
+	}
+)
+
+// NewPayloadTransformer returns a new instance of the PayloadTransformer
+func NewPayloadTransformer() *PayloadTransformer {
+	return &PayloadTransformer{
+		types: map[string]PayloadInitiator{},
+		names: map[string]string{},
+	}
+}
+
+// ConvertPayload marshals the protobuf message payload returning the payload type name and the serialized data
+func (p *PayloadTransformer) ConvertPayload(payload interface{}) (string, []byte, error) {
+	payloadName, err := p.ResolveName(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	msg, ok := payload.(proto.Message)
+	if !ok {
+		return "", nil, ErrPayloadNotProtoMessage
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return "", nil, ErrPayloadCannotBeSerialized
+	}
+
+	return payloadName, data, nil
+}
+
+// ResolveName returns the payloadType name of the provided payload
+func (p *PayloadTransformer) ResolveName(payload interface{}) (string, error) {
+	if payload == nil {
+		return "", ErrPayloadNotRegistered
+	}
+
+	payloadName, ok := p.names[typeName(reflect.TypeOf(payload))]
+	if !ok {
+		return "", ErrPayloadNotRegistered
+	}
+
+	return payloadName, nil
+}
+
+// RegisterPayload registers a payload type and the way to initialize it with the factory
+func (p *PayloadTransformer) RegisterPayload(payloadType string, initiator PayloadInitiator) error {
+	if _, known := p.types[payloadType]; known {
+		return ErrDuplicatePayloadType
+	}
+
+	checkPayload := initiator()
+	if checkPayload == nil {
+		return ErrInitiatorInvalidResult
+	}
+
+	rv := reflect.ValueOf(checkPayload)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return ErrInitiatorInvalidResult
+	}
+
+	p.names[typeName(rv.Type())] = payloadType
+	p.types[payloadType] = initiator
+
+	return nil
+}
+
+// RegisterPayloads registers multiple payload types
+func (p *PayloadTransformer) RegisterPayloads(payloads map[string]PayloadInitiator) error {
+	for name, initiator := range payloads {
+		if err := p.RegisterPayload(name, initiator); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreatePayload reconstructs a protobuf message payload based on it's type and the serialized data
+func (p *PayloadTransformer) CreatePayload(typeName string, data interface{}) (interface{}, error) {
+	dataBytes, ok := data.([]byte)
+	if !ok {
+		return nil, ErrUnsupportedProtobufPayloadData
+	}
+
+	initiator, found := p.types[typeName]
+	if !found {
+		return nil, ErrUnknownPayloadType
+	}
+
+	payload := initiator()
+	if err := proto.Unmarshal(dataBytes, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// typeName returns the full qualified name of the type, protobuf messages are pointers so the name of the element type
+// is used for pointers
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + reflectUtil.FullTypeName(t.Elem())
+	}
+
+	return reflectUtil.FullTypeName(t)
+}
@@ -0,0 +1,107 @@
+// +build unit
+
+package protobuf_test
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/strategy/protobuf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayloadTransformer_ConvertPayload(t *testing.T) {
+	transformer := protobuf.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayloads(map[string]protobuf.PayloadInitiator{
+		"name_changed": func() proto.Message {
+			return &wrappers.StringValue{}
+		},
+		"opened_at": func() proto.Message {
+			return &timestamp.Timestamp{}
+		},
+	}))
+
+	t.Run("convert payload", func(t *testing.T) {
+		asserts := assert.New(t)
+
+		name, data, err := transformer.ConvertPayload(&wrappers.StringValue{Value: "alice"})
+
+		asserts.NoError(err)
+		asserts.Equal("name_changed", name)
+
+		expectedData, err := proto.Marshal(&wrappers.StringValue{Value: "alice"})
+		require.NoError(t, err)
+		asserts.Equal(expectedData, data)
+	})
+
+	t.Run("payload not registered", func(t *testing.T) {
+		asserts := assert.New(t)
+
+		name, data, err := transformer.ConvertPayload(&wrappers.Int64Value{Value: 1})
+
+		asserts.Equal(protobuf.ErrPayloadNotRegistered, err)
+		asserts.Equal("", name)
+		asserts.Nil(data)
+
+		_, _, err = transformer.ConvertPayload(wrappers.StringValue{})
+		asserts.Equal(protobuf.ErrPayloadNotRegistered, err)
+
+		_, _, err = transformer.ConvertPayload(nil)
+		asserts.Equal(protobuf.ErrPayloadNotRegistered, err)
+	})
+}
+
+func TestPayloadTransformer_CreatePayload(t *testing.T) {
+	transformer := protobuf.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayload("opened_at", func() proto.Message {
+		return &timestamp.Timestamp{}
+	}))
+
+	t.Run("create payload", func(t *testing.T) {
+		data, err := proto.Marshal(&timestamp.Timestamp{Seconds: 1546398245})
+		require.NoError(t, err)
+
+		payload, err := transformer.CreatePayload("opened_at", data)
+
+		assert.NoError(t, err)
+		assert.True(t, proto.Equal(&timestamp.Timestamp{Seconds: 1546398245}, payload.(proto.Message)))
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		_, err := transformer.CreatePayload("opened_at", "string")
+		assert.Equal(t, protobuf.ErrUnsupportedProtobufPayloadData, err)
+
+		_, err = transformer.CreatePayload("closed_at", []byte{})
+		assert.Equal(t, protobuf.ErrUnknownPayloadType, err)
+		assert.True(t, goengine.IsUnknownPayloadType(err))
+
+		_, err = transformer.CreatePayload("opened_at", []byte{0xff})
+		assert.Error(t, err)
+	})
+}
+
+func TestPayloadTransformer_RegisterPayload(t *testing.T) {
+	transformer := protobuf.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayload("name_changed", func() proto.Message {
+		return &wrappers.StringValue{}
+	}))
+
+	err := transformer.RegisterPayload("name_changed", func() proto.Message {
+		return &wrappers.StringValue{}
+	})
+	assert.Equal(t, protobuf.ErrDuplicatePayloadType, err)
+
+	err = transformer.RegisterPayload("nil", func() proto.Message {
+		return nil
+	})
+	assert.Equal(t, protobuf.ErrInitiatorInvalidResult, err)
+
+	err = transformer.RegisterPayload("nil_ptr", func() proto.Message {
+		return (*wrappers.StringValue)(nil)
+	})
+	assert.Equal(t, protobuf.ErrInitiatorInvalidResult, err)
+}
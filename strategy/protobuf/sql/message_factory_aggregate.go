@@ -0,0 +1,18 @@
+package sql
+
+import (
+	"github.com/hellofresh/goengine"
+	strategyJSONSQL "github.com/hellofresh/goengine/strategy/json/sql"
+	"github.com/hellofresh/goengine/strategy/protobuf"
+)
+
+// NewAggregateChangedFactory returns a new instance of an AggregateChangedFactory that reconstructs aggregate.Changed
+// messages with protobuf payloads.
+// Only the payload is stored as protobuf, the metadata is stored as JSON, so the json AggregateChangedFactory is used.
+func NewAggregateChangedFactory(transformer *protobuf.PayloadTransformer) (*strategyJSONSQL.AggregateChangedFactory, error) {
+	if transformer == nil {
+		return nil, goengine.InvalidArgumentError("transformer")
+	}
+
+	return strategyJSONSQL.NewAggregateChangedFactory(transformer)
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/sql"
+	"github.com/hellofresh/goengine/driver/sql/postgres"
+	jsonPostgres "github.com/hellofresh/goengine/strategy/json/sql/postgres"
+)
+
+// Ensure SingleStreamStrategy implements strategy.PersistenceStrategy
+var _ sql.PersistenceStrategy = &SingleStreamStrategy{}
+
+// SingleStreamStrategy struct represents eventstore with single stream storing protobuf payloads.
+// The events are stored the same as the json SingleStreamStrategy except that the payload column is a BYTEA column.
+type SingleStreamStrategy struct {
+	*jsonPostgres.SingleStreamStrategy
+}
+
+// NewSingleStreamStrategy is the constructor postgres for PersistenceStrategy interface
+func NewSingleStreamStrategy(converter goengine.MessagePayloadConverter) (sql.PersistenceStrategy, error) {
+	strategy, err := jsonPostgres.NewSingleStreamStrategy(converter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SingleStreamStrategy{strategy.(*jsonPostgres.SingleStreamStrategy)}, nil
+}
+
+// CreateSchema returns a valid set of SQL statements to create the event store tables and indexes
+func (s *SingleStreamStrategy) CreateSchema(tableName string) []string {
+	tableName = postgres.QuoteIdentifier(tableName)
+
+	statements := make([]string, 3)
+	statements[0] = fmt.Sprintf(
+		`CREATE TABLE %s (
+    no BIGSERIAL,
+    event_id UUID NOT NULL,
+    event_name VARCHAR(100) NOT NULL,
+    payload BYTEA NOT NULL,
+    metadata JSONB NOT NULL,
+    aggregate_type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    aggregate_version SMALLINT NOT NULL,
+    created_at TIMESTAMP(6) NOT NULL,
+    PRIMARY KEY (no),
+    UNIQUE (event_id)
+);`,
+		tableName,
+	)
+	statements[1] = fmt.Sprintf(`CREATE UNIQUE INDEX ON %s (aggregate_type, aggregate_id, aggregate_version);`, tableName)
+	statements[2] = fmt.Sprintf(`CREATE INDEX ON %s (aggregate_type, aggregate_id, no);`, tableName)
+
+	return statements
+}
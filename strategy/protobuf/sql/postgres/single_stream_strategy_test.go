@@ -0,0 +1,80 @@
+// +build unit
+
+package postgres_test
+
+import (
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/aggregate"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/strategy/protobuf"
+	"github.com/hellofresh/goengine/strategy/protobuf/sql"
+	"github.com/hellofresh/goengine/strategy/protobuf/sql/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSingleStreamStrategy_CreateSchema(t *testing.T) {
+	strategy, err := postgres.NewSingleStreamStrategy(protobuf.NewPayloadTransformer())
+	require.NoError(t, err)
+
+	statements := strategy.CreateSchema("events_orders")
+
+	require.Len(t, statements, 3)
+	assert.Contains(t, statements[0], `CREATE TABLE "events_orders"`)
+	assert.Contains(t, statements[0], "payload BYTEA NOT NULL")
+}
+
+func TestSingleStreamStrategy_RoundTrip(t *testing.T) {
+	transformer := protobuf.NewPayloadTransformer()
+	require.NoError(t, transformer.RegisterPayload("name_changed", func() proto.Message {
+		return &wrappers.StringValue{}
+	}))
+
+	strategy, err := postgres.NewSingleStreamStrategy(transformer)
+	require.NoError(t, err)
+
+	aggregateID := aggregate.GenerateID()
+	meta := metadata.WithValue(metadata.WithValue(metadata.New(), aggregate.IDKey, string(aggregateID)), aggregate.VersionKey, 1)
+	msg, err := aggregate.ReconstituteChange(aggregateID, goengine.GenerateUUID(), &wrappers.StringValue{Value: "alice"}, meta, time.Now().UTC(), 1)
+	require.NoError(t, err)
+
+	data, err := strategy.PrepareData([]goengine.Message{msg})
+	require.NoError(t, err)
+	require.Len(t, data, len(strategy.InsertColumnNames()))
+
+	// Load the prepared data as if it was stored in the event store
+	uuid, _ := msg.UUID().MarshalBinary()
+	mockRows := sqlmock.NewRows(strategy.EventColumnNames())
+	mockRows.AddRow(1, uuid, data[1], data[2], data[3], msg.CreatedAt())
+
+	db, dbMock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectQuery("SELECT").WillReturnRows(mockRows)
+	rows, err := db.Query("SELECT")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	messageFactory, err := sql.NewAggregateChangedFactory(transformer)
+	require.NoError(t, err)
+
+	stream, err := messageFactory.CreateEventStream(rows)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	messages, _, err := goengine.ReadEventStream(stream)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+
+	changed := messages[0].(*aggregate.Changed)
+	assert.Equal(t, aggregateID, changed.AggregateID())
+	assert.Equal(t, uint(1), changed.Version())
+	assert.True(t, proto.Equal(&wrappers.StringValue{Value: "alice"}, changed.Payload().(proto.Message)))
+}
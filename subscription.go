@@ -0,0 +1,407 @@
+package goengine
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/hellofresh/goengine/metadata"
+)
+
+const (
+	// subscriptionBatchSize is the maximum number of messages a catch-up subscription loads at once
+	subscriptionBatchSize = 1000
+	// subscriptionMaxTrackedGaps is the maximum number of missing message numbers a catch-up subscription keeps track of
+	subscriptionMaxTrackedGaps = 1000
+	// subscriptionGapTimeout is the duration after which a catch-up subscription stops waiting for a missing message
+	subscriptionGapTimeout = 10 * time.Second
+)
+
+type (
+	// SubscriptionHandler is called by a subscription for every message it receives.
+	// Returning an error stops the subscription.
+	SubscriptionHandler func(ctx context.Context, message Message, messageNumber int64) error
+
+	// SubscriptionCheckpoint is called by a subscription after a set of messages was handled.
+	// The messageNumber is the number up to which all messages were handled and can be stored in order to resume the
+	// subscription from messageNumber+1. Returning an error stops the subscription.
+	SubscriptionCheckpoint func(ctx context.Context, messageNumber int64) error
+
+	// SubscriptionNotifier notifies a subscription that messages may have been appended to a event stream.
+	// The notifier must call notify once it is listening and every time messages were appended to the stream.
+	// It must block until the context is done.
+	SubscriptionNotifier func(ctx context.Context, notify func()) error
+
+	// Subscription is a running subscription on a event stream
+	Subscription interface {
+		// Done returns a channel that is closed when the subscription stopped
+		Done() <-chan struct{}
+
+		// Err returns the error that stopped the subscription or nil when the subscription was closed
+		Err() error
+
+		// Close stops the subscription and waits for it to stop
+		Close() error
+	}
+
+	// CatchUpSubscription is a subscription that first receives the messages that are already in the event stream and
+	// then the messages that are appended to it
+	CatchUpSubscription interface {
+		Subscription
+
+		// Position returns the number of the last message that was handled
+		Position() int64
+	}
+
+	// CatchUpSubscriber is an event store that supports catch-up subscriptions
+	CatchUpSubscriber interface {
+		// SubscribeFrom starts a CatchUpSubscription on the stream beginning at the message with number fromNumber.
+		// The checkpoint is optional.
+		SubscribeFrom(
+			ctx context.Context,
+			streamName StreamName,
+			fromNumber int64,
+			metadataMatcher metadata.Matcher,
+			handler SubscriptionHandler,
+			checkpoint SubscriptionCheckpoint,
+		) (CatchUpSubscription, error)
+	}
+)
+
+// Ensure catchUpSubscription satisfies the CatchUpSubscription interface
+var _ CatchUpSubscription = &catchUpSubscription{}
+
+// catchUpSubscription is a CatchUpSubscription that loads messages from a event store every time it is notified
+//
+// Message numbers can be assigned before the message is committed to the event store, so a message with a lower
+// number can become visible after a message with a higher number. The skipped numbers are tracked as gaps and loaded
+// once they become visible or until subscriptionGapTimeout passed. The numbers of the messages are loaded without the
+// metadata matcher, so the numbers of messages that do not match are skipped instead of tracked as gaps.
+type catchUpSubscription struct {
+	eventStore      ReadOnlyEventStore
+	notifier        SubscriptionNotifier
+	streamName      StreamName
+	metadataMatcher metadata.Matcher
+	handler         SubscriptionHandler
+	checkpoint      SubscriptionCheckpoint
+	logger          Logger
+
+	position int64
+	gaps     map[int64]time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+	err      error
+}
+
+// StartCatchUpSubscription starts a CatchUpSubscription that loads the messages from the event store every time the
+// notifier calls notify. This allows a event store to implement the CatchUpSubscriber interface.
+func StartCatchUpSubscription(
+	ctx context.Context,
+	eventStore ReadOnlyEventStore,
+	notifier SubscriptionNotifier,
+	streamName StreamName,
+	fromNumber int64,
+	metadataMatcher metadata.Matcher,
+	handler SubscriptionHandler,
+	checkpoint SubscriptionCheckpoint,
+	logger Logger,
+) (CatchUpSubscription, error) {
+	switch {
+	case eventStore == nil:
+		return nil, InvalidArgumentError("eventStore")
+	case notifier == nil:
+		return nil, InvalidArgumentError("notifier")
+	case streamName == "":
+		return nil, InvalidArgumentError("streamName")
+	case fromNumber < 1:
+		return nil, InvalidArgumentError("fromNumber")
+	case handler == nil:
+		return nil, InvalidArgumentError("handler")
+	}
+
+	if metadataMatcher == nil {
+		metadataMatcher = metadata.NewMatcher()
+	}
+	if logger == nil {
+		logger = NopLogger
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &catchUpSubscription{
+		eventStore:      eventStore,
+		notifier:        notifier,
+		streamName:      streamName,
+		metadataMatcher: metadataMatcher,
+		handler:         handler,
+		checkpoint:      checkpoint,
+		logger:          logger,
+		position:        fromNumber - 1,
+		gaps:            map[int64]time.Time{},
+		cancel:          cancel,
+		done:            make(chan struct{}),
+	}
+
+	go s.run(ctx)
+
+	return s, nil
+}
+
+// Done returns a channel that is closed when the subscription stopped
+func (s *catchUpSubscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error that stopped the subscription
+func (s *catchUpSubscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close stops the subscription and waits for it to stop
+func (s *catchUpSubscription) Close() error {
+	s.cancel()
+	<-s.done
+
+	return s.err
+}
+
+// Position returns the number of the last message that was handled
+func (s *catchUpSubscription) Position() int64 {
+	return atomic.LoadInt64(&s.position)
+}
+
+func (s *catchUpSubscription) run(ctx context.Context) {
+	defer close(s.done)
+
+	signal := make(chan struct{}, 1)
+	notifierDone := make(chan error, 1)
+	go func() {
+		notifierDone <- s.notifier(ctx, func() {
+			select {
+			case signal <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			<-notifierDone
+			return
+		case err := <-notifierDone:
+			s.cancel()
+			s.err = err
+			return
+		case <-signal:
+		}
+
+		if err := s.catchUp(ctx); err != nil {
+			s.cancel()
+			<-notifierDone
+
+			// A closed subscription is not an error
+			if ctx.Err() == nil || err != context.Canceled {
+				s.err = err
+			}
+			return
+		}
+	}
+}
+
+// catchUp handles the messages that were appended to the stream since the last handled message
+func (s *catchUpSubscription) catchUp(ctx context.Context) error {
+	resolvedGaps, err := s.handleGaps(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		handled, err := s.handleBatch(ctx)
+		if err != nil {
+			return err
+		}
+
+		if (handled > 0 || resolvedGaps > 0) && s.checkpoint != nil {
+			if err := s.checkpoint(ctx, s.checkpointPosition()); err != nil {
+				return err
+			}
+		}
+		resolvedGaps = 0
+
+		if handled < subscriptionBatchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// handleBatch handles the next batch of messages after the last handled message
+func (s *catchUpSubscription) handleBatch(ctx context.Context) (int, error) {
+	return s.load(ctx, s.Position()+1, func(message Message, messageNumber int64, matched bool) error {
+		if matched {
+			if err := s.handler(ctx, message, messageNumber); err != nil {
+				return err
+			}
+		}
+
+		s.trackGaps(messageNumber)
+		atomic.StoreInt64(&s.position, messageNumber)
+
+		return nil
+	})
+}
+
+// handleGaps handles the messages that previously were missing and expires old gaps
+func (s *catchUpSubscription) handleGaps(ctx context.Context) (int, error) {
+	var fromNumber int64
+	expireBefore := time.Now().Add(-subscriptionGapTimeout)
+	for no, missingSince := range s.gaps {
+		if missingSince.Before(expireBefore) {
+			delete(s.gaps, no)
+			continue
+		}
+
+		if fromNumber == 0 || no < fromNumber {
+			fromNumber = no
+		}
+	}
+
+	position := s.Position()
+	var resolved int
+	for len(s.gaps) > 0 {
+		loaded, err := s.load(ctx, fromNumber, func(message Message, messageNumber int64, matched bool) error {
+			fromNumber = messageNumber + 1
+			if _, missing := s.gaps[messageNumber]; !missing {
+				return nil
+			}
+
+			if matched {
+				if err := s.handler(ctx, message, messageNumber); err != nil {
+					return err
+				}
+			}
+
+			delete(s.gaps, messageNumber)
+			resolved++
+
+			return nil
+		})
+		if err != nil || loaded < subscriptionBatchSize || fromNumber > position {
+			return resolved, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// load loads a batch of message numbers starting at fromNumber and calls handle for every number in order.
+// When the message matches the metadata matcher it is passed to handle, otherwise the message is nil and matched false.
+// The number of loaded message numbers is returned.
+func (s *catchUpSubscription) load(
+	ctx context.Context,
+	fromNumber int64,
+	handle func(message Message, messageNumber int64, matched bool) error,
+) (int, error) {
+	var numbers []int64
+	loaded, err := s.loadStream(ctx, fromNumber, metadata.NewMatcher(), func(_ Message, messageNumber int64) error {
+		numbers = append(numbers, messageNumber)
+		return nil
+	})
+	if err != nil || loaded == 0 {
+		return loaded, err
+	}
+
+	// Messages after the last loaded number are left for the next batch
+	last := numbers[len(numbers)-1]
+	_, err = s.loadStream(ctx, fromNumber, s.metadataMatcher, func(message Message, messageNumber int64) error {
+		if messageNumber > last {
+			return nil
+		}
+
+		for len(numbers) > 0 && numbers[0] <= messageNumber {
+			skipped := numbers[0]
+			numbers = numbers[1:]
+			if skipped == messageNumber {
+				continue
+			}
+
+			if err := handle(nil, skipped, false); err != nil {
+				return err
+			}
+		}
+
+		return handle(message, messageNumber, true)
+	})
+	if err != nil {
+		return loaded, err
+	}
+
+	for _, messageNumber := range numbers {
+		if err := handle(nil, messageNumber, false); err != nil {
+			return loaded, err
+		}
+	}
+
+	return loaded, nil
+}
+
+// loadStream loads a batch of messages matching the metadataMatcher starting at the message with number fromNumber and
+// calls handle for every message. The number of loaded messages is returned.
+func (s *catchUpSubscription) loadStream(
+	ctx context.Context,
+	fromNumber int64,
+	metadataMatcher metadata.Matcher,
+	handle func(Message, int64) error,
+) (int, error) {
+	count := uint(subscriptionBatchSize)
+	stream, err := s.eventStore.Load(ctx, s.streamName, fromNumber, &count, metadataMatcher)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := stream.Close(); err != nil {
+			s.logger.Warn("failed to close the subscription event stream", func(e LoggerEntry) {
+				e.Error(err)
+			})
+		}
+	}()
+
+	var loaded int
+	for stream.Next() {
+		message, messageNumber, err := stream.Message()
+		if err != nil {
+			return loaded, err
+		}
+
+		loaded++
+		if err := handle(message, messageNumber); err != nil {
+			return loaded, err
+		}
+	}
+
+	return loaded, stream.Err()
+}
+
+// trackGaps registers the message numbers between the current position and the provided number as missing
+func (s *catchUpSubscription) trackGaps(messageNumber int64) {
+	now := time.Now()
+	for missing := s.Position() + 1; missing < messageNumber && len(s.gaps) < subscriptionMaxTrackedGaps; missing++ {
+		s.gaps[missing] = now
+	}
+}
+
+// checkpointPosition returns the number up to which all messages were handled
+func (s *catchUpSubscription) checkpointPosition() int64 {
+	position := s.Position()
+	for no := range s.gaps {
+		if no <= position {
+			position = no - 1
+		}
+	}
+
+	return position
+}
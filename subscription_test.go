@@ -0,0 +1,343 @@
+// +build unit
+
+package goengine_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hellofresh/goengine"
+	"github.com/hellofresh/goengine/driver/inmemory"
+	"github.com/hellofresh/goengine/metadata"
+	"github.com/hellofresh/goengine/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartCatchUpSubscription(t *testing.T) {
+	t.Run("Invalid arguments", func(t *testing.T) {
+		store := inmemory.NewEventStore(nil)
+		notifier := func(context.Context, func()) error { return nil }
+		handler := func(context.Context, goengine.Message, int64) error { return nil }
+
+		testCases := []struct {
+			title         string
+			eventStore    goengine.ReadOnlyEventStore
+			notifier      goengine.SubscriptionNotifier
+			streamName    goengine.StreamName
+			fromNumber    int64
+			handler       goengine.SubscriptionHandler
+			expectedError string
+		}{
+			{"Invalid event store", nil, notifier, "event_stream", 1, handler, "eventStore"},
+			{"Invalid notifier", store, nil, "event_stream", 1, handler, "notifier"},
+			{"Invalid stream name", store, notifier, "", 1, handler, "streamName"},
+			{"Invalid from number", store, notifier, "event_stream", 0, handler, "fromNumber"},
+			{"Invalid handler", store, notifier, "event_stream", 1, nil, "handler"},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.title, func(t *testing.T) {
+				subscription, err := goengine.StartCatchUpSubscription(
+					context.Background(),
+					testCase.eventStore,
+					testCase.notifier,
+					testCase.streamName,
+					testCase.fromNumber,
+					nil,
+					testCase.handler,
+					nil,
+					nil,
+				)
+
+				assert.Nil(t, subscription)
+				assert.Equal(t, goengine.InvalidArgumentError(testCase.expectedError), err)
+			})
+		}
+	})
+
+	t.Run("Catch up and handle notified messages", func(t *testing.T) {
+		ctx := context.Background()
+		store := createSubscriptionEventStore(t, 3)
+
+		notifications := make(chan struct{})
+		notifier := func(ctx context.Context, notify func()) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-notifications:
+					notify()
+				}
+			}
+		}
+
+		handled := make(chan int64, 10)
+		checkpoints := make(chan int64, 10)
+		subscription, err := goengine.StartCatchUpSubscription(
+			ctx,
+			store,
+			notifier,
+			"event_stream",
+			2,
+			nil,
+			func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+				handled <- messageNumber
+				return nil
+			},
+			func(ctx context.Context, messageNumber int64) error {
+				checkpoints <- messageNumber
+				return nil
+			},
+			nil,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), subscription.Position())
+
+		notifications <- struct{}{}
+		assert.Equal(t, int64(2), <-handled)
+		assert.Equal(t, int64(3), <-handled)
+		assert.Equal(t, int64(3), <-checkpoints)
+
+		appendSubscriptionMessages(t, store, 1)
+		notifications <- struct{}{}
+		assert.Equal(t, int64(4), <-handled)
+		assert.Equal(t, int64(4), <-checkpoints)
+		assert.Equal(t, int64(4), subscription.Position())
+
+		assert.NoError(t, subscription.Close())
+		assert.NoError(t, subscription.Err())
+	})
+
+	t.Run("Handle messages that become visible after a later message", func(t *testing.T) {
+		store := &hiddenMessagesEventStore{
+			EventStore: createSubscriptionEventStore(t, 4),
+			hidden:     map[int64]bool{2: true},
+		}
+
+		notifications := make(chan struct{})
+		handled := make(chan int64, 10)
+		checkpoints := make(chan int64, 10)
+		subscription, err := goengine.StartCatchUpSubscription(
+			context.Background(),
+			store,
+			func(ctx context.Context, notify func()) error {
+				for {
+					select {
+					case <-ctx.Done():
+						return nil
+					case <-notifications:
+						notify()
+					}
+				}
+			},
+			"event_stream",
+			1,
+			nil,
+			func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+				handled <- messageNumber
+				return nil
+			},
+			func(ctx context.Context, messageNumber int64) error {
+				checkpoints <- messageNumber
+				return nil
+			},
+			nil,
+		)
+		require.NoError(t, err)
+
+		notifications <- struct{}{}
+		assert.Equal(t, int64(1), <-handled)
+		assert.Equal(t, int64(3), <-handled)
+		assert.Equal(t, int64(4), <-handled)
+		assert.Equal(t, int64(1), <-checkpoints, "expected the checkpoint to stay before the missing message")
+
+		store.reveal(2)
+		notifications <- struct{}{}
+		assert.Equal(t, int64(2), <-handled)
+		assert.Equal(t, int64(4), <-checkpoints)
+		assert.Equal(t, int64(4), subscription.Position())
+
+		assert.NoError(t, subscription.Close())
+	})
+
+	t.Run("Skip messages that do not match the metadata matcher", func(t *testing.T) {
+		store := createSubscriptionEventStore(t, 0)
+		messages := make([]goengine.Message, 4)
+		for i, kind := range []string{"match", "other", "other", "match"} {
+			messages[i] = mocks.NewDummyMessage(
+				goengine.GenerateUUID(),
+				i,
+				metadata.WithValue(metadata.New(), "kind", kind),
+				time.Now(),
+			)
+		}
+		require.NoError(t, store.AppendTo(context.Background(), "event_stream", messages))
+
+		handled := make(chan int64, 10)
+		checkpoints := make(chan int64, 10)
+		subscription, err := goengine.StartCatchUpSubscription(
+			context.Background(),
+			store,
+			func(ctx context.Context, notify func()) error {
+				notify()
+				<-ctx.Done()
+				return nil
+			},
+			"event_stream",
+			1,
+			metadata.WithConstraint(metadata.NewMatcher(), "kind", metadata.Equals, "match"),
+			func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+				handled <- messageNumber
+				return nil
+			},
+			func(ctx context.Context, messageNumber int64) error {
+				checkpoints <- messageNumber
+				return nil
+			},
+			nil,
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), <-handled)
+		assert.Equal(t, int64(4), <-handled)
+		assert.Equal(t, int64(4), <-checkpoints, "expected the skipped messages not to be tracked as gaps")
+		assert.Equal(t, int64(4), subscription.Position())
+
+		assert.NoError(t, subscription.Close())
+	})
+
+	t.Run("Stop when the handler fails", func(t *testing.T) {
+		store := createSubscriptionEventStore(t, 2)
+		expectedErr := errors.New("handler failed")
+
+		subscription, err := goengine.StartCatchUpSubscription(
+			context.Background(),
+			store,
+			func(ctx context.Context, notify func()) error {
+				notify()
+				<-ctx.Done()
+				return nil
+			},
+			"event_stream",
+			1,
+			nil,
+			func(ctx context.Context, message goengine.Message, messageNumber int64) error {
+				if messageNumber == 2 {
+					return expectedErr
+				}
+				return nil
+			},
+			func(ctx context.Context, messageNumber int64) error {
+				t.Error("checkpoint should not be called")
+				return nil
+			},
+			nil,
+		)
+		require.NoError(t, err)
+
+		select {
+		case <-subscription.Done():
+		case <-time.After(time.Second):
+			t.Fatal("subscription did not stop")
+		}
+
+		assert.Equal(t, expectedErr, subscription.Err())
+		assert.Equal(t, int64(1), subscription.Position())
+		assert.Equal(t, expectedErr, subscription.Close())
+	})
+
+	t.Run("Stop when the notifier fails", func(t *testing.T) {
+		store := createSubscriptionEventStore(t, 0)
+		expectedErr := errors.New("listener failed")
+
+		subscription, err := goengine.StartCatchUpSubscription(
+			context.Background(),
+			store,
+			func(context.Context, func()) error {
+				return expectedErr
+			},
+			"event_stream",
+			1,
+			nil,
+			func(context.Context, goengine.Message, int64) error { return nil },
+			nil,
+			nil,
+		)
+		require.NoError(t, err)
+
+		<-subscription.Done()
+		assert.Equal(t, expectedErr, subscription.Err())
+	})
+}
+
+// hiddenMessagesEventStore is a event store of which the hidden messages are not yet visible
+type hiddenMessagesEventStore struct {
+	*inmemory.EventStore
+
+	mux    sync.Mutex
+	hidden map[int64]bool
+}
+
+func (s *hiddenMessagesEventStore) Load(
+	ctx context.Context,
+	streamName goengine.StreamName,
+	fromNumber int64,
+	count *uint,
+	metadataMatcher metadata.Matcher,
+) (goengine.EventStream, error) {
+	stream, err := s.EventStore.Load(ctx, streamName, fromNumber, nil, metadataMatcher)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var (
+		messages []goengine.Message
+		numbers  []int64
+	)
+	for stream.Next() && (count == nil || uint(len(messages)) < *count) {
+		message, messageNumber, err := stream.Message()
+		if err != nil {
+			return nil, err
+		}
+
+		if !s.hidden[messageNumber] {
+			messages = append(messages, message)
+			numbers = append(numbers, messageNumber)
+		}
+	}
+
+	return inmemory.NewEventStream(messages, numbers)
+}
+
+func (s *hiddenMessagesEventStore) reveal(messageNumber int64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.hidden, messageNumber)
+}
+
+func createSubscriptionEventStore(t *testing.T, messages int) *inmemory.EventStore {
+	store := inmemory.NewEventStore(nil)
+	require.NoError(t, store.Create(context.Background(), "event_stream"))
+
+	appendSubscriptionMessages(t, store, messages)
+
+	return store
+}
+
+func appendSubscriptionMessages(t *testing.T, store *inmemory.EventStore, count int) {
+	messages := make([]goengine.Message, count)
+	for i := range messages {
+		messages[i] = mocks.NewDummyMessage(goengine.GenerateUUID(), i, metadata.New(), time.Now())
+	}
+
+	require.NoError(t, store.AppendTo(context.Background(), "event_stream", messages))
+}
@@ -55,6 +55,13 @@ func TestAggregateProjectorSuite(t *testing.T) {
 			},
 		})
 	})
+	t.Run("RowLock", func(t *testing.T) {
+		suite.Run(t, &aggregateProjectorTestSuite{
+			createProjectionStorage: func(eventStoreTable, projectionTable string, serialization driverSQL.ProjectionStateSerialization, logger goengine.Logger) (storage driverSQL.AggregateProjectorStorage, e error) {
+				return postgres.NewRowLockAggregateProjectionStorage(eventStoreTable, projectionTable, serialization, logger)
+			},
+		})
+	})
 }
 
 func (s *aggregateProjectorTestSuite) SetupTest() {
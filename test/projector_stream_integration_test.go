@@ -51,6 +51,13 @@ func TestStreamProjectorSuite(t *testing.T) {
 			},
 		})
 	})
+	t.Run("RowLock", func(t *testing.T) {
+		suite.Run(t, &streamProjectorTestSuite{
+			createProjectionStorage: func(eventStoreTable, projectionTable string, serialization driverSQL.ProjectionStateSerialization, logger goengine.Logger) (storage driverSQL.StreamProjectorStorage, e error) {
+				return postgres.NewRowLockStreamProjectionStorage(eventStoreTable, projectionTable, serialization, logger)
+			},
+		})
+	})
 }
 
 func (s *streamProjectorTestSuite) SetupTest() {